@@ -7,4 +7,5 @@ const (
 	PrepareQuorumMultiplier  = 2.0/3.0
 	NodeCount                = 100 // 默认节点数
 	SimRounds                = 20  // 默认轮数
-)
\ No newline at end of file
+	RoundTimeoutMs           = 2000 // 单轮三阶段消息交换的超时（仿真毫秒）
+)
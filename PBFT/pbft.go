@@ -1,11 +1,13 @@
 package pbft
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"math/rand"
 	"time"
 	// ======================= 【高亮-2026-03-08】引入通用节点池规格 =======================
 	"PBFT1/node"
+	"PBFT1/topology"
 )
 
 type Validator struct {
@@ -23,9 +25,74 @@ type PBFTResult struct {
 	FailedReason string
 	Price        float64
 	LeaderNode   string
+	LatencyMs    float64 // 【高亮-2026-10-16】新增：从 PRE-PREPARE 到网络静默/超时的仿真时延（毫秒）
+}
+
+// ======================= 【高亮-2026-10-16】新增：单轮内的 PBFT 副本状态（由网络消息驱动） =======================
+// replica 只根据收到的 PRE-PREPARE / PREPARE / COMMIT 消息推进状态，不再由本地掷硬币决定投票结果。
+type replica struct {
+	spec node.NodeSpec
+
+	digest      string                  // 接受的 PRE-PREPARE 摘要
+	prepares    map[string]map[int]bool // digest -> 已收到 PREPARE 的发送者
+	commits     map[string]map[int]bool // digest -> 已收到 COMMIT 的发送者
+	sentPrepare bool
+	sentCommit  bool
+	withheld    bool // 恶意副本已 prepared 但扣留 COMMIT
+	committed   bool
+}
+
+func newReplica(sp node.NodeSpec) *replica {
+	return &replica{
+		spec:     sp,
+		prepares: make(map[string]map[int]bool),
+		commits:  make(map[string]map[int]bool),
+	}
+}
+
+func addVote(votes map[string]map[int]bool, digest string, from int) int {
+	set, ok := votes[digest]
+	if !ok {
+		set = make(map[int]bool)
+		votes[digest] = set
+	}
+	set[from] = true
+	return len(set)
+}
+
+// defaultMalicious 未在节点池中配置行为时恶意节点的默认策略（与原硬编码概率一致）：
+// 恶意 leader 30% 不发 PRE-PREPARE，恶意副本 60% 不发 PREPARE、40% 扣留 COMMIT
+var defaultMalicious node.Behavior = node.ProbabilisticBehavior{
+	Silent: map[node.Phase]float64{
+		node.PhasePrePrepare: 0.3,
+		node.PhasePrepare:    0.6,
+		node.PhaseCommit:     0.4,
+	},
+}
+
+// sendPhase 按节点行为策略向每个对端发送一条协议消息，返回实际发出的条数：
+// 沉默/反对/伪造签名的消息不发送（接收方验签失败等同于未收到），equivocation 改写摘要，Delay 推迟发送
+func sendPhase(nw *node.Network, b node.Behavior, step node.Step, msg node.Message, peers []int) int {
+	sent := 0
+	for _, p := range peers {
+		step.Peer = p
+		act := b.Decide(step)
+		m := msg
+		m.To = p
+		switch act.Kind {
+		case node.ActSilent, node.ActReject, node.ActBadSign:
+			continue
+		case node.ActEquivocate:
+			m.Digest = act.Digest
+		}
+		nw.SendAfter(m, act.Delay)
+		sent++
+	}
+	return sent
 }
 
 // ======================= 【高亮-2026-03-11】修改：升级为完整三阶段 PBFT 并对齐阈值 =======================
+// ======================= 【高亮-2026-10-16】修改：三阶段投票改为经 node.Network 真实收发消息 =======================
 func RunPBFTWithRoundAndSpecs(round int, txId string, amount int, specs []node.NodeSpec) PBFTResult {
 	n := len(specs)
 	if n <= 0 {
@@ -38,56 +105,113 @@ func RunPBFTWithRoundAndSpecs(round int, txId string, amount int, specs []node.N
 
 	// Leader 轮转逻辑与 apbft 对齐
 	leaderIdx := round % n
-	leader := fmt.Sprintf("node-%d", specs[leaderIdx].ID)
+	leaderID := specs[leaderIdx].ID
+	leader := fmt.Sprintf("node-%d", leaderID)
 
 	seed := int64(20260308 + round)
 	rng := rand.New(rand.NewSource(seed))
 
+	nw := node.NewNetwork(node.DefaultNetworkConfig(), seed)
+	nw.SetDistanceModel(topology.ForPool(specs)) // 【高亮-2026-10-16】链路时延随电网拓扑距离增加
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", txId, round, amount))))
+
+	replicas := make([]*replica, n)
+	peers := make([]int, 0, n)
+	for i, sp := range specs {
+		replicas[i] = newReplica(sp)
+		if sp.Active {
+			peers = append(peers, sp.ID)
+		}
+	}
+
+	// 【高亮-2026-10-16】每个节点的拜占庭行为由可插拔策略决定（未配置时沿用原先的恶意概率）
+	behaviors := node.BuildBehaviors(specs, defaultMalicious)
+	timeout := time.Duration(RoundTimeoutMs) * time.Millisecond
+	stepFor := func(phase node.Phase, self int, d string) node.Step {
+		return node.Step{Phase: phase, Round: round, Self: self, Leader: leaderID, Peer: -1, Digest: d, Timeout: timeout, Prominent: -1}
+	}
+
+	for _, r := range replicas {
+		if !r.spec.Active {
+			continue // 离线节点不注册，发往它的消息被网络丢弃
+		}
+		r := r
+		b := behaviors[r.spec.ID]
+		nw.Register(r.spec.ID, func(msg node.Message) {
+			switch msg.Type {
+			case node.MsgPrePrepare:
+				if msg.From != leaderID || r.digest != "" {
+					return
+				}
+				r.digest = msg.Digest
+				msg := node.Message{Type: node.MsgPrepare, From: r.spec.ID, Round: round, Seq: 1, Digest: r.digest}
+				r.sentPrepare = sendPhase(nw, b, stepFor(node.PhasePrepare, r.spec.ID, r.digest), msg, peers) > 0
+			case node.MsgPrepare:
+				cnt := addVote(r.prepares, msg.Digest, msg.From)
+				if r.digest == "" || msg.Digest != r.digest || r.sentCommit || !r.sentPrepare {
+					return
+				}
+				if cnt >= quorum {
+					r.sentCommit = true
+					msg := node.Message{Type: node.MsgCommit, From: r.spec.ID, Round: round, Seq: 1, Digest: r.digest}
+					// prepared 后仍可能拒绝发送 COMMIT
+					if sendPhase(nw, b, stepFor(node.PhaseCommit, r.spec.ID, r.digest), msg, peers) == 0 {
+						r.withheld = true
+					}
+				}
+			case node.MsgCommit:
+				cnt := addVote(r.commits, msg.Digest, msg.From)
+				if r.digest != "" && msg.Digest == r.digest && !r.withheld && cnt >= quorum {
+					r.committed = true
+				}
+			}
+		})
+	}
+
 	// --- 阶段 1: Pre-Prepare ---
-	if specs[leaderIdx].IsMalicious && rng.Float64() < 0.3 {
+	if !specs[leaderIdx].Active {
+		return failResult(txId, round, leader, "Pre-Prepare failed: leader offline")
+	}
+	prePrepare := node.Message{Type: node.MsgPrePrepare, From: leaderID, Round: round, Seq: 1, Digest: digest}
+	if sendPhase(nw, behaviors[leaderID], stepFor(node.PhasePrePrepare, leaderID, digest), prePrepare, peers) == 0 {
 		return failResult(txId, round, leader, "Pre-Prepare failed: Malicious leader")
 	}
 
-	// --- 阶段 2: Prepare (收集投票) ---
+	// --- 阶段 2/3: Prepare + Commit（消息驱动，直到网络静默或超时） ---
+	nw.RunFor(timeout)
+	latencyMs := node.DurationMs(nw.Now())
+
 	prepareVotes := 0
+	commitVotes := 0
 	validators := make([]Validator, 0, n)
-
-	for i := 0; i < n; i++ {
-		vote := "prepare"
-		if specs[i].IsMalicious {
-			if rng.Float64() < 0.6 { vote = "reject" }
-		} else {
-			if rng.Float64() < 0.05 { vote = "reject" }
+	commitNodeIDs := []string{} // 【修复点：明确定义】
+	for _, r := range replicas {
+		vote := "reject"
+		switch {
+		case r.committed:
+			vote = "commit"
+			commitVotes++
+			commitNodeIDs = append(commitNodeIDs, fmt.Sprintf("node-%d", r.spec.ID))
+		case r.sentPrepare:
+			vote = "prepare"
 		}
-
-		if vote == "prepare" {
+		if r.sentPrepare {
 			prepareVotes++
 		}
 		validators = append(validators, Validator{
-			ID:   fmt.Sprintf("node-%d", specs[i].ID),
+			ID:   fmt.Sprintf("node-%d", r.spec.ID),
 			Vote: vote,
 		})
 	}
 
 	if prepareVotes < quorum {
-		return failResult(txId, round, leader, fmt.Sprintf("Prepare phase failed: %d/%d", prepareVotes, quorum))
+		res := failResult(txId, round, leader, fmt.Sprintf("Prepare phase failed: %d/%d", prepareVotes, quorum))
+		res.LatencyMs = latencyMs
+		return res
 	}
 
-	// --- 阶段 3: Commit (最终确认) ---
-	commitVotes := 0
 	// 撮合价格机理对齐：500 + 随机扰动
-    price := 500.0 + rng.Float64()*20.0
-	commitNodeIDs := []string{} // 【修复点：明确定义】
-	for i := 0; i < n; i++ {
-		// 只有 Prepare 成功的节点进入 Commit
-		if validators[i].Vote == "prepare" {
-			if specs[i].IsMalicious && rng.Float64() < 0.4 {
-				continue
-			}
-			commitVotes++
-			validators[i].Vote = "commit"
-		}
-	}
+	price := 500.0 + rng.Float64()*20.0
 
 	status := "已确认"
 	reason := ""
@@ -110,6 +234,7 @@ func RunPBFTWithRoundAndSpecs(round int, txId string, amount int, specs []node.N
 		FailedReason: reason,
 		Price:        price,
 		LeaderNode:   leader,
+		LatencyMs:    latencyMs,
 	}
 }
 
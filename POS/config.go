@@ -5,4 +5,5 @@ const (
 	StakeMax     = 100.0      // 节点最大权益
 	ValidatorNum = 100        // 默认节点数
 	Rounds       = 20         // 仿真轮数
+	VoteTimeoutMs = 1000      // 委员会投票收集超时（仿真毫秒）
 )
\ No newline at end of file
@@ -7,6 +7,7 @@ import (
 	"time"
 	// ======================= 【高亮-2026-03-09】新增：接入共用节点池 NodeSpec =======================
     "PBFT1/node"
+    "PBFT1/topology"
 )
 
 // ======================= 2026-03-06 高亮新增：POS结果结构（含委员会与投票） BEGIN =======================
@@ -27,6 +28,7 @@ type POSResult struct {
 	FailedReason string
 	Price        float64
 	SellNode     string // 为了兼容你之前字段，这里让 SellNode = Leader
+	LatencyMs    float64 // 【高亮-2026-10-16】新增：提案到投票收齐/超时的仿真时延（毫秒）
 }
 
 var posHeight = 1
@@ -57,6 +59,9 @@ type SimConfig struct {
 
 	// stake 边界
 	MinActiveStake float64 // stake 低于此值视为失效
+
+	// 【高亮-2026-10-16】新增：多轮仿真使用的共用节点池配置（节点数/恶意率/权益分布/放置策略）
+	Pool node.PoolConfig
 }
 
 // 默认配置（你可以按需调整）
@@ -77,6 +82,7 @@ func DefaultSimConfig() SimConfig {
 		MaliciousPenalty: 1.0,
 		DoubleSignSlash:  3.0,
 		MinActiveStake:   1.0,
+		Pool:             node.DefaultPoolConfig(),
 	}
 }
 
@@ -130,6 +136,35 @@ func SyncNodesFromSpecs(nodes []*SimNode, specs []node.NodeSpec, stakeOverride b
     }
 }
 
+// ======================= 【高亮-2026-10-16】新增：节点流失下的验证者集合变更 =======================
+// UpdateValidatorSet 让跨轮复用的验证者集合跟上节点池（见 node.Churn）：
+// specs 中新出现的 ID 以其初始 Stake 被接纳为验证者，不再出现的节点被移出（其 Stake 随之退出）；
+// 留下的验证者保持累计的 Stake，宕机/恢复由 SyncNodesFromSpecs 同步 Active。
+// 返回新的集合（按 specs 顺序）以及本次接纳、移出的节点 ID。
+func UpdateValidatorSet(nodes []*SimNode, specs []node.NodeSpec) (out []*SimNode, admitted, removed []int) {
+	byID := make(map[int]*SimNode, len(nodes))
+	for _, n := range nodes {
+		byID[n.ID] = n
+	}
+	out = make([]*SimNode, 0, len(specs))
+	seen := make(map[int]bool, len(specs))
+	for _, sp := range specs {
+		seen[sp.ID] = true
+		if n, ok := byID[sp.ID]; ok {
+			out = append(out, n)
+			continue
+		}
+		out = append(out, &SimNode{ID: sp.ID, Stake: sp.Stake, Active: sp.Active, Malicious: sp.IsMalicious})
+		admitted = append(admitted, sp.ID)
+	}
+	for _, n := range nodes {
+		if !seen[n.ID] {
+			removed = append(removed, n.ID)
+		}
+	}
+	return out, admitted, removed
+}
+
 // ======================= 【高亮-2026-03-09】新增：可注入 RNG 的加权抽取（stake 权重）BEGIN =======================
 func weightedPickOneWithRNG(nodes []*SimNode, rng *rand.Rand) *SimNode {
 	total := 0.0
@@ -185,6 +220,26 @@ func applyStakeDelta(n *SimNode, delta float64, cfg SimConfig) {
 	}
 }
 
+// ======================= 【高亮-2026-10-16】新增：未配置行为时恶意节点的默认策略 =======================
+// 恶意节点结成"马太"联盟：当 leader 是全网权益最高的诚实节点（Step.Prominent）时集体投反对票，
+// 迫使其遭受 LeaderPenalty；否则伪装成好人（仅 2% 失误投反对），自己当 leader 时 5% 罢工。
+func defaultMalicious(specs []node.NodeSpec) node.Behavior {
+	members := map[int]bool{}
+	for _, sp := range specs {
+		if sp.IsMalicious {
+			members[sp.ID] = true
+		}
+	}
+	return node.CoalitionBehavior{
+		Coalition: &node.Coalition{Name: "matthew", Target: node.CoalitionTargetProminent, Members: members},
+		Attack:    node.ActReject,
+		Otherwise: node.ProbabilisticBehavior{
+			Reject: map[node.Phase]float64{node.PhaseVote: 0.02},
+			Silent: map[node.Phase]float64{node.PhasePropose: 0.05},
+		},
+	}
+}
+
 // ======================= 【高亮-2026-03-09】新增：POS 单轮（共用 nodepool + 权重抽取 + 奖惩累计） BEGIN =======================
 // RunPOSWithRoundAndSpecs：
 // - round：用于固定随机源（可复现）
@@ -223,17 +278,6 @@ func RunPOSWithRoundAndSpecs(round int, txId string, amount int, nodes []*SimNod
 		}
 	}
 
-	// 恶意节点为了积累财富（马太效应），自己当主节点时会倾向于好好工作赚取 LeaderReward
-	// 所以大幅降低恶意 Leader 罢工的概率（从 0.3 降到 0.05）
-	if leaderNode.Malicious && rng.Float64() < 0.05 {
-		applyStakeDelta(leaderNode, -cfg.LeaderPenalty, cfg)
-		return POSResult{
-			TxId: txId, Status: "失败", Consensus: "pos", BlockHeight: round,
-			Timestamp: time.Now(), FailedReason: "Leader proposal failed (malicious)",
-			Leader: leaderNode.Name(), SellNode: leaderNode.Name(),
-		}
-	}
-
 	// 3. 选取委员会成员
 	committeeNodes := weightedPickKWithRNG(nodes, committeeSize, leaderNode.ID, rng)
 	committeeNames := make([]string, 0, len(committeeNodes))
@@ -243,42 +287,109 @@ func RunPOSWithRoundAndSpecs(round int, txId string, amount int, nodes []*SimNod
 
 	// ======================= 【高亮-2026-03-21 修改：增加马太节点判定标志】 =======================
 	isMatthewLeader := (highestStakeNode != nil && leaderNode.ID == highestStakeNode.ID)
+	prominent := -1
+	if highestStakeNode != nil {
+		prominent = highestStakeNode.ID
+	}
+
+	// 【高亮-2026-10-16】各节点的拜占庭行为由可插拔策略决定；未配置时恶意节点结成"马太"联盟（见 defaultMalicious）
+	behaviors := node.BuildBehaviors(specs, defaultMalicious(specs))
+	stepFor := func(phase node.Phase, self, peer int) node.Step {
+		return node.Step{Phase: phase, Round: round, Self: self, Leader: leaderNode.ID, Peer: peer, Digest: txId, Timeout: time.Duration(VoteTimeoutMs) * time.Millisecond, Prominent: prominent}
+	}
 
 	// 4. 执行投票
+	// ======================= 【高亮-2026-10-16】修改：提案与投票经 node.Network 真实收发 =======================
+	// 诚实节点的"离线/丢包"不再掷硬币，而是由网络丢包决定：收不到提案就无法投票，投票丢失同样不计数。
+	nw := node.NewNetwork(node.DefaultNetworkConfig(), seed)
+	nw.SetDistanceModel(topology.ForPool(specs)) // 【高亮-2026-10-16】链路时延随电网拓扑距离增加
+	memberIDs := make([]int, 0, len(committeeNodes))
 	for _, v := range committeeNodes {
 		committeeNames = append(committeeNames, v.Name())
-		voteStr := "commit"
+		memberIDs = append(memberIDs, v.ID)
+	}
 
-		// ======================= 【高亮-2026-03-21 修改：马太效应针对性攻击（威力增强版）】 =======================
-		if v.Malicious {
-			// 策略：如果当前的 Leader 是网络里的“首富”，所有入选委员会的恶意节点集体砸盘，100% 投反对票！
-			// 目的：让该轮共识失败，迫使“首富”节点遭受巨大的 LeaderPenalty 扣款。
-			if isMatthewLeader {
-				voteStr = "reject"
-				applyStakeDelta(v, -cfg.MaliciousPenalty, cfg) // 哪怕自己也被扣点钱，也要拉低巨头的权益
-			} else {
-				// 潜伏期：如果 Leader 是普通人或同伙，恶意节点伪装成好人投赞成票，安稳赚取 VoterReward
-				if rng.Float64() < 0.02 { // 仅维持 2% 的极低失误率，最大化保留实力
-					voteStr = "reject"
-					applyStakeDelta(v, -cfg.MaliciousPenalty, cfg)
-				}
-			}
-		} else {
-			offlineProb := 0.05
-			// 如果当前 Leader 是马太节点，恶意节点会在暗中发动 DDOS/日蚀攻击拦截网络
-			// 导致大量诚实节点也无法收到 Leader 的区块提案，被迫“离线”或投废票
-			if isMatthewLeader {
-				offlineProb = 0.45 // 使得 45% 的诚实节点受到网络攻击影响无法投票
+	// 如果当前 Leader 是马太节点，恶意节点会在暗中发动 DDOS/日蚀攻击拦截网络：
+	// Leader 到诚实委员的链路被大幅劣化，使约 45% 的诚实节点收不到区块提案
+	if isMatthewLeader {
+		attacked := node.DefaultNetworkConfig().Default
+		attacked.LossProb = 0.45
+		for _, v := range committeeNodes {
+			if !v.Malicious {
+				nw.SetLinkConfig(leaderNode.ID, v.ID, attacked)
 			}
+		}
+	}
 
-			// 诚实节点的离线/丢包/受攻击导致投票失败
-			if rng.Float64() < offlineProb {
+	received := make(map[int]string, len(committeeNodes)) // 委员 ID -> 送达 leader 的投票
+	nw.Register(leaderNode.ID, func(msg node.Message) {
+		if msg.Type != node.MsgPOSVote || msg.Digest != txId {
+			return
+		}
+		if _, dup := received[msg.From]; !dup {
+			received[msg.From] = msg.Payload.(string)
+		}
+	})
+	for _, v := range committeeNodes {
+		v := v
+		if !v.Active {
+			continue
+		}
+		nw.Register(v.ID, func(msg node.Message) {
+			if msg.Type != node.MsgPOSProposal {
+				return
+			}
+			voteStr := "commit"
+			act := behaviors[v.ID].Decide(stepFor(node.PhaseVote, v.ID, leaderNode.ID))
+			switch act.Kind {
+			case node.ActSilent:
+				return // 不投票，leader 处记为 offline
+			case node.ActReject:
 				voteStr = "reject"
+				applyStakeDelta(v, -cfg.MaliciousPenalty, cfg) // 哪怕自己也被扣点钱，也要拉低巨头的权益
+			case node.ActBadSign:
+				voteStr = "malicious"
+				applyStakeDelta(v, -cfg.MaliciousPenalty, cfg)
+			case node.ActEquivocate:
+				voteStr = "double-sign" // 同一提案同时投赞成与反对，被 leader 发现后罚没
+				applyStakeDelta(v, -cfg.DoubleSignSlash, cfg)
 			}
+			nw.SendAfter(node.Message{Type: node.MsgPOSVote, From: v.ID, To: leaderNode.ID, Round: round, Digest: msg.Digest, Payload: voteStr}, act.Delay)
+		})
+	}
+
+	// leader 按行为策略向每个委员发送提案：恶意 Leader 为了积累财富（马太效应）通常好好工作赚取 LeaderReward，偶尔罢工
+	proposed := 0
+	for _, id := range memberIDs {
+		act := behaviors[leaderNode.ID].Decide(stepFor(node.PhasePropose, leaderNode.ID, id))
+		m := node.Message{Type: node.MsgPOSProposal, From: leaderNode.ID, To: id, Round: round, Digest: txId}
+		switch act.Kind {
+		case node.ActSilent, node.ActReject, node.ActBadSign:
+			continue
+		case node.ActEquivocate:
+			m.Digest = act.Digest
 		}
+		nw.SendAfter(m, act.Delay)
+		proposed++
+	}
+	if proposed == 0 && len(memberIDs) > 0 {
+		applyStakeDelta(leaderNode, -cfg.LeaderPenalty, cfg)
+		return POSResult{
+			TxId: txId, Status: "失败", Consensus: "pos", BlockHeight: round,
+			Timestamp: time.Now(), FailedReason: "Leader proposal failed (malicious)",
+			Leader: leaderNode.Name(), Committee: committeeNames, SellNode: leaderNode.Name(),
+		}
+	}
+	nw.RunFor(time.Duration(VoteTimeoutMs) * time.Millisecond)
 
+	for _, v := range committeeNodes {
+		voteStr, ok := received[v.ID]
+		if !ok {
+			voteStr = "offline" // 提案或投票在网络中丢失 / 节点离线
+		}
 		if voteStr == "commit" {
 			commitCount++
+			voterIDs = append(voterIDs, v.Name())
 			applyStakeDelta(v, cfg.VoterReward, cfg)
 		}
 		votes = append(votes, Vote{ID: v.Name(), Vote: voteStr})
@@ -325,6 +436,7 @@ func RunPOSWithRoundAndSpecs(round int, txId string, amount int, nodes []*SimNod
 		FailedReason: reason,
 		Price:        price,
 		SellNode:     leaderNode.Name(),
+		LatencyMs:    node.DurationMs(nw.Now()),
 	}
 }
 
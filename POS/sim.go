@@ -16,7 +16,10 @@ type RoundSummary struct {
 // ======================= 【高亮-2026-03-11】修改：确保 POS 仿真完全闭环使用 NodePool 对齐 =======================
 func RunSimulator(totalRounds int, cfg SimConfig) ([]RoundSummary, []*SimNode) {
 	// 1. 获取初始规格（第1轮），用于初始化跨轮次复用的节点集合（以便累积 Stake 奖惩）
-	specs0 := node.NewPool(1, node.FixedNumNodes, node.FixedMaliciousRatio)
+	// 【高亮-2026-10-16】修改：节点池由 cfg.Pool 描述，不再写死节点数/恶意率
+	// 【高亮-2026-10-16】修改：节点池由流失过程逐轮给出（cfg.Pool.Churn 为空时与 NewPoolFromConfig 相同）
+	churn := node.NewChurn(cfg.Pool)
+	specs0 := churn.Pool(1)
 	nodes := NewNodesFromSpecs(specs0)
 
 	out := make([]RoundSummary, 0, totalRounds)
@@ -24,7 +27,12 @@ func RunSimulator(totalRounds int, cfg SimConfig) ([]RoundSummary, []*SimNode) {
 	for r := 1; r <= totalRounds; r++ {
 		// 2. 【高亮-2026-03-11】对齐点：每轮重新获取 specs。
 		// 这样可以确保在第 r 轮，POS 看到的恶意节点 ID 与 PBFT/APBFT/RAFT 完全一致。
-		specs := node.NewPool(r, node.FixedNumNodes, node.FixedMaliciousRatio)
+		specs := churn.Pool(r)
+		// 新加入的节点按初始 Stake 成为验证者，离开的节点退出
+		var admitted, removed []int
+		if nodes, admitted, removed = UpdateValidatorSet(nodes, specs); len(admitted)+len(removed) > 0 {
+			fmt.Printf("[POS] round %d validators admitted %v, removed %v\n", r, admitted, removed)
+		}
 
 		// 3. 执行单轮 POS 共识逻辑
 		// 注意：RunPOSWithRoundAndSpecs 内部会调用 SyncNodesFromSpecs 同步 specs 的恶意状态到 nodes 中
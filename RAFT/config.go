@@ -6,4 +6,5 @@ const (
 	SimRounds      = 20     // 仿真轮数
 	ElectionTimeout = 5     // 选主超时时间（单位可调）
 	MaxFailures     = 5     // 最大允许故障节点数
+	RPCTimeoutMs    = 500   // 一次 RequestVote/AppendEntries 广播等待响应的超时（仿真毫秒）
 )
\ No newline at end of file
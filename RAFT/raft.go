@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"PBFT1/node"
+	"PBFT1/topology"
 )
 
 // ======================= 【高亮-2026-03-09】RAFT：使用 nodepool.go 共用节点集 + “日志不落后���投票” + Leader 完整性 =======================
@@ -109,6 +111,17 @@ type Cluster struct {
 	// For deterministic simulation, we keep a rng.
 	rng *rand.Rand
 
+	// clock is the simulated time shared by election timers and the network,
+	// so election timeouts cost no wall-clock time.
+	clock *node.VirtualClock
+
+	// ======================= 【高亮-2026-10-16】RPC 经共用网络层真实收发 =======================
+	net   *node.Network
+	inbox []node.Message // 当前 RPC 广播收到的响应（仅在 Run 期间写入）
+
+	// behaviors holds the byzantine strategy of every node (honest nodes get node.HonestBehavior).
+	behaviors map[int]node.Behavior
+
 	// For observability
 	LeaderID *int
 }
@@ -118,37 +131,246 @@ type Cluster struct {
 func NewClusterFromPool(round int, specs []node.NodeSpec) *Cluster {
 	seed := int64(20260309 + round) // ======================= 【高亮-2026-03-09】round 固定随机性 =======================
 	rng := rand.New(rand.NewSource(seed))
+	clock := node.NewVirtualClock()
 
-	nodes := make(map[int]*NodeState, len(specs))
+	c := &Cluster{
+		Round: round,
+		Nodes: make(map[int]*NodeState, len(specs)),
+		rng:   rng,
+		clock: clock,
+		net:   node.NewNetworkWithClock(node.DefaultNetworkConfig(), seed, clock),
+	}
+	c.UpdateMembership(specs)
+	return c
+}
+
+// UpdateMembership applies a new view of the node pool to the cluster configuration
+// (see node.Churn): IDs missing from specs leave the cluster, new IDs join as followers
+// with an empty log, and members whose Spec.Active flips crash (stop receiving RPCs) or
+// recover (keeping their log and term). Crashed members still count towards the quorum.
+// It returns the IDs that joined and left, in ascending order.
+func (c *Cluster) UpdateMembership(specs []node.NodeSpec) (joined, left []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// handlers capture the behavior when registered, so rebuild behaviors first
+	c.behaviors = node.BuildBehaviors(specs, defaultMalicious)
+	want := make(map[int]bool, len(specs))
 	for _, sp := range specs {
-		id := sp.ID
-		n := &NodeState{
-			ID:          id,
-			Spec:        sp,
-			Role:        Follower,
-			CurrentTerm: DefaultTerm,
-			VotedFor:    nil,
-			Log:         make([]LogEntry, 0),
-			CommitIndex: 0,
-			LastApplied: 0,
-			NextIndex:   make(map[int]int),
-			MatchIndex:  make(map[int]int),
+		want[sp.ID] = true
+	}
+	for _, id := range c.peerIDs(-1) {
+		if !want[id] {
+			c.net.Unregister(id)
+			delete(c.Nodes, id)
+			if c.LeaderID != nil && *c.LeaderID == id {
+				c.LeaderID = nil
+			}
+			left = append(left, id)
 		}
-		n.resetElectionDeadline(rng)
-		nodes[id] = n
 	}
 
-	return &Cluster{
-		Round:  round,
-		Nodes: nodes,
-		rng:   rng,
+	var leader *NodeState
+	if c.LeaderID != nil {
+		leader = c.Nodes[*c.LeaderID]
+	}
+	for _, sp := range specs {
+		n, ok := c.Nodes[sp.ID]
+		if !ok {
+			n = &NodeState{
+				ID:          sp.ID,
+				Spec:        sp,
+				Role:        Follower,
+				CurrentTerm: DefaultTerm,
+				VotedFor:    nil,
+				Log:         make([]LogEntry, 0),
+				CommitIndex: 0,
+				LastApplied: 0,
+				NextIndex:   make(map[int]int),
+				MatchIndex:  make(map[int]int),
+			}
+			n.resetElectionDeadline(c.rng, c.clock)
+			c.Nodes[sp.ID] = n
+			joined = append(joined, sp.ID)
+			if leader != nil {
+				leader.mu.Lock()
+				leader.NextIndex[sp.ID] = len(leader.Log) + 1
+				leader.MatchIndex[sp.ID] = 0
+				leader.mu.Unlock()
+			}
+		}
+		n.mu.Lock()
+		n.Spec = sp
+		n.mu.Unlock()
+		if sp.Active {
+			c.net.Register(sp.ID, c.handlerFor(n))
+		} else {
+			c.net.Unregister(sp.ID)
+			if c.LeaderID != nil && *c.LeaderID == sp.ID {
+				// a crashed leader restarts as a follower; the next election timeout picks a new one
+				n.mu.Lock()
+				n.Role = Follower
+				n.mu.Unlock()
+				c.LeaderID = nil
+			}
+		}
+	}
+
+	c.net.SetDistanceModel(topology.ForPool(specs)) // link latency grows with grid distance
+	return joined, left
+}
+
+// ======================= 【高亮-2026-10-16】新增：RPC 消息处理（RequestVote / AppendEntries 经网络投递） =======================
+// voteReply / appendReply 是响应消息的载荷；请求方在 Run 期间把它们收集到 inbox 里。
+type voteReply struct {
+	resp VoteResponse
+}
+
+type appendReply struct {
+	resp       AppendEntriesResponse
+	matchIndex int
+}
+
+// defaultMalicious is the strategy of malicious nodes that have no behavior configured in the pool.
+// It reproduces the former hard-coded odds: deny 20% of votes, drop 40% of AppendEntries,
+// and fail 30% of proposals when leading.
+var defaultMalicious node.Behavior = node.ProbabilisticBehavior{
+	Reject: map[node.Phase]float64{node.PhaseVote: 0.20},
+	Silent: map[node.Phase]float64{node.PhaseAppend: 0.4, node.PhasePropose: 0.3},
+}
+
+func (c *Cluster) step(phase node.Phase, self, leader, peer int, digest string) node.Step {
+	return node.Step{
+		Phase:     phase,
+		Round:     c.Round,
+		Self:      self,
+		Leader:    leader,
+		Peer:      peer,
+		Digest:    digest,
+		Timeout:   time.Duration(RPCTimeoutMs) * time.Millisecond,
+		Prominent: -1,
+	}
+}
+
+// handlerFor returns the network handler of one raft node.
+// Requests are answered through the same network, so a lost request or a lost reply both cost the vote.
+// Every reply goes through the node's behavior: it may stay silent, deny, equivocate or answer late.
+func (c *Cluster) handlerFor(n *NodeState) node.Handler {
+	b := c.behaviors[n.ID]
+	return func(msg node.Message) {
+		switch msg.Type {
+		case node.MsgRequestVote:
+			req := msg.Payload.(VoteRequest)
+			act := b.Decide(c.step(node.PhaseVote, n.ID, req.CandidateID, msg.From, fmt.Sprintf("term-%d", req.Term)))
+			var resp VoteResponse
+			switch act.Kind {
+			case node.ActSilent, node.ActBadSign:
+				return
+			case node.ActEquivocate:
+				// Grant the vote without recording it, so several candidates may win it in the same term.
+				resp = VoteResponse{Term: req.Term, VoteGranted: true, Reason: "equivocating vote"}
+			default:
+				resp = n.HandleRequestVote(req)
+				if act.Kind == node.ActReject && resp.VoteGranted {
+					resp.VoteGranted = false
+					resp.Reason = "malicious denial"
+				} else if resp.VoteGranted {
+					n.resetElectionDeadline(c.rng, c.clock) // granting a vote restarts the follower's timer
+				}
+			}
+			c.net.SendAfter(node.Message{Type: node.MsgRequestVoteResp, From: n.ID, To: msg.From, Round: resp.Term, Payload: voteReply{resp: resp}}, act.Delay)
+		case node.MsgAppendEntries:
+			req := msg.Payload.(AppendEntriesRequest)
+			digest := fmt.Sprintf("term-%d", req.Term)
+			if len(req.Entries) > 0 {
+				digest = req.Entries[len(req.Entries)-1].Command
+			}
+			act := b.Decide(c.step(node.PhaseAppend, n.ID, req.LeaderID, msg.From, digest))
+			var resp AppendEntriesResponse
+			switch act.Kind {
+			case node.ActSilent, node.ActBadSign:
+				return // 恶意节点：静默丢弃 AppendEntries（拒绝复制）
+			case node.ActReject:
+				resp = AppendEntriesResponse{Term: req.Term, Success: false, Reason: "malicious rejection"}
+			case node.ActEquivocate:
+				// Acknowledge without storing the entries.
+				resp = AppendEntriesResponse{Term: req.Term, Success: true, Reason: "equivocating ack"}
+			default:
+				resp = n.HandleAppendEntries(req)
+				if resp.Success {
+					n.resetElectionDeadline(c.rng, c.clock) // heard from a live leader
+				}
+			}
+			match := 0
+			if resp.Success && len(req.Entries) > 0 {
+				match = req.Entries[len(req.Entries)-1].Index
+			}
+			c.net.SendAfter(node.Message{Type: node.MsgAppendEntriesResp, From: n.ID, To: msg.From, Round: resp.Term, Payload: appendReply{resp: resp, matchIndex: match}}, act.Delay)
+		case node.MsgRequestVoteResp, node.MsgAppendEntriesResp:
+			c.inbox = append(c.inbox, msg)
+		}
+	}
+}
+
+func (c *Cluster) peerIDs(exclude int) []int {
+	ids := make([]int, 0, len(c.Nodes))
+	for id := range c.Nodes {
+		if id != exclude {
+			ids = append(ids, id)
+		}
 	}
+	sort.Ints(ids)
+	return ids
 }
 
-func (n *NodeState) resetElectionDeadline(rng *rand.Rand) {
-	// A small randomized timeout; the config value is treated as base.
-	jitter := rng.Intn(ElectionTimeout + 1) // [0..ElectionTimeout]
-	n.ElectionDeadline = time.Now().Add(time.Duration(ElectionTimeout+jitter) * time.Second)
+// drainInbox 取出并清空本次 RPC 广播收到的响应
+func (c *Cluster) drainInbox() []node.Message {
+	out := c.inbox
+	c.inbox = nil
+	return out
+}
+
+// resetElectionDeadline restarts the election timer on the cluster's clock.
+// The timeout is ElectionTimeout seconds plus a millisecond-granular jitter of up to
+// another ElectionTimeout seconds, so timers rarely tie.
+func (n *NodeState) resetElectionDeadline(rng *rand.Rand, clock node.Clock) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	base := time.Duration(ElectionTimeout) * time.Second
+	jitter := time.Duration(rng.Int63n(int64(base/time.Millisecond)+1)) * time.Millisecond
+	n.ElectionDeadline = clock.Now().Add(base + jitter)
+}
+
+// Clock returns the simulated clock shared by the cluster's timers and network.
+func (c *Cluster) Clock() *node.VirtualClock {
+	return c.clock
+}
+
+// NextElectionTimeout advances the clock to the earliest election deadline among active
+// nodes and returns the node whose timer fired (ties broken by the lower ID).
+func (c *Cluster) NextElectionTimeout() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	first := -1
+	var at time.Time
+	for _, id := range c.peerIDs(-1) {
+		n := c.Nodes[id]
+		if !n.Spec.Active {
+			continue
+		}
+		n.mu.Lock()
+		d := n.ElectionDeadline
+		n.mu.Unlock()
+		if first < 0 || d.Before(at) {
+			first, at = id, d
+		}
+	}
+	if first < 0 {
+		return 0, false
+	}
+	c.clock.AdvanceTo(at.Sub(node.VirtualEpoch))
+	return first, true
 }
 
 // lastLogIndexTerm returns the last log index and term.
@@ -318,34 +540,33 @@ func (c *Cluster) StartElection(candidateID int) (leaderID int, err error) {
 	cand.VotedFor = &cid
 	lastIdx, lastTerm := cand.lastLogIndexTerm()
 	cand.mu.Unlock()
+	cand.resetElectionDeadline(c.rng, c.clock) // a new election term restarts the candidate's own timer
 
 	// Request votes
 	votes := 1 // self vote
 	needed := c.quorum()
 
-	for id, peer := range c.Nodes {
-		if id == candidateID {
-			continue
-		}
-
-		// If peer is inactive or malicious, we still process; maliciousness affects response stochastically.
-		// But "log not behind" rule is always enforced.
-		resp := peer.HandleRequestVote(VoteRequest{
+	c.net.Broadcast(node.Message{
+		Type:  node.MsgRequestVote,
+		From:  candidateID,
+		Round: candTerm,
+		Payload: VoteRequest{
 			Term:         candTerm,
 			CandidateID:  candidateID,
 			LastLogIndex: lastIdx,
 			LastLogTerm:  lastTerm,
-		})
-
-		// Malicious peer might flip its response sometimes (simulation).
-		// ======================= 【高亮-2026-03-09】nodepool 共用节点集：用 Spec.IsMalicious 影响行为（可控仿真） =======================
-		if peer.Spec.IsMalicious { // 【高亮-2026-03-15 21:40:00】 用 peer.Spec 替换 peerSpec，修复未定义变量
-			// With small probability, deny vote even if would grant.
-			if resp.VoteGranted && c.rng.Float64() < 0.20 {
-				resp.VoteGranted = false
-				resp.Reason = "malicious denial"
-			}
+		},
+	}, c.peerIDs(candidateID))
+	c.net.RunFor(time.Duration(RPCTimeoutMs) * time.Millisecond)
+
+	// ======================= 【高亮-2026-10-16】只统计经网络送达候选人的 RequestVote 响应 =======================
+	voted := map[int]bool{}
+	for _, msg := range c.drainInbox() {
+		if msg.Type != node.MsgRequestVoteResp || voted[msg.From] {
+			continue // 网络可能重复投递，同一投票者只计一次
 		}
+		voted[msg.From] = true
+		resp := msg.Payload.(voteReply).resp
 
 		if resp.Term > candTerm {
 			// Candidate discovers higher term, step down.
@@ -411,37 +632,82 @@ func (c *Cluster) LeaderAppend(command string) (int, float64, error) {
 
 	leader := c.Nodes[*c.LeaderID]
 	leader.mu.Lock()
-	// 如果 Leader 是恶意节点，模拟提案失败
-	if leader.Spec.IsMalicious && c.rng.Float64() < 0.3 {
-	    leader.mu.Unlock()
-		return 0, 0, fmt.Errorf("malicious leader failed to propose")
-	}
-
     newEntry := LogEntry{Index: len(leader.Log) + 1, Term: leader.CurrentTerm, Command: command}
 	leader.Log = append(leader.Log, newEntry)
 	leader.mu.Unlock()
 
 	successCount := 1 // Leader 算一票
-	for _, nd := range c.Nodes {
-		if nd.ID == *c.LeaderID { continue }
-
-		// 模拟副本确认逻辑 (对齐 PBFT 投票行为)
-		shouldConfirm := true
-		if nd.Spec.IsMalicious {
-			// 恶意节点：大概率拒绝
-			if c.rng.Float64() < 0.4 { shouldConfirm = false }
-		} else {
-			// 正常节点：极小概率网络抖动
-			if c.rng.Float64() < 0.05 { shouldConfirm = false }
+
+	// ======================= 【高亮-2026-10-16】副本确认改为真实 AppendEntries 往返（诚实节点的"抖动"由网络丢包体现） =======================
+	leader.mu.Lock()
+	prevIdx, prevTerm := 0, 0
+	if newEntry.Index > 1 {
+		prevIdx = newEntry.Index - 1
+		prevTerm = leader.Log[prevIdx-1].Term
+	}
+	req := AppendEntriesRequest{
+		Term:         leader.CurrentTerm,
+		LeaderID:     leaderID,
+		PrevLogIndex: prevIdx,
+		PrevLogTerm:  prevTerm,
+		Entries:      []LogEntry{newEntry},
+		LeaderCommit: leader.CommitIndex,
+	}
+	leader.mu.Unlock()
+
+	// 【高亮-2026-10-16】leader 按行为策略逐个副本发送：可能沉默（提案失败）或向部分副本发送冲突条目
+	sent := 0
+	lb := c.behaviors[leaderID]
+	for _, p := range c.peerIDs(leaderID) {
+		act := lb.Decide(c.step(node.PhasePropose, leaderID, leaderID, p, command))
+		r := req
+		switch act.Kind {
+		case node.ActSilent, node.ActReject, node.ActBadSign:
+			continue
+		case node.ActEquivocate:
+			e := newEntry
+			e.Command = act.Digest
+			r.Entries = []LogEntry{e}
 		}
+		c.net.SendAfter(node.Message{
+			Type:    node.MsgAppendEntries,
+			From:    leaderID,
+			To:      p,
+			Round:   req.Term,
+			Size:    node.DefaultMessageSize + len(command),
+			Payload: r,
+		}, act.Delay)
+		sent++
+	}
+	if sent == 0 {
+		return 0, 0, fmt.Errorf("malicious leader failed to propose")
+	}
+	c.net.RunFor(time.Duration(RPCTimeoutMs) * time.Millisecond)
 
-		if shouldConfirm {
-			successCount++
+	acked := map[int]bool{}
+	for _, msg := range c.drainInbox() {
+		if msg.Type != node.MsgAppendEntriesResp || acked[msg.From] {
+			continue // 网络可能重复投递，同一副本只计一次
+		}
+		rep := msg.Payload.(appendReply)
+		if !rep.resp.Success {
+			continue
 		}
+		acked[msg.From] = true
+		successCount++
+		leader.mu.Lock()
+		leader.MatchIndex[msg.From] = rep.matchIndex
+		leader.NextIndex[msg.From] = rep.matchIndex + 1
+		leader.mu.Unlock()
 	}
 
 	q := c.quorum() // 【高亮-2026-03-15 21:40:00】 用 q := c.quorum() 替换 undefined: quorum
 	if successCount >= q {
+		leader.mu.Lock()
+		if newEntry.Index > leader.CommitIndex {
+			leader.CommitIndex = newEntry.Index
+		}
+		leader.mu.Unlock()
 		// 【对齐点】撮合成功价格逻辑对齐
 		price := 500.0 + c.rng.Float64()*20.0
         // 【关键修改-2026-03-15】：暴露安全性劣势
@@ -464,21 +730,24 @@ func (c *Cluster) LeaderAppend(command string) (int, float64, error) {
 
 // SimulateRoundWithPrice 用于服务端仿真入口，返回价格以对齐
 func SimulateRoundWithPrice(round int, specs []node.NodeSpec) (int, float64, error) {
+	lid, price, _, err := SimulateRoundWithLatency(round, specs)
+	return lid, price, err
+}
+
+// SimulateRoundWithLatency 同 SimulateRoundWithPrice，并返回从选举超时触发到日志提交（或失败）的仿真时延
+// 【高亮-2026-10-16】修改：候选人不再随机挑选，而是虚拟时钟上选举计时器最先到期的活跃节点
+func SimulateRoundWithLatency(round int, specs []node.NodeSpec) (int, float64, time.Duration, error) {
 	c := NewClusterFromPool(round, specs)
 
-	// 简单选主逻辑
-	active := make([]int, 0)
-	for _, sp := range specs {
-		if sp.Active { active = append(active, sp.ID) }
-	}
-	if len(active) == 0 { return 0, 0, errors.New("no active nodes") }
+	cand, ok := c.NextElectionTimeout()
+	if !ok { return 0, 0, 0, errors.New("no active nodes") }
+	start := c.clock.Elapsed()
 
-	cand := active[c.rng.Intn(len(active))]
 	lid, err := c.StartElection(cand)
-	if err != nil { return 0, 0, err }
+	if err != nil { return 0, 0, c.clock.Elapsed() - start, err }
 
 	_, price, err := c.LeaderAppend(fmt.Sprintf("cmd-round-%d", round))
-	return lid, price, err
+	return lid, price, c.clock.Elapsed() - start, err
 }
 
 func SimulateRound(round int, numNodes int, maliciousRatio float64) (int, int, error) {
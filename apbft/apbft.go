@@ -7,29 +7,80 @@ import ( // 导入必要的标准库包
 	"sync"      // 并发原语，用于等待并保护共享切片
 	"time"
 	"PBFT1/node"
+	"PBFT1/topology"
 )
 
 // ======================= 【高亮-2026-03-22】新增：KNN 辅助结构与距离计算 =======================
 type Neighbor struct {
-	ID    int
-	D     float64 // 标签 d: 与主节点的距离
-	Quote float64 // 节点作为卖方的预期报价
+	ID    int     `json:"id"`
+	D     float64 `json:"d"`     // 标签 d: 与主节点的距离
+	Quote float64 `json:"quote"` // 节点作为卖方的预期报价
 }
 
-// calculateNodeDistance 用于模拟两个节点在电网拓扑中的固定物理距离
-func calculateNodeDistance(id1, id2 int) float64 {
-	if id1 == id2 {
-		return 0.0
+// 【高亮-2026-10-16】修改：节点间距离改由共享电网拓扑（topology.Grid）沿线路的最短电气距离给出，
+// 取代原 calculateNodeDistance 按节点 ID 哈希出的随机距离
+// ======================= 【高亮-2026-03-22】新增结束 =======================
+
+// signedVote 副本发回 leader 的 PREPARE/COMMIT 载荷（公钥由 leader 按 ID 从 KeyRegistry 查询，不随消息携带）
+type signedVote struct {
+	id  int
+	sig []byte
+}
+
+// ======================= 【高亮-2026-10-16】新增：leader 收集的签名集合 + 作恶者定位 =======================
+// voteSet 按到达顺序保存签名者、公钥（来自 KeyRegistry）与签名，三者下标一一对应
+type voteSet struct {
+	ids     []int
+	pubKeys [][]byte
+	sigs    [][]byte
+}
+
+func (v *voteSet) add(id int, pubKey, sig []byte) {
+	v.ids = append(v.ids, id)
+	v.pubKeys = append(v.pubKeys, pubKey)
+	v.sigs = append(v.sigs, sig)
+}
+
+// without 去掉下标 drop 中的签名
+func (v voteSet) without(drop []int) voteSet {
+	skip := make(map[int]bool, len(drop))
+	for _, i := range drop {
+		skip[i] = true
 	}
-	// 利用节点ID生成固定的伪随机种子，保证两点间拓扑距离固定
-	seed := int64(id1*1000 + id2)
-	if id1 > id2 {
-		seed = int64(id2*1000 + id1)
+	var out voteSet
+	for i := range v.ids {
+		if !skip[i] {
+			out.add(v.ids[i], v.pubKeys[i], v.sigs[i])
+		}
 	}
-	rng := rand.New(rand.NewSource(seed))
-	return rng.Float64() * 100.0 // 模拟距离范围 0 ~ 100 KM
+	return out
+}
+
+// aggregateVotes leader 聚合并验证签名；验证失败时二分定位坏签名，剔除后重新聚合。
+// 返回聚合签名、剩余的有效签名集合、作恶签名者 ID，以及最终聚合是否有效。
+func aggregateVotes(leader *node.Node, votes voteSet, message []byte) ([]byte, voteSet, []int, bool) {
+	agg, err := leader.AggregateSignatures(votes.sigs)
+	if err == nil {
+		if ok, _ := leader.VerifyAggregate(votes.pubKeys, message, agg); ok {
+			return agg, votes, nil, true
+		}
+	}
+	bad := leader.FindCulprits(votes.pubKeys, message, votes.sigs)
+	culprits := make([]int, 0, len(bad))
+	for _, i := range bad {
+		culprits = append(culprits, votes.ids[i])
+	}
+	valid := votes.without(bad)
+	if len(valid.sigs) == 0 {
+		return nil, valid, culprits, false
+	}
+	agg, err = leader.AggregateSignatures(valid.sigs)
+	if err != nil {
+		return nil, valid, culprits, false
+	}
+	ok, _ := leader.VerifyAggregate(valid.pubKeys, message, agg)
+	return agg, valid, culprits, ok
 }
-// ======================= 【高亮-2026-03-22】新增结束 =======================
 
 // 简化 PBFT 模拟器（PRE-PREPARE / PREPARE / COMMIT）
 // 定义 PBFT 模拟器的结构体，封装节点集合与参数
@@ -39,13 +90,54 @@ type PBFTSimulator struct {
 	f                     int          // 最大容忍拜占庭节点数 (f)
 	useBlst               bool         // 是否使用 BLS（布鲁姆/聚合签名）库的标志
 	AfterConsensusHandler func(round int) // <<< 新增：达成共识后的业务钩子
+	registry              *node.KeyRegistry // 【高亮-2026-10-16】新增：节点 ID -> 公钥登记表
+	culprits              []int             // 【高亮-2026-10-16】新增：最近一轮被定位的坏签名节点
+	culpritPhase          map[int]node.Phase // 坏签名出现在哪个阶段（按阶段加权的信誉模型使用）
+	clock                 *node.VirtualClock // 【高亮-2026-10-16】新增：节点签名、网络投递与轮间隔共用的虚拟时钟
+	lastLatency           time.Duration      // 最近一轮的共识时延（仿真时间）
+	grid                  *topology.Grid     // 【高亮-2026-10-16】新增：电网拓扑（KNN 距离、拒绝概率与链路时延共用）
+	repModel              node.ReputationModel // 【高亮-2026-10-16】新增：ApplyConfig 装配的信誉模型（新加入节点沿用）
+	keys                  *node.Keystore       // 【高亮-2026-10-16】新增：持久化密钥库（为空时节点使用临时密钥）
+	// 【高亮-2026-10-16】新增：视图转换状态（同一轮请求内跨 view 保留）
+	round    int                  // 当前请求所在轮次（-1 表示尚未开始）
+	view     int                  // 当前 view
+	prepared map[int]PreparedCert // 副本在本轮收到的 prepared 证书
+	missed   map[int]bool         // 本轮已因未提交 COMMIT 受罚的节点：同一请求的多次 view 只罚一次
+	// 【高亮-2026-10-16】新增：副本消息日志与检查点（见 checkpoint.go）
+	replicas map[int]*replicaState // 各副本的按序号日志、执行进度与稳定检查点
+	execBase int                   // 副本的初始执行位置（第一个请求序号 - 1）
+	started  bool                  // 是否已处理过请求（execBase 已确定）
+	members  map[int]int           // 低水位以上各序号处理时的成员数
+	retired  map[int]retiredKey    // 已离开节点的公钥（低水位以上的旧证书验证用）
+	joined   map[int]int           // 【高亮-2026-10-16】运行中加入的节点 -> 加入后的第一个序号（公钥清单的 from）
+	payload  int                   // 【高亮-2026-10-16】当前提案附带的交易列表字节数（批量提案，见 batch.go）
+	// 【高亮-2026-10-16】新增：流水线调度与节点 CPU 占用（见 pipeline.go）
+	pipe pipelineState
+	cpu  map[int][]busyInterval
+	// 【高亮-2026-10-16】新增：分层路由（见 routing.go）
+	routing    RoutingConfig
+	demand     DemandClass                // 当前请求自带的需求类别
+	committee  map[int]bool               // 当前序号的验证委员会（nil 表示全部活跃节点）
+	committees map[int]int                // 低水位以上使用了委员会的序号 -> 委员会大小
+	tiers      map[DemandClass]*tierTally // 各需求类别下最终主节点的层级分布
+	sampling   committeeTally             // 【高亮-2026-10-16】委员会抽样与消息量统计（见 committee.go）
+	// 【高亮-2026-10-16】新增：定价策略与当前序号的交易电量（见 pricing.go）
+	pricing PricingStrategy
+	amount  int
+	// 【高亮-2026-10-16】新增：当前请求的共识过程记录（见 transcript.go）
+	trace  Transcript
+	phases map[int][]PhaseRecord
+	qc     *QuorumCertificate // 【高亮-2026-10-16】当前请求提交时的法定人数证书（见 qc.go）
+	market marketState        // 【高亮-2026-10-16】副本订单簿的比对状态（见 market.go）
+	clearing ClearingMode     // 【高亮-2026-10-16】副本订单簿的出清方式（见 auction.go）
 }
 
 // 核心模拟器
 // ====== 导出共识结果结构体及节点类型 ======
 type Validator struct {
-	ID   string
-	Vote string
+	ID     string
+	Vote   string
+	Phases []PhaseRecord // 【高亮-2026-10-16】新增：各 view 各阶段的结果与时延（见 transcript.go）
 }
 
 type PBFTResult struct {
@@ -58,22 +150,186 @@ type PBFTResult struct {
 	FailedReason string
 	Price        float64 // <== 新增：成交价
 	LeaderNode   string  // <== 新增：撮合节点
+	Culprits     []string // 【高亮-2026-10-16】新增：验签定位并剔除的坏签名节点
+	LatencyMs    float64  // 【高亮-2026-10-16】新增：本轮共识时延（仿真毫秒）
+	View         int      // 【高亮-2026-10-16】新增：提交（或放弃）时所在的 view，>0 表示发生过视图转换
+	Pricing      PricingRecord // 【高亮-2026-10-16】新增：成交价使用的定价策略及参数
+	Transcript   Transcript    // 【高亮-2026-10-16】新增：主节点、视图转换、定价报价与聚合签名
+	QC           *QuorumCertificate // 【高亮-2026-10-16】新增：可凭公钥清单离线验证的法定人数证书（未提交时为 nil）
+	Market       *MarketRecord      // 【高亮-2026-10-16】新增：订单批次在各副本上的执行结果（不是订单批次时为 nil）
 }
 
 func NewPBFTSimulator(nodes []*node.Node, useBlst bool) *PBFTSimulator { // 构造函数：创建 PBFTSimulator 实例
 	n := len(nodes)  // 计算节点数
 	f := (n - 1) / 3 // 根据 PBFT 理论计算可容错的拜占庭个数 f
+	clock := node.NewVirtualClock()
+	maxID := 0
+	for _, nd := range nodes {
+		nd.SetClock(clock) // 节点的签名耗时只推进虚拟时间
+		if nd.ID+1 > maxID {
+			maxID = nd.ID + 1
+		}
+	}
 	return &PBFTSimulator{
 		nodes:                 nodes,
 		n:                     n,
 		f:                     f,
 		useBlst:               useBlst,
 		AfterConsensusHandler: nil, // 默认无处理
+		registry:              node.RegistryFromNodes(nodes),
+		clock:                 clock,
+		grid:                  topology.Default(maxID),
+		round:                 -1,
+		pricing:               KNNPricing{K: 5, BasePrice: 250, LossCoeff: 1.2}, // 【高亮-2026-10-16】与 DefaultPricingConfig 相同
 	} // 返回新建实例
 }
 
+// SetTopology 替换模拟器使用的电网拓扑（须包含全部节点）
+func (s *PBFTSimulator) SetTopology(g *topology.Grid) error {
+	for _, nd := range s.nodes {
+		if !g.HasNode(nd.ID) {
+			return fmt.Errorf("apbft: topology has no node %d", nd.ID)
+		}
+	}
+	s.grid = g
+	return nil
+}
+
+// Topology 模拟器使用的电网拓扑
+func (s *PBFTSimulator) Topology() *topology.Grid {
+	return s.grid
+}
+
+// Clock 模拟器的虚拟时钟
+func (s *PBFTSimulator) Clock() *node.VirtualClock {
+	return s.clock
+}
+
+// LastLatency 最近一轮从 PRE-PREPARE 到结束（成功或失败）所经过的仿真时间
+func (s *PBFTSimulator) LastLatency() time.Duration {
+	return s.lastLatency
+}
+
+// Culprits 最近一轮 leader 通过验签定位出的坏签名节点 ID（升序）
+func (s *PBFTSimulator) Culprits() []int {
+	return append([]int(nil), s.culprits...)
+}
+
+// ApplyConfig 按配置为所有节点装配信誉模型（会重新初始化信誉状态，应在第一轮之前调用）
+// 【高亮-2026-10-16】修改：配置了密钥库时同时装上节点的持久身份
+func (s *PBFTSimulator) ApplyConfig(cfg Config) error {
+	model, err := cfg.Reputation.Build()
+	if err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	for _, nd := range s.nodes {
+		nd.SetReputationModel(model)
+	}
+	s.repModel = model
+	if err := s.SetPipeline(cfg.Pipeline); err != nil { // 【高亮-2026-10-16】流水线参数
+		return err
+	}
+	if err := s.SetRouting(cfg.Routing); err != nil { // 【高亮-2026-10-16】分层路由参数
+		return err
+	}
+	pricing, err := cfg.Pricing.Build() // 【高亮-2026-10-16】定价策略
+	if err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	s.SetPricing(pricing)
+	if err := s.SetClearing(cfg.Clearing); err != nil { // 【高亮-2026-10-16】副本订单簿的出清方式
+		return err
+	}
+	if err := cfg.OpenKeystore(); err != nil {
+		return err
+	}
+	if cfg.Keys != nil {
+		return s.UseKeystore(cfg.Keys)
+	}
+	return nil
+}
+
+// UseKeystore 从密钥库为所有节点加载（缺失时生成）持久密钥，并按新公钥重建登记表
+func (s *PBFTSimulator) UseKeystore(ks *node.Keystore) error {
+	if _, err := ks.AttachKeys(s.nodes); err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	s.keys = ks
+	s.registry = node.RegistryFromNodes(s.nodes)
+	return nil
+}
+
+// settleRewards 按本轮结果结算信誉：坏签名者按所在阶段直接受罚；
+// 成功时提交了 COMMIT 的节点受奖，其余节点不变；失败时未提交 COMMIT 的节点受罚。
+func (s *PBFTSimulator) settleRewards(round int, success bool, committed []int) {
+	done := make(map[int]bool, len(committed))
+	for _, id := range committed {
+		done[id] = true
+	}
+	bad := make(map[int]bool, len(s.culprits))
+	for _, id := range s.culprits {
+		bad[id] = true
+	}
+	for _, nd := range s.nodes {
+		switch {
+		case bad[nd.ID]:
+			nd.RecordOutcome(node.ReputationEvent{Success: false, Phase: s.culpritPhase[nd.ID], Round: round})
+		case success && done[nd.ID]:
+			nd.RecordOutcome(node.ReputationEvent{Success: true, Phase: node.PhaseCommit, Round: round})
+		case !success && !done[nd.ID] && !s.missed[nd.ID] && s.votes(nd.ID): // 【高亮-2026-10-16】委员会外的节点不参与签名
+			s.missed[nd.ID] = true
+			nd.RecordOutcome(node.ReputationEvent{Success: false, Phase: node.PhaseCommit, Round: round})
+		}
+	}
+}
+
+// penalizeLeader 本 view 的失败按所在阶段记在 leader 头上，并计入 missed：
+// 随后的 settleRewards 不会再因"未提交 COMMIT"对 leader 重复处罚
+func (s *PBFTSimulator) penalizeLeader(leader *node.Node, phase node.Phase, round int) {
+	leader.RecordOutcome(node.ReputationEvent{Success: false, Phase: phase, Round: round})
+	s.missed[leader.ID] = true
+}
+
+// addCulprits 记录本轮在 phase 阶段定位出的坏签名者（去重、升序）
+func (s *PBFTSimulator) addCulprits(phase node.Phase, ids []int) {
+	if s.culpritPhase == nil {
+		s.culpritPhase = make(map[int]node.Phase)
+	}
+	for _, id := range ids {
+		dup := false
+		for _, c := range s.culprits {
+			if c == id {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			s.culprits = append(s.culprits, id)
+			s.culpritPhase[id] = phase
+		}
+	}
+	sort.Ints(s.culprits)
+}
+
+// Registry 返回模拟器使用的公钥登记表
+func (s *PBFTSimulator) Registry() *node.KeyRegistry {
+	return s.registry
+}
+
 // 主节点选择，基于活跃节点
+// 【高亮-2026-10-16】修改：候选顺序由 leaderOrder 给出（按当前请求的需求类别分层路由），view v 的主节点即 SelectLeader(round, v)
 func (s *PBFTSimulator) SelectLeader(round int, offset int) *node.Node {
+	active := s.leaderOrder(round)
+	if len(active) == 0 {
+		return nil
+	}
+
+	// 【轮换逻辑】：仅在优质节点集合中取模，使得主节点始终是高信誉节点，极大概率避免触发 View Change
+	return active[offset%len(active)]
+}
+
+// primaryOrder 主节点候选顺序：信誉合格的节点按 m 降序（所有副本据相同的信誉状态得到相同顺序）
+func (s *PBFTSimulator) primaryOrder() []*node.Node {
 	active := []*node.Node{}
 
 	// 1. 过滤出信誉值合格的优质节点作为主节点候选池（从根源规避恶意节点）
@@ -92,23 +348,24 @@ func (s *PBFTSimulator) SelectLeader(round int, offset int) *node.Node {
 		}
 	}
 
-	if len(active) == 0 {
-		return nil
-	}
-
 	// APBFT 核心：按信誉值M排序（这里简化为信誉值 M）
 	sort.Slice(active, func(i, j int) bool {
 		return active[i].M() > active[j].M()
 	})
-
-	// 【轮换逻辑】：仅在优质节点集合中取模，使得主节点始终是高信誉节点，极大概率避免触发 View Change
-	idx := (round + offset) % len(active)
-	return active[idx]
+	return active
 }
 
 // 层级计算
+// 【高亮-2026-10-16】修改：只对在线节点按吞吐量分层，宕机节点一律记为 Low
 func (s *PBFTSimulator) ComputeTiers() {
-	arr := append([]*node.Node{}, s.nodes...)
+	arr := make([]*node.Node, 0, len(s.nodes))
+	for _, nd := range s.nodes {
+		if !nd.Online() {
+			nd.Tier = node.TierLow
+			continue
+		}
+		arr = append(arr, nd)
+	}
 	sort.Slice(arr, func(i, j int) bool {
 		return arr[i].Throughput > arr[j].Throughput
 	})
@@ -136,221 +393,444 @@ type roundSeedSetter interface {
 	SetRoundSeed(round int)
 }
 
+// 【高亮-2026-10-16】修改：主节点失效时由超时驱动的 VIEW-CHANGE / NEW-VIEW 轮换，而不是固定只跑一个 view
 func (s *PBFTSimulator) RunRound(round int, request []byte) bool {
-	leader := s.SelectLeader(round, 0) // 默认不轮换执行
-	ok, _ := s.RunRoundWithLeader(round, request, leader)
+	ok, _, _, _ := s.RunRoundWithViewChange(round, request)
 	return ok
 }
 
-// 共识流程(本轮)
-func (s *PBFTSimulator) RunRoundWithLeader(round int, request []byte, leader *node.Node) (bool, float64) {
+// beginRound 新请求到达：每轮只执行一次（同一轮内的视图转换不重复推进随机源与信誉模型）
+func (s *PBFTSimulator) beginRound(round int) {
+	if s.round == round {
+		return
+	}
+	s.round, s.view, s.prepared, s.missed = round, 0, make(map[int]PreparedCert), make(map[int]bool)
+	s.resetTranscript() // 【高亮-2026-10-16】共识过程按请求记录
+	s.qc, s.market.last = nil, nil
 	for _, nd := range s.nodes {
 		if ss, ok := any(nd).(roundSeedSetter); ok {
 			ss.SetRoundSeed(round)
 		}
+		nd.BeginRound(round) // 【高亮-2026-10-16】信誉模型的按轮规则（如观察期复权）
 	}
+}
+
+// 共识流程(本轮)
+// 【高亮-2026-10-16】修改：在当前 view（s.view）下以 leader 为主节点执行一次三阶段流程
+func (s *PBFTSimulator) RunRoundWithLeader(round int, request []byte, leader *node.Node) (bool, float64) {
+	s.beginRound(round)
 
+	s.culprits, s.culpritPhase = nil, nil
+	start := s.clock.Elapsed()
+	defer func() { s.lastLatency = s.clock.Elapsed() - start }()
 	if leader == nil {
 		// ======================= 【修复报错点】补充返回值 0 =======================
 		return false, 0
 	}
 
-	// PRE-PREPARE
-	if leader.IsMalicious && rand.Float64() < 0.5 { // 如果 leader 是恶意并以 50% 概率作恶
-		fmt.Printf("Leader %d acted maliciously in pre-prepare\n", leader.ID) // 打印作恶日志
-		leader.UpdateReward(false)                                            // 更新 leader 的奖励/惩罚（作恶导致失败）
-		// ======================= 【修复报错点】补充返回值 0 =======================
-		return false, 0
+	var neighbors []Neighbor // 存储邻居节点信息用于定价（【高亮-2026-10-16】策略见 pricing.go）
+
+	// ======================= 【高亮-2026-10-16】新增：PRE-PREPARE/PREPARE/COMMIT 经 node.Network 收发 =======================
+	// APBFT 采用"leader 收集 + BLS 聚合"的星型通信：leader 广播，副本把签名发回 leader。
+	// 只有真正送达的消息才计入签名集合，丢包/超时由网络层决定。
+	nw := node.NewNetworkWithClock(node.DefaultNetworkConfig(), int64(20260322+round), s.clock)
+	nw.SetDistanceModel(s.grid)
+	defer func() { // 【高亮-2026-10-16】三阶段流程的消息量（比较全体签名与委员会签名）
+		s.sampling.requests++
+		s.sampling.messages += nw.Stats().Sent
+	}()
+	phaseTimeout := time.Duration(PhaseTimeoutMs) * time.Millisecond
+	digest := fmt.Sprintf("%x", request)
+	// 【高亮-2026-10-16】协议步骤上下文：各节点的拜占庭行为策略据此决定动作
+	prominent := -1
+	if top := s.SelectLeader(round, 0); top != nil {
+		prominent = top.ID
+	}
+	stepFor := func(phase node.Phase, d string) node.Step {
+		return node.Step{Phase: phase, Round: round, Leader: leader.ID, Peer: leader.ID, Digest: d, Timeout: phaseTimeout, Prominent: prominent, View: s.view}
 	}
 
-	// 【KNN 参数初始化】
-	basePrice := 250.0       // 基础电价
-	lineLossCoeff := 1.2     // 线损系数（元/单位距离）
-	K := 5                   // K近邻数量
-	var neighbors []Neighbor // 存储邻居节点信息用于 KNN 定价
+	activeIDs := make([]int, 0, s.n)
+	byID := make(map[int]*node.Node, s.n)
+	got := make(map[int]node.Message, s.n) // 本阶段各副本收到的 leader 消息
+	// 【高亮-2026-10-16】各阶段的逐节点记录（见 transcript.go）
+	pre := newPhaseLog(node.PhasePrePrepare, s.clock.Elapsed())
+	var prep, com *phaseLog
+	fail := func(reason string, prepareSigners, commitSigners []int) {
+		s.recordView(leader, false, reason, prepareSigners, commitSigners)
+	}
+	for _, nd := range s.nodes {
+		if !nd.IsActive() || !nd.Online() { // 【高亮-2026-10-16】宕机节点不收发消息
+			continue
+		}
+		id := nd.ID
+		activeIDs = append(activeIDs, id)
+		byID[id] = nd
+		if id == leader.ID {
+			continue
+		}
+		nw.Register(id, func(msg node.Message) {
+			if _, dup := got[id]; !dup {
+				got[id] = msg
+				if msg.Type == node.MsgPrePrepare {
+					pre.arrived(id, s.clock.Elapsed())
+				}
+			}
+		})
+	}
+
+	var prepareVotes voteSet // 收集每个节点对请求的签名、公钥与参与节点
+	seen := make(map[int]bool, s.n)
+	nw.Register(leader.ID, func(msg node.Message) {
+		switch msg.Type {
+		case node.MsgPrePrepare, node.MsgCommit:
+			if _, dup := got[leader.ID]; !dup {
+				got[leader.ID] = msg
+			}
+		case node.MsgPrepare:
+			if seen[msg.From] || msg.Digest != digest || !s.votes(msg.From) {
+				return // 重复投递、摘要不符或不在验证委员会中
+			}
+			pk, known := s.registry.PublicKey(msg.From)
+			if !known {
+				return // 未登记公钥的节点签名无法验证
+			}
+			seen[msg.From] = true
+			prep.arrived(msg.From, s.clock.Elapsed())
+			s.sampling.votes++
+			prepareVotes.add(msg.From, pk, msg.Payload.(signedVote).sig)
+		}
+	})
 
-	// PREPARE: 所有活跃节点签名
-	var wg sync.WaitGroup                // 等待组，用于并发收集签名
-	var mu sync.Mutex                    // 互斥锁，保护共享切片
-	signatures := make([][]byte, 0, s.n) // 收集每个节点对请求的签名切片
-	pubKeys := make([][]byte, 0, s.n)    // 收集每个节点的公钥切片
-	signedIDs := []int{}                 // 用于记录参与节点
+	// 【高亮-2026-10-16】leader 已宕机：副本等到 PRE-PREPARE 超时，本轮失败
+	if !leader.Online() {
+		nw.RunFor(phaseTimeout)
+		fmt.Printf("Leader %d is offline; pre-prepare timed out\n", leader.ID)
+		for _, id := range activeIDs {
+			pre.set(id, OutcomeNoProposal)
+		}
+		s.recordPhase(pre)
+		fail("leader offline", nil, nil)
+		leader.RecordOutcome(node.ReputationEvent{Success: false, Phase: node.PhasePrePrepare, Round: round})
+		return false, 0
+	}
 
-	for _, nd := range s.nodes { // 遍历所有节点
-		if !nd.IsActive() { // 跳过非活跃节点
+	// PRE-PREPARE: leader 按自身行为策略向每个副本发送请求（可能沉默或对部分副本发送冲突提案）
+	prePrepare := node.Message{Type: node.MsgPrePrepare, From: leader.ID, Round: round, Seq: 1, Digest: digest, Size: node.DefaultMessageSize + len(request) + s.payload}
+	sent := 0
+	pre.start = s.clock.Elapsed()
+	for _, id := range activeIDs {
+		step := stepFor(node.PhasePrePrepare, digest)
+		step.Peer = id
+		act := leader.Decide(step)
+		m := prePrepare
+		m.To = id
+		switch act.Kind {
+		case node.ActSilent, node.ActReject, node.ActBadSign:
 			continue
+		case node.ActEquivocate:
+			m.Digest = act.Digest
+		}
+		nw.SendAfter(m, act.Delay)
+		sent++
+	}
+	if sent == 0 {
+		fmt.Printf("Leader %d acted maliciously in pre-prepare\n", leader.ID)                             // 打印作恶日志
+		for _, id := range activeIDs {
+			pre.set(id, OutcomeNoProposal)
+		}
+		pre.set(leader.ID, OutcomeMaliciousRefusal)
+		s.recordPhase(pre)
+		fail("leader sent no pre-prepare", nil, nil)
+		leader.RecordOutcome(node.ReputationEvent{Success: false, Phase: node.PhasePrePrepare, Round: round}) // 更新 leader 的奖励/惩罚（作恶导致失败）
+		return false, 0
+	}
+	nw.RunFor(phaseTimeout)
+	for id, pp := range got {
+		s.logPrePrepare(id, round, pp.Digest) // 【高亮-2026-10-16】副本消息日志
+	}
+	for _, id := range activeIDs {
+		switch pp, ok := got[id]; {
+		case id == leader.ID:
+			pre.set(id, OutcomeProposed)
+		case !ok:
+			pre.set(id, OutcomeNoProposal)
+		case pp.Digest != digest:
+			pre.set(id, OutcomeConflicting)
+		default:
+			pre.set(id, OutcomeReceived)
 		}
+	}
+	s.recordPhase(pre)
+	prep = newPhaseLog(node.PhasePrepare, s.clock.Elapsed())
+
+	// PREPARE: 收到 PRE-PREPARE 的活跃节点并发签名
+	var wg sync.WaitGroup // 等待组，用于并发收集签名
+	var mu sync.Mutex     // 互斥锁，保护共享切片
+	type pendingVote struct {
+		signedVote
+		digest string
+		delay  time.Duration
+	}
+	prepared := make([]pendingVote, 0, s.n)
+
+	for _, id := range activeIDs { // 遍历所有活跃节点
+		pp, ok := got[id]
+		if ok && !s.votes(id) {
+			prep.set(id, OutcomeNotInCommittee)
+		}
+		if !ok || !s.votes(id) {
+			continue // PRE-PREPARE 未送达，或不在验证委员会中（【高亮-2026-10-16】分层路由）
+		}
+		nd := byID[id]
 
 		// 计算距离 d 并生成本地报价
-		d := calculateNodeDistance(nd.ID, leader.ID)
-		quote := 15.0 + rand.Float64()*10.0 // 模拟节点的卖方报价
+		d := s.grid.Distance(nd.ID, leader.ID)
+		quote := 15.0 + nd.RandFloat()*10.0 // 模拟节点的卖方报价（节点按轮固定的随机源，保证可复现）
 		neighbors = append(neighbors, Neighbor{ID: nd.ID, D: d, Quote: quote})
 
 		wg.Add(1) // 增加等待计数
 
-		go func(node *node.Node, distance float64) { // 并发签名以模拟真实网��的并行性
+		go func(nd *node.Node, distance float64, pp node.Message) { // 并发签名以模拟真实网络的并行性
 			defer wg.Done() // 完成时通知等待组
 
 			// 基于 KNN 距离的 Reject 逻辑
 			rejectProb := distance * 0.004 // 假设最大距离100时，有40%概率拒绝交易
-			if rand.Float64() < rejectProb {
+			if nd.RandFloat() < rejectProb {
+				mu.Lock()
+				prep.set(nd.ID, OutcomeDistanceReject)
+				mu.Unlock()
 				return // 模拟节点投 reject，直接返回不签名
 			}
 
-			sig, err := node.Sign(request) // 节点对请求进行签名
-			if err == nil && sig != nil {  // 如果签名成功
-				mu.Lock()                                   // 保护共享切片
-				signatures = append(signatures, sig)        // 添加签名
-				pubKeys = append(pubKeys, node.PublicKey()) // 添加对应公钥
-				signedIDs = append(signedIDs, node.ID)
+			// 对收到的提案签名（若 leader equivocate，签的是冲突摘要）；签名耗时经网络层计入仿真时间
+			msg := request
+			if pp.Digest != digest {
+				msg = []byte(pp.Digest)
+			}
+			step := stepFor(node.PhasePrepare, pp.Digest)
+			sig, delay, err := nd.SignStep(step, msg)
+			if err == nil && sig != nil { // 如果签名成功
+				voted := pp.Digest
+				if act := nd.Decide(step); act.Kind == node.ActEquivocate {
+					voted = act.Digest
+				}
+				mu.Lock() // 保护共享切片
+				prepared = append(prepared, pendingVote{signedVote{id: nd.ID, sig: sig}, voted, delay})
 				mu.Unlock() // 解锁
+			} else {
+				mu.Lock()
+				prep.set(nd.ID, OutcomeMaliciousRefusal)
+				mu.Unlock()
 			}
-		}(nd, d) // 传入节点和距离
+		}(nd, d, pp) // 传入节点、距离和收到的提案
 	}
 	wg.Wait() // 等待所有并发签名完成
 
-	// leader 聚合
-	aggSig, _ := leader.AggregateSignatures(signatures) // 需要 node.Node 提供 AggregateSignatures()
-
-	// leader 验证聚合签名
-	ok, _ := leader.VerifyAggregate(pubKeys, request, aggSig) // 需要 node.Node 提供 VerifyAggregate()
-	if !ok {                                                  // 如果验证失败
-		leader.UpdateReward(false) // 更新 leader 奖励为失败
+	// 签名按节点 ID 排序后再发送，保证网络随机序列可复现
+	sort.Slice(prepared, func(i, j int) bool { return prepared[i].id < prepared[j].id })
+	for _, v := range prepared {
+		nw.SendAfter(node.Message{Type: node.MsgPrepare, From: v.id, To: leader.ID, Round: round, Seq: 1, Digest: v.digest, Size: node.DefaultMessageSize + len(v.sig), Payload: v.signedVote}, v.delay)
+	}
+	nw.RunFor(phaseTimeout)
+
+	// leader 聚合并验证；失败时定位坏签名者并剔除后重新聚合
+	aggSig, prepareVotes, culprits, ok := aggregateVotes(leader, prepareVotes, request)
+	s.compute(leader.ID, aggregationCost(len(prepareVotes.ids)+len(culprits), len(culprits) > 0)) // 【高亮-2026-10-16】聚合耗时占用 leader 的 CPU
+	s.addCulprits(node.PhasePrepare, culprits)
+	for _, v := range prepared {
+		prep.set(v.id, sentOutcome(prep, v.id, v.digest != digest))
+	}
+	for _, id := range culprits {
+		prep.set(id, OutcomeBadSignature)
+	}
+	s.recordPhase(prep)
+	if len(culprits) > 0 {
+		fmt.Printf("Leader %d excluded bad prepare signatures from %v\n", leader.ID, culprits)
+	}
+	if !ok { // 剔除后仍无有效签名
+		s.penalizeLeader(leader, node.PhasePrepare, round) // 更新 leader 奖励为失败
+		s.settleRewards(round, false, nil)
+		fail("no valid prepare signatures", nil, nil)
 		// ======================= 【修复报错点】补充返回值 0 =======================
 		return false, 0
 	}
-
-	// COMMIT: 节点对聚合签名再次签名（模拟）
-	commitSigs := make([][]byte, 0)    // 收集 commit 阶段的签名
-	commitPubKeys := make([][]byte, 0) // 收集 commit 阶段的公钥
-	for _, nd := range s.nodes {       // 遍历所有节点
-		if !nd.IsActive() { // 跳过非活跃节点
-			continue
+	signedIDs := prepareVotes.ids // 用于记录参与节点
+	s.trace.PrepareAggSig = aggSig
+
+	// COMMIT: leader 广播聚合签名，收到的节点对 commit 消息签名后发回
+	// 【高亮-2026-10-16】修改：COMMIT 签名覆盖 (序号, view, 摘要)，提交后可作为法定人数证书离线验证（见 qc.go）
+	commitMsg := commitMessage(round, s.view, digest)
+	// 【高亮-2026-10-16】有验证委员会时只发给委员会成员，其余副本在最后收到提交证书
+	voters := activeIDs
+	if s.committee != nil {
+		voters = make([]int, 0, len(s.committee))
+		for _, id := range activeIDs {
+			if s.votes(id) {
+				voters = append(voters, id)
+			}
 		}
-		sig, err := nd.Sign(aggSig) // 节点对聚合签名再签一次，作为 commit 的签名（模拟）
+	}
+	got = make(map[int]node.Message, s.n)
+	com = newPhaseLog(node.PhaseCommit, s.clock.Elapsed())
+	nw.Broadcast(node.Message{Type: node.MsgCommit, From: leader.ID, Round: round, Seq: 1, Digest: digest, Size: node.DefaultMessageSize + len(aggSig), Payload: aggSig}, voters)
+	nw.RunFor(phaseTimeout)
+
+	var commitVotes voteSet // 收集 commit 阶段的签名与公钥
+	commitSeen := make(map[int]bool, s.n)
+	nw.Register(leader.ID, func(msg node.Message) {
+		vote, isVote := msg.Payload.(signedVote)
+		if msg.Type != node.MsgCommit || !isVote || commitSeen[msg.From] || msg.Digest != digest || !s.votes(msg.From) {
+			return
+		}
+		pk, known := s.registry.PublicKey(msg.From)
+		if !known {
+			return
+		}
+		commitSeen[msg.From] = true
+		com.arrived(msg.From, s.clock.Elapsed())
+		s.sampling.votes++
+		commitVotes.add(msg.From, pk, vote.sig)
+	})
+	commitSent := make(map[int]string, len(voters)) // 已发出 COMMIT 的节点 -> 所签摘要
+	for _, id := range voters { // 遍历所有节点
+		if _, ok := got[id]; !ok {
+			com.set(id, OutcomeNoProposal)
+			continue // 聚合签名未送达
+		}
+		// 【高亮-2026-10-16】收到聚合签名即持有本 view 的 prepared 证书（视图转换时携带）
+		s.prepared[id] = PreparedCert{View: s.view, Digest: digest, AggSig: aggSig, Signers: append([]int(nil), signedIDs...)}
+		s.logPrepare(id, round, s.prepared[id])
+		nd := byID[id]
+		step := stepFor(node.PhaseCommit, digest)
+		sig, delay, err := nd.SignStep(step, commitMsg) // 节点对 commit 消息签名
 		if err == nil && sig != nil { // 如果签名成功
-			commitSigs = append(commitSigs, sig) // 收集 commit 签名
-			commitPubKeys = append(commitPubKeys, nd.PublicKey()) // 收集公钥
+			voted := digest
+			if act := nd.Decide(step); act.Kind == node.ActEquivocate {
+				voted = act.Digest
+			}
+			nw.SendAfter(node.Message{Type: node.MsgCommit, From: id, To: leader.ID, Round: round, Seq: 1, Digest: voted, Size: node.DefaultMessageSize + len(sig), Payload: signedVote{id: id, sig: sig}}, delay)
+			commitSent[id] = voted
+		} else {
+			com.set(id, OutcomeMaliciousRefusal)
 		}
 	}
-
-	aggCommitSig, _ := leader.AggregateSignatures(commitSigs)           // leader 聚合 commit 签名
-	ok2, _ := leader.VerifyAggregate(commitPubKeys, aggSig, aggCommitSig) // 验证聚合的 commit 签名（以 aggSig 作为消息）
-	if !ok2 {                                                            // 如果 commit 阶段验证失败
-		fmt.Println("Aggregate verification failed in commit phase") // 打印错误信息
-		leader.UpdateReward(false)                                   // 更新奖励为失败
+	nw.RunFor(phaseTimeout)
+
+	// leader 聚合 commit 签名并验证，同样剔除坏签名（【高亮-2026-10-16】按签名者 ID 升序聚合，与 QC 位图的顺序一致）
+	commitAgg, commitVotes, culprits, ok2 := aggregateVotes(leader, commitVotes.byID(), commitMsg)
+	s.compute(leader.ID, aggregationCost(len(commitVotes.ids)+len(culprits), len(culprits) > 0))
+	s.addCulprits(node.PhaseCommit, culprits)
+	if len(culprits) > 0 {
+		fmt.Printf("Leader %d excluded bad commit signatures from %v\n", leader.ID, culprits)
+	}
+	for id, voted := range commitSent {
+		com.set(id, sentOutcome(com, id, voted != digest))
+	}
+	for _, id := range culprits {
+		com.set(id, OutcomeBadSignature)
+	}
+	s.recordPhase(com)
+	if !ok2 { // 如果 commit 阶段验证失败
+		fmt.Println("Aggregate verification failed in commit phase")                                     // 打印错误信息
+		s.penalizeLeader(leader, node.PhaseCommit, round) // 更新奖励为失败
+		s.settleRewards(round, false, nil)
+		fail("no valid commit signatures", signedIDs, nil)
 		// ======================= 【修复报错点】补充返回值 0 =======================
 		return false, 0
 	}
+	commitIDs := commitVotes.ids
+	s.trace.CommitAggSig = commitAgg
 
 	// 判断阈值
-	quorum := int(float64(s.n) * PrepareQuorumMultiplier)
-	if len(commitSigs) >= quorum { // 如果 commit 签名数达到阈值
-		fmt.Println("Consensus achieved in this round") // 打印达成共识
-
-		successIDs := map[int]bool{}       // 创建映射以记录哪些节点参与了成功的 commit
-		for _, pk := range commitPubKeys { // 遍历 commit 的公钥切片
-			var id int
-			fmt.Sscanf(string(pk), "PK-node-%02d", &id) // 通过格式化字符串解析出节点 ID（这里是模拟）
-			successIDs[id] = true                       // 标记该 id 为成功参与者
+	// 【高亮-2026-10-16】修改：提交阈值按验证委员会大小计算；提交证书仍须送达全体副本中的法定数量
+	quorum := int(float64(s.committeeSize()) * PrepareQuorumMultiplier)
+	replicaQuorum := int(float64(s.n) * PrepareQuorumMultiplier)
+	if len(commitIDs) >= quorum { // 如果 commit 签名数达到阈值
+		// 【高亮-2026-10-16】新增：提交证书须送达法定数量的副本才算提交，否则副本计时器到期、转入视图转换
+		cert := CommitCert{Seq: round, Prepared: PreparedCert{View: s.view, Digest: digest, AggSig: aggSig, Signers: append([]int(nil), signedIDs...)}, AggSig: commitAgg, Signers: append([]int(nil), commitIDs...)}
+		if delivered := s.disseminateCommit(nw, leader, activeIDs, got, stepFor, cert); delivered < replicaQuorum {
+			fmt.Printf("Leader %d delivered the commit certificate to only %d replicas (quorum %d); consensus failed\n", leader.ID, delivered, replicaQuorum)
+			s.penalizeLeader(leader, node.PhaseCommit, round)
+			s.settleRewards(round, false, commitIDs)
+			fail(fmt.Sprintf("commit certificate reached %d replicas (quorum %d)", delivered, replicaQuorum), signedIDs, commitIDs)
+			return false, 0
 		}
-		for _, nd := range s.nodes { // 遍历所有节点以更新奖励/惩罚
-			if successIDs[nd.ID] { // 如果该节点在成功列表中
-				nd.UpdateReward(true) // 更新奖励为成功
-			} else {
-				nd.UpdateReward(false) // 否则视为未参与或失败
-			}
+		fmt.Println("Consensus achieved in this round") // 打印达成共识
+		if len(commitIDs) >= ByzantineQuorum(s.n) { // 审计方按全体成员数验证 QC（委员会无法离线重算）
+			s.qc = cert.quorumCertificate(s.n)
 		}
 
+		// 【高亮-2026-10-16】修改：按 commit 参与者与坏签名者结算，不再对全体节点一视同仁
+		s.settleRewards(round, true, commitIDs)
+
 		if s.AfterConsensusHandler != nil {
 			s.AfterConsensusHandler(round)
 		}
 
-		// 【KNN 定价核心逻辑】
-		// 按距离 d 对所有参与的邻居节点进行升序排序，提取最近的 K 个邻居
-		sort.Slice(neighbors, func(i, j int) bool {
-			return neighbors[i].D < neighbors[j].D
-		})
-
-		knnCount := K
-		if len(neighbors) < K {
-			knnCount = len(neighbors)
-		}
-
-		sumQuote := 0.0
-		sumDistance := 0.0
-		for i := 0; i < knnCount; i++ {
-			sumQuote += neighbors[i].Quote
-			sumDistance += neighbors[i].D
+		// 【高亮-2026-10-16】修改：成交价由配置的定价策略给出（原 KNN 常数见 DefaultPricingConfig）
+		finalPrice, priced, _ := s.pricing.Price(neighbors, s.amount)
+		pricedIDs := make([]int, len(priced))
+		for i, q := range priced {
+			pricedIDs[i] = q.ID
 		}
-
-		avgQuote := sumQuote / float64(knnCount)       // 最近 K 个卖方的平均报价
-		avgDistance := sumDistance / float64(knnCount) // 最近 K 个节点的平均距离（KNN距离）
-
-		// 最终撮合价格 = 基础电价 + K邻近平均报价 + KNN平均距离 * 线损系数
-		finalPrice := basePrice + avgQuote + (avgDistance * lineLossCoeff)
+		s.recordView(leader, true, "", signedIDs, commitIDs)
+		s.trace.Neighbors = priced
 
 		// 【控制台输出】
 		fmt.Printf("\n>>>>>> [APBFT 共识达成 | 轮次 %d] <<<<<<\n", round)
 		fmt.Printf("├─ 主节点信息: ID=%d | 信誉值(m)=%.d | 层级(Tier)=%d | 吞吐量=%.2f\n",
 			leader.ID, leader.M(), leader.Tier, leader.Throughput)
-		fmt.Printf("├─ KNN 定价: 基础价=%.2f | K邻近均报价=%.2f | KNN均距=%.2f\n", basePrice, avgQuote, avgDistance)
+		fmt.Printf("├─ 定价策略: %s | 定价报价节点=%v\n", s.Pricing(), pricedIDs)
 		fmt.Printf("├─ 共识详情: 最终成交价=%.2f | 参与度=%d/%d (法定人数:%d)\n",
-			finalPrice, len(signatures), s.n, quorum)
+			finalPrice, len(signedIDs), s.committeeSize(), quorum)
 		fmt.Printf("└─ 参与节点列表: %v\n", signedIDs)
 
-		for _, nd := range s.nodes {
-			nd.UpdateReward(true)
-		}
 		return true, finalPrice // 返回共识成功及最终价格
 	} else {
 		fmt.Println("Not enough commit signatures; consensus failed") // 未达到阈值，打印失败信息
-		for _, nd := range s.nodes {                                  // 对所有节点应用失败的奖励更新
-			nd.UpdateReward(false)
-		}
+		s.settleRewards(round, false, commitIDs)                      // 未提交 COMMIT 的节点与坏签名者受罚
+		fail(fmt.Sprintf("%d commit signatures (quorum %d)", len(commitIDs), quorum), signedIDs, commitIDs)
 		// ======================= 【修复报错点】补充返回值 0 =======================
 		return false, 0
 	}
 }
 
 func RunAPBFTWithRoundAndSpecs(round int, txId string, amount int, specs []node.NodeSpec) PBFTResult {
+	return RunAPBFTWithConfig(round, txId, amount, specs, DefaultConfig())
+}
+
+// RunAPBFTWithConfig 与 RunAPBFTWithRoundAndSpecs 相同，但信誉模型等参数来自 cfg
+// 【高亮-2026-10-16】新增
+func RunAPBFTWithConfig(round int, txId string, amount int, specs []node.NodeSpec, cfg Config) PBFTResult {
 	useBlst := true
 
 	// ========== 构建节点池：把 isMal 写入节点 ==========
 	nodes := make([]*node.Node, 0, len(specs))
 	for _, sp := range specs {
 		nd := node.NewNode(sp.ID, sp.Throughput, sp.IsMalicious, useBlst)
+		nd.SetOnline(sp.Active) // 【高亮-2026-10-16】节点流失：宕机节点不参与本轮
 		nodes = append(nodes, nd)
 	}
+	node.ApplyBehaviors(nodes, specs) // 【高亮-2026-10-16】场景中按节点配置的拜占庭行为
 
 	sim := NewPBFTSimulator(nodes, true)
+	if err := sim.ApplyConfig(cfg); err != nil {
+		return PBFTResult{TxId: txId, Status: "失败", Consensus: "pbft", BlockHeight: round, Timestamp: time.Now(), FailedReason: err.Error()}
+	}
 	sim.ComputeTiers()
+	sim.amount = amount // 【高亮-2026-10-16】交易电量（统一价格拍卖按它确定边际卖方）
 
 	// 【主节点轮换算法逻辑】
-	var finalLeader *node.Node
-	var success bool
-	var finalPrice float64   // 接收 KNN 计算的新价格
-	viewOffset := 0
-	maxViewChange := 5 // 最多允许轮换 5 个备份节点
-
-	for viewOffset < maxViewChange {
-		leader := sim.SelectLeader(round, viewOffset)
-		if leader == nil {
-			break
-		}
-
-		if leader.IsMalicious || leader.M() <= node.MMin {
-			fmt.Printf("[View Change] 轮次 %d: 节点 %d (m=%.d, Malicious=%v) 不可信，触发视图转换...\n", round, leader.ID, leader.M(), leader.IsMalicious)
-			viewOffset++
-			continue
-		}
+	// 【高亮-2026-10-16】修改：不再读取 leader.IsMalicious 跳过坏主节点，改为超时驱动的 VIEW-CHANGE / NEW-VIEW
+	success, finalPrice, finalLeader, finalView := sim.RunRoundWithViewChange(round, []byte(txId))
 
-		finalLeader = leader
-		// 接收成功状态和基于 KNN 计算的定价
-		success, finalPrice = sim.RunRoundWithLeader(round, []byte(txId), leader)
-		break
-	}
+	return sim.result(round, txId, success, finalPrice, finalLeader, finalView)
+}
 
+// result 把一次请求的共识结果整理为 PBFTResult（失败时回退为按轮次可复现的默认价格）
+// 【高亮-2026-10-16】新增：RunAPBFTWithConfig 与 Cluster.Submit 共用
+func (s *PBFTSimulator) result(round int, txId string, success bool, finalPrice float64, finalLeader *node.Node, finalView int) PBFTResult {
 	status := "已确认"
 	reason := ""
 	if !success {
@@ -362,10 +842,18 @@ func RunAPBFTWithRoundAndSpecs(round int, txId string, amount int, specs []node.
 		finalPrice = 45 + rngObj.Float64()*15
 	}
 
+	var qc *QuorumCertificate
+	if success {
+		qc = s.qc
+	}
 	leaderNodeName := "None"
 	if finalLeader != nil {
 		leaderNodeName = finalLeader.String()
 	}
+	culprits := []string{}
+	for _, id := range s.Culprits() {
+		culprits = append(culprits, fmt.Sprintf("node-%d", id))
+	}
 
 	return PBFTResult{
 		TxId:         txId,
@@ -373,10 +861,17 @@ func RunAPBFTWithRoundAndSpecs(round int, txId string, amount int, specs []node.
 		Consensus:    "pbft",
 		BlockHeight:  round,
 		Timestamp:    time.Now(),
-		Validators:   nil,
+		Validators:   s.Validators(), // 【高亮-2026-10-16】修改：各节点的逐阶段记录
 		FailedReason: reason,
 		Price:        finalPrice,
 		LeaderNode:   leaderNodeName,
+		Culprits:     culprits,
+		LatencyMs:    node.DurationMs(s.LastLatency()),
+		View:         finalView,
+		Pricing:      s.Pricing(),
+		Transcript:   s.Transcript(),
+		QC:           qc,
+		Market:       s.Market(),
 	}
 }
 
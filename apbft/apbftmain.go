@@ -12,7 +12,9 @@ import (
 
 // ====== 高亮：支持自定义节点和恶性节点数量 ======
 //======“共享同一批 specs”（恶意集合/吞吐量等输入一致），这就是 main.go 里 simulateCUSTOM 的做法============
-func RunPBFTSimulator(numNodes int, maliciousCount int, maliciousRatio float64, totalRounds int) {
+// 【高亮-2026-10-16】修改：节点数/恶意率/分布/放置策略统一由 node.PoolConfig 描述（可来自场景文件）
+// 【高亮-2026-10-16】修改：信誉模型等 APBFT 参数由 cfg 指定
+func RunPBFTSimulator(poolCfg node.PoolConfig, cfg Config, totalRounds int) {
 	var csvWriter *csv.Writer
 
 	tradeLogger, err := NewTradeLog("trade.log")
@@ -21,34 +23,55 @@ func RunPBFTSimulator(numNodes int, maliciousCount int, maliciousRatio float64,
 		return
 	}
 	defer tradeLogger.Close()
-	ob := NewOrderBook()
 
 	useBlst := false
 	rand.Seed(time.Now().UnixNano())
 
-	// ======================= 【高亮-2026-03-08】Fix：nodepool.go 内部会强制固定节点数/恶意率；这里对齐 simulateCUSTOM 的写法 =======================
-    _ = maliciousCount
-    maliciousRatio = node.FixedMaliciousRatio
-    numNodes = node.FixedNumNodes
-
     // ======================= 【高亮-2026-03-08】Fix：初始化一次 specs（共用节点池规格），并实例化为 node.Node；节点在 sim 中跨轮演化 =======================
-    specs := node.NewPool(0, numNodes, maliciousRatio)
+    // 【高亮-2026-10-16】修改：节点池由流失过程逐轮给出（poolCfg.Churn 为空时与 NewPoolFromConfig 相同）
+    churn := node.NewChurn(poolCfg)
+    specs := churn.Pool(0)
 	nodes := make([]*node.Node, 0, len(specs))
 	for _, sp := range specs {
 		nd := node.NewNode(sp.ID, sp.Throughput, sp.IsMalicious, useBlst)
+		nd.SetOnline(sp.Active)
 		nodes = append(nodes, nd)
 	}
+	node.ApplyBehaviors(nodes, specs) // 【高亮-2026-10-16】场景中按节点配置的拜占庭行为
 
 	sim := NewPBFTSimulator(nodes, useBlst)
+	if err := sim.ApplyConfig(cfg); err != nil {
+		fmt.Println("Invalid apbft config:", err)
+		return
+	}
 	sim.ComputeTiers()
+	// 【高亮-2026-10-16】持久化密钥：导出公钥清单供其它节点 / 轻客户端验签
+	exportManifest := func() {
+		if sim.keys != nil {
+			ksCfg := node.KeystoreConfig{Dir: sim.keys.Dir()}
+			if cfg.Keystore != nil {
+				ksCfg = *cfg.Keystore
+			}
+			if err := sim.keys.ExportManifest(ksCfg.ManifestPath()); err != nil {
+				fmt.Println("Failed to export key manifest:", err)
+			}
+		}
+	}
+	exportManifest()
 
 	fmt.Println("Initial node statuses:")
 	for _, nd := range sim.nodes {
 		fmt.Println(nd.String())
 	}
-	ob = NewOrderBook()
 
+	roundInterval := time.Duration(RoundIntervalMs) * time.Millisecond
+	var totalLatency time.Duration
+	succeeded := 0
 	for r := 0; r < totalRounds; r++ {
+		// 【高亮-2026-10-16】节点流失：宕机/恢复/加入/离开后重建分层
+		if joined, left := sim.ApplyMembership(churn.Pool(r)); len(joined)+len(left) > 0 {
+			fmt.Printf("Round %d membership change: joined %v, left %v (n=%d)\n", r, joined, left, len(sim.nodes))
+		}
 		if r%5 == 0 && r > 0 {
 			for _, nd := range sim.nodes {
 				nd.Throughput = nd.Throughput * (0.9 + rand.Float64()*0.2)
@@ -59,10 +82,32 @@ func RunPBFTSimulator(numNodes int, maliciousCount int, maliciousRatio float64,
 				fmt.Println(nd.String())
 			}
 		}
-		request := []byte(fmt.Sprintf("request-%d", r))
+		// 【高亮-2026-10-16】修改：本轮订单作为请求参与共识，由各副本在自己的订单簿上执行（见 market.go），
+		// 不再在仿真进程里于共识之后单独撮合
+		// ======================= 【修改四：降低固定机器人的挂单价格】 =======================
+		orders := []OrderRequest{
+			{Type: Buy, Price: 50 + rand.Float64()*15, Quantity: 10 + rand.Float64()*3, User: "Alice"}, // 50~65 元买
+			{Type: Sell, Price: 45 + rand.Float64()*15, Quantity: 5 + rand.Float64()*6, User: "Bob"},    // 45~60 元卖
+			{Type: Buy, Price: 48 + rand.Float64()*10, Quantity: 4 + rand.Float64()*2, User: "Carol"},   // 48~58 元买
+			{Type: Sell, Price: 52 + rand.Float64()*10, Quantity: 8 + rand.Float64()*5, User: "David"},  // 52~62 元卖
+		}
+		numOrders := 5
+		for i := 0; i < numOrders; i++ {
+			// ======================= 【修改五：降低随机散户的挂单价格】 =======================
+			if i%2 == 0 {
+				orders = append(orders, OrderRequest{Type: Buy, Price: 40 + rand.Float64()*30, Quantity: 5 + rand.Float64()*10, User: fmt.Sprintf("User_%d", i)}) // 40~70 买
+			} else {
+				orders = append(orders, OrderRequest{Type: Sell, Price: 35 + rand.Float64()*30, Quantity: 3 + rand.Float64()*9, User: fmt.Sprintf("User_%d", i)}) // 35~65 卖
+			}
+		}
+		request := EncodeClearing(sim.Clock().Now(), orders) // 每轮的订单批次结束该轮：集合竞价模式下执行完即按轮出清
 		ok := sim.RunRound(r, request)
+		totalLatency += sim.LastLatency()
+		if ok {
+			succeeded++
+		}
 		if !ok {
-			fmt.Printf("Round %d failed\n", r)
+			fmt.Printf("Round %d failed (%.2f simulated ms)\n", r, node.DurationMs(sim.LastLatency()))
 		}
         // ======================= 【高亮-2026-03-11】关键修改：共识失败则不撮合（不提交订单/不MatchAndClear） =======================
     	if !ok {
@@ -71,22 +116,21 @@ func RunPBFTSimulator(numNodes int, maliciousCount int, maliciousRatio float64,
     		if csvWriter != nil {
     			csvWriter.Flush()
     		}
-            time.Sleep(200 * time.Millisecond)
+            sim.Clock().Sleep(roundInterval) // 【高亮-2026-10-16】轮间隔只推进虚拟时间
     		continue
     	}
         // ======================= 【高亮-2026-03-11】关键修改结束 =======================
 
-		// ======================= 【修改四：降低固定机器人的挂单价格】 =======================
-        ob.SubmitOrder(Buy, 50+rand.Float64()*15, 10+rand.Float64()*3, "Alice")   // 50~65 元买
-		ob.SubmitOrder(Sell, 45+rand.Float64()*15, 5+rand.Float64()*6, "Bob")     // 45~60 元卖
-		ob.SubmitOrder(Buy, 48+rand.Float64()*10, 4+rand.Float64()*2, "Carol")    // 48~58 元买
-		ob.SubmitOrder(Sell, 52+rand.Float64()*10, 8+rand.Float64()*5, "David")   // 52~62 元卖
-		trades := ob.MatchAndClear()
-
+		var trades []Trade
+		if market := sim.Market(); market != nil {
+			trades = market.Trades // f+1 个以上副本一致的订单簿状态下的成交
+		}
 		for _, t := range trades {
 			tradeLogger.LogTrade(t)
 		}
-		tradeLogger.LogSingleOrderBook(0, ob)
+		if book, found := sim.ReplicaOrderBook(0); found {
+			tradeLogger.LogSingleOrderBook(0, book)
+		}
 
 		// ===== 写同步共识结果 =====
 		saveConsensusResult(r, sim, "/tmp/pbft_result.json")
@@ -95,16 +139,6 @@ func RunPBFTSimulator(numNodes int, maliciousCount int, maliciousRatio float64,
 			csvWriter.Flush()
 		}
 
-		numOrders := 5
-		for i := 0; i < numOrders; i++ {
-			// ======================= 【修改五：降低随机散户的挂单价格】 =======================
-			if i%2 == 0 {
-				ob.SubmitOrder(Buy, 40+rand.Float64()*30, 5+rand.Float64()*10, fmt.Sprintf("User_%d", i)) // 40~70 买
-			} else {
-				ob.SubmitOrder(Sell, 35+rand.Float64()*30, 3+rand.Float64()*9, fmt.Sprintf("User_%d", i)) // 35~65 卖
-			}
-		}
-		trades = ob.MatchAndClear()
 		if len(trades) > 0 {
 			fmt.Printf("Round %d matched trades:\n", r)
 			for _, t := range trades {
@@ -112,8 +146,39 @@ func RunPBFTSimulator(numNodes int, maliciousCount int, maliciousRatio float64,
 					t.BuyOrderID, t.SellOrderID, t.Price, t.Quantity)
 			}
 		}
-		time.Sleep(200 * time.Millisecond)
+		sim.Clock().Sleep(roundInterval)
 	}
+	fmt.Printf("Simulated %d rounds in %.1f simulated ms (avg consensus latency %.2f ms)\n",
+		totalRounds, node.DurationMs(sim.Clock().Elapsed()), node.DurationMs(totalLatency)/float64(max(totalRounds, 1)))
+	exportManifest() // 包含运行中加入的节点
+	st := churn.Stats()
+	fmt.Printf("Availability: consensus %d/%d rounds, nodes online %.1f%% (crashes %d, joins %d, leaves %d)\n",
+		succeeded, totalRounds, st.Availability()*100, st.Crashes, st.Joins, st.Leaves)
+	// 【高亮-2026-10-16】检查点与日志回收概况
+	cp := sim.StableCheckpoint()
+	logged, lagging, fetches := 0, 0, 0
+	for _, nd := range sim.nodes {
+		if rs, ok := sim.Replica(nd.ID); ok {
+			logged += rs.LogEntries
+			fetches += rs.Fetches
+			if rs.Executed < cp.Seq {
+				lagging++
+			}
+		}
+	}
+	fmt.Printf("Stable checkpoint: seq %d (%d signers), retained log entries %d, lagging replicas %d, state fetches %d\n",
+		cp.Seq, len(cp.Signers), logged, lagging, fetches)
+	// 【高亮-2026-10-16】主节点按层级的分布（需求类别由 cfg.Routing.Demand 指定）
+	for _, line := range FormatLeaderTiers(sim.LeaderTiers()) {
+		fmt.Println(line)
+	}
+	fmt.Println(sim.CommitteeStats()) // 【高亮-2026-10-16】委员会失败概率与每次三阶段流程的消息量
+	// 【高亮-2026-10-16】副本订单簿的分歧：执行后状态哈希与 f+1 个副本一致的状态不符
+	divergent := make(map[int]int)
+	for _, d := range sim.MarketDivergences() {
+		divergent[d.Node]++
+	}
+	fmt.Printf("Market divergence: %d replica executions on %d replicas\n", len(sim.MarketDivergences()), len(divergent))
 }
 
 func saveConsensusResult(round int, sim *PBFTSimulator, filename string) {
@@ -123,17 +188,11 @@ func saveConsensusResult(round int, sim *PBFTSimulator, filename string) {
 		"Consensus":    "pbft",
 		"BlockHeight":  round,
 		"Timestamp":    time.Now(),
-		"Validators":   []map[string]interface{}{},
+		"Validators":   sim.Validators(), // 【高亮-2026-10-16】修改：各节点的逐阶段记录，不再一律记为 commit
+		"Transcript":   sim.Transcript(),
+		"Market":       sim.Market(), // 【高亮-2026-10-16】订单批次在各副本上的执行结果
 		"FailedReason": "",
 	}
-	for _, nd := range sim.nodes {
-		if nd.IsActive() {
-			result["Validators"] = append(result["Validators"].([]map[string]interface{}), map[string]interface{}{
-				"ID":   fmt.Sprintf("node%d", nd.ID),
-				"Vote": "commit",
-			})
-		}
-	}
 	data, _ := json.Marshal(result)
 	_ = os.WriteFile(filename, data, 0644)
 }
\ No newline at end of file
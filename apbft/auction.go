@@ -0,0 +1,306 @@
+package apbft
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ======================= 【高亮-2026-10-16】新增：统一价格集合竞价出清 =======================
+// MatchAndClear 原先逐对撮合，每对按 (买价+卖价)/2 定价，同一次出清中的成交价格各不相同。
+// 集合竞价模式（UniformClearing）下订单到达时只挂单，MatchAndClear 时：
+// - 以全部挂单价格为候选价，构造累计需求曲线（报价不低于该价的买单总量）与累计供给曲线（报价不高于该价的卖单总量）；
+// - 出清价取成交量 min(需求, 供给) 最大的价格；并列时取供需差最小的价格；仍并列时取这些价格区间的中点；
+// - 价格优于出清价边际档位的挂单全部成交，边际档位（成交量在此用尽）内的挂单按数量比例分配，以整单位成交：
+//   先分比例份额的整数部分，余下的单位按小数部分从大到小（相同时按时间优先）逐个分配，整数挂单不会产生零碎成交；
+// - 买卖成交量按价格优先顺序配对，生成与逐对撮合相同的 Trade 记录，全部以出清价成交。
+// 适合按轮次周期出清的本地电力市场；集合竞价只接受 GTC 限价单（不含只挂单与最小成交量）。
+// 副本上订单批次只挂单，出清只在轮次边界进行：经共识排序的出清请求（EncodeClearing / Cluster.ClearMarket）
+// 让各副本在同一位置出清，一轮内到达的订单共同构成该轮的供需曲线。
+
+// auctionDust 按比例分配的浮点误差：低于它的成交量不成交、剩余量视为成交完毕
+const auctionDust = 1e-9
+
+// ClearingMode 订单簿的出清方式
+type ClearingMode string
+
+const (
+	PairwiseClearing ClearingMode = "pairwise" // 连续撮合：到达即成交，逐对按报价平均定价（默认）
+	UniformClearing  ClearingMode = "uniform"  // 集合竞价：到达只挂单，出清时统一价格成交
+)
+
+// ParseClearingMode 解析出清方式（为空时为 pairwise）
+func ParseClearingMode(s string) (ClearingMode, error) {
+	switch ClearingMode(strings.ToLower(s)) {
+	case "", PairwiseClearing:
+		return PairwiseClearing, nil
+	case UniformClearing:
+		return UniformClearing, nil
+	}
+	return "", fmt.Errorf("clearing: unknown mode %q (pairwise / uniform)", s)
+}
+
+// SetClearingMode 切换出清方式；切换为连续撮合时已交叉的挂单在下次 MatchAndClear 时逐对成交
+func (ob *OrderBook) SetClearingMode(mode ClearingMode) error {
+	mode, err := ParseClearingMode(string(mode))
+	if err != nil {
+		return err
+	}
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.clearing = mode
+	return nil
+}
+
+// ClearingMode 当前的出清方式
+func (ob *OrderBook) ClearingMode() ClearingMode {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.clearing == "" {
+		return PairwiseClearing
+	}
+	return ob.clearing
+}
+
+// SetClearing 设置副本订单簿的出清方式（已有副本的订单簿立即切换，各副本一致）
+func (s *PBFTSimulator) SetClearing(mode ClearingMode) error {
+	mode, err := ParseClearingMode(string(mode))
+	if err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	s.clearing = mode
+	for _, r := range s.replicas {
+		r.ownBook().SetClearingMode(mode)
+	}
+	return nil
+}
+
+// newReplicaBook 按当前出清方式新建副本订单簿
+func (s *PBFTSimulator) newReplicaBook() *OrderBook {
+	ob := NewReplicatedOrderBook()
+	ob.clearing = s.clearing
+	return ob
+}
+
+// CurvePoint 候选价格上的累计需求与供给
+type CurvePoint struct {
+	Price  float64 `json:"price"`
+	Demand float64 `json:"demand"` // 报价不低于 Price 的买单总量
+	Supply float64 `json:"supply"` // 报价不高于 Price 的卖单总量
+}
+
+// AuctionResult 集合竞价的出清结果
+type AuctionResult struct {
+	Price  float64 `json:"price"`
+	Volume float64 `json:"volume"` // 成交量 min(Demand, Supply)
+	Demand float64 `json:"demand"`
+	Supply float64 `json:"supply"`
+}
+
+// Curves 以全部挂单价格为候选价（升序）的供需曲线
+func (ob *OrderBook) Curves() []CurvePoint {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.curves()
+}
+
+// Auction 按当前挂单计算集合竞价的出清结果（不成交）；没有可成交的量时返回 false
+func (ob *OrderBook) Auction() (AuctionResult, bool) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.auction()
+}
+
+// levelQty 档位内的挂单总量
+func levelQty(l *priceLevel) float64 {
+	qty := 0.0
+	for e := l.head; e != nil; e = e.next {
+		qty += e.order.Quantity
+	}
+	return qty
+}
+
+func (ob *OrderBook) curves() []CurvePoint {
+	bids, asks := ob.bids.sortedLevels(), ob.asks.sortedLevels() // 买方价格降序，卖方价格升序
+	bidQty := make([]float64, len(bids))
+	prices := make([]float64, 0, len(bids)+len(asks))
+	for i, l := range bids {
+		bidQty[i] = levelQty(l)
+		prices = append(prices, l.price)
+	}
+	for _, l := range asks {
+		prices = append(prices, l.price)
+	}
+	sort.Float64s(prices)
+	points := make([]CurvePoint, 0, len(prices))
+	bi, ai := len(bids)-1, 0 // 买方从最低价向上，卖方从最低价向上
+	demand, supply := 0.0, 0.0
+	for _, q := range bidQty {
+		demand += q
+	}
+	for i, p := range prices {
+		if i > 0 && p == prices[i-1] {
+			continue
+		}
+		for bi >= 0 && bids[bi].price < p {
+			demand -= bidQty[bi]
+			bi--
+		}
+		for ai < len(asks) && asks[ai].price <= p {
+			supply += levelQty(asks[ai])
+			ai++
+		}
+		points = append(points, CurvePoint{Price: p, Demand: demand, Supply: supply})
+	}
+	return points
+}
+
+func (ob *OrderBook) auction() (AuctionResult, bool) {
+	points := ob.curves()
+	lo, hi := -1, -1
+	bestVol, bestGap := 0.0, 0.0
+	for i, p := range points {
+		vol, gap := math.Min(p.Demand, p.Supply), math.Abs(p.Demand-p.Supply)
+		switch {
+		case vol <= 0:
+		case lo < 0 || vol > bestVol || (vol == bestVol && gap < bestGap):
+			lo, hi, bestVol, bestGap = i, i, vol, gap
+		case vol == bestVol && gap == bestGap:
+			hi = i
+		}
+	}
+	if lo < 0 {
+		return AuctionResult{}, false
+	}
+	res := AuctionResult{Price: (points[lo].Price + points[hi].Price) / 2}
+	res.Demand = ob.bids.eligible(res.Price)
+	res.Supply = ob.asks.eligible(res.Price)
+	res.Volume = math.Min(res.Demand, res.Supply)
+	return res, res.Volume > 0
+}
+
+// eligible 出清价 price 下可成交的挂单总量（买方报价不低于、卖方报价不高于 price）
+func (s *bookSide) eligible(price float64) float64 {
+	qty := 0.0
+	for _, l := range s.sortedLevels() {
+		if (s.buy && l.price < price) || (!s.buy && l.price > price) {
+			break
+		}
+		qty += levelQty(l)
+	}
+	return qty
+}
+
+// auctionFill 一笔挂单在集合竞价中分到的成交量
+type auctionFill struct {
+	e    *bookEntry
+	qty  float64
+	full bool // 全部成交（配对后的浮点误差不留下残量）
+}
+
+// allocate 按价格优先分配 volume：边际档位之前的挂单全部成交，边际档位内按挂单数量比例分配（见 prorate）
+func (s *bookSide) allocate(price, volume float64) []auctionFill {
+	var fills []auctionFill
+	left := volume
+	for _, l := range s.sortedLevels() {
+		if left <= 0 || (s.buy && l.price < price) || (!s.buy && l.price > price) {
+			break
+		}
+		qty := levelQty(l)
+		if qty <= left {
+			for e := l.head; e != nil; e = e.next {
+				fills = append(fills, auctionFill{e: e, qty: e.order.Quantity, full: true})
+			}
+			left -= qty
+			continue
+		}
+		fills = append(fills, prorate(l, qty, left)...) // 边际档位
+		left = 0
+	}
+	return fills
+}
+
+// prorate 边际档位 l（挂单总量 qty）按比例分配 volume，以整单位成交：每笔先分到比例份额的整数部分，
+// 剩余的量逐个单位分给小数部分最大的挂单（相同时按时间优先），每笔最多分到自己的剩余量。
+// 挂单与 volume 都是整数时每笔成交也是整数，结算不必舍入（按比例直接分配会产生 0.4 这样的零碎成交）
+func prorate(l *priceLevel, qty, volume float64) []auctionFill {
+	var fills []auctionFill
+	var fracs []float64
+	left := volume
+	for e := l.head; e != nil; e = e.next {
+		share := e.order.Quantity * volume / qty
+		base := min(math.Floor(share), e.order.Quantity)
+		fills = append(fills, auctionFill{e: e, qty: base})
+		fracs = append(fracs, share-base)
+		left -= base
+	}
+	order := make([]int, len(fills)) // 按小数部分降序，相同时按时间优先（档位内顺序）
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return fracs[order[a]] > fracs[order[b]] })
+	for left > auctionDust {
+		progressed := false
+		for _, i := range order {
+			f := &fills[i]
+			unit := min(min(1, left), f.e.order.Quantity-f.qty)
+			if unit <= auctionDust {
+				continue
+			}
+			f.qty += unit
+			left -= unit
+			progressed = true
+			if left <= auctionDust {
+				break
+			}
+		}
+		if !progressed {
+			break
+		}
+	}
+	for i := range fills {
+		fills[i].full = fills[i].qty >= fills[i].e.order.Quantity
+	}
+	return fills
+}
+
+// clearUniform 集合竞价出清：全部成交以同一出清价生成 Trade，买卖两方按价格优先顺序配对
+func (ob *OrderBook) clearUniform() []Trade {
+	trades := []Trade{}
+	res, ok := ob.auction()
+	if !ok {
+		return trades
+	}
+	buys, sells := ob.bids.allocate(res.Price, res.Volume), ob.asks.allocate(res.Price, res.Volume)
+	for i, j := 0, 0; i < len(buys) && j < len(sells); {
+		b, s := &buys[i], &sells[j]
+		quantity := min(b.qty, s.qty)
+		if quantity > auctionDust {
+			trade := Trade{
+				BuyOrderID: b.e.order.ID, SellOrderID: s.e.order.ID, Price: res.Price, Quantity: quantity,
+				Timestamp: ob.now(), Seq: ob.seq, BuyUser: b.e.order.User, SellUser: s.e.order.User,
+			}
+			trades = append(trades, trade)
+			b.qty -= quantity
+			s.qty -= quantity
+			ob.setQuantity(b.e, b.e.order.Quantity-quantity)
+			ob.setQuantity(s.e, s.e.order.Quantity-quantity)
+		}
+		if b.qty <= auctionDust {
+			i++
+		}
+		if s.qty <= auctionDust {
+			j++
+		}
+	}
+	for _, fills := range [][]auctionFill{buys, sells} {
+		for _, f := range fills {
+			if f.full || f.e.order.Quantity <= auctionDust {
+				ob.drop(f.e)
+			}
+		}
+	}
+	ob.logf("Uniform-price auction: %.2f units at %.2f (demand %.2f, supply %.2f, %d trades)", res.Volume, res.Price, res.Demand, res.Supply, len(trades))
+	return trades
+}
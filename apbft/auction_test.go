@@ -0,0 +1,198 @@
+package apbft
+
+import (
+	"math"
+	"testing"
+)
+
+// auctionBook 集合竞价模式的副本订单簿，按顺序挂单（订单编号从 0 开始）
+func auctionBook(t *testing.T, orders []OrderRequest) *OrderBook {
+	t.Helper()
+	ob := NewReplicatedOrderBook()
+	ob.clock = testNow
+	ob.SetClearingMode(UniformClearing)
+	for _, req := range orders {
+		if res := ob.Place(req); res.Status != StatusResting {
+			t.Fatalf("setup %+v: %s %s", req, res.Status, res.Reason)
+		}
+	}
+	return ob
+}
+
+func TestUniformAuction(t *testing.T) {
+	cases := []struct {
+		name      string
+		orders    []OrderRequest
+		crosses   bool
+		price     float64
+		volume    float64
+		remaining map[int]float64 // 出清后仍挂着的订单编号与剩余数量
+	}{
+		{
+			// 候选价 100 / 102 / 105 上成交量为 5 / 15 / 10，唯一的最大值在 102；买方 102 档位是边际档位
+			name: "single crossing",
+			orders: []OrderRequest{
+				{Type: Buy, Price: 105, Quantity: 10, User: "a"},
+				{Type: Buy, Price: 102, Quantity: 10, User: "b"},
+				{Type: Sell, Price: 100, Quantity: 5, User: "s"},
+				{Type: Sell, Price: 102, Quantity: 10, User: "t"},
+			},
+			crosses: true, price: 102, volume: 15,
+			remaining: map[int]float64{1: 5},
+		},
+		{
+			// 100 与 105 上成交量、供需差都相同，取区间中点
+			name: "equal-volume range takes midpoint",
+			orders: []OrderRequest{
+				{Type: Buy, Price: 105, Quantity: 10, User: "a"},
+				{Type: Sell, Price: 100, Quantity: 10, User: "s"},
+			},
+			crosses: true, price: 102.5, volume: 10,
+			remaining: map[int]float64{},
+		},
+		{
+			// 出清价 97.5，成交量 10：买方 110 档位全部成交，100 档位（6 + 3）按比例分到剩下的 6
+			name: "pro-rated marginal buy level",
+			orders: []OrderRequest{
+				{Type: Buy, Price: 110, Quantity: 4, User: "a"},
+				{Type: Buy, Price: 100, Quantity: 6, User: "b"},
+				{Type: Buy, Price: 100, Quantity: 3, User: "c"},
+				{Type: Sell, Price: 95, Quantity: 10, User: "s"},
+			},
+			crosses: true, price: 97.5, volume: 10,
+			remaining: map[int]float64{1: 2, 2: 1},
+		},
+		{
+			// 出清价 97.5，成交量 6：卖方 90 档位全部成交，95 档位（4 + 4）按比例分到剩下的 4
+			name: "pro-rated marginal sell level",
+			orders: []OrderRequest{
+				{Type: Buy, Price: 100, Quantity: 6, User: "a"},
+				{Type: Sell, Price: 90, Quantity: 2, User: "s"},
+				{Type: Sell, Price: 95, Quantity: 4, User: "t"},
+				{Type: Sell, Price: 95, Quantity: 4, User: "u"},
+			},
+			crosses: true, price: 97.5, volume: 6,
+			remaining: map[int]float64{2: 2, 3: 2},
+		},
+		{
+			// 出清价 97.5，成交量 2：五笔各 1 单位的买单按比例各分 0.4，以整单位成交：前两笔（时间优先）各成交 1
+			name: "pro-rated marginal level in whole units",
+			orders: []OrderRequest{
+				{Type: Buy, Price: 100, Quantity: 1, User: "a"},
+				{Type: Buy, Price: 100, Quantity: 1, User: "b"},
+				{Type: Buy, Price: 100, Quantity: 1, User: "c"},
+				{Type: Buy, Price: 100, Quantity: 1, User: "d"},
+				{Type: Buy, Price: 100, Quantity: 1, User: "e"},
+				{Type: Sell, Price: 95, Quantity: 2, User: "s"},
+			},
+			crosses: true, price: 97.5, volume: 2,
+			remaining: map[int]float64{2: 1, 3: 1, 4: 1},
+		},
+		{
+			// 边际档位 7 + 3 分 5：份额 3.5 / 1.5，整数部分 3 / 1，余下 1 单位按小数部分（相同）给时间在先的一笔
+			name: "whole-unit remainder by time priority",
+			orders: []OrderRequest{
+				{Type: Buy, Price: 100, Quantity: 7, User: "a"},
+				{Type: Buy, Price: 100, Quantity: 3, User: "b"},
+				{Type: Sell, Price: 95, Quantity: 5, User: "s"},
+			},
+			crosses: true, price: 97.5, volume: 5,
+			remaining: map[int]float64{0: 3, 1: 2},
+		},
+		{
+			name: "no crossing",
+			orders: []OrderRequest{
+				{Type: Buy, Price: 99, Quantity: 5, User: "a"},
+				{Type: Sell, Price: 100, Quantity: 5, User: "s"},
+			},
+			remaining: map[int]float64{0: 5, 1: 5},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ob := auctionBook(t, tc.orders)
+			res, ok := ob.Auction()
+			if ok != tc.crosses {
+				t.Fatalf("crosses %v, want %v", ok, tc.crosses)
+			}
+			if ok && (res.Price != tc.price || !near(res.Volume, tc.volume)) {
+				t.Errorf("cleared %v at %v, want %v at %v", res.Volume, res.Price, tc.volume, tc.price)
+			}
+
+			trades := ob.MatchAndClear()
+			var traded float64
+			for _, tr := range trades {
+				if tr.Price != tc.price {
+					t.Errorf("trade %+v not at clearing price %v", tr, tc.price)
+				}
+				if tr.Quantity != math.Trunc(tr.Quantity) { // 挂单都是整数，成交也应是整数
+					t.Errorf("trade %+v fills a fractional quantity", tr)
+				}
+				traded += tr.Quantity
+			}
+			if !near(traded, tc.volume) {
+				t.Errorf("trades sum to %v, want %v", traded, tc.volume)
+			}
+
+			// 每方剩余挂单量 = 挂单总量 - 成交量，且逐笔与预期一致
+			var placed [2]float64
+			for _, req := range tc.orders {
+				placed[req.Type] += req.Quantity
+			}
+			var left [2]float64
+			resting := append(ob.Buys(), ob.Sells()...)
+			for _, o := range resting {
+				left[o.Type] += o.Quantity
+				if want, ok := tc.remaining[o.ID]; !ok || !near(o.Quantity, want) {
+					t.Errorf("order #%d rests with %v, want %v (listed %v)", o.ID, o.Quantity, want, ok)
+				}
+			}
+			if len(resting) != len(tc.remaining) {
+				t.Errorf("%d orders rest, want %d", len(resting), len(tc.remaining))
+			}
+			for side := range left {
+				if !near(left[side], placed[side]-traded) {
+					t.Errorf("side %d leaves %v, want %v - %v", side, left[side], placed[side], traded)
+				}
+			}
+		})
+	}
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) <= auctionDust }
+
+// 集合竞价只接受 GTC 限价单
+func TestUniformAuctionLimitOnly(t *testing.T) {
+	for _, req := range []OrderRequest{
+		{Type: Buy, Kind: Market, Quantity: 1, User: "a"},
+		{Type: Buy, TIF: IOC, Price: 100, Quantity: 1, User: "a"},
+		{Type: Sell, TIF: FOK, Price: 100, Quantity: 1, User: "a"},
+		{Type: Buy, PostOnly: true, Price: 100, Quantity: 1, User: "a"},
+		{Type: Sell, Price: 100, Quantity: 2, MinQuantity: 1, User: "a"},
+	} {
+		ob := auctionBook(t, nil)
+		if res := ob.Place(req); res.Reason != ReasonAuctionLimitOnly {
+			t.Errorf("%+v: got %s/%q, want %q", req, res.Status, res.Reason, ReasonAuctionLimitOnly)
+		}
+	}
+}
+
+// 订单批次只挂单，出清留给轮次边界的 MatchAndClear
+func TestUniformAuctionBatchPlacesOnly(t *testing.T) {
+	ob := auctionBook(t, nil)
+	trades, results := ob.ApplyBatch(1, testNow, []OrderRequest{
+		{Type: Buy, Price: 105, Quantity: 10, User: "a"},
+		{Type: Sell, Price: 100, Quantity: 10, User: "s"},
+	})
+	if len(trades) != 0 {
+		t.Fatalf("batch traded %+v before the round closed", trades)
+	}
+	for _, res := range results {
+		if res.Status != StatusResting {
+			t.Errorf("order #%d: %s %s, want resting", res.OrderID, res.Status, res.Reason)
+		}
+	}
+	if trades := ob.MatchAndClear(); len(trades) != 1 || trades[0].Price != 102.5 || trades[0].Seq != 1 {
+		t.Errorf("clearing gave %+v, want one trade at 102.5 in seq 1", trades)
+	}
+}
@@ -0,0 +1,253 @@
+package apbft
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：请求批处理 =======================
+// 每笔交易单独跑一次三阶段流程时，吞吐量受限于单次共识的时延。Batcher 把待处理交易攒成一个提案：
+// - 攒满 MaxSize 笔，或最早的一笔已等待 MaxDelayMs，即切出一批；
+// - 一批交易占用一个序号（一个区块），PRE-PREPARE 携带交易列表，PREPARE / COMMIT 的聚合签名覆盖批摘要；
+// - 每笔交易得到各自的结果，时延包含在队列中的等待。
+
+// BatchConfig 批处理参数
+type BatchConfig struct {
+	MaxSize    int     `json:"maxSize" yaml:"maxSize"`       // 每批最多交易数（1 表示不批处理）
+	MaxDelayMs float64 `json:"maxDelayMs" yaml:"maxDelayMs"` // 最早一笔交易的最长等待（仿真毫秒）
+}
+
+// DefaultBatchConfig 每批最多 16 笔、最多等待 50ms
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{MaxSize: 16, MaxDelayMs: 50}
+}
+
+// Validate 检查批处理参数
+func (b BatchConfig) Validate() error {
+	if b.MaxSize < 1 {
+		return fmt.Errorf("batch: maxSize must be at least 1, got %d", b.MaxSize)
+	}
+	if b.MaxDelayMs < 0 {
+		return fmt.Errorf("batch: maxDelayMs must not be negative, got %g", b.MaxDelayMs)
+	}
+	return nil
+}
+
+func (b BatchConfig) maxDelay() time.Duration {
+	return time.Duration(b.MaxDelayMs * float64(time.Millisecond))
+}
+
+// batchDigest 批摘要：按顺序对各交易 (ID, Amount) 求哈希，作为本序号的请求
+func batchDigest(txs []Tx) []byte {
+	h := sha256.New()
+	for _, tx := range txs {
+		fmt.Fprintf(h, "%s|%d\n", tx.ID, tx.Amount)
+	}
+	return h.Sum(nil)
+}
+
+// SubmitBatch 对一批交易执行一次共识（一个序号），按交易顺序返回各自的结果；同步返回（等执行完）
+func (c *Cluster) SubmitBatch(txs []Tx) []PBFTResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out, _ := c.submitBatch(txs, c.sim.Clock().Elapsed())
+	c.sim.Drain()
+	return out
+}
+
+// submitBatch 在流水线中提交一批交易（不早于 ready 提案），返回各交易的结果与提案时刻
+func (c *Cluster) submitBatch(txs []Tx, ready time.Duration) ([]PBFTResult, time.Duration) {
+	if len(txs) == 0 {
+		return nil, ready
+	}
+	c.seq++
+	c.sim.payload = len(txs) * TxWireBytes
+	c.sim.demand = batchDemand(txs) // 【高亮-2026-10-16】一批交易按其中最强的需求路由
+	c.sim.amount = 0
+	for _, tx := range txs {
+		c.sim.amount += tx.Amount // 整批的电量一起定价
+	}
+	ok, price, leader, view, start := c.sim.RunPipelined(c.seq, batchDigest(txs), ready)
+	c.sim.payload, c.sim.demand, c.sim.amount = 0, DemandAny, 0
+	if ok {
+		c.height++
+	}
+	out := make([]PBFTResult, len(txs))
+	for i, tx := range txs {
+		out[i] = c.sim.result(c.seq, tx.ID, ok, price, leader, view)
+	}
+	return out, start
+}
+
+// Elapsed 集群虚拟时钟的读数
+func (c *Cluster) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.Clock().Elapsed()
+}
+
+type pendingTx struct {
+	tx Tx
+	at time.Duration // 到达时刻（虚拟时钟）
+}
+
+// Batcher 按 BatchConfig 把到达的交易切成批并提交给集群；同时在共识中的批数受流水线深度限制，
+// 没有空闲槽位期间到达的交易在队列中等待。所有方法可并发调用（内部串行执行）。
+type Batcher struct {
+	mu      sync.Mutex
+	c       *Cluster
+	cfg     BatchConfig
+	pending []pendingTx
+}
+
+// NewBatcher 按集群配置中的批处理参数创建批处理器
+func (c *Cluster) NewBatcher() *Batcher {
+	return &Batcher{c: c, cfg: c.batch}
+}
+
+// Offer 交易在虚拟时刻 at 到达（不得早于上一笔，可以早于当前时钟：上一批共识期间到达的交易）；
+// 返回在此之前切出的各批交易的结果
+func (b *Batcher) Offer(tx Tx, at time.Duration) []PBFTResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := b.advance(at)
+	b.pending = append(b.pending, pendingTx{tx: tx, at: at})
+	return append(out, b.advance(at)...)
+}
+
+// AdvanceTo 让虚拟时间推进到 t，期间等待到期的批次被切出并提交
+func (b *Batcher) AdvanceTo(t time.Duration) []PBFTResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.advance(t)
+}
+
+// Flush 不再有交易到达：按批处理规则提交队列中的全部交易（不足一批的等最长等待到期）
+func (b *Batcher) Flush() []PBFTResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []PBFTResult
+	for len(b.pending) > 0 {
+		out = append(out, b.cut(b.ready())...)
+	}
+	return out
+}
+
+// Pending 队列中等待的交易数
+func (b *Batcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// ready 队首一批的提案时刻：攒满 MaxSize 笔或最早一笔等满 MaxDelayMs，且流水线有空闲槽位
+func (b *Batcher) ready() time.Duration {
+	at := b.pending[0].at + b.cfg.maxDelay()
+	if len(b.pending) >= b.cfg.MaxSize && b.pending[b.cfg.MaxSize-1].at < at {
+		at = b.pending[b.cfg.MaxSize-1].at
+	}
+	b.c.mu.Lock()
+	defer b.c.mu.Unlock()
+	if slot := b.c.sim.NextSlot(b.c.seq + 1); slot > at {
+		at = slot
+	}
+	return at
+}
+
+// advance 提交提案时刻不晚于 t 的各批（更晚的批次可能还会有交易加入），然后让时钟走到 t
+func (b *Batcher) advance(t time.Duration) []PBFTResult {
+	var out []PBFTResult
+	for len(b.pending) > 0 {
+		at := b.ready()
+		if at > t {
+			break
+		}
+		out = append(out, b.cut(at)...)
+	}
+	b.c.mu.Lock()
+	b.c.sim.Clock().AdvanceTo(t)
+	b.c.mu.Unlock()
+	return out
+}
+
+// cut 在虚拟时刻 at 切出至多 MaxSize 笔交易并提交
+func (b *Batcher) cut(at time.Duration) []PBFTResult {
+	n := len(b.pending)
+	if n > b.cfg.MaxSize {
+		n = b.cfg.MaxSize
+	}
+	batch := b.pending[:n]
+	b.pending = append([]pendingTx(nil), b.pending[n:]...)
+
+	txs := make([]Tx, n)
+	for i, p := range batch {
+		txs[i] = p.tx
+	}
+	b.c.mu.Lock()
+	defer b.c.mu.Unlock()
+	out, start := b.c.submitBatch(txs, at)
+	for i := range out {
+		out[i].LatencyMs += node.DurationMs(start - batch[i].at) // 排队等待
+	}
+	return out
+}
+
+// BatchPoint 批大小扫描中的一个点
+type BatchPoint struct {
+	BatchSize    int     `json:"batchSize"`
+	Batches      int     `json:"batches"`      // 提交的批（序号）数
+	Committed    int     `json:"committed"`    // 已提交的交易数
+	Throughput   float64 `json:"throughput"`   // 已提交交易数 / 仿真秒（从第一笔到达到最后一批结束）
+	AvgLatencyMs float64 `json:"avgLatencyMs"` // 已提交交易从到达到提交的平均时延
+}
+
+// BatchSweep 吞吐量随批大小的变化：对每个批大小新建一个集群，处理 txs 笔以 ratePerSec 均匀到达的交易
+// （最长等待取 cfg.Batch.MaxDelayMs）
+func BatchSweep(specs []node.NodeSpec, cfg Config, sizes []int, txs int, ratePerSec float64) ([]BatchPoint, error) {
+	if txs <= 0 || ratePerSec <= 0 {
+		return nil, fmt.Errorf("apbft: batch sweep needs txs > 0 and ratePerSec > 0")
+	}
+	gap := time.Duration(float64(time.Second) / ratePerSec)
+	points := make([]BatchPoint, 0, len(sizes))
+	for _, size := range sizes {
+		c := cfg
+		c.Batch.MaxSize = size
+		if err := c.Batch.Validate(); err != nil {
+			return nil, fmt.Errorf("apbft: %w", err)
+		}
+		cluster, err := NewCluster(specs, c)
+		if err != nil {
+			return nil, err
+		}
+		b := cluster.NewBatcher()
+		first := cluster.Elapsed()
+		var results []PBFTResult
+		for i := 0; i < txs; i++ {
+			tx := Tx{ID: fmt.Sprintf("bench-%d-%04d", size, i), Amount: 10}
+			results = append(results, b.Offer(tx, first+time.Duration(i)*gap)...)
+		}
+		results = append(results, b.Flush()...)
+		cluster.Drain()
+
+		pt := BatchPoint{BatchSize: size, Batches: cluster.Seq()}
+		totalMs := 0.0
+		for _, r := range results {
+			if r.Status == "已确认" {
+				pt.Committed++
+				totalMs += r.LatencyMs
+			}
+		}
+		if pt.Committed > 0 {
+			pt.AvgLatencyMs = totalMs / float64(pt.Committed)
+		}
+		if secs := (cluster.Elapsed() - first).Seconds(); secs > 0 {
+			pt.Throughput = float64(pt.Committed) / secs
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
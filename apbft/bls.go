@@ -0,0 +1,12 @@
+package apbft
+
+import "PBFT1/node"
+
+// ======================= 【高亮-2026-10-16】修改：真实 blst 实现移至 node 包 =======================
+// 原先这里的 BlstBLS 只在 apbft 包内可见，而节点实际使用的是 node.NewBlstBLS（恒为 Stub）。
+// 现在统一由 node 包提供：go build -tags blst 时为真实 blst，否则为 SimpleBLSStub。
+
+// NewBlstBLS 返回节点 id 的 BLS 实现（node.BLS 与本包 BLS 接口方法集一致）
+func NewBlstBLS(id int) BLS {
+	return node.NewBlstBLS(id)
+}
@@ -3,6 +3,7 @@ package apbft
 import (
 	"crypto/rand"
 	"fmt"
+	"strings"
 )
 
 // 默认 BLS 接口（Stub），用于无 blst 环境快速测试
@@ -14,6 +15,8 @@ type BLS interface {
 	AggregateSignatures(sigs [][]byte) ([]byte, error)
 	// 验证聚合签名：给定公钥列表、消息和聚合签名，返回验证结果或错误
 	VerifyAggregate(pubKeys [][]byte, message []byte, aggSig []byte) (bool, error)
+	// 【高亮-2026-10-16】新增：验证单个签名（用于定位聚合失败时的作恶签名者）
+	Verify(pubKey []byte, message []byte, sig []byte) (bool, error)
 	// 返回该 BLS 实例对应的公钥（序列化字节）
 	PublicKey() []byte
 }
@@ -64,6 +67,13 @@ func (s *SimpleBLSStub) VerifyAggregate(pubKeys [][]byte, message []byte, aggSig
 	return false, nil
 }
 
+// Verify 单签名"伪验证"：只要求签名带有该公钥对应节点的前缀
+// 与 VerifyAggregate 一样不提供任何安全性；需要可定位作恶者的 Stub 请使用 node.SimpleBLSStub。
+func (s *SimpleBLSStub) Verify(pubKey []byte, message []byte, sig []byte) (bool, error) {
+	prefix := "SIG-" + strings.TrimPrefix(string(pubKey), "PK-") + "-"
+	return strings.HasPrefix(string(sig), prefix), nil
+}
+
 // PublicKey 返回该节点的伪公钥字符串，格式为 "PK-node-01"
 // 仅用于演示和在测试中作为公钥占位符。
 func (s *SimpleBLSStub) PublicKey() []byte {
@@ -0,0 +1,641 @@
+package apbft
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：消息日志、检查点与日志回收 =======================
+// 每个副本按序号保存 PRE-PREPARE / PREPARE / COMMIT 日志，并按序执行已提交的请求
+// （被放弃的序号按 PBFT 以空请求填补），状态摘要为执行链的哈希：
+// - 每 CheckpointInterval 个序号，执行到该序号的副本对 (序号, 状态摘要) 签名，CHECKPOINT 发给当前主节点；
+//   签名前，执行进度落后的副本先向 f+1 个信誉最高的在线节点补齐缺失的已确定日志（提交证书逐条验证）；
+// - 主节点聚合 2f+1 条一致的签名（剔除坏签名）形成稳定检查点证明并广播；
+// - 副本验证证明后把低水位推进到该序号，截断低水位及以下的日志；
+// - 仍落后于稳定检查点（或状态与之不符）的副本向主节点及上述节点请求状态，
+//   按证明校验状态摘要后直接跳到检查点，再继续执行日志中更高的序号。
+
+// CommitCert 提交证书：被提交的 prepared 证书，以及 leader 对 COMMIT 签名（【高亮-2026-10-16】签的是 commitMessage(序号, view, 摘要)）的聚合
+type CommitCert struct {
+	Seq      int
+	Prepared PreparedCert
+	AggSig   []byte
+	Signers  []int
+}
+
+// LogEntry 副本在一个序号上的消息日志
+type LogEntry struct {
+	Seq        int
+	View       int
+	PrePrepare string        // 收到的 PRE-PREPARE 摘要（空串表示未收到）
+	Prepare    *PreparedCert // PREPARE 聚合证书
+	Commit     *CommitCert   // 提交证书
+	Null       bool          // 请求被放弃，序号以空请求填补
+}
+
+// decided 该序号是否已有确定结果（可以执行）
+func (e *LogEntry) decided() bool {
+	return e.Commit != nil || e.Null
+}
+
+// Checkpoint 稳定检查点：2f+1 个副本对 (Seq, State) 签名的聚合
+type Checkpoint struct {
+	Seq     int    `json:"seq"`
+	State   string `json:"state"`
+	AggSig  []byte `json:"aggSig,omitempty"`
+	Signers []int  `json:"signers,omitempty"`
+}
+
+// replicaState 副本的日志、执行进度与稳定检查点
+type replicaState struct {
+	id       int
+	log      map[int]*LogEntry
+	executed int        // 已按序执行到的序号
+	state    string     // 执行到 executed 时的状态摘要
+	stable   Checkpoint // 最新稳定检查点（低水位）
+	fetches  int        // 状态传输次数
+	// 【高亮-2026-10-16】新增：副本执行订单批次的订单簿（见 market.go）
+	book    *OrderBook
+	shared  bool          // book 与正确订单簿共享（分歧纠正或状态传输后），修改前先复制
+	market  string        // 执行到 executed 时订单簿的状态哈希
+	trades  []Trade       // 最近一个订单批次的成交
+	results []OrderResult // 最近一个订单批次中每笔操作的结果
+}
+
+// ReplicaStatus 副本日志与检查点概况
+type ReplicaStatus struct {
+	ID           int
+	Executed     int    // 已执行到的序号
+	State        string // 执行到 Executed 时的状态摘要
+	LowWatermark int    // 最新稳定检查点序号
+	LogEntries   int    // 日志中保留的序号数
+	Fetches      int    // 从稳定检查点获取状态的次数
+}
+
+// fetchRequest FETCH-STATE 消息：补齐 Executed 之后的已确定日志；Proof 非空时获取该检查点的状态
+type fetchRequest struct {
+	Executed int
+	Proof    *Checkpoint
+}
+
+// stateTransfer STATE 消息：已确定的日志条目，或稳定检查点证明及对应的状态
+type stateTransfer struct {
+	Entries []LogEntry
+	Proof   *Checkpoint
+	State   string
+}
+
+// nextState 执行一个序号后的状态摘要（空请求记为 "-"）
+func nextState(prev string, seq int, digest string) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", prev, seq, digest)))
+	return hex.EncodeToString(h[:])
+}
+
+// checkpointMessage CHECKPOINT 的签名内容
+func checkpointMessage(seq int, state string) []byte {
+	return []byte(fmt.Sprintf("CHECKPOINT|%d|%s", seq, state))
+}
+
+// replica 返回副本状态（首次访问时创建，执行位置为初始位置）
+func (s *PBFTSimulator) replica(id int) *replicaState {
+	if s.replicas == nil {
+		s.replicas = make(map[int]*replicaState)
+	}
+	r, ok := s.replicas[id]
+	if !ok {
+		r = &replicaState{id: id, log: make(map[int]*LogEntry), executed: s.execBase, book: s.newReplicaBook()}
+		r.market = r.book.StateHash()
+		s.replicas[id] = r
+	}
+	return r
+}
+
+// entry 返回副本在 seq 上的日志（低水位及以下返回 nil：已被检查点覆盖）
+func (r *replicaState) entry(seq int) *LogEntry {
+	if seq <= r.stable.Seq && r.stable.Signers != nil {
+		return nil
+	}
+	e, ok := r.log[seq]
+	if !ok {
+		e = &LogEntry{Seq: seq}
+		r.log[seq] = e
+	}
+	return e
+}
+
+// execute 副本按序执行已确定的序号（【高亮-2026-10-16】订单批次同时在副本的订单簿上执行）
+func (s *PBFTSimulator) execute(r *replicaState) {
+	for {
+		e, ok := r.log[r.executed+1]
+		if !ok || !e.decided() {
+			return
+		}
+		digest := "-"
+		if e.Commit != nil {
+			digest = e.Commit.Prepared.Digest
+		}
+		r.executed++
+		r.state = nextState(r.state, r.executed, digest)
+		s.applyOrders(r, r.executed, digest)
+	}
+}
+
+// install 接受稳定检查点证明：推进低水位并截断日志
+func (r *replicaState) install(proof Checkpoint) {
+	if proof.Seq <= r.stable.Seq && r.stable.Signers != nil {
+		return
+	}
+	r.stable = proof
+	for seq := range r.log {
+		if seq <= proof.Seq {
+			delete(r.log, seq)
+		}
+	}
+}
+
+// logPrePrepare / logPrepare / logCommit 记录副本在当前 view 收到的消息
+func (s *PBFTSimulator) logPrePrepare(id, seq int, digest string) {
+	if e := s.replica(id).entry(seq); e != nil {
+		e.View, e.PrePrepare = s.view, digest
+	}
+}
+
+func (s *PBFTSimulator) logPrepare(id, seq int, cert PreparedCert) {
+	if e := s.replica(id).entry(seq); e != nil {
+		e.View, e.Prepare = cert.View, &cert
+	}
+}
+
+func (s *PBFTSimulator) logCommit(id, seq int, cert CommitCert) {
+	r := s.replica(id)
+	if e := r.entry(seq); e != nil {
+		e.View, e.Commit = cert.Prepared.View, &cert
+		s.execute(r)
+	}
+}
+
+// disseminateCommit 收齐 COMMIT 后 leader 按自身行为策略把提交证书发给副本，副本验证后记入日志并按序执行；
+// 返回记下证书的副本数（含 leader）
+func (s *PBFTSimulator) disseminateCommit(nw *node.Network, leader *node.Node, ids []int, got map[int]node.Message, stepFor func(node.Phase, string) node.Step, cert CommitCert) int {
+	round := s.round
+	for id := range got {
+		delete(got, id)
+	}
+	s.logCommit(leader.ID, round, cert)
+	size := node.DefaultMessageSize + len(cert.Prepared.AggSig) + len(cert.AggSig) + 4*(len(cert.Prepared.Signers)+len(cert.Signers))
+	for _, id := range ids {
+		if id == leader.ID {
+			continue
+		}
+		step := stepFor(node.PhaseCommit, cert.Prepared.Digest)
+		step.Peer = id
+		act := leader.Decide(step)
+		m := cert
+		switch act.Kind {
+		case node.ActSilent, node.ActReject, node.ActBadSign:
+			continue
+		case node.ActEquivocate:
+			m.Prepared.Digest = act.Digest
+		}
+		nw.SendAfter(node.Message{Type: node.MsgCommitCert, From: leader.ID, To: id, Round: round, Seq: 1, Digest: m.Prepared.Digest, Size: size, Payload: m}, act.Delay)
+	}
+	nw.RunFor(time.Duration(PhaseTimeoutMs) * time.Millisecond)
+
+	verified := make(map[string]bool)
+	recv := make([]int, 0, len(got))
+	for id := range got {
+		recv = append(recv, id)
+	}
+	sort.Ints(recv)
+	delivered := 1
+	for _, id := range recv {
+		c, isCert := got[id].Payload.(CommitCert)
+		if got[id].Type != node.MsgCommitCert || !isCert || !s.verifyCommit(s.nodeByID(id), c, verified) {
+			continue
+		}
+		s.logCommit(id, round, c)
+		delivered++
+	}
+	return delivered
+}
+
+// verifyCommit 验证提交证书：prepared 证书的聚合签名，以及达到提交阈值的 COMMIT 聚合签名（同一证书只验一次）
+func (s *PBFTSimulator) verifyCommit(verifier *node.Node, c CommitCert, cache map[string]bool) bool {
+	key := fmt.Sprintf("%s:%x:%x", c.Prepared.Digest, c.Prepared.AggSig, c.AggSig)
+	if ok, done := cache[key]; done {
+		return ok
+	}
+	quorum, known := s.commitQuorum(c.Seq) // 【高亮-2026-10-16】按当时的验证委员会或成员数
+	ok := known && len(c.Signers) >= quorum && s.verifyPrepared(verifier, c.Prepared, c.Seq)
+	if ok {
+		pks, err := s.keysAt(c.Signers, c.Seq)
+		ok = err == nil
+		if ok {
+			ok, _ = verifier.VerifyAggregate(pks, commitMessage(c.Seq, c.Prepared.View, c.Prepared.Digest), c.AggSig) // 【高亮-2026-10-16】COMMIT 签名覆盖 (序号, view, 摘要)
+		}
+	}
+	cache[key] = ok
+	return ok
+}
+
+// sequenceDecided 一个序号处理结束（提交或放弃）：在线副本以空请求填补被放弃的序号，
+// 到达检查点间隔时执行检查点协议
+func (s *PBFTSimulator) sequenceDecided(seq int, ok bool, primary *node.Node) {
+	if !ok {
+		for _, nd := range s.nodes {
+			if !nd.Online() {
+				continue
+			}
+			r := s.replica(nd.ID)
+			if e := r.entry(seq); e != nil && e.Commit == nil {
+				e.Null = true
+				s.execute(r)
+			}
+		}
+	}
+	s.auditMarket(seq) // 【高亮-2026-10-16】比对副本订单簿的状态哈希（检查点补齐日志前）
+	if CheckpointInterval > 0 && seq > 0 && seq%CheckpointInterval == 0 {
+		s.checkpoint(seq, primary)
+	}
+}
+
+// openSequence 开始处理序号 seq：记录当时的成员数（成员变更经配置全局确定，
+// 补齐日志时按当时的提交阈值验证证书）；第一个请求确定副本的初始执行位置
+func (s *PBFTSimulator) openSequence(seq int) {
+	if s.members == nil {
+		s.members = make(map[int]int)
+	}
+	s.members[seq] = s.n
+	if s.started {
+		return
+	}
+	s.started, s.execBase = true, seq-1
+	for _, r := range s.replicas {
+		if r.executed < s.execBase {
+			r.executed = s.execBase
+		}
+	}
+}
+
+// checkpoint 在 seq 上执行检查点协议，collector 为收集签名的主节点（离线时改用信誉排序中第一个在线节点）
+func (s *PBFTSimulator) checkpoint(seq int, collector *node.Node) {
+	if collector == nil || !collector.Online() {
+		collector = nil
+		for _, nd := range s.primaryOrder() {
+			if nd.Online() {
+				collector = nd
+				break
+			}
+		}
+		if collector == nil {
+			return
+		}
+	}
+	nw := node.NewNetworkWithClock(node.DefaultNetworkConfig(), int64(20260415+seq), s.clock)
+	nw.SetDistanceModel(s.grid)
+	phaseTimeout := time.Duration(PhaseTimeoutMs) * time.Millisecond
+	quorum := 2*s.f + 1
+
+	online := make([]*node.Node, 0, len(s.nodes))
+	for _, nd := range s.nodes {
+		if nd.Online() {
+			online = append(online, nd)
+		}
+	}
+	// 补齐日志与状态传输的服务方：主节点加上信誉排序靠前的在线节点，共 f+1 个（至少一个诚实）
+	helpers := []*node.Node{collector}
+	for _, nd := range s.primaryOrder() {
+		if len(helpers) > s.f {
+			break
+		}
+		if nd != collector && nd.Online() {
+			helpers = append(helpers, nd)
+		}
+	}
+	fetch := func(from *node.Node, req fetchRequest) {
+		for _, h := range helpers {
+			if h != from {
+				nw.Send(node.Message{Type: node.MsgFetchState, From: from.ID, To: h.ID, Round: seq, Seq: seq, Payload: req})
+			}
+		}
+	}
+	step := func(self *node.Node, peer int, digest string) node.Step {
+		return node.Step{Phase: node.PhaseCheckpoint, Round: seq, Self: self.ID, Leader: collector.ID, Peer: peer, Digest: digest, Timeout: phaseTimeout, Prominent: -1, View: s.view}
+	}
+
+	votes := make(map[string]*voteSet)
+	seen := make(map[int]bool, len(online))
+	var proof *Checkpoint
+	proofOK := make(map[string]bool)
+	commitOK := make(map[string]bool)
+	for _, nd := range online {
+		nd := nd
+		nw.Register(nd.ID, func(msg node.Message) {
+			switch msg.Type {
+			case node.MsgCheckpoint:
+				vote, isVote := msg.Payload.(signedVote)
+				if nd != collector || !isVote || seen[msg.From] {
+					return
+				}
+				pk, known := s.registry.PublicKey(msg.From)
+				if !known {
+					return
+				}
+				seen[msg.From] = true
+				if votes[msg.Digest] == nil {
+					votes[msg.Digest] = &voteSet{}
+				}
+				votes[msg.Digest].add(msg.From, pk, vote.sig)
+			case node.MsgStableCheckpoint:
+				cp, isCP := msg.Payload.(Checkpoint)
+				if !isCP || !s.verifyCheckpoint(nd, cp, proofOK) {
+					return
+				}
+				r := s.replica(nd.ID)
+				r.install(cp)
+				if r.executed < cp.Seq || (r.executed == cp.Seq && r.state != cp.State) {
+					fetch(nd, fetchRequest{Executed: r.executed, Proof: &cp})
+				}
+			case node.MsgFetchState:
+				req, isReq := msg.Payload.(fetchRequest)
+				if !isReq {
+					return
+				}
+				r := s.replica(nd.ID)
+				// 请求方落后于自己的低水位时附上稳定检查点证明（状态摘要即证明中的 State），再补齐其上的已确定日志
+				var st stateTransfer
+				from := req.Executed
+				if cp := r.stable; cp.Signers != nil && (from < cp.Seq || (req.Proof != nil && from == cp.Seq)) && r.executed >= cp.Seq {
+					st.Proof, st.State = &cp, cp.State
+					from = cp.Seq
+				}
+				for q := from + 1; q <= r.executed; q++ {
+					if e, ok := r.log[q]; ok && e.decided() {
+						st.Entries = append(st.Entries, *e)
+					}
+				}
+				if st.Proof == nil && len(st.Entries) == 0 {
+					return
+				}
+				act := nd.Decide(step(nd, msg.From, msg.Digest))
+				switch act.Kind {
+				case node.ActSilent, node.ActReject, node.ActBadSign:
+					return
+				case node.ActEquivocate:
+					st = tamper(st, act.Digest)
+				}
+				nw.SendAfter(node.Message{Type: node.MsgState, From: nd.ID, To: msg.From, Round: seq, Seq: seq, Digest: st.State, Size: node.DefaultMessageSize * (1 + len(st.Entries)), Payload: st}, act.Delay)
+			case node.MsgState:
+				st, isST := msg.Payload.(stateTransfer)
+				if !isST {
+					return
+				}
+				r := s.replica(nd.ID)
+				if st.Proof != nil {
+					if st.State != st.Proof.State || !s.verifyCheckpoint(nd, *st.Proof, proofOK) {
+						return
+					}
+					r.install(*st.Proof)
+					if r.executed < st.Proof.Seq || (r.executed == st.Proof.Seq && r.state != st.State) {
+						r.executed, r.state = st.Proof.Seq, st.State
+						r.fetches++
+						s.installBook(r, st.Proof.Seq)
+					}
+				}
+				for _, e := range st.Entries {
+					if e.Seq <= r.executed {
+						continue
+					}
+					local := r.entry(e.Seq)
+					switch {
+					case local == nil || local.decided():
+					case e.Commit != nil && s.verifyCommit(nd, *e.Commit, commitOK):
+						local.View, local.Commit = e.Commit.Prepared.View, e.Commit
+					case e.Commit == nil && e.Null:
+						local.Null = true // 空请求没有证书；若对方谎报，检查点处状态不一致，随后经状态传输纠正
+					}
+				}
+				s.execute(r)
+			}
+		})
+	}
+
+	// 补齐日志：执行进度落后的副本请求缺失的已确定条目
+	for _, nd := range online {
+		if r := s.replica(nd.ID); r.executed < seq {
+			fetch(nd, fetchRequest{Executed: r.executed})
+		}
+	}
+	nw.RunFor(phaseTimeout)
+
+	// CHECKPOINT：执行到 seq 的副本签名，主节点按状态摘要分组收集
+	for _, nd := range online {
+		r := s.replica(nd.ID)
+		if !nd.IsActive() || r.executed != seq {
+			continue
+		}
+		msg := checkpointMessage(seq, r.state)
+		stp := step(nd, collector.ID, r.state)
+		sig, delay, err := nd.SignStep(stp, msg)
+		if err != nil || sig == nil {
+			continue
+		}
+		voted := r.state
+		if act := nd.Decide(stp); act.Kind == node.ActEquivocate {
+			voted = act.Digest
+		}
+		nw.SendAfter(node.Message{Type: node.MsgCheckpoint, From: nd.ID, To: collector.ID, Round: seq, Seq: seq, Digest: voted, Size: node.DefaultMessageSize + len(sig), Payload: signedVote{id: nd.ID, sig: sig}}, delay)
+	}
+	nw.RunFor(phaseTimeout)
+
+	// 主节点取签名最多的状态摘要聚合（剔除坏签名），不足 2f+1 时本次检查点不稳定
+	states := make([]string, 0, len(votes))
+	for st := range votes {
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if len(votes[states[i]].ids) != len(votes[states[j]].ids) {
+			return len(votes[states[i]].ids) > len(votes[states[j]].ids)
+		}
+		return states[i] < states[j]
+	})
+	if len(states) == 0 || len(votes[states[0]].ids) < quorum {
+		fmt.Printf("[Checkpoint] seq %d: not stable (%d matching signatures, need %d)\n", seq, maxVotes(votes), quorum)
+		return
+	}
+	state := states[0]
+	agg, valid, culprits, ok := aggregateVotes(collector, *votes[state], checkpointMessage(seq, state))
+	for _, id := range culprits {
+		if nd := s.nodeByID(id); nd != nil {
+			nd.RecordOutcome(node.ReputationEvent{Success: false, Phase: node.PhaseCheckpoint, Round: seq})
+		}
+	}
+	if !ok || len(valid.ids) < quorum {
+		fmt.Printf("[Checkpoint] seq %d: not stable (%d valid signatures, need %d)\n", seq, len(valid.ids), quorum)
+		return
+	}
+	signers := append([]int(nil), valid.ids...) // 保持聚合顺序（签名与公钥按相同顺序对应）
+	proof = &Checkpoint{Seq: seq, State: state, AggSig: agg, Signers: signers}
+
+	// STABLE-CHECKPOINT：主节点按自身行为策略广播证明；落后的副本随后请求状态
+	proofOK[proofKey(*proof)] = true
+	s.replica(collector.ID).install(*proof)
+	for q := range s.members {
+		if q < seq {
+			delete(s.members, q) // 低水位以下只通过状态传输追赶，不再需要验证证书（保留 seq 本身用于验证检查点证明）
+		}
+	}
+	for q := range s.committees {
+		if q < seq {
+			delete(s.committees, q)
+		}
+	}
+	s.pruneMarket(seq)
+	for id, k := range s.retired {
+		if k.leftAt <= seq {
+			delete(s.retired, id)
+		}
+	}
+	for _, nd := range online {
+		if nd == collector {
+			continue
+		}
+		act := collector.Decide(step(collector, nd.ID, state))
+		cp := *proof
+		switch act.Kind {
+		case node.ActSilent, node.ActReject, node.ActBadSign:
+			continue
+		case node.ActEquivocate:
+			cp.State = act.Digest
+		}
+		nw.SendAfter(node.Message{Type: node.MsgStableCheckpoint, From: collector.ID, To: nd.ID, Round: seq, Seq: seq, Digest: cp.State, Size: node.DefaultMessageSize + len(agg) + 4*len(signers), Payload: cp}, act.Delay)
+	}
+	nw.RunFor(2 * phaseTimeout) // 证明广播 + 状态请求的往返
+
+	installed, lagging := 0, 0
+	for _, nd := range online {
+		r := s.replica(nd.ID)
+		if r.stable.Seq == seq {
+			installed++
+		}
+		if r.executed < seq {
+			lagging++
+		}
+	}
+	fmt.Printf("[Checkpoint] seq %d stable: %d signers, installed by %d replicas, %d still lagging\n", seq, len(signers), installed, lagging)
+}
+
+// tamper 作恶的主节点篡改补齐的日志或状态（接收方验证时会发现）
+func tamper(st stateTransfer, digest string) stateTransfer {
+	if st.Proof != nil {
+		st.State = digest
+		return st
+	}
+	entries := make([]LogEntry, len(st.Entries))
+	for i, e := range st.Entries {
+		if e.Commit != nil {
+			c := *e.Commit
+			c.Prepared.Digest = digest
+			e.Commit = &c
+		}
+		entries[i] = e
+	}
+	st.Entries = entries
+	return st
+}
+
+// proofKey 稳定检查点证明的缓存键
+func proofKey(cp Checkpoint) string {
+	return fmt.Sprintf("%d:%s:%x", cp.Seq, cp.State, cp.AggSig)
+}
+
+// verifyCheckpoint 验证稳定检查点证明：检查点序号上 2f+1 个不同签名者对 (Seq, State) 的聚合签名（同一证明只验一次）
+func (s *PBFTSimulator) verifyCheckpoint(verifier *node.Node, cp Checkpoint, cache map[string]bool) bool {
+	key := proofKey(cp)
+	if ok, done := cache[key]; done {
+		return ok
+	}
+	ok := false
+	distinct := make(map[int]bool, len(cp.Signers))
+	for _, id := range cp.Signers {
+		distinct[id] = true
+	}
+	n, known := s.members[cp.Seq]
+	if known && len(distinct) == len(cp.Signers) && len(distinct) >= 2*((n-1)/3)+1 {
+		if pks, err := s.keysAt(cp.Signers, cp.Seq); err == nil {
+			ok, _ = verifier.VerifyAggregate(pks, checkpointMessage(cp.Seq, cp.State), cp.AggSig)
+		}
+	}
+	cache[key] = ok
+	return ok
+}
+
+// maxVotes 各状态摘要中最多的签名数
+func maxVotes(votes map[string]*voteSet) int {
+	best := 0
+	for _, v := range votes {
+		if len(v.ids) > best {
+			best = len(v.ids)
+		}
+	}
+	return best
+}
+
+// retiredKey 已离开节点的公钥：低水位以上、离开之前的序号上的证书仍需用它验证
+type retiredKey struct {
+	pubKey []byte
+	pop    []byte // 公钥的持有证明（写入公钥清单）
+	leftAt int    // 离开后的第一个序号
+}
+
+// keysAt 序号 seq 时签名者的公钥（已离开的节点在其离开之前的序号上仍可验证）
+func (s *PBFTSimulator) keysAt(ids []int, seq int) ([][]byte, error) {
+	out := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		if pk, ok := s.registry.PublicKey(id); ok {
+			out = append(out, pk)
+			continue
+		}
+		if k, ok := s.retired[id]; ok && seq < k.leftAt {
+			out = append(out, k.pubKey)
+			continue
+		}
+		return nil, fmt.Errorf("apbft: no public key for node %d at seq %d", id, seq)
+	}
+	return out, nil
+}
+
+// nodeByID 按 ID 查找成员
+func (s *PBFTSimulator) nodeByID(id int) *node.Node {
+	for _, nd := range s.nodes {
+		if nd.ID == id {
+			return nd
+		}
+	}
+	return nil
+}
+
+// Replica 返回副本的日志与检查点概况
+func (s *PBFTSimulator) Replica(id int) (ReplicaStatus, bool) {
+	r, ok := s.replicas[id]
+	if !ok || s.nodeByID(id) == nil {
+		return ReplicaStatus{}, false
+	}
+	return ReplicaStatus{ID: id, Executed: r.executed, State: r.state, LowWatermark: r.stable.Seq, LogEntries: len(r.log), Fetches: r.fetches}, true
+}
+
+// StableCheckpoint 成员已知的最新稳定检查点（尚无时 Seq 为 0、Signers 为空）
+func (s *PBFTSimulator) StableCheckpoint() Checkpoint {
+	var best Checkpoint
+	for _, nd := range s.nodes {
+		if r, ok := s.replicas[nd.ID]; ok && r.stable.Signers != nil && (best.Signers == nil || r.stable.Seq > best.Seq) {
+			best = r.stable
+		}
+	}
+	return best
+}
@@ -0,0 +1,244 @@
+package apbft
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：长期存活的 APBFT 集群 =======================
+// RunAPBFTWithRoundAndSpecs 每次调用都新建节点，m 回到 InitialM，信誉机制在服务端形同虚设。
+// Cluster 持有节点、序号、虚拟时钟与信誉状态，跨多笔交易保留：
+// - Submit 为每笔交易分配递增序号（即 PBFT 的 round），经视图转换流程达成共识；
+// - UpdateMembership 跟随节点池变化（节点流失）；
+// - SubmitBatch / NewBatcher 把多笔交易合并为一个序号（见 batch.go），按配置的流水线深度并发推进多个序号（见 pipeline.go）；
+// - Snapshot / Restore（以及 SaveSnapshot / LoadSnapshot）保存与恢复跨进程的集群状态。
+// 所有方法可并发调用（内部串行执行）。
+
+// Tx 提交给集群的一笔交易
+type Tx struct {
+	ID     string
+	Amount int
+	Class  DemandClass // 【高亮-2026-10-16】需求类别：主节点与验证委员会按对应层级路由（见 routing.go）
+}
+
+// Cluster 长期存活的 APBFT 集群
+type Cluster struct {
+	mu     sync.Mutex
+	sim    *PBFTSimulator
+	seq    int         // 最近分配的序号（0 表示尚未提交过交易）
+	height int         // 已提交（达成共识）的序号数，即区块高度（一批交易一个区块）
+	batch  BatchConfig // NewBatcher 使用的批处理参数
+}
+
+// NewCluster 按节点池与配置创建集群（信誉模型、密钥库等来自 cfg）
+func NewCluster(specs []node.NodeSpec, cfg Config) (*Cluster, error) {
+	nodes := make([]*node.Node, 0, len(specs))
+	for _, sp := range specs {
+		nd := node.NewNode(sp.ID, sp.Throughput, sp.IsMalicious, true)
+		nd.SetOnline(sp.Active)
+		nodes = append(nodes, nd)
+	}
+	node.ApplyBehaviors(nodes, specs)
+
+	if err := cfg.Batch.Validate(); err != nil {
+		return nil, fmt.Errorf("apbft: %w", err)
+	}
+	sim := NewPBFTSimulator(nodes, true)
+	if err := sim.ApplyConfig(cfg); err != nil {
+		return nil, err
+	}
+	sim.ComputeTiers()
+	return &Cluster{sim: sim, batch: cfg.Batch}, nil
+}
+
+// Submit 对一笔交易执行一次共识（必要时发生视图转换），信誉结算保留到下一笔交易
+func (c *Cluster) Submit(tx Tx) PBFTResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	c.sim.demand, c.sim.amount = tx.Class, tx.Amount
+	ok, price, leader, view, _ := c.sim.RunPipelined(c.seq, []byte(tx.ID), c.sim.Clock().Elapsed())
+	c.sim.demand, c.sim.amount = DemandAny, 0
+	c.sim.Drain() // 单笔提交是同步的：等它（及之前进行中的序号）执行完
+	if ok {
+		c.height++
+	}
+	return c.sim.result(c.seq, tx.ID, ok, price, leader, view)
+}
+
+// UpdateMembership 应用节点池的新状态（加入 / 离开 / 宕机 / 恢复），见 PBFTSimulator.ApplyMembership
+func (c *Cluster) UpdateMembership(specs []node.NodeSpec) (joined, left []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.ApplyMembership(specs)
+}
+
+// Drain 等进行中的序号全部执行完（主时钟推进到最后一次执行）
+func (c *Cluster) Drain() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sim.Drain()
+}
+
+// LeaderTiers 各需求类别下最终主节点的层级分布与时延（见 PBFTSimulator.LeaderTiers）
+func (c *Cluster) LeaderTiers() []TierShare {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.LeaderTiers()
+}
+
+// CommitteeStats 验证委员会抽样与消息量统计（见 PBFTSimulator.CommitteeStats）
+func (c *Cluster) CommitteeStats() CommitteeStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.CommitteeStats()
+}
+
+// Manifest 验证法定人数证书所需的公钥清单（见 PBFTSimulator.Manifest）
+func (c *Cluster) Manifest() *node.Manifest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.Manifest()
+}
+
+// Seq 最近分配的交易序号
+func (c *Cluster) Seq() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+// Height 已达成共识的序号数（区块高度）
+func (c *Cluster) Height() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.height
+}
+
+// Nodes 当前成员（含宕机节点，按 ID 升序）
+func (c *Cluster) Nodes() []*node.Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.Nodes()
+}
+
+// NodeSnapshot 单个节点的可恢复状态
+type NodeSnapshot struct {
+	ID          int                  `json:"id"`
+	IsMalicious bool                 `json:"malicious"`
+	Throughput  float64              `json:"throughput"`
+	Tier        node.Tier            `json:"tier"`
+	Online      bool                 `json:"online"`
+	Reputation  node.ReputationState `json:"reputation"`
+	Executed    int                  `json:"executed"` // 副本已执行到的序号
+	State       string               `json:"state"`    // 执行到 Executed 时的状态摘要
+}
+
+// ClusterSnapshot 集群状态快照（不含密钥：持久身份由密钥库负责）
+type ClusterSnapshot struct {
+	Seq       int            `json:"seq"`
+	Height    int            `json:"height"`
+	ElapsedMs float64        `json:"elapsedMs"` // 虚拟时钟读数（仿真毫秒）
+	Nodes     []NodeSnapshot `json:"nodes"`
+	// Checkpoint 最新稳定检查点；恢复后各副本以它为低水位（消息日志不进入快照）
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// Snapshot 导出当前状态
+func (c *Cluster) Snapshot() ClusterSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snap := ClusterSnapshot{Seq: c.seq, Height: c.height, ElapsedMs: node.DurationMs(c.sim.Clock().Elapsed())}
+	if cp := c.sim.StableCheckpoint(); cp.Signers != nil {
+		snap.Checkpoint = &cp
+	}
+	for _, nd := range c.sim.Nodes() {
+		st, _ := c.sim.Replica(nd.ID)
+		snap.Nodes = append(snap.Nodes, NodeSnapshot{
+			ID:          nd.ID,
+			IsMalicious: nd.IsMalicious,
+			Throughput:  nd.Throughput,
+			Tier:        nd.Tier,
+			Online:      nd.Online(),
+			Reputation:  nd.Reputation(),
+			Executed:    st.Executed,
+			State:       st.State,
+		})
+	}
+	return snap
+}
+
+// Restore 恢复快照：成员按快照增删，节点的信誉、分层、吞吐量、在线状态与执行进度按快照设置，
+// 稳定检查点作为低水位，序号与区块高度从快照继续；虚拟时钟只向前推进。
+func (c *Cluster) Restore(snap ClusterSnapshot) error {
+	if snap.Seq < 0 || snap.Height < 0 || snap.Height > snap.Seq {
+		return fmt.Errorf("apbft: invalid snapshot (seq %d, height %d)", snap.Seq, snap.Height)
+	}
+	byID := make(map[int]NodeSnapshot, len(snap.Nodes))
+	specs := make([]node.NodeSpec, 0, len(snap.Nodes))
+	for _, ns := range snap.Nodes {
+		if _, dup := byID[ns.ID]; dup {
+			return fmt.Errorf("apbft: snapshot lists node %d twice", ns.ID)
+		}
+		byID[ns.ID] = ns
+		specs = append(specs, node.NodeSpec{ID: ns.ID, IsMalicious: ns.IsMalicious, Throughput: ns.Throughput, Active: ns.Online})
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].ID < specs[j].ID })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sim.ApplyMembership(specs)
+	for _, nd := range c.sim.nodes {
+		ns := byID[nd.ID]
+		nd.Throughput, nd.Tier = ns.Throughput, ns.Tier
+		nd.SetReputation(ns.Reputation)
+		r := c.sim.replica(nd.ID)
+		r.log, r.executed, r.state = make(map[int]*LogEntry), ns.Executed, ns.State
+		r.stable = Checkpoint{}
+		if snap.Checkpoint != nil {
+			r.stable = *snap.Checkpoint
+		}
+	}
+	c.sim.started, c.sim.execBase = true, 0
+	c.sim.pipe, c.sim.cpu = pipelineState{cfg: c.sim.pipe.cfg}, nil // 快照不含进行中的序号
+	c.sim.members, c.sim.committees = make(map[int]int), nil
+	c.sim.resetMarket() // 快照不含订单簿
+	if snap.Checkpoint != nil {
+		c.sim.members[snap.Checkpoint.Seq] = c.sim.n // 快照不含检查点时的成员数，按恢复后的成员验证证明
+	}
+	c.sim.Clock().AdvanceTo(time.Duration(snap.ElapsedMs * float64(time.Millisecond)))
+	c.sim.round = -1
+	c.seq, c.height = snap.Seq, snap.Height
+	return nil
+}
+
+// SaveSnapshot 把快照写入 JSON 文件
+func (c *Cluster) SaveSnapshot(path string) error {
+	data, err := json.MarshalIndent(c.Snapshot(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot 读取 SaveSnapshot 写出的快照
+func LoadSnapshot(path string) (ClusterSnapshot, error) {
+	var snap ClusterSnapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snap, fmt.Errorf("apbft: %w", err)
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("apbft: snapshot %s: %w", path, err)
+	}
+	return snap, nil
+}
@@ -0,0 +1,195 @@
+package apbft
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：按信誉加权抽样的验证委员会 =======================
+// 全体活跃节点都对 PREPARE / COMMIT 签名时，每个序号 O(n) 个签名、实际部署中 O(n²) 条消息。
+// Sampling 为 weighted 时，每个序号从健康节点中按权重不放回地抽取 CommitteeSize 个成员：
+// - 权重 = m × 层级系数（需求类别偏好的层级 3，相邻层 2，其余 1；未标注类别时按 High > Normal > Low）；
+// - 抽样以序号为种子（Efraimidis–Spirakis 加权抽样），各副本据相同的信誉状态得到相同的委员会；
+// - 提交阈值按委员会大小计算（见 routing.go），委员会外的副本只接收提案与提交证书，COMMIT 阶段的消息只在委员会内往返；
+// - 每个序号估计委员会中拜占庭节点超过 (c-1)/3 的概率：把抽样近似为 c 次独立抽取，
+//   拜占庭节点的权重占比为 p 时，概率为二项分布尾部 P[X > (c-1)/3]。p 取两种口径：
+//   实际恶意节点的权重占比（仿真已知），以及最坏情况——攻击者控制权重最大的 f 个候选节点。
+
+// CommitteeSampling 验证委员会的选取方式
+type CommitteeSampling string
+
+const (
+	SampleOrdered  CommitteeSampling = ""         // 按层级偏好与信誉排序取前 CommitteeSize 个（确定性）
+	SampleWeighted CommitteeSampling = "weighted" // 按 m 与层级加权抽样
+)
+
+// committeeTierWeight 加权抽样的层级系数（按偏好位置）
+var committeeTierWeight = []float64{3, 2, 1}
+
+// committeeWeights 候选节点的抽样权重
+func committeeWeights(cands []*node.Node, tiers []node.Tier) []float64 {
+	pos := make(map[node.Tier]int, len(tiers))
+	for i, t := range tiers {
+		pos[t] = i
+	}
+	w := make([]float64, len(cands))
+	for i, nd := range cands {
+		w[i] = float64(nd.M()) * committeeTierWeight[pos[nd.Tier]]
+	}
+	return w
+}
+
+// sampleCommittee 以 seq 为种子从 cands 中按权重不放回地抽取 size 个节点（Efraimidis–Spirakis：键 u^(1/w) 最大的 size 个）
+func sampleCommittee(seq int, cands []*node.Node, weights []float64, size int) []*node.Node {
+	rng := rand.New(rand.NewSource(int64(20260516 + seq)))
+	type keyed struct {
+		nd  *node.Node
+		key float64
+	}
+	ks := make([]keyed, len(cands))
+	for i, nd := range cands {
+		ks[i] = keyed{nd: nd, key: math.Log(rng.Float64()) / weights[i]}
+	}
+	sort.SliceStable(ks, func(i, j int) bool { return ks[i].key > ks[j].key })
+	if size > len(ks) {
+		size = len(ks)
+	}
+	out := make([]*node.Node, size)
+	for i := range out {
+		out[i] = ks[i].nd
+	}
+	return out
+}
+
+// committeeFailure 委员会大小为 c、每次抽到拜占庭节点的概率为 p 时，拜占庭成员超过 (c-1)/3 的概率
+func committeeFailure(c int, p float64) float64 {
+	if p <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return 1
+	}
+	fc := (c - 1) / 3
+	lc := func(n, k int) float64 {
+		a, _ := math.Lgamma(float64(n + 1))
+		b, _ := math.Lgamma(float64(k + 1))
+		d, _ := math.Lgamma(float64(n - k + 1))
+		return a - b - d
+	}
+	sum := 0.0
+	for k := fc + 1; k <= c; k++ {
+		sum += math.Exp(lc(c, k) + float64(k)*math.Log(p) + float64(c-k)*math.Log1p(-p))
+	}
+	return math.Min(sum, 1)
+}
+
+// committeeRisk 抽样时的拜占庭权重占比：实际恶意节点的占比，以及攻击者控制权重最大的 f 个候选时的占比
+func committeeRisk(cands []*node.Node, weights []float64, f int) (actual, worst float64) {
+	total := 0.0
+	for i, nd := range cands {
+		total += weights[i]
+		if nd.IsMalicious {
+			actual += weights[i]
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	sorted := append([]float64(nil), weights...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+	for i := 0; i < f && i < len(sorted); i++ {
+		worst += sorted[i]
+	}
+	return actual / total, worst / total
+}
+
+// committeeTally 运行期间的委员会与消息统计
+type committeeTally struct {
+	requests  int     // 三阶段流程次数（每个 view 一次）
+	messages  int     // 三阶段流程发送的消息数
+	votes     int     // leader 收到的 PREPARE / COMMIT 签名数
+	sampled   int     // 加权抽样的序号数
+	sumBound  float64 // 按实际恶意权重估计的失败概率之和
+	maxBound  float64
+	maxWorst  float64 // 最坏情况（攻击者控制权重最大的 f 个候选）的最大失败概率
+	unsafe    int     // 实际恶意成员超过 (c-1)/3 的委员会数
+	byzantine int     // 各委员会中实际恶意成员数之和
+}
+
+// recordSample 记录一次加权抽样的结果与概率估计
+func (s *PBFTSimulator) recordSample(members, cands []*node.Node, weights []float64) {
+	actual, worst := committeeRisk(cands, weights, s.f)
+	t := &s.sampling
+	c := len(members)
+	bound, worstBound := committeeFailure(c, actual), committeeFailure(c, worst)
+	t.sampled++
+	t.sumBound += bound
+	t.maxBound = math.Max(t.maxBound, bound)
+	t.maxWorst = math.Max(t.maxWorst, worstBound)
+	bad := 0
+	for _, nd := range members {
+		if nd.IsMalicious {
+			bad++
+		}
+	}
+	t.byzantine += bad
+	if bad > (c-1)/3 {
+		t.unsafe++
+	}
+}
+
+// CommitteeStats 委员会抽样与消息量的运行统计
+type CommitteeStats struct {
+	Sampling          CommitteeSampling `json:"sampling"`
+	CommitteeSize     int               `json:"committeeSize"`     // 0 表示全部活跃节点签名
+	Rounds            int               `json:"rounds"`            // 三阶段流程次数
+	AvgMessages       float64           `json:"avgMessages"`       // 每次三阶段流程的消息数
+	AvgSignatures     float64           `json:"avgSignatures"`     // 每次三阶段流程 leader 收到的签名数
+	Sampled           int               `json:"sampled"`           // 加权抽样的序号数
+	MeanFailureBound  float64           `json:"meanFailureBound"`  // 按实际恶意节点权重估计的委员会失败概率（均值）
+	MaxFailureBound   float64           `json:"maxFailureBound"`   // 同上（最大值）
+	WorstFailureBound float64           `json:"worstFailureBound"` // 攻击者控制权重最大的 f 个候选时的失败概率（最大值）
+	AvgByzantine      float64           `json:"avgByzantine"`      // 委员会中实际恶意成员的平均数
+	Unsafe            int               `json:"unsafe"`            // 实际恶意成员超过 (c-1)/3 的委员会数
+}
+
+// CommitteeStats 返回运行至今的委员会统计
+func (s *PBFTSimulator) CommitteeStats() CommitteeStats {
+	t := s.sampling
+	st := CommitteeStats{Sampling: s.routing.Sampling, CommitteeSize: s.routing.CommitteeSize, Rounds: t.requests, Sampled: t.sampled,
+		MaxFailureBound: t.maxBound, WorstFailureBound: t.maxWorst, Unsafe: t.unsafe}
+	if t.requests > 0 {
+		st.AvgMessages = float64(t.messages) / float64(t.requests)
+		st.AvgSignatures = float64(t.votes) / float64(t.requests)
+	}
+	if t.sampled > 0 {
+		st.MeanFailureBound = t.sumBound / float64(t.sampled)
+		st.AvgByzantine = float64(t.byzantine) / float64(t.sampled)
+	}
+	return st
+}
+
+// String 一行摘要
+func (st CommitteeStats) String() string {
+	var b strings.Builder
+	if st.CommitteeSize == 0 {
+		fmt.Fprintf(&b, "Committee: all active nodes sign")
+	} else {
+		mode := "ordered"
+		if st.Sampling == SampleWeighted {
+			mode = "weighted"
+		}
+		fmt.Fprintf(&b, "Committee: %s, size %d", mode, st.CommitteeSize)
+	}
+	fmt.Fprintf(&b, ", %.1f messages and %.1f signatures per three-phase run (%d runs)", st.AvgMessages, st.AvgSignatures, st.Rounds)
+	if st.Sampled > 0 {
+		fmt.Fprintf(&b, "; P[>1/3 Byzantine] mean %.2e max %.2e (worst case %.2e), avg Byzantine members %.2f, unsafe committees %d/%d",
+			st.MeanFailureBound, st.MaxFailureBound, st.WorstFailureBound, st.AvgByzantine, st.Unsafe, st.Sampled)
+	}
+	return b.String()
+}
@@ -1,9 +1,93 @@
 package apbft
 
+import (
+	"fmt"
+	"strings"
+
+	"PBFT1/node"
+)
+
 // 全局参数，可按需调整
 const (
 	InitialM   = 5   // m0
 	MMax       = 10  // mmax
 	MMin       = 0   // mmin, 当 m < mmin 判为恶意并排除
 	PrepareQuorumMultiplier = 2.0/3.0 // 准备/提交阶段阈值（简化）
+	PhaseTimeoutMs = 500 // 每个阶段等待网络消息的超时（仿真毫秒）
+	RoundIntervalMs = 200 // 【高亮-2026-10-16】相邻两轮之间的间隔（仿真毫秒，原 time.Sleep(200ms)）
+	ViewChangeTimeoutMs = 2500 // 【高亮-2026-10-16】副本的 view-change 计时器（仿真毫秒，须长于一次完整的三阶段流程），每换一次 view 翻倍
+	MaxViews = 5 // 【高亮-2026-10-16】单个请求最多尝试的 view 数（原 maxViewChange）
+	CheckpointInterval = 10 // 【高亮-2026-10-16】每 K 个序号生成一次检查点（稳定后截断低水位以下的消息日志）
+	TxWireBytes = 256 // 【高亮-2026-10-16】批量提案中每笔交易的线上字节数（交易正文 + 客户端签名）
 )
+
+
+// ======================= 【高亮-2026-10-16】新增：APBFT 运行配置（可与节点池写在同一个场景文件中） =======================
+// Config 目前包含信誉模型；未来的 APBFT 可调参数也放在这里
+type Config struct {
+	Reputation node.ReputationConfig `json:"reputation" yaml:"reputation"`
+	// 【高亮-2026-10-16】新增：持久化节点密钥库（为空时每次运行生成临时密钥）
+	Keystore *node.KeystoreConfig `json:"keystore,omitempty" yaml:"keystore,omitempty"`
+	// Keys 已打开的密钥库（由 OpenKeystore 填充，跨轮 / 跨交易复用解密后的密钥）
+	Keys *node.Keystore `json:"-" yaml:"-"`
+	// 【高亮-2026-10-16】新增：Cluster 批处理参数（见 batch.go）
+	Batch BatchConfig `json:"batch" yaml:"batch"`
+	// 【高亮-2026-10-16】新增：流水线深度与水位窗口（见 pipeline.go）
+	Pipeline PipelineConfig `json:"pipeline" yaml:"pipeline"`
+	// 【高亮-2026-10-16】新增：按需求类别的分层路由与验证委员会（见 routing.go）
+	Routing RoutingConfig `json:"routing" yaml:"routing"`
+	// 【高亮-2026-10-16】新增：撮合定价策略（见 pricing.go）
+	Pricing PricingConfig `json:"pricing" yaml:"pricing"`
+	// 【高亮-2026-10-16】新增：副本订单簿的出清方式（pairwise / uniform，见 auction.go）
+	Clearing ClearingMode `json:"clearing" yaml:"clearing"`
+}
+
+// DefaultConfig 与原行为一致（线性 ±1 信誉规则）
+func DefaultConfig() Config {
+	return Config{Reputation: node.DefaultReputationConfig(), Batch: DefaultBatchConfig(), Pipeline: DefaultPipelineConfig(), Routing: DefaultRoutingConfig(), Pricing: DefaultPricingConfig()}
+}
+
+// LoadConfig 从场景文件读取 APBFT 配置；文件中未出现的字段保持默认值
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if err := node.LoadScenarioFile(path, &cfg); err != nil {
+		return cfg, fmt.Errorf("apbft: %w", err)
+	}
+	if _, err := cfg.Reputation.Build(); err != nil {
+		return cfg, fmt.Errorf("apbft: %w", err)
+	}
+	if err := cfg.Batch.Validate(); err != nil {
+		return cfg, fmt.Errorf("apbft: %w", err)
+	}
+	if err := cfg.Pipeline.Validate(); err != nil {
+		return cfg, fmt.Errorf("apbft: %w", err)
+	}
+	if err := cfg.Routing.Validate(); err != nil {
+		return cfg, fmt.Errorf("apbft: %w", err)
+	}
+	// 【高亮-2026-10-16】策略名在此统一为小写，调用方（如 find_k）可直接与 PricingKNN 等常量比较
+	cfg.Pricing.Strategy = strings.ToLower(cfg.Pricing.Strategy)
+	if _, err := cfg.Pricing.Build(); err != nil {
+		return cfg, fmt.Errorf("apbft: %w", err)
+	}
+	if _, err := ParseClearingMode(string(cfg.Clearing)); err != nil {
+		return cfg, fmt.Errorf("apbft: %w", err)
+	}
+	if err := cfg.OpenKeystore(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// OpenKeystore 按 Keystore 配置打开密钥库（未配置或已打开时不做任何事）
+func (c *Config) OpenKeystore() error {
+	if c.Keystore == nil || c.Keys != nil {
+		return nil
+	}
+	ks, err := c.Keystore.Open()
+	if err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	c.Keys = ks
+	return nil
+}
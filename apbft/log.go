@@ -44,11 +44,11 @@ func (tl *TradeLog) LogAllOrderBook(orderBooks map[int]*OrderBook) {
 		title := fmt.Sprintf("[%s] --- Node %d Order Book ---\n", ts, nodeID)
 		tl.writeOrPrint(title)
 		tl.writeOrPrint(fmt.Sprintf("-- Buy Orders --\n"))
-		for _, b := range ob.Buys {
+		for _, b := range ob.Buys() {
 			tl.writeOrPrint(fmt.Sprintf("  ID:%d Price:%.2f Qty:%.2f By:%s\n", b.ID, b.Price, b.Quantity, b.User))
 		}
 		tl.writeOrPrint(fmt.Sprintf("-- Sell Orders --\n"))
-		for _, s := range ob.Sells {
+		for _, s := range ob.Sells() {
 			tl.writeOrPrint(fmt.Sprintf("  ID:%d Price:%.2f Qty:%.2f By:%s\n", s.ID, s.Price, s.Quantity, s.User))
 		}
 	}
@@ -67,11 +67,11 @@ func (tl *TradeLog) LogSingleOrderBook(nodeID int, ob *OrderBook) {
 	title := fmt.Sprintf("[%s] --- Node %d Order Book ---\n", ts, nodeID)
 	tl.writeOrPrint(title)
 	tl.writeOrPrint(fmt.Sprintf("-- Buy Orders --\n"))
-	for _, b := range ob.Buys {
+	for _, b := range ob.Buys() {
 		tl.writeOrPrint(fmt.Sprintf("  ID:%d Price:%.2f Qty:%.2f By:%s\n", b.ID, b.Price, b.Quantity, b.User))
 	}
 	tl.writeOrPrint(fmt.Sprintf("-- Sell Orders --\n"))
-	for _, s := range ob.Sells {
+	for _, s := range ob.Sells() {
 		tl.writeOrPrint(fmt.Sprintf("  ID:%d Price:%.2f Qty:%.2f By:%s\n", s.ID, s.Price, s.Quantity, s.User))
 	}
 }
@@ -0,0 +1,444 @@
+package apbft
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：复制的订单簿状态机 =======================
+// 原先 OrderBook.MatchAndClear 只在仿真进程里、共识之后跑一次，副本并不执行达成一致的订单。
+// 现在订单批次就是请求本身（EncodeOrders，摘要即请求字节的十六进制，COMMIT 证书覆盖全部订单）：
+// - 每个副本持有自己的订单簿，按序执行已提交的序号时解码订单批次并逐笔下单、撤单或改单（ApplyBatch，见 orders.go），
+//   不读取墙钟：时间取批次中达成一致的时间，时间优先按序号与订单编号决定；空请求与非订单请求不改变订单簿；
+// - 执行后计算订单簿的状态哈希；序号处理结束时比对在线副本的哈希，f+1 个以上副本一致的哈希为该序号的正确状态，
+//   其余副本记为分歧（Divergence），并从正确副本取得订单簿（状态传输）后继续执行；之后才执行到该序号的副本同样比对；
+// - 状态哈希增量维护（见 pricelevel.go）；状态一致的副本共享订单簿，修改前才复制（ownBook），
+//   从同一共享状态出发、执行同样订单的副本共用一次执行结果（sharedExec），每个不同的状态只复制、执行一次；
+// - 拜占庭副本在执行步骤（node.PhaseExecute）按行为策略作恶：沉默时跳过订单批次，其余作恶动作篡改订单数量。
+// 快照不含订单簿：Restore 后各副本从空订单簿开始。
+
+// orderBatchPrefix 订单批次请求的前缀（与单笔交易 ID 等其它请求区分）
+const orderBatchPrefix = "ORDERS\n"
+
+// orderBatch 订单批次：批次时间随请求达成一致，副本以它判断按时间过期的订单
+type orderBatch struct {
+	Time   time.Time      `json:"time,omitzero"`
+	Orders []OrderRequest `json:"orders"`
+	Clear  bool           `json:"clear,omitempty"` // 【高亮-2026-10-16】本批执行完后出清（集合竞价的轮次边界，见 auction.go）
+}
+
+// EncodeOrders 把时间为 at 的订单批次编码为共识请求
+func EncodeOrders(at time.Time, orders []OrderRequest) []byte {
+	return encodeBatch(orderBatch{Time: at, Orders: orders})
+}
+
+// EncodeClearing 把时间为 at、结束一个出清轮次的订单批次编码为共识请求：副本执行 orders（可为空）后出清
+func EncodeClearing(at time.Time, orders []OrderRequest) []byte {
+	return encodeBatch(orderBatch{Time: at, Orders: orders, Clear: true})
+}
+
+func encodeBatch(batch orderBatch) []byte {
+	data, _ := json.Marshal(batch) // 只含基本类型与时间，编码不会失败
+	return append([]byte(orderBatchPrefix), data...)
+}
+
+// decodeOrders 从提交的摘要（请求字节的十六进制）解码订单批次；不是订单批次时返回 false
+func decodeOrders(digest string) (orderBatch, bool) {
+	raw, err := hex.DecodeString(digest)
+	if err != nil || !strings.HasPrefix(string(raw), orderBatchPrefix) {
+		return orderBatch{}, false
+	}
+	var batch orderBatch
+	if err := json.Unmarshal(raw[len(orderBatchPrefix):], &batch); err != nil {
+		return orderBatch{}, false
+	}
+	return batch, true
+}
+
+// NewReplicatedOrderBook 副本上确定性执行的订单簿
+func NewReplicatedOrderBook() *OrderBook {
+	ob := NewOrderBook()
+	ob.replicated, ob.Logs = true, nil
+	return ob
+}
+
+// ApplyBatch 以序号 seq、批次时间 at 执行一批操作：先移除过期挂单，再按批内顺序逐笔执行（Apply），
+// 返回全部成交与每笔操作的结果（被拒绝的操作不改变订单簿，各副本一致）。
+// 连续撮合下最后再 MatchAndClear 一次（挂单不会交叉）；集合竞价下只挂单，出清由轮次边界的出清请求触发（EncodeClearing）
+func (ob *OrderBook) ApplyBatch(seq int, at time.Time, orders []OrderRequest) ([]Trade, []OrderResult) {
+	ob.mu.Lock()
+	ob.clock = at
+	ob.mu.Unlock()
+	ob.SetRound(seq)
+	var trades []Trade
+	results := make([]OrderResult, 0, len(orders))
+	for _, req := range orders {
+		res := ob.Apply(req)
+		trades = append(trades, res.Trades...)
+		results = append(results, res)
+	}
+	if ob.ClearingMode() != UniformClearing {
+		trades = append(trades, ob.MatchAndClear()...)
+	}
+	return trades, results
+}
+
+// StateHash 订单簿状态哈希：下一个订单编号、两方挂单数与两方的档位摘要（见 pricelevel.go；不含时间戳与日志）。
+// 摘要增量维护，只重算上次取哈希之后有变化的档位
+func (ob *OrderBook) StateHash() string {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	h := sha256.New()
+	var buf [8]byte
+	for _, v := range []int{ob.NextID, ob.bids.size, ob.asks.size} {
+		binary.BigEndian.PutUint64(buf[:], uint64(v))
+		h.Write(buf[:])
+	}
+	for _, side := range []*bookSide{ob.bids, ob.asks} {
+		digest := side.stateDigest()
+		h.Write(digest[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clone 复制订单簿（不含日志）：逐档位复制，不重新排序，缓存的档位摘要一并复制
+func (ob *OrderBook) clone() *OrderBook {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	cp := NewOrderBook()
+	cp.Logs, cp.NextID, cp.replicated, cp.seq, cp.clock, cp.clearing = nil, ob.NextID, ob.replicated, ob.seq, ob.clock, ob.clearing
+	cp.bids, cp.asks = ob.bids.copyTo(cp), ob.asks.copyTo(cp)
+	heap.Init(&cp.byRound)
+	heap.Init(&cp.byTime)
+	return cp
+}
+
+// MarketRecord 一个订单批次序号的执行结果
+type MarketRecord struct {
+	Seq       int           `json:"seq"`
+	StateHash string        `json:"stateHash"` // f+1 个以上副本一致的状态哈希（为空表示没有达到 f+1 个一致的副本）
+	Agreeing  int           `json:"agreeing"`  // 状态哈希一致的在线副本数
+	Executed  int           `json:"executed"`  // 序号处理结束时已执行到该序号的在线副本数
+	Trades    []Trade       `json:"trades"`    // 正确状态下的成交
+	Results   []OrderResult `json:"results"`   // 正确状态下批次中每笔操作的结果（与批次顺序一致）
+	Divergent []int         `json:"divergent,omitempty"`
+}
+
+// Divergence 副本执行后的状态哈希与正确状态不一致
+type Divergence struct {
+	Seq      int    `json:"seq"`
+	Node     int    `json:"node"`
+	Hash     string `json:"hash"`
+	Expected string `json:"expected"`
+}
+
+// canonicalBook 序号上 f+1 个副本一致的订单簿（状态传输的来源）
+type canonicalBook struct {
+	hash    string
+	book    *OrderBook
+	trades  []Trade
+	results []OrderResult
+}
+
+// marketState 订单簿的比对状态
+type marketState struct {
+	canonical   map[int]canonicalBook // 低水位以上各序号的正确订单簿
+	pending     map[int]bool          // 有副本执行了订单批次、尚未比对的序号
+	divergences []Divergence
+	last        *MarketRecord                // 当前请求的执行结果
+	execs       map[sharedExec]canonicalBook // 共享订单簿上的执行结果（稳定检查点时清空）
+	decoded     map[string]decodedBatch      // 按摘要缓存的解码结果：同一序号的各副本只解码一次（稳定检查点时清空）
+	agreed      canonicalBook                // 序号最大的正确订单簿（AgreedOrderBook）
+	agreedSeq   int
+}
+
+// decodedBatch 摘要的解码结果（不是订单批次时 ok 为 false）
+type decodedBatch struct {
+	batch orderBatch
+	ok    bool
+}
+
+// sharedExec 副本从共享的订单簿 book 出发执行摘要为 digest 的订单批次：起点与执行的订单都相同的副本结果也相同，
+// 只需复制、执行一次（分歧纠正后，篡改同一批次的恶意副本通常落在同一个状态上）
+type sharedExec struct {
+	book    *OrderBook
+	digest  string
+	variant int // execHonest / execSilent / execTampered
+}
+
+const (
+	execHonest   = iota // 按批次执行
+	execSilent          // 沉默：不执行批次中的订单
+	execTampered        // 篡改：数量加倍
+)
+
+// batch 解码摘要为 digest 的订单批次（按摘要缓存）
+func (m *marketState) batch(digest string) (orderBatch, bool) {
+	d, ok := m.decoded[digest]
+	if !ok {
+		if m.decoded == nil {
+			m.decoded = make(map[string]decodedBatch)
+		}
+		d.batch, d.ok = decodeOrders(digest)
+		m.decoded[digest] = d
+	}
+	return d.batch, d.ok
+}
+
+// ownBook 副本修改订单簿前取得独占的副本：与正确订单簿共享时先复制
+func (r *replicaState) ownBook() *OrderBook {
+	if r.shared {
+		r.book, r.shared = r.book.clone(), false
+	}
+	return r.book
+}
+
+// applyOrders 副本 r 执行序号 seq（摘要 digest，空请求为 "-"）后更新订单簿与状态哈希
+func (s *PBFTSimulator) applyOrders(r *replicaState, seq int, digest string) {
+	batch, ok := s.market.batch(digest)
+	if !ok {
+		return
+	}
+	orders, clear := batch.Orders, batch.Clear
+	key := sharedExec{book: r.book, digest: digest, variant: execHonest}
+	if nd := s.nodeByID(r.id); nd != nil {
+		act := nd.Decide(node.Step{Phase: node.PhaseExecute, Round: seq, Self: r.id, Leader: -1, Peer: -1, Digest: digest, Prominent: -1, View: s.view})
+		switch act.Kind {
+		case node.ActSilent:
+			orders, clear = nil, false
+			key.variant = execSilent
+		case node.ActReject, node.ActBadSign, node.ActEquivocate:
+			tampered := make([]OrderRequest, len(orders))
+			for i, o := range orders {
+				o.Quantity *= 2
+				tampered[i] = o
+			}
+			orders = tampered
+			key.variant = execTampered
+		}
+	}
+	if done, ok := s.market.execs[key]; ok && r.shared {
+		r.book, r.market, r.trades, r.results = done.book, done.hash, done.trades, done.results
+	} else {
+		shared := r.shared
+		book := r.ownBook()
+		r.trades, r.results = book.ApplyBatch(seq, batch.Time, orders)
+		if clear {
+			r.trades = append(r.trades, book.MatchAndClear()...)
+		}
+		r.market = book.StateHash()
+		if shared { // 从共享订单簿出发的结果同样共享给之后同一起点、执行同样订单的副本
+			r.shared = true
+			if s.market.execs == nil {
+				s.market.execs = make(map[sharedExec]canonicalBook)
+			}
+			s.market.execs[key] = canonicalBook{hash: r.market, book: book, trades: r.trades, results: r.results}
+		}
+	}
+	if s.market.pending == nil {
+		s.market.pending = make(map[int]bool)
+	}
+	if cb, audited := s.market.canonical[seq]; audited {
+		if r.market != cb.hash {
+			s.diverged(r, seq, cb)
+		}
+		return
+	}
+	s.market.pending[seq] = true
+}
+
+// diverged 记录分歧并从正确订单簿恢复副本状态（与正确订单簿共享，副本下次执行时才复制）
+func (s *PBFTSimulator) diverged(r *replicaState, seq int, cb canonicalBook) {
+	s.market.divergences = append(s.market.divergences, Divergence{Seq: seq, Node: r.id, Hash: r.market, Expected: cb.hash})
+	r.book, r.shared, r.market, r.trades, r.results = cb.book, true, cb.hash, cb.trades, cb.results
+}
+
+// auditMarket 序号 seq 处理结束：比对已执行到 seq 的在线副本的状态哈希
+func (s *PBFTSimulator) auditMarket(seq int) {
+	if !s.market.pending[seq] {
+		return
+	}
+	delete(s.market.pending, seq)
+	groups := make(map[string][]int)
+	executed := 0
+	for _, nd := range s.nodes {
+		r, ok := s.replicas[nd.ID]
+		if !ok || !nd.Online() || r.executed != seq {
+			continue
+		}
+		executed++
+		groups[r.market] = append(groups[r.market], nd.ID)
+	}
+	best := ""
+	for hash, ids := range groups {
+		if best == "" || len(ids) > len(groups[best]) || (len(ids) == len(groups[best]) && hash < best) {
+			best = hash
+		}
+	}
+	rec := &MarketRecord{Seq: seq, Agreeing: len(groups[best]), Executed: executed}
+	s.market.last = rec
+	if len(groups[best]) < s.f+1 {
+		fmt.Printf("[Market] seq %d: no state hash shared by f+1=%d replicas (%d executed)\n", seq, s.f+1, executed)
+		return
+	}
+	holder := s.replicas[groups[best][0]]
+	cb := canonicalBook{hash: best, book: holder.book, trades: holder.trades, results: holder.results}
+	for _, id := range groups[best] { // 状态一致的副本共享同一个订单簿：下一批次每个不同的状态只复制、执行一次
+		r := s.replicas[id]
+		r.book, r.shared = cb.book, true
+	}
+	if s.market.canonical == nil {
+		s.market.canonical = make(map[int]canonicalBook)
+	}
+	s.market.canonical[seq] = cb
+	if seq >= s.market.agreedSeq {
+		s.market.agreed, s.market.agreedSeq = cb, seq
+	}
+	rec.StateHash, rec.Trades, rec.Results = best, cb.trades, cb.results
+	hashes := make([]string, 0, len(groups))
+	for hash := range groups {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		if hash == best {
+			continue
+		}
+		for _, id := range groups[hash] {
+			rec.Divergent = append(rec.Divergent, id)
+			s.diverged(s.replicas[id], seq, cb)
+		}
+	}
+	sort.Ints(rec.Divergent)
+}
+
+// installBook 副本经状态传输跳到检查点 seq：订单簿取该序号的正确状态（没有时保留原状态，之后比对时纠正）
+func (s *PBFTSimulator) installBook(r *replicaState, seq int) {
+	if cb, ok := s.market.canonical[seq]; ok {
+		r.book, r.shared, r.market, r.trades, r.results = cb.book, true, cb.hash, cb.trades, cb.results
+	}
+}
+
+// pruneMarket 稳定检查点 seq 之下的正确订单簿不再需要（保留 seq 本身供状态传输）
+func (s *PBFTSimulator) pruneMarket(seq int) {
+	for q := range s.market.canonical {
+		if q < seq {
+			delete(s.market.canonical, q)
+		}
+	}
+	for q := range s.market.pending {
+		if q < seq {
+			delete(s.market.pending, q)
+		}
+	}
+	clear(s.market.execs)
+	clear(s.market.decoded)
+}
+
+// resetMarket 各副本从空订单簿开始（快照不含订单簿）
+func (s *PBFTSimulator) resetMarket() {
+	s.market = marketState{}
+	for _, r := range s.replicas {
+		r.book, r.shared = s.newReplicaBook(), false
+		r.market, r.trades, r.results = r.book.StateHash(), nil, nil
+	}
+}
+
+// Market 当前请求（订单批次）的执行结果；不是订单批次时为 nil
+func (s *PBFTSimulator) Market() *MarketRecord {
+	return s.market.last
+}
+
+// MarketDivergences 至今记录的全部分歧
+func (s *PBFTSimulator) MarketDivergences() []Divergence {
+	return append([]Divergence(nil), s.market.divergences...)
+}
+
+// AgreedOrderBook 最近一个序号上 f+1 个以上副本一致的订单簿的副本（不含日志）；还没有时为空订单簿
+func (s *PBFTSimulator) AgreedOrderBook() *OrderBook {
+	if s.market.agreed.book == nil {
+		return s.newReplicaBook()
+	}
+	return s.market.agreed.book.clone()
+}
+
+// ReplicaOrderBook 副本订单簿的副本（不含日志）
+func (s *PBFTSimulator) ReplicaOrderBook(id int) (*OrderBook, bool) {
+	r, ok := s.replicas[id]
+	if !ok {
+		return nil, false
+	}
+	return r.book.clone(), true
+}
+
+// SubmitOrders 对一个订单批次执行一次共识（一个序号），各副本执行后比对订单簿状态；同步返回。
+// 集合竞价模式下订单只挂单，成交在 ClearMarket 出清时产生
+func (c *Cluster) SubmitOrders(orders []OrderRequest) PBFTResult {
+	return c.submitOrders(orders, false, "orders")
+}
+
+// ClearMarket 结束一个出清轮次：经共识提交出清请求（一个序号），各副本在同一位置统一出清；同步返回，
+// 成交见 PBFTResult.Market.Trades
+func (c *Cluster) ClearMarket() PBFTResult {
+	return c.submitOrders(nil, true, "clear")
+}
+
+func (c *Cluster) submitOrders(orders []OrderRequest, clear bool, label string) PBFTResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	for _, o := range orders {
+		c.sim.amount += int(o.Quantity)
+	}
+	request := EncodeOrders(c.sim.Clock().Now(), orders)
+	if clear {
+		request = EncodeClearing(c.sim.Clock().Now(), orders)
+	}
+	ok, price, leader, view, _ := c.sim.RunPipelined(c.seq, request, c.sim.Clock().Elapsed())
+	c.sim.amount = 0
+	c.sim.Drain()
+	if ok {
+		c.height++
+	}
+	return c.sim.result(c.seq, fmt.Sprintf("%s-%d", label, c.seq), ok, price, leader, view)
+}
+
+// Clearing 副本订单簿的出清方式
+func (c *Cluster) Clearing() ClearingMode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sim.clearing == "" {
+		return PairwiseClearing
+	}
+	return c.sim.clearing
+}
+
+// MarketDivergences 至今记录的订单簿分歧（见 PBFTSimulator.MarketDivergences）
+func (c *Cluster) MarketDivergences() []Divergence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.MarketDivergences()
+}
+
+// AgreedOrderBook 一致的订单簿（见 PBFTSimulator.AgreedOrderBook）：服务端据此计算各用户挂单冻结的余额
+func (c *Cluster) AgreedOrderBook() *OrderBook {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.AgreedOrderBook()
+}
+
+// ReplicaOrderBook 副本订单簿（见 PBFTSimulator.ReplicaOrderBook）
+func (c *Cluster) ReplicaOrderBook(id int) (*OrderBook, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sim.ReplicaOrderBook(id)
+}
@@ -0,0 +1,100 @@
+package apbft
+
+import (
+	"fmt"
+	"sort"
+
+	"PBFT1/node"
+	"PBFT1/topology"
+)
+
+// ======================= 【高亮-2026-10-16】新增：节点流失下的成员变更 =======================
+// ApplyMembership 让跨轮演化的模拟器跟上节点池的变化（见 node.Churn）：
+// - specs 中新出现的 ID 作为新节点加入（登记公钥、沿用信誉模型与虚拟时钟、装配行为策略）；
+// - 不再出现的节点离开：移出成员并注销公钥；
+// - 其余节点按 Active 标记在线/宕机。宕机节点仍计入 n（法定人数不变），但不收发消息。
+// 成员或在线状态有变化时重新计算 f 与吞吐量分层。返回本次加入与离开的节点 ID（升序）。
+func (s *PBFTSimulator) ApplyMembership(specs []node.NodeSpec) (joined, left []int) {
+	want := make(map[int]node.NodeSpec, len(specs))
+	for _, sp := range specs {
+		want[sp.ID] = sp
+	}
+
+	changed := false
+	kept := make([]*node.Node, 0, len(specs))
+	have := make(map[int]bool, len(s.nodes))
+	for _, nd := range s.nodes {
+		sp, ok := want[nd.ID]
+		if !ok {
+			left = append(left, nd.ID)
+			if s.retired == nil {
+				s.retired = make(map[int]retiredKey)
+			}
+			if pk, ok := s.registry.PublicKey(nd.ID); ok {
+				pop, _ := s.registry.ProofOfPossession(nd.ID)
+				s.retired[nd.ID] = retiredKey{pubKey: pk, pop: pop, leftAt: s.round + 1} // 低水位以上的旧证书仍需验证
+			}
+			s.registry.Revoke(nd.ID)
+			delete(s.replicas, nd.ID)
+			continue
+		}
+		have[nd.ID] = true
+		if nd.Online() != sp.Active {
+			nd.SetOnline(sp.Active)
+			changed = true
+		}
+		kept = append(kept, nd)
+	}
+
+	var added []*node.Node
+	for _, sp := range specs {
+		if have[sp.ID] {
+			continue
+		}
+		nd := node.NewNode(sp.ID, sp.Throughput, sp.IsMalicious, s.useBlst)
+		if s.keys != nil {
+			if _, err := s.keys.AttachKeys([]*node.Node{nd}); err != nil {
+				fmt.Printf("apbft: node %d joins with an ephemeral key: %v\n", sp.ID, err)
+			}
+		}
+		nd.SetClock(s.clock)
+		nd.SetOnline(sp.Active)
+		if s.repModel != nil {
+			nd.SetReputationModel(s.repModel)
+		}
+		pop, _ := nd.ProofOfPossession()
+		_ = s.registry.Register(nd.ID, nd.PublicKey(), pop) // 新 ID 从未登记过，不会冲突
+		if s.joined == nil {
+			s.joined = make(map[int]int)
+		}
+		s.joined[nd.ID] = s.round + 1
+		added = append(added, nd)
+		joined = append(joined, sp.ID)
+	}
+	if len(added) > 0 {
+		node.ApplyBehaviors(added, specs) // 联盟行为按整个节点池构建
+		kept = append(kept, added...)
+		sort.Slice(kept, func(i, j int) bool { return kept[i].ID < kept[j].ID })
+	}
+
+	if len(joined) == 0 && len(left) == 0 && !changed {
+		return nil, nil
+	}
+	s.nodes = kept
+	s.n = len(kept)
+	s.f = (s.n - 1) / 3
+	for _, nd := range added {
+		if !s.grid.HasNode(nd.ID) {
+			// 新节点不在当前拓扑中：换成覆盖全部节点的共享拓扑
+			s.grid = topology.ForPool(specs)
+			break
+		}
+	}
+	s.ComputeTiers()
+	return joined, left
+}
+
+// Nodes 当前成员（含宕机节点，按 ID 升序）
+func (s *PBFTSimulator) Nodes() []*node.Node {
+	return append([]*node.Node(nil), s.nodes...)
+}
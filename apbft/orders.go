@@ -0,0 +1,407 @@
+package apbft
+
+import (
+	"math"
+	"time"
+)
+
+// ======================= 【高亮-2026-10-16】新增：订单类型、撤单与改单 =======================
+// SubmitOrder 只能挂限价单，挂上后等 MatchAndClear 撮合，也不能撤单或改单。
+// Place / Cancel / Amend 在订单到达时即与对手方挂单按价格优先、时间优先撮合，并返回结果（OrderResult）与明确的原因：
+// - 市价单（Market）：不限价，成交价取挂单价；剩余部分撤销，不挂单；
+// - 有效期（TimeInForce）：GTC 剩余部分挂单；IOC 立即成交、剩余撤销；FOK 不能全部立即成交时整单拒绝；
+// - 只挂单（PostOnly）：会与对手方成交时整单拒绝，只能是 GTC 限价单；
+// - 最小成交量（MinQuantity）：到达时可立即成交的数量低于它时整单拒绝（挂单后不再适用）；
+// - 过期：ExpireRound 之后的轮次（SetRound / 副本上的共识序号）或 ExpireAt 起失效，下次操作订单簿时移除；
+// - 撤单、改单按订单编号，只有下单用户可以操作；只减少数量的改单保留时间优先，改价或加量等同重新下单。
+// 限价单之间的成交价沿用 MatchAndClear 的规则（买卖报价的平均）。副本上订单批次逐笔按此执行（见 market.go）。
+// 集合竞价模式（UniformClearing，见 auction.go）下下单、改单只挂单不撮合，等轮次边界的 MatchAndClear 统一出清。
+
+// OrderKind 订单的价格类型
+type OrderKind string
+
+const (
+	Limit  OrderKind = "limit"  // 限价单
+	Market OrderKind = "market" // 市价单
+)
+
+// TimeInForce 订单有效期类型
+type TimeInForce string
+
+const (
+	GTC TimeInForce = "GTC" // 剩余部分挂单直到成交、撤单或过期
+	IOC TimeInForce = "IOC" // 立即成交，剩余部分撤销
+	FOK TimeInForce = "FOK" // 全部立即成交，否则整单拒绝
+)
+
+// OrderAction 对订单簿的操作
+type OrderAction string
+
+const (
+	ActionPlace  OrderAction = "place"
+	ActionCancel OrderAction = "cancel"
+	ActionAmend  OrderAction = "amend"
+)
+
+// OrderStatus 操作后订单的状态
+type OrderStatus string
+
+const (
+	StatusResting   OrderStatus = "resting"   // 剩余部分挂在订单簿上
+	StatusFilled    OrderStatus = "filled"    // 全部成交
+	StatusCancelled OrderStatus = "cancelled" // 已撤单，或 IOC / 市价单的剩余部分已撤销
+	StatusRejected  OrderStatus = "rejected"  // 操作被拒绝，订单簿不变
+)
+
+// OrderReason 拒绝或撤销的原因
+type OrderReason string
+
+const (
+	ReasonInvalidSide        OrderReason = "invalid_side"
+	ReasonInvalidKind        OrderReason = "invalid_kind"
+	ReasonInvalidTIF         OrderReason = "invalid_tif"
+	ReasonInvalidPrice       OrderReason = "invalid_price"
+	ReasonInvalidQuantity    OrderReason = "invalid_quantity"
+	ReasonInvalidMinQuantity OrderReason = "invalid_min_quantity"
+	ReasonInvalidExpiry      OrderReason = "invalid_expiry"
+	ReasonInvalidAction      OrderReason = "invalid_action"
+	ReasonPostOnlyNotGTC     OrderReason = "post_only_requires_gtc_limit"
+	ReasonWouldCross         OrderReason = "post_only_would_cross"
+	ReasonFOKUnfilled        OrderReason = "fok_not_fully_fillable"
+	ReasonMinQuantity        OrderReason = "min_quantity_not_fillable"
+	ReasonExpired            OrderReason = "expired"
+	ReasonUnknownOrder       OrderReason = "unknown_order"
+	ReasonNotOwner           OrderReason = "not_owner"
+	ReasonUnfilled           OrderReason = "unfilled_remainder_cancelled"
+	ReasonCancelled          OrderReason = "cancelled_by_user"
+	ReasonAuctionLimitOnly   OrderReason = "auction_requires_gtc_limit" // 【高亮-2026-10-16】新增：集合竞价模式（见 auction.go）
+)
+
+// reasonMessages 原因的说明（接口返回给用户）
+var reasonMessages = map[OrderReason]string{
+	ReasonInvalidSide:        "订单方向无效",
+	ReasonInvalidKind:        "订单类型无效（limit / market）",
+	ReasonInvalidTIF:         "有效期类型无效（GTC / IOC / FOK）",
+	ReasonInvalidPrice:       "价格无效",
+	ReasonInvalidQuantity:    "数量无效",
+	ReasonInvalidMinQuantity: "最小成交量无效（须在 0 与数量之间）",
+	ReasonInvalidExpiry:      "过期轮次无效",
+	ReasonInvalidAction:      "操作无效（place / cancel / amend）",
+	ReasonPostOnlyNotGTC:     "只挂单必须是 GTC 限价单",
+	ReasonWouldCross:         "只挂单会立即成交",
+	ReasonFOKUnfilled:        "FOK 订单无法全部立即成交",
+	ReasonMinQuantity:        "可立即成交的数量低于最小成交量",
+	ReasonExpired:            "订单已过期",
+	ReasonUnknownOrder:       "订单不存在（已成交、撤销或过期）",
+	ReasonNotOwner:           "只能操作自己的订单",
+	ReasonUnfilled:           "未成交部分已撤销",
+	ReasonCancelled:          "已撤单",
+	ReasonAuctionLimitOnly:   "集合竞价只接受 GTC 限价单（不含只挂单与最小成交量）",
+}
+
+// Message 原因的中文说明
+func (r OrderReason) Message() string {
+	if msg, ok := reasonMessages[r]; ok {
+		return msg
+	}
+	return string(r)
+}
+
+// OrderRequest 一次下单、撤单或改单（副本上即订单批次中的一项）
+type OrderRequest struct {
+	Action      OrderAction `json:"action,omitempty"`  // 为空时为 place
+	OrderID     int         `json:"orderId,omitempty"` // cancel / amend 的目标订单
+	Type        OrderType   `json:"type"`
+	Kind        OrderKind   `json:"kind,omitempty"` // 为空时为 limit
+	TIF         TimeInForce `json:"tif,omitempty"`  // 为空时为 GTC
+	PostOnly    bool        `json:"postOnly,omitempty"`
+	Price       float64     `json:"price"`    // 限价（市价单忽略）；amend 时为新价格，0 表示不改
+	Quantity    float64     `json:"quantity"` // amend 时为新的剩余数量，0 表示不改
+	MinQuantity float64     `json:"minQuantity,omitempty"`
+	ExpireRound int         `json:"expireRound,omitempty"`
+	ExpireAt    time.Time   `json:"expireAt,omitzero"`
+	User        string      `json:"user"`
+}
+
+// OrderResult 操作的结果
+type OrderResult struct {
+	Action    OrderAction `json:"action"`
+	OrderID   int         `json:"orderId"` // 被拒绝的新订单没有编号，为 -1
+	Status    OrderStatus `json:"status"`
+	Reason    OrderReason `json:"reason,omitempty"`
+	Filled    float64     `json:"filled"`    // 本次操作成交的数量
+	Remaining float64     `json:"remaining"` // 挂在订单簿上的剩余数量
+	Trades    []Trade     `json:"trades,omitempty"`
+}
+
+// Rejected 操作是否被拒绝
+func (r OrderResult) Rejected() bool {
+	return r.Status == StatusRejected
+}
+
+// Apply 按 req.Action 下单、撤单或改单
+func (ob *OrderBook) Apply(req OrderRequest) OrderResult {
+	switch req.Action {
+	case "", ActionPlace:
+		return ob.Place(req)
+	case ActionCancel:
+		return ob.Cancel(req.OrderID, req.User)
+	case ActionAmend:
+		return ob.Amend(req.OrderID, req.User, req.Price, req.Quantity)
+	}
+	return ob.reject(req.Action, -1, ReasonInvalidAction)
+}
+
+// Place 下单：先与对手方挂单撮合，剩余部分按有效期类型挂单或撤销
+func (ob *OrderBook) Place(req OrderRequest) OrderResult {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.expire()
+	if req.Kind == "" {
+		req.Kind = Limit
+	}
+	if req.TIF == "" {
+		req.TIF = GTC
+	}
+	if reason := checkOrder(req); reason != "" {
+		return ob.reject(ActionPlace, -1, reason)
+	}
+	if (req.ExpireRound > 0 && req.ExpireRound < ob.seq) || (!req.ExpireAt.IsZero() && !ob.now().Before(req.ExpireAt)) {
+		return ob.reject(ActionPlace, -1, ReasonExpired)
+	}
+	auction := ob.clearing == UniformClearing
+	if auction && (req.Kind != Limit || req.TIF != GTC || req.PostOnly || req.MinQuantity > 0) {
+		return ob.reject(ActionPlace, -1, ReasonAuctionLimitOnly)
+	}
+	market := req.Kind == Market
+	o := Order{
+		ID: ob.NextID, Timestamp: ob.now(), Type: req.Type, Price: req.Price, Quantity: req.Quantity, User: req.User, Seq: ob.seq,
+		PostOnly: req.PostOnly, ExpireRound: req.ExpireRound, ExpireAt: req.ExpireAt,
+	}
+	if market {
+		o.Price = 0
+	}
+	left := o.Quantity
+	if !auction && (req.PostOnly || req.TIF == FOK || req.MinQuantity > 0) { // 只有这几种订单需要预先知道能成交多少
+		left = ob.unfilled(&o, market)
+	}
+	switch {
+	case req.PostOnly && left < o.Quantity:
+		return ob.reject(ActionPlace, -1, ReasonWouldCross)
+	case req.TIF == FOK && left > 0:
+		return ob.reject(ActionPlace, -1, ReasonFOKUnfilled)
+	case req.MinQuantity > 0 && o.Quantity-left < req.MinQuantity:
+		return ob.reject(ActionPlace, -1, ReasonMinQuantity)
+	}
+	ob.NextID++
+	res := OrderResult{Action: ActionPlace, OrderID: o.ID}
+	if !auction {
+		res.Trades = ob.take(&o, market)
+	}
+	res.Filled = req.Quantity - o.Quantity
+	switch {
+	case o.Quantity <= 0:
+		res.Status = StatusFilled
+	case market || req.TIF != GTC:
+		res.Status, res.Reason = StatusCancelled, ReasonUnfilled
+	default:
+		ob.add(o)
+		res.Status, res.Remaining = StatusResting, o.Quantity
+	}
+	ob.logf("Order %d placed (%s %s): %s, filled %.2f, resting %.2f", o.ID, req.Kind, req.TIF, res.Status, res.Filled, res.Remaining)
+	return res
+}
+
+// Cancel 撤销挂单
+func (ob *OrderBook) Cancel(id int, user string) OrderResult {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.expire()
+	e, ok := ob.index[id]
+	if !ok {
+		return ob.reject(ActionCancel, id, ReasonUnknownOrder)
+	}
+	if e.order.User != user {
+		return ob.reject(ActionCancel, id, ReasonNotOwner)
+	}
+	ob.drop(e)
+	ob.logf("Order %d cancelled by %s", id, user)
+	return OrderResult{Action: ActionCancel, OrderID: id, Status: StatusCancelled, Reason: ReasonCancelled}
+}
+
+// Amend 改单：price 为新价格、quantity 为新的剩余数量（为 0 时不改）。
+// 只减少数量时原地修改、保留时间优先；改价或加量时按新价格重新撮合、排到价格档位末尾（订单编号不变）
+func (ob *OrderBook) Amend(id int, user string, price, quantity float64) OrderResult {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.expire()
+	e, ok := ob.index[id]
+	switch {
+	case !ok:
+		return ob.reject(ActionAmend, id, ReasonUnknownOrder)
+	case e.order.User != user:
+		return ob.reject(ActionAmend, id, ReasonNotOwner)
+	case price != 0 && !positive(price):
+		return ob.reject(ActionAmend, id, ReasonInvalidPrice)
+	case quantity != 0 && !positive(quantity), price == 0 && quantity == 0:
+		return ob.reject(ActionAmend, id, ReasonInvalidQuantity)
+	}
+	o := e.order
+	if price == 0 {
+		price = o.Price
+	}
+	if quantity == 0 {
+		quantity = o.Quantity
+	}
+	if price == o.Price && quantity <= o.Quantity {
+		ob.setQuantity(e, quantity)
+		ob.logf("Order %d amended in place: quantity %.2f", id, quantity)
+		return OrderResult{Action: ActionAmend, OrderID: id, Status: StatusResting, Remaining: quantity}
+	}
+	o.Price, o.Quantity, o.Timestamp, o.Seq = price, quantity, ob.now(), ob.seq
+	auction := ob.clearing == UniformClearing
+	if o.PostOnly && !auction && ob.unfilled(&o, false) < o.Quantity {
+		return ob.reject(ActionAmend, id, ReasonWouldCross)
+	}
+	ob.drop(e)
+	res := OrderResult{Action: ActionAmend, OrderID: id}
+	if !auction {
+		res.Trades = ob.take(&o, false)
+	}
+	res.Filled = quantity - o.Quantity
+	if o.Quantity <= 0 {
+		res.Status = StatusFilled
+	} else {
+		ob.add(o)
+		res.Status, res.Remaining = StatusResting, o.Quantity
+	}
+	ob.logf("Order %d amended: price %.2f, filled %.2f, resting %.2f", id, price, res.Filled, res.Remaining)
+	return res
+}
+
+// SetRound 设置当前轮次并移除过期的挂单，返回过期的订单（副本上由 ApplyBatch 按共识序号设置）
+func (ob *OrderBook) SetRound(round int) []Order {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.seq = round
+	return ob.expire()
+}
+
+// checkOrder 校验新订单的参数（Kind、TIF 已填默认值），返回拒绝原因；合法时为空
+func checkOrder(req OrderRequest) OrderReason {
+	switch {
+	case req.Type != Buy && req.Type != Sell:
+		return ReasonInvalidSide
+	case req.Kind != Limit && req.Kind != Market:
+		return ReasonInvalidKind
+	case req.TIF != GTC && req.TIF != IOC && req.TIF != FOK:
+		return ReasonInvalidTIF
+	case req.Kind == Limit && !positive(req.Price):
+		return ReasonInvalidPrice
+	case !positive(req.Quantity):
+		return ReasonInvalidQuantity
+	case !(req.MinQuantity >= 0) || req.MinQuantity > req.Quantity:
+		return ReasonInvalidMinQuantity
+	case req.ExpireRound < 0:
+		return ReasonInvalidExpiry
+	case req.PostOnly && (req.Kind != Limit || req.TIF != GTC):
+		return ReasonPostOnlyNotGTC
+	}
+	return ""
+}
+
+// positive 有限的正数（NaN、无穷大与非正数都不是；价格档位以价格为键，NaN 价格会破坏档位）
+func positive(v float64) bool {
+	return v > 0 && !math.IsInf(v, 1)
+}
+
+// reject 拒绝操作（订单簿不变）
+func (ob *OrderBook) reject(action OrderAction, id int, reason OrderReason) OrderResult {
+	ob.logf("%s order %d rejected: %s", action, id, reason)
+	return OrderResult{Action: action, OrderID: id, Status: StatusRejected, Reason: reason}
+}
+
+// opposite 订单 o 的对手方档位
+func (ob *OrderBook) opposite(o *Order) *bookSide {
+	if o.Type == Buy {
+		return ob.asks
+	}
+	return ob.bids
+}
+
+// crosses 挂单 rest 的价格能否与到达的订单 o 成交
+func crosses(o, rest *Order, market bool) bool {
+	switch {
+	case market:
+		return true
+	case o.Type == Buy:
+		return rest.Price <= o.Price
+	default:
+		return rest.Price >= o.Price
+	}
+}
+
+// unfilled 订单 o 与对手方挂单撮合后剩余的数量（不改变订单簿；与 take 的计算一致）
+func (ob *OrderBook) unfilled(o *Order, market bool) float64 {
+	left := o.Quantity
+	ob.opposite(o).walk(func(e *bookEntry) bool {
+		if left <= 0 || !crosses(o, &e.order, market) {
+			return false
+		}
+		left -= min(left, e.order.Quantity)
+		return true
+	})
+	return left
+}
+
+// take 订单 o 按价格优先、时间优先与对手方挂单撮合，扣减双方数量并移除成交完毕的挂单
+func (ob *OrderBook) take(o *Order, market bool) []Trade {
+	book := ob.opposite(o)
+	var trades []Trade
+	for o.Quantity > 0 {
+		e := book.best()
+		if e == nil || !crosses(o, &e.order, market) {
+			break
+		}
+		rest := &e.order
+		quantity := min(o.Quantity, rest.Quantity)
+		price := (o.Price + rest.Price) / 2
+		if market {
+			price = rest.Price // 市价单按挂单价成交
+		}
+		buy, sell := o, rest
+		if o.Type == Sell {
+			buy, sell = rest, o
+		}
+		trade := Trade{
+			BuyOrderID: buy.ID, SellOrderID: sell.ID, Price: price, Quantity: quantity,
+			Timestamp: ob.now(), Seq: ob.seq, BuyUser: buy.User, SellUser: sell.User,
+		}
+		trades = append(trades, trade)
+		ob.logf("Matched trade: %+v", trade)
+		o.Quantity -= quantity
+		ob.setQuantity(e, rest.Quantity-quantity)
+		if rest.Quantity <= 0 {
+			ob.drop(e)
+		}
+	}
+	return trades
+}
+
+// expire 移除过期的挂单并返回它们（先按轮次、再按时间）
+func (ob *OrderBook) expire() []Order {
+	now := ob.now()
+	var expired []Order
+	for {
+		e := ob.byRound.due(func(o *Order) bool { return ob.seq > o.ExpireRound })
+		if e == nil {
+			e = ob.byTime.due(func(o *Order) bool { return !now.Before(o.ExpireAt) })
+		}
+		if e == nil {
+			return expired
+		}
+		ob.drop(e)
+		expired = append(expired, e.order)
+		ob.logf("Order %d expired", e.order.ID)
+	}
+}
@@ -0,0 +1,198 @@
+package apbft
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testNow 测试订单簿的批次时间
+var testNow = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+// testBook 第 3 轮的副本订单簿（不写日志），挂单：
+//
+//	#0 alice 卖 100 × 5   #1 alice 卖 101 × 5   #2 bob 买 95 × 5
+func testBook(t *testing.T) *OrderBook {
+	t.Helper()
+	ob := NewReplicatedOrderBook()
+	ob.clock = testNow
+	ob.SetRound(3)
+	for _, req := range []OrderRequest{
+		{Type: Sell, Price: 100, Quantity: 5, User: "alice"},
+		{Type: Sell, Price: 101, Quantity: 5, User: "alice"},
+		{Type: Buy, Price: 95, Quantity: 5, User: "bob"},
+	} {
+		if res := ob.Place(req); res.Status != StatusResting {
+			t.Fatalf("setup %+v: %s %s", req, res.Status, res.Reason)
+		}
+	}
+	return ob
+}
+
+func TestOrderBookApply(t *testing.T) {
+	cases := []struct {
+		name      string
+		req       OrderRequest
+		status    OrderStatus
+		reason    OrderReason
+		filled    float64
+		remaining float64
+	}{
+		// 参数校验
+		{"invalid side", OrderRequest{Type: OrderType(7), Price: 100, Quantity: 1, User: "carol"}, StatusRejected, ReasonInvalidSide, 0, 0},
+		{"invalid kind", OrderRequest{Type: Buy, Kind: "stop", Price: 100, Quantity: 1, User: "carol"}, StatusRejected, ReasonInvalidKind, 0, 0},
+		{"invalid tif", OrderRequest{Type: Buy, TIF: "GTD", Price: 100, Quantity: 1, User: "carol"}, StatusRejected, ReasonInvalidTIF, 0, 0},
+		{"zero price", OrderRequest{Type: Buy, Price: 0, Quantity: 1, User: "carol"}, StatusRejected, ReasonInvalidPrice, 0, 0},
+		{"nan price", OrderRequest{Type: Buy, Price: nan(), Quantity: 1, User: "carol"}, StatusRejected, ReasonInvalidPrice, 0, 0},
+		{"infinite price", OrderRequest{Type: Sell, Price: inf(), Quantity: 1, User: "carol"}, StatusRejected, ReasonInvalidPrice, 0, 0},
+		{"negative quantity", OrderRequest{Type: Buy, Price: 100, Quantity: -1, User: "carol"}, StatusRejected, ReasonInvalidQuantity, 0, 0},
+		{"nan quantity", OrderRequest{Type: Buy, Price: 100, Quantity: nan(), User: "carol"}, StatusRejected, ReasonInvalidQuantity, 0, 0},
+		{"min quantity above quantity", OrderRequest{Type: Buy, Price: 100, Quantity: 1, MinQuantity: 2, User: "carol"}, StatusRejected, ReasonInvalidMinQuantity, 0, 0},
+		{"negative expiry", OrderRequest{Type: Buy, Price: 100, Quantity: 1, ExpireRound: -1, User: "carol"}, StatusRejected, ReasonInvalidExpiry, 0, 0},
+		{"invalid action", OrderRequest{Action: "modify", OrderID: 0, User: "alice"}, StatusRejected, ReasonInvalidAction, 0, 0},
+		{"post-only market", OrderRequest{Type: Buy, Kind: Market, PostOnly: true, Quantity: 1, User: "carol"}, StatusRejected, ReasonPostOnlyNotGTC, 0, 0},
+		{"post-only ioc", OrderRequest{Type: Buy, TIF: IOC, PostOnly: true, Price: 90, Quantity: 1, User: "carol"}, StatusRejected, ReasonPostOnlyNotGTC, 0, 0},
+		{"expired round", OrderRequest{Type: Buy, Price: 90, Quantity: 1, ExpireRound: 2, User: "carol"}, StatusRejected, ReasonExpired, 0, 0},
+		{"expired time", OrderRequest{Type: Buy, Price: 90, Quantity: 1, ExpireAt: testNow, User: "carol"}, StatusRejected, ReasonExpired, 0, 0},
+
+		// 只挂单、FOK 与最小成交量
+		{"post-only would cross", OrderRequest{Type: Buy, PostOnly: true, Price: 100, Quantity: 1, User: "carol"}, StatusRejected, ReasonWouldCross, 0, 0},
+		{"post-only rests", OrderRequest{Type: Buy, PostOnly: true, Price: 99, Quantity: 1, User: "carol"}, StatusResting, "", 0, 1},
+		{"fok not fillable", OrderRequest{Type: Buy, TIF: FOK, Price: 100, Quantity: 6, User: "carol"}, StatusRejected, ReasonFOKUnfilled, 0, 0},
+		{"fok filled across levels", OrderRequest{Type: Buy, TIF: FOK, Price: 101, Quantity: 8, User: "carol"}, StatusFilled, "", 8, 0},
+		{"min quantity not fillable", OrderRequest{Type: Buy, Price: 100, Quantity: 8, MinQuantity: 6, User: "carol"}, StatusRejected, ReasonMinQuantity, 0, 0},
+		{"min quantity met", OrderRequest{Type: Buy, Price: 100, Quantity: 8, MinQuantity: 5, User: "carol"}, StatusResting, "", 5, 3},
+
+		// 有效期与市价单
+		{"gtc rests without cross", OrderRequest{Type: Buy, Price: 99, Quantity: 2, User: "carol"}, StatusResting, "", 0, 2},
+		{"gtc filled", OrderRequest{Type: Buy, Price: 100, Quantity: 5, User: "carol"}, StatusFilled, "", 5, 0},
+		{"gtc partial rests", OrderRequest{Type: Buy, Price: 100, Quantity: 7, User: "carol"}, StatusResting, "", 5, 2},
+		{"ioc filled", OrderRequest{Type: Sell, TIF: IOC, Price: 95, Quantity: 5, User: "carol"}, StatusFilled, "", 5, 0},
+		{"ioc remainder cancelled", OrderRequest{Type: Buy, TIF: IOC, Price: 100, Quantity: 7, User: "carol"}, StatusCancelled, ReasonUnfilled, 5, 0},
+		{"ioc no cross", OrderRequest{Type: Buy, TIF: IOC, Price: 99, Quantity: 1, User: "carol"}, StatusCancelled, ReasonUnfilled, 0, 0},
+		{"market filled", OrderRequest{Type: Buy, Kind: Market, Quantity: 10, User: "carol"}, StatusFilled, "", 10, 0},
+		{"market remainder cancelled", OrderRequest{Type: Sell, Kind: Market, Quantity: 7, User: "carol"}, StatusCancelled, ReasonUnfilled, 5, 0},
+
+		// 撤单与改单
+		{"cancel", OrderRequest{Action: ActionCancel, OrderID: 0, User: "alice"}, StatusCancelled, ReasonCancelled, 0, 0},
+		{"cancel unknown", OrderRequest{Action: ActionCancel, OrderID: 42, User: "alice"}, StatusRejected, ReasonUnknownOrder, 0, 0},
+		{"cancel not owner", OrderRequest{Action: ActionCancel, OrderID: 0, User: "bob"}, StatusRejected, ReasonNotOwner, 0, 0},
+		{"amend unknown", OrderRequest{Action: ActionAmend, OrderID: 42, Quantity: 1, User: "alice"}, StatusRejected, ReasonUnknownOrder, 0, 0},
+		{"amend not owner", OrderRequest{Action: ActionAmend, OrderID: 2, Quantity: 1, User: "alice"}, StatusRejected, ReasonNotOwner, 0, 0},
+		{"amend nan price", OrderRequest{Action: ActionAmend, OrderID: 2, Price: nan(), User: "bob"}, StatusRejected, ReasonInvalidPrice, 0, 0},
+		{"amend nothing", OrderRequest{Action: ActionAmend, OrderID: 2, User: "bob"}, StatusRejected, ReasonInvalidQuantity, 0, 0},
+		{"amend reduce", OrderRequest{Action: ActionAmend, OrderID: 2, Quantity: 3, User: "bob"}, StatusResting, "", 0, 3},
+		{"amend reprice crosses", OrderRequest{Action: ActionAmend, OrderID: 2, Price: 100, Quantity: 7, User: "bob"}, StatusResting, "", 5, 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ob := testBook(t)
+			before := ob.StateHash()
+			res := ob.Apply(tc.req)
+			if res.Status != tc.status || res.Reason != tc.reason {
+				t.Fatalf("got %s/%q, want %s/%q", res.Status, res.Reason, tc.status, tc.reason)
+			}
+			if res.Filled != tc.filled || res.Remaining != tc.remaining {
+				t.Errorf("filled %v remaining %v, want %v / %v", res.Filled, res.Remaining, tc.filled, tc.remaining)
+			}
+			var traded float64
+			for _, tr := range res.Trades {
+				traded += tr.Quantity
+			}
+			if traded != res.Filled {
+				t.Errorf("trades sum to %v, filled %v", traded, res.Filled)
+			}
+			if res.Rejected() && ob.StateHash() != before {
+				t.Errorf("rejected %s changed the book", tc.req.Action)
+			}
+		})
+	}
+}
+
+func nan() float64 { return math.NaN() }
+
+func inf() float64 { return math.Inf(1) }
+
+// 每个原因代码都有中文说明
+func TestOrderReasonMessages(t *testing.T) {
+	for _, reason := range []OrderReason{
+		ReasonInvalidSide, ReasonInvalidKind, ReasonInvalidTIF, ReasonInvalidPrice, ReasonInvalidQuantity,
+		ReasonInvalidMinQuantity, ReasonInvalidExpiry, ReasonInvalidAction, ReasonPostOnlyNotGTC, ReasonWouldCross,
+		ReasonFOKUnfilled, ReasonMinQuantity, ReasonExpired, ReasonUnknownOrder, ReasonNotOwner,
+		ReasonUnfilled, ReasonCancelled, ReasonAuctionLimitOnly,
+	} {
+		if reason.Message() == string(reason) {
+			t.Errorf("%s has no message", reason)
+		}
+	}
+}
+
+func TestOrderBookPriceTimePriority(t *testing.T) {
+	ob := testBook(t)
+	ob.Place(OrderRequest{Type: Sell, Price: 100, Quantity: 5, User: "dave"}) // #3，与 #0 同价、排在其后
+	res := ob.Place(OrderRequest{Type: Buy, Price: 101, Quantity: 7, User: "carol"})
+	if len(res.Trades) != 2 {
+		t.Fatalf("got %d trades, want 2", len(res.Trades))
+	}
+	if tr := res.Trades[0]; tr.SellOrderID != 0 || tr.Quantity != 5 || tr.Price != 100.5 {
+		t.Errorf("first trade %+v, want order 0 × 5 at 100.5", tr)
+	}
+	if tr := res.Trades[1]; tr.SellOrderID != 3 || tr.Quantity != 2 {
+		t.Errorf("second trade %+v, want order 3 × 2", tr)
+	}
+
+	// 市价单按挂单价成交
+	res = ob.Place(OrderRequest{Type: Sell, Kind: Market, Quantity: 1, User: "carol"})
+	if len(res.Trades) != 1 || res.Trades[0].Price != 95 {
+		t.Errorf("market sell trades %+v, want one at 95", res.Trades)
+	}
+}
+
+func TestOrderBookAmendPriority(t *testing.T) {
+	// 只减少数量保留时间优先
+	ob := testBook(t)
+	ob.Place(OrderRequest{Type: Sell, Price: 100, Quantity: 5, User: "dave"}) // #3
+	ob.Amend(0, "alice", 0, 2)
+	res := ob.Place(OrderRequest{Type: Buy, Kind: Market, TIF: IOC, Quantity: 1, User: "carol"})
+	if res.Trades[0].SellOrderID != 0 {
+		t.Errorf("reduced order lost priority: matched %d", res.Trades[0].SellOrderID)
+	}
+
+	// 加量排到档位末尾
+	ob = testBook(t)
+	ob.Place(OrderRequest{Type: Sell, Price: 100, Quantity: 5, User: "dave"}) // #3
+	ob.Amend(0, "alice", 0, 6)
+	res = ob.Place(OrderRequest{Type: Buy, Kind: Market, TIF: IOC, Quantity: 1, User: "carol"})
+	if res.Trades[0].SellOrderID != 3 {
+		t.Errorf("increased order kept priority: matched %d", res.Trades[0].SellOrderID)
+	}
+
+	// 只挂单改价后仍不能成交
+	ob = testBook(t)
+	ob.Place(OrderRequest{Type: Buy, PostOnly: true, Price: 90, Quantity: 1, User: "carol"}) // #3
+	if res := ob.Amend(3, "carol", 100, 0); res.Reason != ReasonWouldCross {
+		t.Errorf("post-only amend: got %s/%q, want %q", res.Status, res.Reason, ReasonWouldCross)
+	}
+}
+
+func TestOrderBookExpiry(t *testing.T) {
+	ob := testBook(t)
+	ob.Place(OrderRequest{Type: Buy, Price: 90, Quantity: 1, ExpireRound: 4, User: "carol"})                    // #3
+	ob.Place(OrderRequest{Type: Buy, Price: 91, Quantity: 1, ExpireAt: testNow.Add(time.Minute), User: "dave"}) // #4
+
+	if expired := ob.SetRound(4); len(expired) != 0 {
+		t.Fatalf("round 4 expired %v, want none (orders expire after their round)", expired)
+	}
+	expired := ob.SetRound(5)
+	if len(expired) != 1 || expired[0].ID != 3 {
+		t.Fatalf("round 5 expired %v, want order 3", expired)
+	}
+
+	ob.clock = testNow.Add(time.Minute)
+	if res := ob.Cancel(4, "dave"); res.Reason != ReasonUnknownOrder {
+		t.Errorf("cancel after expiry: got %s/%q, want %q", res.Status, res.Reason, ReasonUnknownOrder)
+	}
+	if n := ob.Resting(); n != 3 {
+		t.Errorf("%d resting orders, want 3", n)
+	}
+}
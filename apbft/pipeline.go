@@ -0,0 +1,243 @@
+package apbft
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：流水线共识与序号水位 =======================
+// 逐个处理请求时，主节点在等网络往返的大部分时间里闲着。流水线允许主节点同时推进多个序号：
+// - 进行中的序号数不超过 Depth；序号须落在水位窗口内：h < seq <= h+Window，h 为最新稳定检查点；
+// - 每个序号的三阶段流程在自己的时间线上运行（从提案时刻起），各序号的网络时延相互重叠；
+// - 节点的 CPU 是独占资源：leader 聚合 BLS 签名（及定位坏签名）的耗时按节点排队，不能与自己的其它计算重叠；
+// - 副本按序号顺序执行：一个序号在自身提交且前一序号执行后才执行，检查点在执行时刻进行并推动低水位。
+// Depth 为 1 时与逐个处理相同。
+
+// PipelineConfig 流水线参数
+type PipelineConfig struct {
+	Depth  int `json:"depth" yaml:"depth"`   // 同时进行中的序号数上限（1 表示逐个处理）
+	Window int `json:"window" yaml:"window"` // 高低水位之差（至少一个检查点间隔）
+}
+
+// DefaultPipelineConfig 逐个处理；水位窗口为两个检查点间隔
+func DefaultPipelineConfig() PipelineConfig {
+	return PipelineConfig{Depth: 1, Window: 2 * CheckpointInterval}
+}
+
+// Validate 检查流水线参数
+func (p PipelineConfig) Validate() error {
+	if p.Depth < 1 {
+		return fmt.Errorf("pipeline: depth must be at least 1, got %d", p.Depth)
+	}
+	if p.Window < CheckpointInterval {
+		return fmt.Errorf("pipeline: window must be at least the checkpoint interval %d, got %d", CheckpointInterval, p.Window)
+	}
+	return nil
+}
+
+// pipelineState 流水线的调度状态（时刻均为虚拟时钟读数）
+type pipelineState struct {
+	cfg         PipelineConfig
+	lastStart   time.Duration         // 最近一个序号的提案时刻（主节点按序号顺序提案）
+	inflight    []time.Duration       // 进行中序号的提交时刻
+	lastExec    time.Duration         // 最近一个序号在副本上执行的时刻
+	checkpoints map[int]time.Duration // 检查点序号 -> 检查点协议结束（低水位推进）的时刻
+}
+
+// busyInterval 节点 CPU 的占用区间 [from, to)
+type busyInterval struct {
+	from, to time.Duration
+}
+
+// 【高亮-2026-10-16】BLS 聚合的计算耗时（仿真毫秒）：一次聚合验证的配对运算，加上逐个签名 / 公钥的群运算；
+// 聚合验证失败时逐个验证签名以定位坏签名者
+const (
+	AggregateVerifyMs = 1.5
+	AggregatePerSigMs = 0.05
+)
+
+// SetPipeline 设置流水线参数（进行中的序号不受影响）
+func (s *PBFTSimulator) SetPipeline(cfg PipelineConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	s.pipe.cfg = cfg
+	return nil
+}
+
+// aggregationCost leader 聚合 votes 个签名的计算耗时（searched 表示做过坏签名定位）
+func aggregationCost(votes int, searched bool) time.Duration {
+	ms := AggregateVerifyMs + float64(votes)*AggregatePerSigMs
+	if searched {
+		ms += float64(votes)*AggregateVerifyMs + AggregateVerifyMs
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// compute 节点 id 在当前时刻发起耗时 cost 的计算：等 CPU 空闲后执行，时钟推进到计算结束
+func (s *PBFTSimulator) compute(id int, cost time.Duration) {
+	if s.cpu == nil {
+		s.cpu = make(map[int][]busyInterval)
+	}
+	start := s.clock.Elapsed()
+	busy := s.cpu[id]
+	for _, b := range busy { // 按开始时刻排序：找第一个放得下的空隙
+		if start+cost <= b.from {
+			break
+		}
+		if b.to > start {
+			start = b.to
+		}
+	}
+	busy = append(busy, busyInterval{from: start, to: start + cost})
+	sort.Slice(busy, func(i, j int) bool { return busy[i].from < busy[j].from })
+	s.cpu[id] = busy
+	s.clock.AdvanceTo(start + cost)
+}
+
+// pruneCPU 丢弃早于 t 结束的 CPU 占用（此后的计算都不早于 t 开始）
+func (s *PBFTSimulator) pruneCPU(t time.Duration) {
+	for id, busy := range s.cpu {
+		kept := busy[:0]
+		for _, b := range busy {
+			if b.to > t {
+				kept = append(kept, b)
+			}
+		}
+		s.cpu[id] = kept
+	}
+}
+
+// NextSlot 序号 seq 最早可以提案的时刻：不早于当前时刻与上一个提案，进行中的序号少于 Depth，
+// 且 seq 不超过高水位（所需的检查点已结束；检查点未能稳定时按其结束时刻放行，实际系统由视图转换解决）
+func (s *PBFTSimulator) NextSlot(seq int) time.Duration {
+	p := &s.pipe
+	t := s.clock.Elapsed()
+	if p.lastStart > t {
+		t = p.lastStart
+	}
+	depth := max(p.cfg.Depth, 1)
+	if len(p.inflight) >= depth {
+		done := append([]time.Duration(nil), p.inflight...)
+		sort.Slice(done, func(i, j int) bool { return done[i] < done[j] })
+		if slot := done[len(done)-depth]; slot > t {
+			t = slot
+		}
+	}
+	if need := seq - p.cfg.Window; need > 0 && CheckpointInterval > 0 {
+		cp := (need + CheckpointInterval - 1) / CheckpointInterval * CheckpointInterval
+		if at, ok := p.checkpoints[cp]; ok && at > t {
+			t = at
+		}
+	}
+	return t
+}
+
+// RunPipelined 在流水线中处理序号 seq：不早于 ready 且在 NextSlot 放行时提案，本序号的流程在自己的时间线上运行，
+// 主时钟只推进到提案时刻。返回结果与提案时刻；本序号的时延（LastLatency）从提案到副本执行。
+func (s *PBFTSimulator) RunPipelined(seq int, request []byte, ready time.Duration) (bool, float64, *node.Node, int, time.Duration) {
+	s.clock.AdvanceTo(ready)
+	start := s.NextSlot(seq)
+	p := &s.pipe
+	p.lastStart = start
+	s.clock.AdvanceTo(start)
+	s.pruneCPU(start)
+	running := p.inflight[:0]
+	for _, done := range p.inflight {
+		if done > start {
+			running = append(running, done)
+		}
+	}
+	p.inflight = running
+
+	main := s.clock
+	lane := node.NewVirtualClock()
+	lane.AdvanceTo(start)
+	s.clock = lane
+	defer func() { s.clock = main }()
+
+	s.beginRound(seq)
+	s.openSequence(seq)
+	s.openCommittee(seq)
+	ok, price, primary, view := s.runViews(seq, request)
+	done := lane.Elapsed()
+	p.inflight = append(p.inflight, done)
+	// 副本按序执行：等前一序号执行完
+	lane.AdvanceTo(p.lastExec)
+	p.lastExec = lane.Elapsed()
+	s.lastLatency = p.lastExec - start
+	s.tallyLeader(primary, ok)
+	s.sequenceDecided(seq, ok, primary)
+	if CheckpointInterval > 0 && seq%CheckpointInterval == 0 {
+		if p.checkpoints == nil {
+			p.checkpoints = make(map[int]time.Duration)
+		}
+		p.checkpoints[seq] = lane.Elapsed()
+		for cp := range p.checkpoints {
+			if cp < seq-p.cfg.Window {
+				delete(p.checkpoints, cp)
+			}
+		}
+	}
+	return ok, price, primary, view, start
+}
+
+// Drain 等流水线中的序号全部执行完，主时钟推进到最后一个序号的执行时刻
+func (s *PBFTSimulator) Drain() {
+	s.clock.AdvanceTo(s.pipe.lastExec)
+	s.pipe.inflight = s.pipe.inflight[:0]
+}
+
+// PipelinePoint 流水线深度扫描中的一个点
+type PipelinePoint struct {
+	Depth        int     `json:"depth"`
+	Committed    int     `json:"committed"`    // 已提交的请求数
+	Throughput   float64 `json:"throughput"`   // 已提交请求数 / 仿真秒
+	AvgLatencyMs float64 `json:"avgLatencyMs"` // 从提案到副本执行的平均时延
+}
+
+// PipelineSweep 吞吐量随流水线深度的变化：对每个深度新建一个集群，requests 个请求在开始时全部就绪（主节点始终有请求可提），
+// 逐个作为一个序号提交
+func PipelineSweep(specs []node.NodeSpec, cfg Config, depths []int, requests int) ([]PipelinePoint, error) {
+	if requests <= 0 {
+		return nil, fmt.Errorf("apbft: pipeline sweep needs requests > 0")
+	}
+	points := make([]PipelinePoint, 0, len(depths))
+	for _, depth := range depths {
+		c := cfg
+		c.Pipeline.Depth = depth
+		c.Batch.MaxSize = 1
+		cluster, err := NewCluster(specs, c)
+		if err != nil {
+			return nil, err
+		}
+		b := cluster.NewBatcher()
+		first := cluster.Elapsed()
+		var results []PBFTResult
+		for i := 0; i < requests; i++ {
+			results = append(results, b.Offer(Tx{ID: fmt.Sprintf("pipe-%d-%04d", depth, i), Amount: 10}, first)...)
+		}
+		results = append(results, b.Flush()...)
+		cluster.Drain()
+
+		pt := PipelinePoint{Depth: depth}
+		totalMs := 0.0
+		for _, r := range results {
+			if r.Status == "已确认" {
+				pt.Committed++
+				totalMs += r.LatencyMs
+			}
+		}
+		if pt.Committed > 0 {
+			pt.AvgLatencyMs = totalMs / float64(pt.Committed)
+		}
+		if secs := (cluster.Elapsed() - first).Seconds(); secs > 0 {
+			pt.Throughput = float64(pt.Committed) / secs
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
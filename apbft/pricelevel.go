@@ -0,0 +1,375 @@
+package apbft
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// ======================= 【高亮-2026-10-16】新增：按价格档位组织的订单簿 =======================
+// 原先买卖队列是两个切片：每次 MatchAndClear 都对整条队列 sort.Slice，撮合后 filterActiveOrders 重新分配。
+// 现在每一方按价格分档：
+// - 档位放在堆中（买方价格高者优先、卖方价格低者优先），同价订单在档位内按到达顺序排成双向链表（时间优先）；
+// - 订单编号到链表节点的索引支持按编号撤单、改单；
+// - 按轮次、按时间过期各建一个最小堆，成交或撤单后的节点懒删除。
+// 挂单、撤单、每一笔撮合都是 O(log n)；Buys() / Sells() 按优先顺序返回挂单快照（用于展示）。
+// 状态哈希（StateHash）增量维护：每个档位缓存自己的摘要，每一方保存全部档位摘要的异或；
+// 挂单、移除或数量变化只把所在档位标记为待重算，下次取哈希时只重算这些档位，不再排序、遍历整个订单簿。
+
+// bookEntry 挂单在档位链表中的节点
+type bookEntry struct {
+	order      Order
+	level      *priceLevel
+	prev, next *bookEntry
+	dead       bool // 已成交、撤单或过期（过期堆中懒删除）
+}
+
+// priceLevel 一个价格档位
+type priceLevel struct {
+	price      float64
+	head, tail *bookEntry
+	count      int
+	index      int // 在 bookSide 堆中的下标
+	digest     [sha256.Size]byte
+	dirty      bool // 挂单有变化，digest 待重算（已从所在一方的摘要中移除）
+}
+
+// bookSide 一方的全部档位（实现 heap.Interface，堆顶为最优价格）
+type bookSide struct {
+	buy     bool
+	levels  []*priceLevel
+	byPrice map[float64]*priceLevel
+	size    int // 挂单数
+	digest  [sha256.Size]byte // 全部未变化档位摘要的异或
+	dirty   []*priceLevel     // 待重算摘要的档位（可能已清空）
+}
+
+func newBookSide(buy bool) *bookSide {
+	return &bookSide{buy: buy, byPrice: make(map[float64]*priceLevel)}
+}
+
+func (s *bookSide) Len() int { return len(s.levels) }
+
+func (s *bookSide) Less(i, j int) bool {
+	if s.buy {
+		return s.levels[i].price > s.levels[j].price
+	}
+	return s.levels[i].price < s.levels[j].price
+}
+
+func (s *bookSide) Swap(i, j int) {
+	s.levels[i], s.levels[j] = s.levels[j], s.levels[i]
+	s.levels[i].index, s.levels[j].index = i, j
+}
+
+func (s *bookSide) Push(x any) {
+	l := x.(*priceLevel)
+	l.index = len(s.levels)
+	s.levels = append(s.levels, l)
+}
+
+func (s *bookSide) Pop() any {
+	n := len(s.levels)
+	l := s.levels[n-1]
+	s.levels[n-1] = nil
+	s.levels = s.levels[:n-1]
+	return l
+}
+
+// best 最优价格档位的第一笔挂单（没有挂单时为 nil）
+func (s *bookSide) best() *bookEntry {
+	if len(s.levels) == 0 {
+		return nil
+	}
+	return s.levels[0].head
+}
+
+// insert 把节点挂到其价格档位的末尾
+func (s *bookSide) insert(e *bookEntry) {
+	l := s.byPrice[e.order.Price]
+	if l == nil {
+		l = &priceLevel{price: e.order.Price}
+		s.byPrice[l.price] = l
+		heap.Push(s, l)
+	}
+	s.touch(l)
+	e.level, e.prev, e.next = l, l.tail, nil
+	if l.tail != nil {
+		l.tail.next = e
+	} else {
+		l.head = e
+	}
+	l.tail = e
+	l.count++
+	s.size++
+}
+
+// remove 从档位中摘除节点；档位为空时从堆中移除
+func (s *bookSide) remove(e *bookEntry) {
+	l := e.level
+	s.touch(l)
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		l.head = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		l.tail = e.prev
+	}
+	e.level, e.prev, e.next = nil, nil, nil
+	l.count--
+	s.size--
+	if l.count == 0 {
+		heap.Remove(s, l.index)
+		delete(s.byPrice, l.price)
+	}
+}
+
+// touch 档位的挂单有变化：从一方的摘要中移除它的旧摘要，等下次 stateDigest 时重算
+func (s *bookSide) touch(l *priceLevel) {
+	if l.dirty {
+		return
+	}
+	l.dirty = true
+	xorDigest(&s.digest, &l.digest)
+	s.dirty = append(s.dirty, l)
+}
+
+// stateDigest 重算有变化的档位摘要后，一方全部挂单的摘要（与档位的排列无关，档位内按时间顺序）
+func (s *bookSide) stateDigest() [sha256.Size]byte {
+	for _, l := range s.dirty {
+		l.dirty = false
+		if l.count == 0 { // 已清空并移出堆
+			continue
+		}
+		l.digest = l.hash(s.buy)
+		xorDigest(&s.digest, &l.digest)
+	}
+	s.dirty = s.dirty[:0]
+	return s.digest
+}
+
+func xorDigest(dst, src *[sha256.Size]byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// hash 档位摘要：方向、价格与按时间顺序的每笔挂单的编号、类型、价格、剩余数量、用户、序号与挂单属性（不含时间戳）
+func (l *priceLevel) hash(buy bool) [sha256.Size]byte {
+	h := sha256.New()
+	var buf [8]byte
+	put := func(v uint64) {
+		binary.BigEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	if buy {
+		put(1)
+	} else {
+		put(0)
+	}
+	put(math.Float64bits(l.price))
+	put(uint64(l.count))
+	for e := l.head; e != nil; e = e.next {
+		o := &e.order
+		put(uint64(o.ID))
+		put(uint64(o.Type))
+		put(math.Float64bits(o.Price))
+		put(math.Float64bits(o.Quantity))
+		put(uint64(o.Seq))
+		put(uint64(o.ExpireRound))
+		expireAt := int64(0)
+		if !o.ExpireAt.IsZero() {
+			expireAt = o.ExpireAt.UnixNano()
+		}
+		put(uint64(expireAt))
+		if o.PostOnly {
+			put(1)
+		} else {
+			put(0)
+		}
+		put(uint64(len(o.User)))
+		h.Write([]byte(o.User))
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// copyTo 把一方复制到订单簿 cp（档位堆的排列、档位内的时间顺序与缓存的摘要不变），挂单登记到 cp 的编号索引与过期堆
+func (s *bookSide) copyTo(cp *OrderBook) *bookSide {
+	out := &bookSide{buy: s.buy, levels: make([]*priceLevel, len(s.levels)), byPrice: make(map[float64]*priceLevel, len(s.levels)), size: s.size, digest: s.digest}
+	levels, entries := make([]priceLevel, len(s.levels)), make([]bookEntry, 0, s.size) // 整块分配，复制时不逐笔分配
+	for i, l := range s.levels {
+		nl := &levels[i]
+		*nl = priceLevel{price: l.price, count: l.count, index: i, digest: l.digest, dirty: l.dirty}
+		for e := l.head; e != nil; e = e.next {
+			entries = append(entries, bookEntry{order: e.order, level: nl, prev: nl.tail})
+			ne := &entries[len(entries)-1]
+			if nl.tail != nil {
+				nl.tail.next = ne
+			} else {
+				nl.head = ne
+			}
+			nl.tail = ne
+			cp.index[ne.order.ID] = ne
+			if ne.order.ExpireRound > 0 {
+				cp.byRound.entries = append(cp.byRound.entries, ne)
+			}
+			if !ne.order.ExpireAt.IsZero() {
+				cp.byTime.entries = append(cp.byTime.entries, ne)
+			}
+		}
+		if nl.dirty {
+			out.dirty = append(out.dirty, nl)
+		}
+		out.levels[i], out.byPrice[nl.price] = nl, nl
+	}
+	return out
+}
+
+// walk 按价格优先、时间优先遍历挂单，fn 返回 false 时停止（不改变订单簿；经过的档位依次出堆后再放回）
+func (s *bookSide) walk(fn func(e *bookEntry) bool) {
+	var popped []*priceLevel
+	defer func() {
+		for _, l := range popped {
+			heap.Push(s, l)
+		}
+	}()
+	for len(s.levels) > 0 {
+		l := heap.Pop(s).(*priceLevel)
+		popped = append(popped, l)
+		for e := l.head; e != nil; e = e.next {
+			if !fn(e) {
+				return
+			}
+		}
+	}
+}
+
+// sortedLevels 按价格优先顺序的档位（副本，不改变堆）
+func (s *bookSide) sortedLevels() []*priceLevel {
+	levels := append([]*priceLevel(nil), s.levels...)
+	sort.Slice(levels, func(i, j int) bool {
+		if s.buy {
+			return levels[i].price > levels[j].price
+		}
+		return levels[i].price < levels[j].price
+	})
+	return levels
+}
+
+// orders 按优先顺序的挂单快照
+func (s *bookSide) orders() []Order {
+	out := make([]Order, 0, s.size)
+	for _, l := range s.sortedLevels() {
+		for e := l.head; e != nil; e = e.next {
+			out = append(out, e.order)
+		}
+	}
+	return out
+}
+
+// expiryQueue 按过期轮次或过期时间排序的最小堆（heap.Interface）
+type expiryQueue struct {
+	entries []*bookEntry
+	byTime  bool
+}
+
+func (q *expiryQueue) Len() int { return len(q.entries) }
+
+func (q *expiryQueue) Less(i, j int) bool {
+	a, b := &q.entries[i].order, &q.entries[j].order
+	if q.byTime {
+		return a.ExpireAt.Before(b.ExpireAt)
+	}
+	return a.ExpireRound < b.ExpireRound
+}
+
+func (q *expiryQueue) Swap(i, j int) { q.entries[i], q.entries[j] = q.entries[j], q.entries[i] }
+
+func (q *expiryQueue) Push(x any) { q.entries = append(q.entries, x.(*bookEntry)) }
+
+func (q *expiryQueue) Pop() any {
+	n := len(q.entries)
+	e := q.entries[n-1]
+	q.entries[n-1] = nil
+	q.entries = q.entries[:n-1]
+	return e
+}
+
+// due 弹出堆顶已到期的节点（跳过已删除的节点）；没有时返回 nil
+func (q *expiryQueue) due(expired func(o *Order) bool) *bookEntry {
+	for len(q.entries) > 0 {
+		e := q.entries[0]
+		if !e.dead && !expired(&e.order) {
+			return nil
+		}
+		heap.Pop(q)
+		if !e.dead {
+			return e
+		}
+	}
+	return nil
+}
+
+// side 订单所在一方的档位
+func (ob *OrderBook) side(t OrderType) *bookSide {
+	if t == Buy {
+		return ob.bids
+	}
+	return ob.asks
+}
+
+// add 挂单：加入档位、编号索引与过期堆
+func (ob *OrderBook) add(o Order) {
+	e := &bookEntry{order: o}
+	ob.side(o.Type).insert(e)
+	ob.index[o.ID] = e
+	if o.ExpireRound > 0 {
+		heap.Push(&ob.byRound, e)
+	}
+	if !o.ExpireAt.IsZero() {
+		heap.Push(&ob.byTime, e)
+	}
+}
+
+// setQuantity 更新挂单的剩余数量（部分成交或原地减量），所在档位的摘要待重算
+func (ob *OrderBook) setQuantity(e *bookEntry, quantity float64) {
+	e.order.Quantity = quantity
+	ob.side(e.order.Type).touch(e.level)
+}
+
+// drop 移除挂单（成交完毕、撤单、改单或过期）
+func (ob *OrderBook) drop(e *bookEntry) {
+	ob.side(e.order.Type).remove(e)
+	if ob.index[e.order.ID] == e {
+		delete(ob.index, e.order.ID)
+	}
+	e.dead = true
+}
+
+// Buys 买单快照（价格高者优先，同价按到达顺序）
+func (ob *OrderBook) Buys() []Order {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.bids.orders()
+}
+
+// Sells 卖单快照（价格低者优先，同价按到达顺序）
+func (ob *OrderBook) Sells() []Order {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.asks.orders()
+}
+
+// Resting 挂单数
+func (ob *OrderBook) Resting() int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.bids.size + ob.asks.size
+}
@@ -0,0 +1,147 @@
+package apbft
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// 订单簿基准测试：每方 benchResting/2 笔数量为 1 的挂单，分布在 benchLevels 个价格档位上，
+// 买单价格 [90, 100)、卖单价格 [100, 110)，互不成交。使用副本订单簿（不写日志、不读墙钟），
+// 结果只反映价格档位数据结构本身。运行：go test ./apbft -run '^$' -bench OrderBook
+
+const (
+	benchResting = 100000
+	benchLevels  = 1000
+)
+
+// benchBook 每方 perSide 笔挂单；买单编号为偶数、卖单编号为奇数
+func benchBook(perSide int) *OrderBook {
+	ob := NewReplicatedOrderBook()
+	for i := 0; i < perSide; i++ {
+		tick := float64(i%benchLevels) / 100
+		ob.SubmitOrder(Buy, 99.99-tick, 1, "bid")
+		ob.SubmitOrder(Sell, 100+tick, 1, "ask")
+	}
+	return ob
+}
+
+// BenchmarkOrderBookInsert 挂一笔不成交的限价单
+func BenchmarkOrderBookInsert(b *testing.B) {
+	ob := benchBook(benchResting / 2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob.Place(OrderRequest{Type: Buy, Price: 90 + float64(i%benchLevels)/100, Quantity: 1, User: "bench"})
+	}
+}
+
+// BenchmarkOrderBookCancel 按编号撤一笔挂单（预先多挂 b.N 笔，测量期间挂单数不低于 benchResting）
+func BenchmarkOrderBookCancel(b *testing.B) {
+	ob := benchBook(benchResting/2 + b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if res := ob.Cancel(2*i, "bid"); res.Rejected() {
+			b.Fatalf("cancel %d: %s", 2*i, res.Reason)
+		}
+	}
+}
+
+// BenchmarkOrderBookMatch IOC 市价单吃掉最优档位的一笔挂单（预先多挂 b.N 笔）
+func BenchmarkOrderBookMatch(b *testing.B) {
+	ob := benchBook(benchResting/2 + b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if res := ob.Place(OrderRequest{Type: Buy, Kind: Market, TIF: IOC, Quantity: 1, User: "bench"}); res.Status != StatusFilled {
+			b.Fatalf("match: %s %s", res.Status, res.Reason)
+		}
+	}
+}
+
+// BenchmarkOrderBookMatchAndClear 挂一笔与最优卖价交叉的买单（SubmitOrder 只挂单），再由 MatchAndClear 撮合掉一笔卖单
+// （预先多挂 b.N 笔卖单；单独挂单的开销见 BenchmarkOrderBookInsert）
+func BenchmarkOrderBookMatchAndClear(b *testing.B) {
+	ob := benchBook(benchResting / 2)
+	for i := 0; i < b.N; i++ {
+		ob.SubmitOrder(Sell, 100, 1, "ask")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob.SubmitOrder(Buy, 100, 1, "bench")
+		if trades := ob.MatchAndClear(); len(trades) != 1 {
+			b.Fatalf("match and clear: %d trades", len(trades))
+		}
+	}
+}
+
+// BenchmarkOrderBookSnapshot 按优先顺序取一方的挂单快照（Buys，排序全部档位并复制 benchResting/2 笔挂单）
+func BenchmarkOrderBookSnapshot(b *testing.B) {
+	ob := benchBook(benchResting / 2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if buys := ob.Buys(); len(buys) != benchResting/2 {
+			b.Fatalf("%d buys", len(buys))
+		}
+	}
+}
+
+// BenchmarkOrderBookStateHash 副本每批次执行后取状态哈希：incremental 为挂一笔订单后取哈希（只重算一个档位），
+// full 为全部档位都有变化时的哈希（等同于对整个订单簿重新哈希）
+func BenchmarkOrderBookStateHash(b *testing.B) {
+	b.Run("incremental", func(b *testing.B) {
+		ob := benchBook(benchResting / 2)
+		ob.StateHash()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ob.Place(OrderRequest{Type: Buy, Price: 90 + float64(i%benchLevels)/100, Quantity: 1, User: "bench"})
+			ob.StateHash()
+		}
+	})
+	b.Run("full", func(b *testing.B) {
+		ob := benchBook(benchResting / 2)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, side := range []*bookSide{ob.bids, ob.asks} {
+				for _, l := range side.levels {
+					side.touch(l)
+				}
+			}
+			ob.StateHash()
+		}
+	})
+}
+
+// 增量维护的状态哈希与按快照重新挂单后的哈希一致（随机下单、撤单、改单与出清）
+func TestOrderBookStateHashIncremental(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, mode := range []ClearingMode{PairwiseClearing, UniformClearing} {
+		ob := NewReplicatedOrderBook()
+		ob.SetClearingMode(mode)
+		for i := 0; i < 2000; i++ {
+			switch op := rng.Intn(10); {
+			case op < 6:
+				side := OrderType(rng.Intn(2))
+				ob.Place(OrderRequest{Type: side, Price: 95 + float64(rng.Intn(10)), Quantity: 1 + float64(rng.Intn(5)), User: "u", ExpireRound: rng.Intn(3) * (i/50 + 1)})
+			case op < 8 && ob.NextID > 0:
+				ob.Cancel(rng.Intn(ob.NextID), "u")
+			case op < 9 && ob.NextID > 0:
+				ob.Amend(rng.Intn(ob.NextID), "u", float64(rng.Intn(2))*(95+float64(rng.Intn(10))), float64(1+rng.Intn(5)))
+			default:
+				ob.SetRound(i / 50)
+				ob.MatchAndClear()
+			}
+			if i%7 != 0 { // 隔几步取一次哈希，覆盖多次变化累积在同一档位上的情况
+				continue
+			}
+			rebuilt := NewReplicatedOrderBook()
+			rebuilt.NextID = ob.NextID
+			for _, o := range append(ob.Buys(), ob.Sells()...) {
+				rebuilt.add(o)
+			}
+			if got, want := ob.StateHash(), rebuilt.StateHash(); got != want {
+				t.Fatalf("%s step %d: incremental hash %.8s, rebuilt %.8s", mode, i, got, want)
+			}
+			if got, want := ob.clone().StateHash(), rebuilt.StateHash(); got != want {
+				t.Fatalf("%s step %d: clone hash %.8s, rebuilt %.8s", mode, i, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package apbft
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ======================= 【高亮-2026-10-16】新增：可插拔的撮合定价策略 =======================
+// RunRoundWithLeader 原先把 KNN 定价的基础电价、线损系数与 K 写死在函数里，find_k.go 又各用一套常数。
+// 定价改由 PricingStrategy 完成：输入为对提案签名的副本报价（卖方报价 + 到主节点的电气距离）与本序号的交易电量，
+// 输出成交价以及决定成交价的报价。可选策略（Config.Pricing 配置）：
+// - knn：最近 K 个报价的平均报价与平均距离，价格 = 基础价 + 平均报价 + 平均距离 × 线损系数（原行为）；
+// - weighted-knn：最近 K 个报价按 1/(1+d) 加权，价格 = 基础价 + Σw(报价 + d × 线损系数) / Σw；
+// - median：全部报价的到户成本（报价 + d × 线损系数）取中位数，再加基础价；
+// - auction：统一价格拍卖，卖方按到户成本从低到高各供应 SellerCapacity 单位，直到满足交易电量，
+//   全部成交按边际卖方的到户成本（加基础价）结算。
+// 所用策略及其参数随每个结果记录（PBFTResult.Pricing）。
+
+// PricingStrategy 撮合定价策略
+type PricingStrategy interface {
+	// Name 策略名（与配置中的 strategy 相同）
+	Name() string
+	// Params 策略参数（记入结果）
+	Params() map[string]float64
+	// Price 按报价与交易电量给出成交价，以及决定成交价的报价（按使用顺序）；没有报价时返回 false
+	Price(quotes []Neighbor, amount int) (float64, []Neighbor, bool)
+}
+
+// 定价策略名
+const (
+	PricingKNN         = "knn"
+	PricingWeightedKNN = "weighted-knn"
+	PricingMedian      = "median"
+	PricingAuction     = "auction"
+)
+
+// PricingConfig 定价策略及参数
+type PricingConfig struct {
+	Strategy       string  `json:"strategy" yaml:"strategy"`             // knn / weighted-knn / median / auction
+	K              int     `json:"k" yaml:"k"`                           // 近邻数（knn、weighted-knn）
+	BasePrice      float64 `json:"basePrice" yaml:"basePrice"`           // 基础电价
+	LossCoeff      float64 `json:"lossCoeff" yaml:"lossCoeff"`           // 线损系数（元 / 单位距离）
+	SellerCapacity float64 `json:"sellerCapacity" yaml:"sellerCapacity"` // 每个卖方可供应的电量（auction）
+}
+
+// DefaultPricingConfig 原 RunRoundWithLeader 中的 KNN 参数
+func DefaultPricingConfig() PricingConfig {
+	return PricingConfig{Strategy: PricingKNN, K: 5, BasePrice: 250, LossCoeff: 1.2, SellerCapacity: 10}
+}
+
+// Build 按配置构造定价策略
+func (c PricingConfig) Build() (PricingStrategy, error) {
+	if c.BasePrice < 0 || c.LossCoeff < 0 {
+		return nil, fmt.Errorf("pricing: basePrice and lossCoeff must not be negative, got %g and %g", c.BasePrice, c.LossCoeff)
+	}
+	switch strings.ToLower(c.Strategy) {
+	case PricingKNN, PricingWeightedKNN:
+		if c.K < 1 {
+			return nil, fmt.Errorf("pricing: k must be at least 1, got %d", c.K)
+		}
+		knn := KNNPricing{K: c.K, BasePrice: c.BasePrice, LossCoeff: c.LossCoeff}
+		if strings.ToLower(c.Strategy) == PricingWeightedKNN {
+			return WeightedKNNPricing{knn}, nil
+		}
+		return knn, nil
+	case PricingMedian:
+		return MedianPricing{BasePrice: c.BasePrice, LossCoeff: c.LossCoeff}, nil
+	case PricingAuction:
+		if c.SellerCapacity <= 0 {
+			return nil, fmt.Errorf("pricing: sellerCapacity must be positive, got %g", c.SellerCapacity)
+		}
+		return AuctionPricing{BasePrice: c.BasePrice, LossCoeff: c.LossCoeff, SellerCapacity: c.SellerCapacity}, nil
+	}
+	return nil, fmt.Errorf("pricing: unknown strategy %q (want knn, weighted-knn, median or auction)", c.Strategy)
+}
+
+// nearest 按距离升序排列的报价副本
+func nearest(quotes []Neighbor) []Neighbor {
+	sorted := append([]Neighbor(nil), quotes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].D < sorted[j].D
+	})
+	return sorted
+}
+
+// KNNPricing 最近 K 个报价的平均报价与平均距离
+type KNNPricing struct {
+	K         int
+	BasePrice float64
+	LossCoeff float64
+}
+
+func (p KNNPricing) Name() string { return PricingKNN }
+
+func (p KNNPricing) Params() map[string]float64 {
+	return map[string]float64{"k": float64(p.K), "basePrice": p.BasePrice, "lossCoeff": p.LossCoeff}
+}
+
+func (p KNNPricing) Price(quotes []Neighbor, amount int) (float64, []Neighbor, bool) {
+	if len(quotes) == 0 {
+		return 0, nil, false
+	}
+	used := nearest(quotes)
+	if len(used) > p.K {
+		used = used[:p.K]
+	}
+	sumQuote, sumDistance := 0.0, 0.0
+	for _, q := range used {
+		sumQuote += q.Quote
+		sumDistance += q.D
+	}
+	avgQuote := sumQuote / float64(len(used))       // 最近 K 个卖方的平均报价
+	avgDistance := sumDistance / float64(len(used)) // 最近 K 个节点的平均距离（KNN距离）
+	return p.BasePrice + avgQuote + (avgDistance * p.LossCoeff), used, true
+}
+
+// WeightedKNNPricing 最近 K 个报价按 1/(1+d) 加权的到户成本
+type WeightedKNNPricing struct {
+	KNNPricing
+}
+
+func (p WeightedKNNPricing) Name() string { return PricingWeightedKNN }
+
+func (p WeightedKNNPricing) Price(quotes []Neighbor, amount int) (float64, []Neighbor, bool) {
+	if len(quotes) == 0 {
+		return 0, nil, false
+	}
+	used := nearest(quotes)
+	if len(used) > p.K {
+		used = used[:p.K]
+	}
+	sumW, sumCost := 0.0, 0.0
+	for _, q := range used {
+		w := 1 / (1 + q.D)
+		sumW += w
+		sumCost += w * (q.Quote + q.D*p.LossCoeff)
+	}
+	return p.BasePrice + sumCost/sumW, used, true
+}
+
+// MedianPricing 全部报价到户成本的中位数
+type MedianPricing struct {
+	BasePrice float64
+	LossCoeff float64
+}
+
+func (p MedianPricing) Name() string { return PricingMedian }
+
+func (p MedianPricing) Params() map[string]float64 {
+	return map[string]float64{"basePrice": p.BasePrice, "lossCoeff": p.LossCoeff}
+}
+
+func (p MedianPricing) Price(quotes []Neighbor, amount int) (float64, []Neighbor, bool) {
+	if len(quotes) == 0 {
+		return 0, nil, false
+	}
+	used := byDeliveredCost(quotes, p.LossCoeff)
+	mid := len(used) / 2
+	median := deliveredCost(used[mid], p.LossCoeff)
+	if len(used)%2 == 0 {
+		median = (deliveredCost(used[mid-1], p.LossCoeff) + median) / 2
+	}
+	return p.BasePrice + median, used, true
+}
+
+// AuctionPricing 统一价格拍卖：按到户成本从低到高接受卖方，直到满足交易电量，按边际卖方结算
+type AuctionPricing struct {
+	BasePrice      float64
+	LossCoeff      float64
+	SellerCapacity float64
+}
+
+func (p AuctionPricing) Name() string { return PricingAuction }
+
+func (p AuctionPricing) Params() map[string]float64 {
+	return map[string]float64{"basePrice": p.BasePrice, "lossCoeff": p.LossCoeff, "sellerCapacity": p.SellerCapacity}
+}
+
+// Price 电量超过全部卖方的供应时全部卖方成交，由报价最高者定价（未满足的部分不在此处理）
+func (p AuctionPricing) Price(quotes []Neighbor, amount int) (float64, []Neighbor, bool) {
+	if len(quotes) == 0 {
+		return 0, nil, false
+	}
+	sellers := byDeliveredCost(quotes, p.LossCoeff)
+	need := int(math.Ceil(float64(max(amount, 1)) / p.SellerCapacity))
+	if need > len(sellers) {
+		need = len(sellers)
+	}
+	used := sellers[:need]
+	return p.BasePrice + deliveredCost(used[need-1], p.LossCoeff), used, true
+}
+
+// deliveredCost 卖方报价加上送到主节点（买方）的线损
+func deliveredCost(q Neighbor, lossCoeff float64) float64 {
+	return q.Quote + q.D*lossCoeff
+}
+
+// byDeliveredCost 按到户成本升序排列的报价副本（相同时按节点 ID）
+func byDeliveredCost(quotes []Neighbor, lossCoeff float64) []Neighbor {
+	sorted := append([]Neighbor(nil), quotes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		ci, cj := deliveredCost(sorted[i], lossCoeff), deliveredCost(sorted[j], lossCoeff)
+		if ci != cj {
+			return ci < cj
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// PricingRecord 结果中记录的定价策略与参数
+type PricingRecord struct {
+	Strategy string             `json:"strategy"`
+	Params   map[string]float64 `json:"params"`
+}
+
+// String 例如 knn(basePrice=250, k=5, lossCoeff=1.2)
+func (r PricingRecord) String() string {
+	keys := make([]string, 0, len(r.Params))
+	for k := range r.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%g", k, r.Params[k])
+	}
+	return fmt.Sprintf("%s(%s)", r.Strategy, strings.Join(parts, ", "))
+}
+
+// SetPricing 设置定价策略（从下一个请求起生效）
+func (s *PBFTSimulator) SetPricing(p PricingStrategy) {
+	s.pricing = p
+}
+
+// Pricing 当前定价策略的记录
+func (s *PBFTSimulator) Pricing() PricingRecord {
+	return PricingRecord{Strategy: s.pricing.Name(), Params: s.pricing.Params()}
+}
@@ -0,0 +1,183 @@
+package apbft
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：可离线验证的法定人数证书（QC） =======================
+// COMMIT 阶段原先对 PREPARE 聚合签名再签一次、验证后即丢弃，外部无法证明某笔交易已最终确定。
+// 现在副本的 COMMIT 签名覆盖 commitMessage(序号, view, 摘要)，leader 按签名者 ID 升序聚合；
+// 提交时把 (摘要, view, 序号, 签名者位图, 聚合签名) 作为 QuorumCertificate 随结果返回。
+// 审计方只需公钥清单（密钥库导出的 manifest，或服务端 /api/pbft/manifest）即可验证：
+// - 签名集合大小取清单中序号 Seq 时的成员数 n（清单条目的 from / until），证书自报的 Members 须与之相等；
+// - 位图中的节点在该序号都是成员，签名数至少 2f+1（f = (n-1)/3）；
+// - 聚合签名是这些节点对 commitMessage 的有效签名。
+// 验证委员会由信誉状态抽取，审计方无法离线重算，因此只有签名数达到全体成员 2f+1 的提交才附 QC。
+
+// commitMessage COMMIT 签名的内容
+func commitMessage(seq, view int, digest string) []byte {
+	return []byte(fmt.Sprintf("COMMIT|%d|%d|%s", seq, view, digest))
+}
+
+// QuorumCertificate 已提交决定的法定人数证书
+type QuorumCertificate struct {
+	Seq     int    `json:"seq"`
+	View    int    `json:"view"`
+	Digest  string `json:"digest"`  // 请求摘要：请求字节的十六进制（单笔交易为交易 ID，批量为批摘要）
+	Members int    `json:"members"` // 签名集合大小（序号 Seq 时的成员数，验证时须与清单一致）
+	Signers []byte `json:"signers"` // 签名者位图：第 i 位（字节 i/8 的第 i%8 位）为 1 表示节点 i 签名
+	AggSig  []byte `json:"aggSig"`  // 签名者（按 ID 升序）对 commitMessage 的聚合签名
+	Scheme  string `json:"scheme"`  // 签名方案（须与清单一致）
+}
+
+// signerBitmap 把签名者 ID 编码为位图
+func signerBitmap(ids []int) []byte {
+	size := 0
+	for _, id := range ids {
+		if id/8+1 > size {
+			size = id/8 + 1
+		}
+	}
+	bm := make([]byte, size)
+	for _, id := range ids {
+		bm[id/8] |= 1 << uint(id%8)
+	}
+	return bm
+}
+
+// SignerIDs 位图中的签名者 ID（升序）
+func (qc QuorumCertificate) SignerIDs() []int {
+	var ids []int
+	for i, b := range qc.Signers {
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<uint(bit)) != 0 {
+				ids = append(ids, i*8+bit)
+			}
+		}
+	}
+	return ids
+}
+
+// ByzantineQuorum n 个成员时证书须达到的签名数 2f+1（f = (n-1)/3）
+func ByzantineQuorum(n int) int {
+	return 2*((n-1)/3) + 1
+}
+
+// Quorum 证书须达到的签名数
+func (qc QuorumCertificate) Quorum() int {
+	return ByzantineQuorum(qc.Members)
+}
+
+// Message 签名者签署的内容
+func (qc QuorumCertificate) Message() []byte {
+	return commitMessage(qc.Seq, qc.View, qc.Digest)
+}
+
+// Verify 按公钥清单验证证书（签名集合大小由清单给出）
+func (qc QuorumCertificate) Verify(m *node.Manifest) error {
+	if qc.Scheme != node.BLSScheme {
+		return fmt.Errorf("qc: scheme %q does not match this build (%q)", qc.Scheme, node.BLSScheme)
+	}
+	if _, err := hex.DecodeString(qc.Digest); err != nil || qc.Digest == "" {
+		return fmt.Errorf("qc: invalid digest %q", qc.Digest)
+	}
+	reg, err := m.Registry()
+	if err != nil {
+		return fmt.Errorf("qc: %w", err)
+	}
+	members := m.MembersAt(qc.Seq)
+	if len(members) == 0 {
+		return fmt.Errorf("qc: manifest lists no members at seq %d", qc.Seq)
+	}
+	if qc.Members != len(members) {
+		return fmt.Errorf("qc: members %d does not match the %d nodes the manifest lists at seq %d", qc.Members, len(members), qc.Seq)
+	}
+	isMember := make(map[int]bool, len(members))
+	for _, id := range members {
+		isMember[id] = true
+	}
+	ids := qc.SignerIDs()
+	for _, id := range ids {
+		if !isMember[id] {
+			return fmt.Errorf("qc: signer %d is not a member at seq %d", id, qc.Seq)
+		}
+	}
+	if len(ids) < qc.Quorum() {
+		return fmt.Errorf("qc: %d signers, quorum is %d of %d", len(ids), qc.Quorum(), qc.Members)
+	}
+	pks, err := reg.PublicKeys(ids)
+	if err != nil {
+		return fmt.Errorf("qc: %w", err)
+	}
+	ok, err := node.VerifyAggregate(pks, qc.Message(), qc.AggSig)
+	if err != nil {
+		return fmt.Errorf("qc: %w", err)
+	}
+	if !ok {
+		return errors.New("qc: aggregate signature does not verify")
+	}
+	return nil
+}
+
+// VerifyWithManifest 按公钥清单文件验证证书
+func (qc QuorumCertificate) VerifyWithManifest(path string) error {
+	m, err := node.LoadManifest(path)
+	if err != nil {
+		return err
+	}
+	return qc.Verify(m)
+}
+
+// quorumCertificate 由提交证书生成 QC（members 为该序号时的成员数）
+func (c CommitCert) quorumCertificate(members int) *QuorumCertificate {
+	return &QuorumCertificate{
+		Seq:     c.Seq,
+		View:    c.Prepared.View,
+		Digest:  c.Prepared.Digest,
+		Members: members,
+		Signers: signerBitmap(c.Signers),
+		AggSig:  append([]byte(nil), c.AggSig...),
+		Scheme:  node.BLSScheme,
+	}
+}
+
+// byID 按签名者 ID 升序排列的签名集合（QC 的聚合顺序）
+func (v voteSet) byID() voteSet {
+	idx := make([]int, len(v.ids))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool { return v.ids[idx[a]] < v.ids[idx[b]] })
+	var out voteSet
+	for _, i := range idx {
+		out.add(v.ids[i], v.pubKeys[i], v.sigs[i])
+	}
+	return out
+}
+
+// Manifest 当前成员及低水位以上仍可能出现在证书中的已离开节点的公钥清单
+// （运行中加入的节点带 from，已离开的节点带 until，审计方据此得出各序号的成员数）
+func (s *PBFTSimulator) Manifest() *node.Manifest {
+	m := s.registry.Manifest()
+	for i := range m.Nodes {
+		m.Nodes[i].From = s.joined[m.Nodes[i].ID]
+	}
+	ids := make([]int, 0, len(s.retired))
+	for id := range s.retired {
+		if _, member := s.registry.PublicKey(id); !member {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		k := s.retired[id]
+		m.Nodes = append(m.Nodes, node.ManifestEntry{ID: id, PublicKey: hex.EncodeToString(k.pubKey), PoP: hex.EncodeToString(k.pop), From: s.joined[id], Until: k.leftAt})
+	}
+	sort.Slice(m.Nodes, func(i, j int) bool { return m.Nodes[i].ID < m.Nodes[j].ID })
+	return m
+}
@@ -0,0 +1,344 @@
+package apbft
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：按吞吐量分层的交易路由 =======================
+// ComputeTiers 给出的 Tier 用于路由：交易带需求类别，主节点与验证委员会优先从对应层级选取：
+// - 工业大负荷 -> High，商业 -> Normal，居民小额 -> Low；未标注类别的交易不做路由（与原行为相同）；
+// - 主节点候选池：按偏好顺序（先本层，再相邻层）加入健康节点（活跃、在线、信誉合格），直到至少 MinLeaders 个
+//   （本层健康节点太少时并入相邻层，避免少数节点承担该类别的全部请求），请求按序号在池内轮换；
+//   池外的合格节点排在其后，视图转换在池内轮换完后继续转向它们；
+// - 验证委员会（CommitteeSize > 0 时）：按同一偏好顺序取 CommitteeSize 个健康节点，健康节点不足时
+//   用其余活跃节点补足；只有委员会成员对 PREPARE / COMMIT 签名，提交阈值按委员会大小计算，
+//   其余副本照常接收提案与提交证书并执行；
+// - 每个请求记录最终主节点的层级，按需求类别统计分布与平均时延（见 LeaderTiers）。
+
+// DemandClass 交易的需求类别
+type DemandClass string
+
+const (
+	DemandAny        DemandClass = ""           // 未标注：不按层级路由
+	DemandHousehold  DemandClass = "household"  // 居民小额交易
+	DemandCommercial DemandClass = "commercial" // 商业用电
+	DemandIndustrial DemandClass = "industrial" // 工业大负荷
+)
+
+// ClassifyDemand 按交易电量划分需求类别的阈值
+const (
+	CommercialDemandAmount = 20
+	IndustrialDemandAmount = 50
+)
+
+// ParseDemandClass 解析需求类别（空串表示未标注）
+func ParseDemandClass(s string) (DemandClass, error) {
+	switch d := DemandClass(strings.ToLower(strings.TrimSpace(s))); d {
+	case DemandAny, DemandHousehold, DemandCommercial, DemandIndustrial:
+		return d, nil
+	}
+	return DemandAny, fmt.Errorf("unknown demand class %q (want household, commercial or industrial)", s)
+}
+
+// ClassifyDemand 按交易电量给出需求类别
+func ClassifyDemand(amount int) DemandClass {
+	switch {
+	case amount >= IndustrialDemandAmount:
+		return DemandIndustrial
+	case amount >= CommercialDemandAmount:
+		return DemandCommercial
+	}
+	return DemandHousehold
+}
+
+// tiers 路由时的层级偏好顺序（先本层，再相邻层）；未标注类别时为 nil
+func (d DemandClass) tiers() []node.Tier {
+	switch d {
+	case DemandIndustrial:
+		return []node.Tier{node.TierHigh, node.TierNormal, node.TierLow}
+	case DemandCommercial:
+		return []node.Tier{node.TierNormal, node.TierHigh, node.TierLow}
+	case DemandHousehold:
+		return []node.Tier{node.TierLow, node.TierNormal, node.TierHigh}
+	}
+	return nil
+}
+
+// rank 需求强度：一批交易按其中最强的需求路由
+func (d DemandClass) rank() int {
+	switch d {
+	case DemandIndustrial:
+		return 3
+	case DemandCommercial:
+		return 2
+	case DemandHousehold:
+		return 1
+	}
+	return 0
+}
+
+// batchDemand 一批交易的需求类别
+func batchDemand(txs []Tx) DemandClass {
+	d := DemandAny
+	for _, tx := range txs {
+		if tx.Class.rank() > d.rank() {
+			d = tx.Class
+		}
+	}
+	return d
+}
+
+func tierName(t node.Tier) string {
+	switch t {
+	case node.TierHigh:
+		return "High"
+	case node.TierNormal:
+		return "Normal"
+	}
+	return "Low"
+}
+
+// RoutingConfig 分层路由参数
+type RoutingConfig struct {
+	Demand        DemandClass `json:"demand" yaml:"demand"`               // 未标注类别的请求使用的需求类别（空串表示不路由）
+	MinLeaders    int         `json:"minLeaders" yaml:"minLeaders"`       // 主节点候选池至少包含的健康节点数
+	CommitteeSize int         `json:"committeeSize" yaml:"committeeSize"` // 每个请求的验证委员会大小（0 表示全部活跃节点签名）
+	// 【高亮-2026-10-16】新增：委员会的选取方式（见 committee.go）
+	Sampling CommitteeSampling `json:"sampling" yaml:"sampling"`
+}
+
+// DefaultRoutingConfig 不按层级路由；候选池至少 3 个节点；全部活跃节点签名
+func DefaultRoutingConfig() RoutingConfig {
+	return RoutingConfig{MinLeaders: 3}
+}
+
+// Validate 检查路由参数
+func (r RoutingConfig) Validate() error {
+	if _, err := ParseDemandClass(string(r.Demand)); err != nil {
+		return fmt.Errorf("routing: %w", err)
+	}
+	if r.MinLeaders < 1 {
+		return fmt.Errorf("routing: minLeaders must be at least 1, got %d", r.MinLeaders)
+	}
+	if r.CommitteeSize != 0 && r.CommitteeSize < 4 {
+		return fmt.Errorf("routing: committeeSize must be 0 (all nodes) or at least 4, got %d", r.CommitteeSize)
+	}
+	if r.Sampling != SampleOrdered && r.Sampling != SampleWeighted {
+		return fmt.Errorf("routing: unknown committee sampling %q (want weighted, or empty for ordered)", r.Sampling)
+	}
+	return nil
+}
+
+// SetRouting 设置分层路由参数（从下一个请求起生效）
+func (s *PBFTSimulator) SetRouting(cfg RoutingConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("apbft: %w", err)
+	}
+	cfg.Demand, _ = ParseDemandClass(string(cfg.Demand))
+	s.routing = cfg
+	return nil
+}
+
+// demandClass 当前请求的需求类别：请求自带的类别，否则为配置的默认类别
+func (s *PBFTSimulator) demandClass() DemandClass {
+	if s.demand != DemandAny {
+		return s.demand
+	}
+	return s.routing.Demand
+}
+
+// healthy 可承接路由的节点：活跃、在线且信誉合格
+func healthy(nd *node.Node) bool {
+	return nd.IsActive() && nd.Online() && nd.M() > node.MMin
+}
+
+// byTier 按层级偏好顺序逐层选取 cands 中的健康节点（同层保持 cands 的顺序），已选满 need 个时不再加入下一层；
+// rest 为其余节点（保持 cands 的顺序）
+func byTier(cands []*node.Node, tiers []node.Tier, need int) (picked, rest []*node.Node) {
+	used := make(map[int]bool, len(cands))
+	for _, t := range tiers {
+		if len(picked) >= need {
+			break
+		}
+		for _, nd := range cands {
+			if nd.Tier == t && healthy(nd) {
+				picked = append(picked, nd)
+				used[nd.ID] = true
+			}
+		}
+	}
+	for _, nd := range cands {
+		if !used[nd.ID] {
+			rest = append(rest, nd)
+		}
+	}
+	return picked, rest
+}
+
+// leaderOrder 请求 round 各 view 的主节点顺序（view v 的主节点为 order[v%len(order)]）：
+// 未标注类别时为按信誉排序轮换后的候选；否则为按层级组成的候选池（至少 MinLeaders 个健康节点）轮换后，接上池外候选
+func (s *PBFTSimulator) leaderOrder(round int) []*node.Node {
+	cands := s.primaryOrder()
+	if len(cands) == 0 {
+		return nil
+	}
+	pool, rest := cands, []*node.Node(nil)
+	if tiers := s.demandClass().tiers(); tiers != nil {
+		if picked, others := byTier(cands, tiers, s.routing.MinLeaders); len(picked) > 0 {
+			pool, rest = picked, others
+		}
+	}
+	k := round % len(pool)
+	order := make([]*node.Node, 0, len(cands))
+	order = append(order, pool[k:]...)
+	order = append(order, pool[:k]...)
+	return append(order, rest...)
+}
+
+// openCommittee 为序号 seq 选出验证委员会（未配置委员会或委员会覆盖全部活跃节点时为 nil，即全部活跃节点签名）；
+// 【高亮-2026-10-16】加权抽样时健康节点不足 CommitteeSize 个则退回按序选取
+func (s *PBFTSimulator) openCommittee(seq int) {
+	s.committee = nil
+	size := s.routing.CommitteeSize
+	active := make([]*node.Node, 0, len(s.nodes))
+	for _, nd := range s.nodes {
+		if nd.IsActive() {
+			active = append(active, nd)
+		}
+	}
+	if size == 0 || size >= len(active) {
+		return
+	}
+	sort.SliceStable(active, func(i, j int) bool { return active[i].M() > active[j].M() })
+	tiers := s.demandClass().tiers()
+	if tiers == nil {
+		tiers = []node.Tier{node.TierHigh, node.TierNormal, node.TierLow} // 未标注类别：只按信誉
+	}
+	var members []*node.Node
+	if s.routing.Sampling == SampleWeighted {
+		var cands []*node.Node
+		for _, nd := range active {
+			if healthy(nd) {
+				cands = append(cands, nd)
+			}
+		}
+		if len(cands) >= size {
+			weights := committeeWeights(cands, tiers)
+			members = sampleCommittee(seq, cands, weights, size)
+			s.recordSample(members, cands, weights)
+		}
+	}
+	if members == nil {
+		picked, rest := byTier(active, tiers, size)
+		members = append(picked, rest...)[:size] // 健康节点不足时用其余活跃节点补足
+	}
+	s.committee = make(map[int]bool, size)
+	for _, nd := range members {
+		s.committee[nd.ID] = true
+	}
+	if s.committees == nil {
+		s.committees = make(map[int]int)
+	}
+	s.committees[seq] = size
+}
+
+// votes 节点是否对本序号的 PREPARE / COMMIT 签名
+func (s *PBFTSimulator) votes(id int) bool {
+	return s.committee == nil || s.committee[id]
+}
+
+// committeeSize 本序号的签名节点数（计算提交阈值用）
+func (s *PBFTSimulator) committeeSize() int {
+	if s.committee == nil {
+		return s.n
+	}
+	return len(s.committee)
+}
+
+// commitQuorum 序号 seq 的提交阈值（按当时的委员会或成员数）；序号已在低水位以下时返回 false
+func (s *PBFTSimulator) commitQuorum(seq int) (int, bool) {
+	n, known := s.members[seq]
+	if c, ok := s.committees[seq]; ok {
+		n = c
+	}
+	return int(float64(n) * PrepareQuorumMultiplier), known
+}
+
+// tierTally 某一需求类别下各层级担任最终主节点的请求数与已提交请求的时延
+type tierTally struct {
+	leaders   [3]int
+	committed [3]int
+	latency   [3]time.Duration
+}
+
+// tallyLeader 记录一个请求的最终主节点层级（时延为本请求的 lastLatency）
+func (s *PBFTSimulator) tallyLeader(primary *node.Node, ok bool) {
+	if primary == nil {
+		return
+	}
+	if s.tiers == nil {
+		s.tiers = make(map[DemandClass]*tierTally)
+	}
+	d := s.demandClass()
+	t := s.tiers[d]
+	if t == nil {
+		t = &tierTally{}
+		s.tiers[d] = t
+	}
+	t.leaders[primary.Tier]++
+	if ok {
+		t.committed[primary.Tier]++
+		t.latency[primary.Tier] += s.lastLatency
+	}
+}
+
+// TierShare 某一需求类别下某一层级担任主节点的情况
+type TierShare struct {
+	Demand       DemandClass `json:"demand"`
+	Tier         string      `json:"tier"`
+	Leaders      int         `json:"leaders"`      // 由该层级节点担任最终主节点的请求数
+	Share        float64     `json:"share"`        // 占该需求类别请求数的比例
+	AvgLatencyMs float64     `json:"avgLatencyMs"` // 其中已提交请求的平均时延（仿真毫秒）
+}
+
+// LeaderTiers 按需求类别（未标注、居民、商业、工业）与层级（High、Normal、Low）统计的主节点分布
+func (s *PBFTSimulator) LeaderTiers() []TierShare {
+	var out []TierShare
+	for _, d := range []DemandClass{DemandAny, DemandHousehold, DemandCommercial, DemandIndustrial} {
+		t := s.tiers[d]
+		if t == nil {
+			continue
+		}
+		total := t.leaders[0] + t.leaders[1] + t.leaders[2]
+		for _, tier := range []node.Tier{node.TierHigh, node.TierNormal, node.TierLow} {
+			share := TierShare{Demand: d, Tier: tierName(tier), Leaders: t.leaders[tier], Share: float64(t.leaders[tier]) / float64(total)}
+			if c := t.committed[tier]; c > 0 {
+				share.AvgLatencyMs = node.DurationMs(t.latency[tier]) / float64(c)
+			}
+			out = append(out, share)
+		}
+	}
+	return out
+}
+
+// FormatLeaderTiers 每个需求类别一行：Leader selection by tier [industrial]: High 80.0% (avg 120.3 ms) | ...
+func FormatLeaderTiers(shares []TierShare) []string {
+	var lines []string
+	for i := 0; i+3 <= len(shares); i += 3 {
+		d := shares[i].Demand
+		if d == DemandAny {
+			d = "unrouted"
+		}
+		parts := make([]string, 0, 3)
+		for _, sh := range shares[i : i+3] {
+			parts = append(parts, fmt.Sprintf("%s %.1f%% (avg %.1f ms)", sh.Tier, sh.Share*100, sh.AvgLatencyMs))
+		}
+		lines = append(lines, fmt.Sprintf("Leader selection by tier [%s]: %s", d, strings.Join(parts, " | ")))
+	}
+	return lines
+}
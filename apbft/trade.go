@@ -3,7 +3,6 @@ package apbft // 指定当前文件属于 main 包
 import (
 	"fmt"     // 字符串格式化与输出
 	"log"     // 日志打印
-	"sort"    // 排序相关功能
 	"sync"    // 并发同步锁
 	"time"    // 时间相关操作
 )
@@ -24,6 +23,11 @@ type Order struct {
 	Price     float64     // 报价
 	Quantity  float64     // 数量
 	User      string      // 用户名
+	Seq       int         // 【高亮-2026-10-16】新增：提交该订单的共识序号（副本确定性执行时按序号而非时间戳排序）
+	// 【高亮-2026-10-16】新增：挂单的属性（见 orders.go）
+	PostOnly    bool      // 只挂单（改价时仍不能与对手方成交）
+	ExpireRound int       // 该轮次之后失效（0 表示不按轮次过期）
+	ExpireAt    time.Time // 该时刻起失效（零值表示不按时间过期）
 }
 
 // Trade 表示一次撮合成交
@@ -33,51 +37,83 @@ type Trade struct {
 	Price       float64   // 成交价
 	Quantity    float64   // 成交数量
 	Timestamp   time.Time // 成交时间戳
+	Seq         int       // 【高亮-2026-10-16】新增：成交所在的共识序号
+	BuyUser     string    // 【高亮-2026-10-16】新增：买方用户
+	SellUser    string    // 【高亮-2026-10-16】新增：卖方用户
 }
 
 // OrderBook 撮合簿，维护买卖订单
+// 【高亮-2026-10-16】修改：买卖队列改为按价格档位组织（见 pricelevel.go），Buys() / Sells() 返回快照。
+// 不兼容变更：原导出字段 Buys / Sells 改为同名方法，读取处需改为 ob.Buys() / ob.Sells()；
+// 快照是副本，不能再直接追加或修改挂单，挂单改用 SubmitOrder / Place，撤单、改单用 Cancel / Amend
 type OrderBook struct {
-	Buys   []Order     // 买单队列
-	Sells  []Order     // 卖单队列
+	bids   *bookSide   // 买单档位（价格高者优先）
+	asks   *bookSide   // 卖单档位（价格低者优先）
+	index  map[int]*bookEntry // 订单编号 -> 挂单
+	byRound, byTime expiryQueue // 按轮次 / 按时间过期的挂单
 	mu     sync.Mutex  // 并发锁，保证线程安全
 	NextID int         // 下一个订单ID编号，自动递增
 	Logs   []string    // 撮合和事件日志
+	// 【高亮-2026-10-16】新增：副本上确定性执行的订单簿（见 market.go）：不读取墙钟、不写日志，顺序由序号决定
+	replicated bool
+	seq        int         // 当前执行的共识序号（非副本上为 SetRound 设置的轮次）
+	clock      time.Time   // 副本上当前订单批次的时间（随请求达成一致）
+	clearing   ClearingMode // 【高亮-2026-10-16】新增：出清方式（见 auction.go），为空时为逐对撮合
 }
 
 // NewOrderBook 构建新的订单簿对象
 func NewOrderBook() *OrderBook {
 	return &OrderBook{
-		Buys:  make([]Order, 0),      // 初始化买单队列
-		Sells: make([]Order, 0),      // 初始化卖单队列
-		Logs:  make([]string, 0),     // 初始化日志队列
+		bids:   newBookSide(true),       // 初始化买单档位
+		asks:   newBookSide(false),      // 初始化卖单档位
+		index:  make(map[int]*bookEntry),
+		byTime: expiryQueue{byTime: true},
+		Logs:   make([]string, 0),     // 初始化日志队列
 	}
 }
 
 // Log 记录事件日志，方便审计和调试
 func (ob *OrderBook) Log(event string) {
+	if ob.replicated {
+		return
+	}
 	logStr := fmt.Sprintf("[%s] %s", time.Now().Format(time.RFC3339), event) // 带时间前缀
 	ob.Logs = append(ob.Logs, logStr)      // 追加到日志队列
 	log.Println(logStr)                    // 同时打印到标准输出
 }
 
+// logf 按格式记录日志；副本订单簿不记日志，也就不必格式化（副本逐笔执行订单时避免无用的 Sprintf）
+func (ob *OrderBook) logf(format string, args ...any) {
+	if ob.replicated {
+		return
+	}
+	ob.Log(fmt.Sprintf(format, args...))
+}
+
 // SubmitOrder 买家/卖家提交订单
+// 【高亮-2026-10-16】修改：方向、价格或数量无效（非正数、NaN、无穷大）时不挂单，记录拒绝原因并返回 -1；
+// NaN 价格无法按价格找到档位，每笔都会新建一个破坏堆顺序的孤立档位
 func (ob *OrderBook) SubmitOrder(orderType OrderType, price, quantity float64, user string) int {
 	ob.mu.Lock()                     // 锁定订单簿，防止并发写冲突
 	defer ob.mu.Unlock()
+	if reason := checkOrder(OrderRequest{Type: orderType, Kind: Limit, TIF: GTC, Price: price, Quantity: quantity}); reason != "" {
+		ob.reject(ActionPlace, -1, reason)
+		return -1
+	}
 	order := Order{                  // 创建新订单对象
 		ID:        ob.NextID,        // 自动生成订单编号
-		Timestamp: time.Now(),       // 当前时间为订单时间
+		Timestamp: ob.now(),         // 当前时间为订单时间（副本上为批次时间）
 		Type:      orderType,        // 类型
 		Price:     price,            // 价格
 		Quantity:  quantity,         // 数量
 		User:      user,             // 用户名
+		Seq:       ob.seq,
 	}
 	ob.NextID++                      // 订单编号自增
+	ob.add(order)                    // 挂到对应价格档位末尾
 	if orderType == Buy {            // 买单
-		ob.Buys = append(ob.Buys, order)
 		ob.Log(fmt.Sprintf("Buy order submitted: %+v", order))  // 日志记录
 	} else {                        // 卖单
-		ob.Sells = append(ob.Sells, order)
 		ob.Log(fmt.Sprintf("Sell order submitted: %+v", order)) // 日志记录
 	}
 	return order.ID                  // 返回订单编号
@@ -88,27 +124,20 @@ func (ob *OrderBook) MatchAndClear() []Trade {
 	ob.mu.Lock()         // 加锁保证线程安全
 	defer ob.mu.Unlock()
 
-	// 买单按价格（高到低），价格相等时按时间升序排列
-	sort.Slice(ob.Buys, func(i, j int) bool {
-		if ob.Buys[i].Price == ob.Buys[j].Price {
-			return ob.Buys[i].Timestamp.Before(ob.Buys[j].Timestamp)
-		}
-		return ob.Buys[i].Price > ob.Buys[j].Price
-	})
-	// 卖单按价格（低到高），价格相等时按时间升序排列
-	sort.Slice(ob.Sells, func(i, j int) bool {
-		if ob.Sells[i].Price == ob.Sells[j].Price {
-			return ob.Sells[i].Timestamp.Before(ob.Sells[j].Timestamp)
-		}
-		return ob.Sells[i].Price < ob.Sells[j].Price
-	})
-
-	buyIdx, sellIdx := 0, 0         // 买单/卖单队列下标
+	ob.expire()          // 【高亮-2026-10-16】新增：先移除过期挂单
+	if ob.clearing == UniformClearing { // 【高亮-2026-10-16】新增：集合竞价模式按统一价格出清
+		return ob.clearUniform()
+	}
+	// 【高亮-2026-10-16】修改：不再排序整条队列，每次取最优买价、最优卖价档位的第一笔挂单（价格优先、时间优先）
 	trades := []Trade{}             // 成交列表
 
-	for buyIdx < len(ob.Buys) && sellIdx < len(ob.Sells) {
-		buy := &ob.Buys[buyIdx]     // 当前买单
-		sell := &ob.Sells[sellIdx]  // 当前卖单
+	for {
+		buyEntry, sellEntry := ob.bids.best(), ob.asks.best()
+		if buyEntry == nil || sellEntry == nil {
+			break
+		}
+		buy := &buyEntry.order      // 当前买单
+		sell := &sellEntry.order    // 当前卖单
 		if buy.Price >= sell.Price {            // 能成交
 			quantity := min(buy.Quantity, sell.Quantity)    // 撮合数量取两者最小值
 			tradePrice := (buy.Price + sell.Price) / 2      // 成交价：简单平均，实际业务可调整
@@ -117,27 +146,27 @@ func (ob *OrderBook) MatchAndClear() []Trade {
 				SellOrderID: sell.ID,
 				Price:       tradePrice,
 				Quantity:    quantity,
-				Timestamp:   time.Now(),    // 成交时间戳
+				Timestamp:   ob.now(),      // 成交时间戳（副本上为批次时间）
+				Seq:         ob.seq,
+				BuyUser:     buy.User,
+				SellUser:    sell.User,
 			}
 			trades = append(trades, trade)    // 增加到成交记录
 			ob.Log(fmt.Sprintf("Matched trade: %+v", trade)) // 日志记录
 
-			buy.Quantity -= quantity    // 扣除买单剩余量
-			sell.Quantity -= quantity   // 扣除卖单剩余量
+			ob.setQuantity(buyEntry, buy.Quantity-quantity)    // 扣除买单剩余量
+			ob.setQuantity(sellEntry, sell.Quantity-quantity)  // 扣除卖单剩余量
 
-			if buy.Quantity <= 0 {      // 买单撮合完毕，下一个
-				buyIdx++
+			if buy.Quantity <= 0 {      // 买单撮合完毕，移出档位
+				ob.drop(buyEntry)
 			}
-			if sell.Quantity <= 0 {    // 卖单撮合完毕，下一个
-				sellIdx++
+			if sell.Quantity <= 0 {    // 卖单撮合完毕，移出档位
+				ob.drop(sellEntry)
 			}
 		} else {
 			break                      // 买价低于卖价，无法成交，结束撮合
 		}
 	}
-	// 移除已成交完毕的买卖订单，仅保留剩余订单
-	ob.Buys = filterActiveOrders(ob.Buys[buyIdx:])
-	ob.Sells = filterActiveOrders(ob.Sells[sellIdx:])
 
 	// 出清日志
 	if len(trades) > 0 {
@@ -147,15 +176,12 @@ func (ob *OrderBook) MatchAndClear() []Trade {
 	return trades               // 返回撮合成交列表
 }
 
-// filterActiveOrders 筛选剩余未成交完的订单
-func filterActiveOrders(orders []Order) []Order {
-	var res []Order
-	for _, o := range orders {
-		if o.Quantity > 0 {       // 只有剩余量才保留
-			res = append(res, o)
-		}
+// now 订单与成交的时间戳：副本上确定性执行时不读取墙钟，取订单批次的时间
+func (ob *OrderBook) now() time.Time {
+	if ob.replicated {
+		return ob.clock
 	}
-	return res
+	return time.Now()
 }
 
 // min 返回两个浮点数的较小值
@@ -172,11 +198,11 @@ func (ob *OrderBook) ShowOrderBook() {
 	defer ob.mu.Unlock()
 	fmt.Println("OrderBook Status:")
 	fmt.Println("Buys:")
-	for _, b := range ob.Buys {
+	for _, b := range ob.bids.orders() {
 		fmt.Printf("%+v\n", b)     // 展示买单详情
 	}
 	fmt.Println("Sells:")
-	for _, s := range ob.Sells {
+	for _, s := range ob.asks.orders() {
 		fmt.Printf("%+v\n", s)     // 展示卖单详情
 	}
 }
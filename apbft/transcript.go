@@ -0,0 +1,185 @@
+package apbft
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：共识过程记录（transcript） =======================
+// RunAPBFTWithRoundAndSpecs 原先返回 Validators: nil，/api/pbft/result 看不到 APBFT 交易中谁签了什么。
+// 每个请求记录：
+// - 每个节点在每个 view、每个阶段的结果（签名、按距离拒绝、作恶拒签、坏签名、消息未送达等）及送达时延；
+// - 每个 view 的主节点、是否提交及失败原因，每次视图转换收到的 VIEW-CHANGE 数与接受 NEW-VIEW 的节点数；
+// - 定价策略使用的报价（近邻）与提交时的聚合签名。
+// 记录从请求到达（beginRound）开始，PBFTResult 中的 Validators 与 Transcript 由它整理而来。
+
+// 节点在某一阶段的结果
+const (
+	OutcomeProposed         = "proposed"          // leader 发出了提案
+	OutcomeReceived         = "received"          // 副本收到提案
+	OutcomeConflicting      = "conflicting"       // 收到或发出的摘要与请求不符（equivocation）
+	OutcomeNoProposal       = "no-proposal"       // 本阶段未收到 leader 的消息
+	OutcomeSigned           = "signed"            // 签名送达 leader 并被接受
+	OutcomeDistanceReject   = "distance-reject"   // 按电气距离拒绝交易
+	OutcomeMaliciousRefusal = "malicious-refusal" // 拜占庭行为：拒签或沉默
+	OutcomeBadSignature     = "bad-signature"     // 签名未通过验证，被 leader 定位剔除
+	OutcomeLost             = "lost"              // 签名已发出，但未在超时前送达 leader
+	OutcomeNotInCommittee   = "not-in-committee"  // 不在本序号的验证委员会中
+)
+
+// PhaseRecord 节点在某个 view 某个阶段的结果
+type PhaseRecord struct {
+	View    int        `json:"view"`
+	Phase   node.Phase `json:"phase"`
+	Outcome string     `json:"outcome"`
+	// LatencyMs 从阶段开始到消息送达（pre-prepare：副本收到提案；prepare / commit：leader 收到签名）的仿真毫秒，未送达时为 0
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// ViewRecord 一个 view 的三阶段流程
+type ViewRecord struct {
+	View           int    `json:"view"`
+	Primary        int    `json:"primary"`
+	Committed      bool   `json:"committed"`
+	Reason         string `json:"reason,omitempty"` // 未提交的原因
+	PrepareSigners []int  `json:"prepareSigners,omitempty"`
+	CommitSigners  []int  `json:"commitSigners,omitempty"`
+}
+
+// ViewChangeRecord 一次 VIEW-CHANGE / NEW-VIEW 交换
+type ViewChangeRecord struct {
+	View        int  `json:"view"` // 请求进入的 view
+	Primary     int  `json:"primary"`
+	ViewChanges int  `json:"viewChanges"` // 新主节点收到的有效 VIEW-CHANGE 数
+	Accepted    int  `json:"accepted"`    // 接受 NEW-VIEW 的节点数
+	Installed   bool `json:"installed"`   // 是否进入了新 view
+}
+
+// Transcript 一个请求的共识过程
+type Transcript struct {
+	Leader        int                `json:"leader"` // 最后执行三阶段流程的主节点（-1 表示没有）
+	Views         []ViewRecord       `json:"views"`
+	ViewChanges   []ViewChangeRecord `json:"viewChanges,omitempty"`
+	Neighbors     []Neighbor         `json:"neighbors,omitempty"`     // 定价使用的报价（按策略使用的顺序）
+	PrepareAggSig []byte             `json:"prepareAggSig,omitempty"` // 最近一次聚合成功的 PREPARE 签名（提交时为提交所在 view 的）
+	CommitAggSig  []byte             `json:"commitAggSig,omitempty"`  // 同上，COMMIT 签名
+}
+
+// phaseLog 三阶段流程中一个阶段的各节点结果与送达时刻
+type phaseLog struct {
+	phase   node.Phase
+	start   time.Duration
+	outcome map[int]string
+	at      map[int]time.Duration
+}
+
+func newPhaseLog(phase node.Phase, start time.Duration) *phaseLog {
+	return &phaseLog{phase: phase, start: start, outcome: make(map[int]string), at: make(map[int]time.Duration)}
+}
+
+// set 记录节点 id 的结果（后记录的覆盖先记录的）
+func (p *phaseLog) set(id int, outcome string) {
+	p.outcome[id] = outcome
+}
+
+// arrived 记录节点 id 的消息送达时刻（只记第一次）
+func (p *phaseLog) arrived(id int, t time.Duration) {
+	if _, dup := p.at[id]; !dup {
+		p.at[id] = t
+	}
+}
+
+// delivered 节点 id 的消息是否已送达
+func (p *phaseLog) delivered(id int) bool {
+	_, ok := p.at[id]
+	return ok
+}
+
+// resetTranscript 新请求到达时清空记录
+func (s *PBFTSimulator) resetTranscript() {
+	s.trace = Transcript{Leader: -1}
+	s.phases = make(map[int][]PhaseRecord)
+}
+
+// recordPhase 把一个阶段的结果记入当前 view
+func (s *PBFTSimulator) recordPhase(p *phaseLog) {
+	if s.phases == nil {
+		s.phases = make(map[int][]PhaseRecord)
+	}
+	ids := make([]int, 0, len(p.outcome))
+	for id := range p.outcome {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		rec := PhaseRecord{View: s.view, Phase: p.phase, Outcome: p.outcome[id]}
+		if at, ok := p.at[id]; ok {
+			rec.LatencyMs = node.DurationMs(at - p.start)
+		}
+		s.phases[id] = append(s.phases[id], rec)
+	}
+}
+
+// recordView 记录当前 view 的三阶段流程结果（签名者按 ID 升序）
+func (s *PBFTSimulator) recordView(primary *node.Node, committed bool, reason string, prepareSigners, commitSigners []int) {
+	sorted := func(ids []int) []int {
+		out := append([]int(nil), ids...)
+		sort.Ints(out)
+		return out
+	}
+	s.trace.Leader = primary.ID
+	s.trace.Views = append(s.trace.Views, ViewRecord{
+		View:           s.view,
+		Primary:        primary.ID,
+		Committed:      committed,
+		Reason:         reason,
+		PrepareSigners: sorted(prepareSigners),
+		CommitSigners:  sorted(commitSigners),
+	})
+}
+
+// recordViewChange 记录一次视图转换
+func (s *PBFTSimulator) recordViewChange(view int, primary *node.Node, viewChanges, accepted int, installed bool) {
+	s.trace.ViewChanges = append(s.trace.ViewChanges, ViewChangeRecord{View: view, Primary: primary.ID, ViewChanges: viewChanges, Accepted: accepted, Installed: installed})
+}
+
+// Transcript 当前（或最近一次）请求的共识过程
+func (s *PBFTSimulator) Transcript() Transcript {
+	return s.trace
+}
+
+// Validators 当前（或最近一次）请求中各节点的逐阶段记录（按 ID 升序）。
+// Vote 为节点最后一条记录的结果，签名送达时为阶段名（prepare / commit）；宕机节点为 offline
+func (s *PBFTSimulator) Validators() []Validator {
+	nodes := s.Nodes()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	out := make([]Validator, 0, len(nodes))
+	for _, nd := range nodes {
+		v := Validator{ID: fmt.Sprintf("node-%d", nd.ID), Vote: "offline", Phases: s.phases[nd.ID]}
+		if n := len(v.Phases); n > 0 {
+			last := v.Phases[n-1]
+			v.Vote = last.Outcome
+			if last.Outcome == OutcomeSigned {
+				v.Vote = string(last.Phase)
+			}
+		} else if nd.IsActive() && nd.Online() {
+			v.Vote = OutcomeNoProposal
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// sentOutcome 已发出签名的节点在本阶段的结果：送达为 signed，否则按所签摘要区分 conflicting 与 lost
+func sentOutcome(p *phaseLog, id int, conflicting bool) string {
+	switch {
+	case p.delivered(id):
+		return OutcomeSigned
+	case conflicting:
+		return OutcomeConflicting
+	}
+	return OutcomeLost
+}
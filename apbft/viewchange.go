@@ -0,0 +1,301 @@
+package apbft
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"PBFT1/node"
+)
+
+// ======================= 【高亮-2026-10-16】新增：超时驱动的 VIEW-CHANGE / NEW-VIEW =======================
+// 取代 RunAPBFTWithConfig 中直接读取 leader.IsMalicious 跳过坏主节点的"预言机"：
+// - 请求到达时副本启动 view-change 计时器（ViewChangeTimeoutMs，每换一次 view 翻倍）；
+// - 本 view 在计时器内未提交，副本对 (轮次, 新 view, 持有的 prepared 证书) 签名，VIEW-CHANGE 发给下一任主节点；
+// - 新主节点逐条验签，凑齐 2f+1 条后广播 NEW-VIEW，重新提案证书中 view 最高的摘要（无证书时为原请求）；
+// - 副本验证 NEW-VIEW（主节点身份、2f+1 条有效签名、重新提案的摘要）后进入新 view；
+//   新主节点离线、作恶或凑不齐 2f+1 时，副本等待计时器到期后继续转向下一 view。
+// 各 view 的主节点仍由信誉排序决定（SelectLeader(round, view)），请求到达时按同一信誉状态确定。
+
+// PreparedCert 副本在某个 view 中收到的 prepared 证书：leader 对 PREPARE 签名的聚合及签名者
+type PreparedCert struct {
+	View    int
+	Digest  string
+	AggSig  []byte
+	Signers []int
+}
+
+// viewChange VIEW-CHANGE 消息：副本请求进入 NewView，并携带自己持有的 prepared 证书
+type viewChange struct {
+	From    int
+	NewView int
+	Cert    *PreparedCert
+	Sig     []byte
+}
+
+// newView NEW-VIEW 消息：新主节点收集的 2f+1 条 VIEW-CHANGE 以及据此选定的重新提案摘要
+type newView struct {
+	View        int
+	Primary     int
+	Digest      string
+	ViewChanges []viewChange
+}
+
+// viewChangeMessage VIEW-CHANGE 的签名内容
+func viewChangeMessage(round, view int, cert *PreparedCert) []byte {
+	c := "-"
+	if cert != nil {
+		c = fmt.Sprintf("%d:%s", cert.View, cert.Digest)
+	}
+	return []byte(fmt.Sprintf("VIEW-CHANGE|%d|%d|%s", round, view, c))
+}
+
+// viewTimeout 第 view 个 view 的计时器时长（指数退避）
+func viewTimeout(view int) time.Duration {
+	return time.Duration(ViewChangeTimeoutMs) * time.Millisecond << uint(view)
+}
+
+// reproposal 按 VIEW-CHANGE 中 view 最高的 prepared 证书选定重新提案的摘要
+func reproposal(vcs []viewChange, requestDigest string) string {
+	chosen, best := requestDigest, -1
+	for _, vc := range vcs {
+		if vc.Cert != nil && vc.Cert.View > best {
+			chosen, best = vc.Cert.Digest, vc.Cert.View
+		}
+	}
+	return chosen
+}
+
+// View 当前（或最近一次请求结束时）的 view 编号
+func (s *PBFTSimulator) View() int {
+	return s.view
+}
+
+// RunRoundWithViewChange 处理一个请求：view 0 的主节点先执行三阶段流程，超时未提交则经
+// VIEW-CHANGE / NEW-VIEW 轮换到下一任主节点，最多尝试 MaxViews 个 view。
+// 返回是否达成共识、成交价、最后执行三阶段流程的主节点与最终 view。
+// 【高亮-2026-10-16】序号处理结束后记入副本日志，到达检查点间隔时执行检查点协议（不计入时延）。
+func (s *PBFTSimulator) RunRoundWithViewChange(round int, request []byte) (bool, float64, *node.Node, int) {
+	s.beginRound(round)
+	s.openSequence(round)
+	s.openCommittee(round) // 【高亮-2026-10-16】按需求类别选出验证委员会
+	start := s.clock.Elapsed()
+	ok, price, primary, view := s.runViews(round, request)
+	s.lastLatency = s.clock.Elapsed() - start
+	s.tallyLeader(primary, ok)
+	s.sequenceDecided(round, ok, primary)
+	return ok, price, primary, view
+}
+
+// runViews 依次尝试各 view，直到提交或用完 MaxViews
+func (s *PBFTSimulator) runViews(round int, request []byte) (bool, float64, *node.Node, int) {
+	order := s.leaderOrder(round) // 【高亮-2026-10-16】按需求类别分层路由后的主节点顺序
+	if len(order) == 0 {
+		return false, 0, nil, 0
+	}
+	primaryOf := func(v int) *node.Node { return order[v%len(order)] }
+
+	var last *node.Node
+	view := 0
+	for view < MaxViews {
+		s.view = view
+		last = primaryOf(view)
+		viewStart := s.clock.Elapsed()
+		if ok, price := s.RunRoundWithLeader(round, request, last); ok {
+			return true, price, last, view
+		}
+		// 计时器到期：发起视图转换；NEW-VIEW 未能建立时等本 view 计时器到期后继续转向下一 view
+		s.clock.AdvanceTo(viewStart + viewTimeout(view))
+		for view++; view < MaxViews; view++ {
+			s.view = view
+			vcStart := s.clock.Elapsed()
+			fmt.Printf("[View Change] 轮次 %d: view %d 超时未提交，副本请求进入 view %d（主节点 %d）\n", round, view-1, view, primaryOf(view).ID)
+			if s.changeView(round, view, primaryOf(view), request) {
+				break
+			}
+			s.clock.AdvanceTo(vcStart + viewTimeout(view))
+		}
+	}
+	return false, 0, last, s.view
+}
+
+// changeView 执行一次 VIEW-CHANGE / NEW-VIEW 交换，返回 2f+1 个节点是否进入了新 view
+func (s *PBFTSimulator) changeView(round, view int, primary *node.Node, request []byte) bool {
+	nw := node.NewNetworkWithClock(node.DefaultNetworkConfig(), int64(20260322+round)*31+int64(view), s.clock)
+	nw.SetDistanceModel(s.grid)
+	phaseTimeout := time.Duration(PhaseTimeoutMs) * time.Millisecond
+	quorum := 2*s.f + 1
+	digest := fmt.Sprintf("%x", request)
+
+	replicas := make([]*node.Node, 0, len(s.nodes))
+	for _, nd := range s.nodes {
+		if nd.IsActive() && nd.Online() {
+			replicas = append(replicas, nd)
+		}
+	}
+
+	// VIEW-CHANGE：新主节点逐条验签（同一证书只验一次）
+	var collected []viewChange
+	seen := make(map[int]bool, len(replicas))
+	certOK := make(map[string]bool)
+	entered := make(map[int]bool, len(replicas)) // 接受了 NEW-VIEW 的副本
+	for _, nd := range replicas {
+		nd := nd
+		nw.Register(nd.ID, func(msg node.Message) {
+			switch msg.Type {
+			case node.MsgViewChange:
+				vc, isVC := msg.Payload.(viewChange)
+				if nd != primary || !isVC || vc.From != msg.From || vc.NewView != view || seen[vc.From] {
+					return
+				}
+				if !s.verifyViewChange(primary, round, vc, certOK) {
+					return
+				}
+				seen[vc.From] = true
+				collected = append(collected, vc)
+			case node.MsgNewView:
+				nv, isNV := msg.Payload.(newView)
+				if !isNV || entered[nd.ID] || msg.From != primary.ID {
+					return
+				}
+				if s.acceptNewView(nd, round, view, primary, nv, digest) {
+					entered[nd.ID] = true
+				}
+			}
+		})
+	}
+	for _, nd := range replicas {
+		cert := s.certOf(nd.ID)
+		msg := viewChangeMessage(round, view, cert)
+		step := node.Step{Phase: node.PhaseViewChange, Round: round, Self: nd.ID, Leader: primary.ID, Peer: primary.ID, Digest: string(msg), Timeout: phaseTimeout, Prominent: -1, View: view}
+		sig, delay, err := nd.SignStep(step, msg)
+		if err != nil || sig == nil {
+			continue
+		}
+		size := node.DefaultMessageSize + len(sig)
+		if cert != nil {
+			size += len(cert.AggSig) + 4*len(cert.Signers)
+		}
+		nw.SendAfter(node.Message{Type: node.MsgViewChange, From: nd.ID, To: primary.ID, Round: round, Seq: view, Digest: digest, Size: size, Payload: viewChange{From: nd.ID, NewView: view, Cert: cert, Sig: sig}}, delay)
+	}
+	nw.RunFor(phaseTimeout)
+	if len(collected) < quorum {
+		fmt.Printf("[View Change] 轮次 %d: 新主节点 %d 只收到 %d 条有效 VIEW-CHANGE（需要 %d）\n", round, primary.ID, len(collected), quorum)
+		s.recordViewChange(view, primary, len(collected), 0, false)
+		return false
+	}
+
+	// NEW-VIEW：新主节点按自身行为策略向每个副本发送（可能沉默或发送冲突的重新提案）
+	sort.Slice(collected, func(i, j int) bool { return collected[i].From < collected[j].From })
+	nv := newView{View: view, Primary: primary.ID, Digest: reproposal(collected, digest), ViewChanges: collected}
+	size := node.DefaultMessageSize
+	for _, vc := range collected {
+		size += len(vc.Sig) + 16
+	}
+	for _, nd := range replicas {
+		step := node.Step{Phase: node.PhaseViewChange, Round: round, Self: primary.ID, Leader: primary.ID, Peer: nd.ID, Digest: nv.Digest, Timeout: phaseTimeout, Prominent: -1, View: view}
+		act := primary.Decide(step)
+		m := nv
+		switch act.Kind {
+		case node.ActSilent, node.ActReject, node.ActBadSign:
+			continue
+		case node.ActEquivocate:
+			m.Digest = act.Digest
+		}
+		nw.SendAfter(node.Message{Type: node.MsgNewView, From: primary.ID, To: nd.ID, Round: round, Seq: view, Digest: m.Digest, Size: size, Payload: m}, act.Delay)
+	}
+	nw.RunFor(phaseTimeout)
+	if len(entered) < quorum {
+		fmt.Printf("[View Change] 轮次 %d: 只有 %d 个节点接受主节点 %d 的 NEW-VIEW（需要 %d）\n", round, len(entered), primary.ID, quorum)
+		s.recordViewChange(view, primary, len(collected), len(entered), false)
+		return false
+	}
+	fmt.Printf("[New View] 轮次 %d: 进入 view %d，主节点 %d（%d 条 VIEW-CHANGE，%d 个节点接受）\n", round, view, primary.ID, len(collected), len(entered))
+	s.recordViewChange(view, primary, len(collected), len(entered), true)
+	return true
+}
+
+// certOf 副本在本轮持有的 prepared 证书（没有时为 nil）
+func (s *PBFTSimulator) certOf(id int) *PreparedCert {
+	if c, ok := s.prepared[id]; ok {
+		return &c
+	}
+	return nil
+}
+
+// verifyViewChange 新主节点验证一条 VIEW-CHANGE：发送者签名，以及所携带 prepared 证书的聚合签名
+func (s *PBFTSimulator) verifyViewChange(verifier *node.Node, round int, vc viewChange, certOK map[string]bool) bool {
+	pk, known := s.registry.PublicKey(vc.From)
+	if !known {
+		return false
+	}
+	if ok, _ := verifier.Verify(pk, viewChangeMessage(round, vc.NewView, vc.Cert), vc.Sig); !ok {
+		return false
+	}
+	if vc.Cert == nil {
+		return true
+	}
+	key := fmt.Sprintf("%d:%s:%x", vc.Cert.View, vc.Cert.Digest, vc.Cert.AggSig)
+	if ok, done := certOK[key]; done {
+		return ok
+	}
+	ok := s.verifyPrepared(verifier, *vc.Cert, round)
+	certOK[key] = ok
+	return ok
+}
+
+// verifyPrepared 验证序号 seq 上的 prepared 证书：签名者对请求（摘要为其十六进制编码）的聚合签名
+func (s *PBFTSimulator) verifyPrepared(verifier *node.Node, cert PreparedCert, seq int) bool {
+	request, err := hex.DecodeString(cert.Digest)
+	if err != nil {
+		return false
+	}
+	pks, err := s.keysAt(cert.Signers, seq)
+	if err != nil || len(pks) == 0 {
+		return false
+	}
+	ok, _ := verifier.VerifyAggregate(pks, request, cert.AggSig)
+	return ok
+}
+
+// acceptNewView 副本验证 NEW-VIEW：来自本 view 的主节点、包含 2f+1 个不同节点的有效 VIEW-CHANGE
+// （按签名内容分组聚合验证）、重新提案的摘要与证书一致
+func (s *PBFTSimulator) acceptNewView(replica *node.Node, round, view int, primary *node.Node, nv newView, requestDigest string) bool {
+	if nv.View != view || nv.Primary != primary.ID {
+		return false
+	}
+	groups := make(map[string]*voteSet)
+	var order []string
+	from := make(map[int]bool, len(nv.ViewChanges))
+	for _, vc := range nv.ViewChanges {
+		if vc.NewView != view || from[vc.From] {
+			return false
+		}
+		from[vc.From] = true
+		pk, known := s.registry.PublicKey(vc.From)
+		if !known {
+			return false
+		}
+		msg := string(viewChangeMessage(round, view, vc.Cert))
+		if groups[msg] == nil {
+			groups[msg] = &voteSet{}
+			order = append(order, msg)
+		}
+		groups[msg].add(vc.From, pk, vc.Sig)
+	}
+	if len(from) < 2*s.f+1 {
+		return false
+	}
+	for _, msg := range order {
+		g := groups[msg]
+		agg, err := replica.AggregateSignatures(g.sigs)
+		if err != nil {
+			return false
+		}
+		if ok, _ := replica.VerifyAggregate(g.pubKeys, []byte(msg), agg); !ok {
+			return false
+		}
+	}
+	return nv.Digest == reproposal(nv.ViewChanges, requestDigest)
+}
@@ -1,32 +1,36 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math/rand"
-	"sort"
 	"time"
+
+	"PBFT1/apbft"
+	"PBFT1/topology"
 )
 
-// 提取自 apbft.go 的基础参数
+// 【高亮-2026-10-16】修改：基础电价与线损系数不再在此另写一套，改用 apbft 的定价配置（默认值或 -scenario 场景文件）
 const (
-	basePrice     = 20.0  // 基础电价 (按我们刚刚的修改)
-	lineLossCoeff = 0.2   // 线损系数 (按我们刚刚的修改)
 	numNodes      = 50    // 模拟的电网节点总数
 	simRounds     = 1000  // 每个 K 值跑 1000 轮蒙特卡洛模拟求平均
 )
 
-type SimNeighbor struct {
-	Distance float64
-	Quote    float64
-}
-
 // 模拟一轮 KNN 定价过程
-func simulateOneRoundKNN(k int, rng *rand.Rand) float64 {
+// 【高亮-2026-10-16】修改：距离不再独立随机抽取，而是随机选一个买方节点，
+// 取它在共享电网拓扑上到其余节点的电气距离（与 apbft 的 KNN 定价、拒绝概率同一张电网）
+// 【高亮-2026-10-16】修改：成交价由 apbft 的定价策略计算（与共识中使用的同一实现）
+func simulateOneRoundKNN(pricing apbft.PricingStrategy, basePrice float64, grid *topology.Grid, rng *rand.Rand) float64 {
+	ids := grid.NodeIDs()
+	buyer := ids[rng.Intn(len(ids))]
+
 	// 1. 生成所有节点的数据
-	neighbors := make([]SimNeighbor, 0, numNodes)
-	for i := 0; i < numNodes; i++ {
-		// 模拟距离: 0~100 之间的随机数
-		distance := rng.Float64() * 100.0
+	neighbors := make([]apbft.Neighbor, 0, len(ids))
+	for _, id := range ids {
+		if id == buyer {
+			continue
+		}
+		distance := grid.Distance(buyer, id)
 
 		// 距离太远，节点可能会拒绝交易（模拟 apbft.go 里的 Reject 逻辑）
 		rejectProb := distance * 0.004
@@ -37,50 +41,56 @@ func simulateOneRoundKNN(k int, rng *rand.Rand) float64 {
 		// 模拟卖方报价: 15 + 0~10 的波动 (期望约 20)
 		quote := 15.0 + rng.Float64()*10.0
 
-		neighbors = append(neighbors, SimNeighbor{
-			Distance: distance,
-			Quote:    quote,
+		neighbors = append(neighbors, apbft.Neighbor{
+			ID:    id,
+			D:     distance,
+			Quote: quote,
 		})
 	}
 
-	// 2. 按距离从近到远排序
-	sort.Slice(neighbors, func(i, j int) bool {
-		return neighbors[i].Distance < neighbors[j].Distance
-	})
-
-	// 3. 截取前 K 个邻居 (如果不够 K 个，就取全部)
-	actualK := k
-	if len(neighbors) < k {
-		actualK = len(neighbors)
-	}
-
-	if actualK == 0 {
+	// 2. 按策略定价（KNN：按距离排序、取前 K 个邻居，不够 K 个就取全部）
+	finalPrice, _, ok := pricing.Price(neighbors, 1)
+	if !ok {
 		return basePrice // 极端情况：没人参与，返回基础价
 	}
-
-	sumQuote := 0.0
-	sumDistance := 0.0
-	for i := 0; i < actualK; i++ {
-		sumQuote += neighbors[i].Quote
-		sumDistance += neighbors[i].Distance
-	}
-
-	avgQuote := sumQuote / float64(actualK)
-	avgDistance := sumDistance / float64(actualK)
-
-	// 4. 最终价格计算公式
-	finalPrice := basePrice + avgQuote + (avgDistance * lineLossCoeff)
 	return finalPrice
 }
 
 func main() {
+	topoFile := flag.String("topology", "", "grid topology file (JSON/YAML/CSV); empty uses the synthetic grid of numNodes nodes")
+	scenario := flag.String("scenario", "", "scenario file whose pricing section (strategy, basePrice, lossCoeff) is used; empty uses the apbft defaults")
+	flag.Parse()
+
+	cfg := apbft.DefaultConfig()
+	if *scenario != "" {
+		loaded, err := apbft.LoadConfig(*scenario)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cfg = loaded
+	}
+	if s := cfg.Pricing.Strategy; s != apbft.PricingKNN && s != apbft.PricingWeightedKNN {
+		fmt.Printf("pricing strategy %q has no K to tune (want %s or %s)\n", s, apbft.PricingKNN, apbft.PricingWeightedKNN)
+		return
+	}
+
+	grid := topology.Default(numNodes)
+	if *topoFile != "" {
+		loaded, err := topology.Load(*topoFile)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		grid = loaded
+	}
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	fmt.Println("==================================================")
 	fmt.Println("启动 KNN 最优 K 值蒙特卡洛仿真寻优 (Monte Carlo Simulation)")
 	fmt.Println("==================================================")
-	fmt.Printf("基础参数: 基础电价=%.1f, 线损系数=%.1f, 节点数=%d, 仿真轮数=%d\n\n",
-		basePrice, lineLossCoeff, numNodes, simRounds)
+	fmt.Printf("基础参数: 定价策略=%s, 基础电价=%.1f, 线损系数=%.1f, 节点数=%d, 仿真轮数=%d\n\n",
+		cfg.Pricing.Strategy, cfg.Pricing.BasePrice, cfg.Pricing.LossCoeff, len(grid.Nodes), simRounds)
 
 	bestK := 1
 	minAvgPrice := 999999.0
@@ -88,10 +98,17 @@ func main() {
 	// 遍历测试 K = 1 到 30
 	for k := 1; k <= 30; k++ {
 		totalPrice := 0.0
+		p := cfg.Pricing
+		p.K = k
+		pricing, err := p.Build()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 
 		// 对当前 K 值运行 1000 轮
 		for r := 0; r < simRounds; r++ {
-			totalPrice += simulateOneRoundKNN(k, rng)
+			totalPrice += simulateOneRoundKNN(pricing, p.BasePrice, grid, rng)
 		}
 
 		avgPrice := totalPrice / float64(simRounds)
@@ -109,5 +126,5 @@ func main() {
 	fmt.Printf("⭐ 寻优结束！系统的最优纳什均衡点为： K = %d ⭐\n", bestK)
 	fmt.Printf("⭐ 此时系统的全局平均成交电价最低，为：%.4f 元\n", minAvgPrice)
 	fmt.Println("==================================================")
-	fmt.Println("💡 建议：请将此 K 值硬编码进 apbft/apbft.go 或 config.go 中，以获得最佳系统效益。")
+	fmt.Printf("💡 建议：在场景文件的 pricing 段设置 k: %d（apbft 通过 -scenario 读取），无需修改代码。\n", bestK)
 }
\ No newline at end of file
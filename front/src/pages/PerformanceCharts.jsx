@@ -66,6 +66,12 @@ export default function PerformanceCharts() {
     const [loading4, setLoading4] = useState(true), [errMsg4, setErrMsg4] = useState(""); // 【高亮-2026-03-15 23:40:00】
     // ======================= 【高亮-2026-03-22】新增：时延图表加载与报错状态 =======================
     const [loading5, setLoading5] = useState(true), [errMsg5, setErrMsg5] = useState("");
+    // ======================= 【高亮-2026-10-16】新增：图6 APBFT 批大小与吞吐量 =======================
+    const [chart6BatchData, setChart6BatchData] = useState([]);
+    const [loading6, setLoading6] = useState(true), [errMsg6, setErrMsg6] = useState("");
+    // ======================= 【高亮-2026-10-16】新增：图7 APBFT 流水线深度与吞吐量 =======================
+    const [chart7PipelineData, setChart7PipelineData] = useState([]);
+    const [loading7, setLoading7] = useState(true), [errMsg7, setErrMsg7] = useState("");
 
     // 图1：挂单成功率
     // 旧写法是要实现可以在图中呈现单个算法和全部算法，因此通过采用algosSuccess!=="all"与?algo=${algoSuccess}` : "",由于要实现多选，因此通过algosSuccess.join(",")实现数组应用
@@ -150,6 +156,42 @@ export default function PerformanceCharts() {
         fetchLatency();
     }, [algosLatency]);
 
+    // ======================= 【高亮-2026-10-16】新增：获取批大小扫描数据（仅 APBFT，无需算法选择） =======================
+    useEffect(() => {
+        async function fetchBatching() {
+            setLoading6(true); setErrMsg6("");
+            try {
+                const res = await fetch(`/api/performance/batching`);
+                if (!res.ok) throw new Error("HTTP error");
+                const data = await res.json();
+                setChart6BatchData(data.points || []);
+            } catch (e) {
+                console.error(e);
+                setErrMsg6("批处理数据获取失败");
+            }
+            setLoading6(false);
+        }
+        fetchBatching();
+    }, []);
+
+    // ======================= 【高亮-2026-10-16】新增：获取流水线深度扫描数据 =======================
+    useEffect(() => {
+        async function fetchPipelining() {
+            setLoading7(true); setErrMsg7("");
+            try {
+                const res = await fetch(`/api/performance/pipelining`);
+                if (!res.ok) throw new Error("HTTP error");
+                const data = await res.json();
+                setChart7PipelineData(data.points || []);
+            } catch (e) {
+                console.error(e);
+                setErrMsg7("流水线数据获取失败");
+            }
+            setLoading7(false);
+        }
+        fetchPipelining();
+    }, []);
+
     // 工具：对齐采样点
     // 将axis作为参数传进去
     const alignPoints = (allPoints, axis, getter) => {
@@ -334,6 +376,50 @@ export default function PerformanceCharts() {
                     )}
                 </Box>
 
+                {/* ======================= 【高亮-2026-10-16】新增：图6 APBFT 吞吐量随批大小的变化（左轴吞吐量，右轴平均时延） ======================= */}
+                <Box sx={{ mb: 4 }}>
+                    {loading6 ? <Typography>数据加载中...</Typography> : (
+                        <>
+                            {errMsg6 && <Typography color="error">{errMsg6}</Typography>}
+                            <Typography variant="subtitle1" mt={1} gutterBottom>APBFT 吞吐量与平均时延随批大小的变化</Typography>
+                            {chart6BatchData.length > 0 ? (
+                                <LineChart
+                                    series={[
+                                        { data: chart6BatchData.map(p => Number(p.throughput.toFixed(1))), label: "吞吐量(笔/秒)", color: colors.apbft, yAxisId: "tps" },
+                                        { data: chart6BatchData.map(p => Number(p.avgLatencyMs.toFixed(1))), label: "平均时延(ms)", color: "gray", yAxisId: "latency" },
+                                    ]}
+                                    xAxis={[{label:"批大小（笔）", data: chart6BatchData.map(p => String(p.batchSize)), scaleType: "point"}]}
+                                    yAxis={[{id: "tps", label:"吞吐量(笔/秒)"}, {id: "latency", label:"平均时延(ms)", position: "right"}]}
+                                    width={680}
+                                    height={300}
+                                />
+                            ):<Typography color="text.secondary" sx={{ py: 2 }}>暂无批处理统计数据</Typography>}
+                        </>
+                    )}
+                </Box>
+
+                {/* ======================= 【高亮-2026-10-16】新增：图7 APBFT 吞吐量随流水线深度的变化（左轴吞吐量，右轴平均时延） ======================= */}
+                <Box sx={{ mb: 4 }}>
+                    {loading7 ? <Typography>数据加载中...</Typography> : (
+                        <>
+                            {errMsg7 && <Typography color="error">{errMsg7}</Typography>}
+                            <Typography variant="subtitle1" mt={1} gutterBottom>APBFT 吞吐量与平均时延随流水线深度的变化</Typography>
+                            {chart7PipelineData.length > 0 ? (
+                                <LineChart
+                                    series={[
+                                        { data: chart7PipelineData.map(p => Number(p.throughput.toFixed(1))), label: "吞吐量(请求/秒)", color: colors.apbft, yAxisId: "tps" },
+                                        { data: chart7PipelineData.map(p => Number(p.avgLatencyMs.toFixed(1))), label: "平均时延(ms)", color: "gray", yAxisId: "latency" },
+                                    ]}
+                                    xAxis={[{label:"流水线深度（并发序号数）", data: chart7PipelineData.map(p => String(p.depth)), scaleType: "point"}]}
+                                    yAxis={[{id: "tps", label:"吞吐量(请求/秒)"}, {id: "latency", label:"平均时延(ms)", position: "right"}]}
+                                    width={680}
+                                    height={300}
+                                />
+                            ):<Typography color="text.secondary" sx={{ py: 2 }}>暂无流水线统计数据</Typography>}
+                        </>
+                    )}
+                </Box>
+
                 {/* ======================= 【高亮-2026-03-22】新增：图5 交易平均时延 (置于最上方以突出优势) ======================= */}
                 {/* ======================= 【高亮-2026-03-22 10:15】修改：图5 交易平均时延，去除原有的蓝色背景、内边距与边框，使底色恢复白色以对齐其他图表 ======================= */}
                 <Box sx={{ mb: 6 }}>
@@ -0,0 +1,296 @@
+package ledger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ======================= 【高亮-2026-10-16】新增：哈希链账本 =======================
+// 原先没有区块：server 的 PBFTBlock 只是最近一次结果的 {Height, Timestamp, ConfirmedTxs}，BlockHeight 就是轮次。
+// Ledger 按高度保存已提交的区块，每个区块带：
+// - 前一区块的哈希（创世区块为全零），以及由区块头计算的本区块哈希；
+// - 所含交易的 Merkle 根（见 merkle.go）；
+// - 提案者（主节点 / leader）与提交证明（如 APBFT 的法定人数证书）。
+// 打开文件时逐块校验高度、哈希链、Merkle 根与区块哈希；追加时只在文件末尾写一行 JSON 并落盘，
+// 已写入的区块不再改写。路径为空时账本只在内存中。
+// 崩溃或写入失败可能在文件末尾留下没有换行的半行：打开时把它截掉（回到最后一个校验通过的区块）并打印日志，
+// 只有文件中间的区块无法解析、哈希或衔接不符时才返回 ErrCorrupt。
+
+// ErrCorrupt 账本文件未通过完整性校验
+var ErrCorrupt = errors.New("ledger: integrity check failed")
+
+// Trade 区块中的一笔交易
+type Trade struct {
+	TxID   string  `json:"txId"`
+	Buyer  string  `json:"buyer,omitempty"`
+	Seller string  `json:"seller,omitempty"`
+	Amount int     `json:"amount"`
+	Price  float64 `json:"price"`
+}
+
+// 提交证明的类型
+const (
+	CertAPBFT = "apbft-qc"      // APBFT 法定人数证书（Data 为 apbft.QuorumCertificate）
+	CertPBFT  = "pbft-commit"   // PBFT 进入 committed 的副本
+	CertPOS   = "pos-committee" // POS 委员会中投 commit 的成员
+	CertRAFT  = "raft-append"   // RAFT 多数派确认的追加（不含签名，只记录 leader）
+)
+
+// Certificate 区块的提交证明
+type Certificate struct {
+	Kind    string          `json:"kind"`
+	Signers []string        `json:"signers,omitempty"` // 签名 / 投票的节点
+	Data    json.RawMessage `json:"data,omitempty"`    // 共识引擎自己的证明（可独立验证时）
+}
+
+// Block 区块
+type Block struct {
+	Height     int         `json:"height"` // 从 1 开始
+	PrevHash   string      `json:"prevHash"`
+	MerkleRoot string      `json:"merkleRoot"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Engine     string      `json:"engine"`   // 共识引擎（apbft / pbft / pos / raft）
+	Round      int         `json:"round"`    // 引擎内的轮次或序号
+	Proposer   string      `json:"proposer"` // 提案的主节点 / leader
+	Trades     []Trade     `json:"trades"`
+	Cert       Certificate `json:"cert"`
+	Hash       string      `json:"hash"`
+}
+
+// genesisHash 创世区块的 PrevHash
+var genesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// ComputeHash 由区块头（不含 Hash 字段）计算区块哈希；交易经 Merkle 根、提交证明经其 JSON 编码的哈希计入
+func (b Block) ComputeHash() string {
+	cert, _ := json.Marshal(b.Cert)
+	certHash := sha256.Sum256(cert)
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%s|%s|%d|%s|%d|%s|%x", b.Height, b.PrevHash, b.MerkleRoot, b.Timestamp.UnixNano(), b.Engine, b.Round, b.Proposer, certHash)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// check 校验区块自身以及与前一区块的衔接（prev 为 nil 表示创世区块）
+func (b Block) check(prev *Block) error {
+	want, prevHash := 1, genesisHash
+	if prev != nil {
+		want, prevHash = prev.Height+1, prev.Hash
+	}
+	switch {
+	case b.Height != want:
+		return fmt.Errorf("%w: block %d follows height %d", ErrCorrupt, b.Height, want-1)
+	case b.PrevHash != prevHash:
+		return fmt.Errorf("%w: block %d does not link to the previous block", ErrCorrupt, b.Height)
+	case b.MerkleRoot != MerkleRoot(b.Trades):
+		return fmt.Errorf("%w: block %d merkle root does not match its trades", ErrCorrupt, b.Height)
+	case b.Hash != b.ComputeHash():
+		return fmt.Errorf("%w: block %d hash does not match its header", ErrCorrupt, b.Height)
+	}
+	return nil
+}
+
+// Ledger 追加写的哈希链账本（并发安全）
+type Ledger struct {
+	mu     sync.RWMutex
+	path   string
+	file   *os.File // 为 nil 时只在内存中
+	blocks []Block
+}
+
+// New 创建只在内存中的账本
+func New() *Ledger {
+	return &Ledger{}
+}
+
+// Open 打开（不存在时创建）账本文件并校验已有区块；末尾写了一半的区块被截掉，文件被篡改时返回 ErrCorrupt
+func Open(path string) (*Ledger, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("ledger: %w", err)
+		}
+	}
+	blocks, size, torn, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	if torn {
+		if err := os.Truncate(path, size); err != nil {
+			return nil, fmt.Errorf("ledger: %w", err)
+		}
+		fmt.Printf("ledger %s: dropped a torn final line after block %d\n", path, len(blocks))
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("ledger: %w", err)
+	}
+	return &Ledger{path: path, file: f, blocks: blocks}, nil
+}
+
+// load 读取并校验账本文件（不存在时为空账本）；size 为最后一个完整区块行的结束位置，
+// torn 表示其后还有一段没有换行的半行（崩溃或写入失败留下的）
+func load(path string) (blocks []Block, size int64, torn bool, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("ledger: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return blocks, size, len(data) > 0, nil
+		}
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("ledger: %w", err)
+		}
+		var b Block
+		if err := json.Unmarshal(data, &b); err != nil {
+			return nil, 0, false, fmt.Errorf("%w: %s line %d: %v", ErrCorrupt, path, line, err)
+		}
+		var prev *Block
+		if len(blocks) > 0 {
+			prev = &blocks[len(blocks)-1]
+		}
+		if err := b.check(prev); err != nil {
+			return nil, 0, false, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		blocks = append(blocks, b)
+		size += int64(len(data))
+	}
+}
+
+// Append 在链尾追加区块：高度、前一区块哈希、Merkle 根与区块哈希由账本填写（Timestamp 为零时取当前时间），
+// 写入文件并落盘后才对读者可见（写入失败时把文件截回原长度，不留半行）；返回写入的区块
+func (l *Ledger) Append(b Block) (Block, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b.Height, b.PrevHash = 1, genesisHash
+	if n := len(l.blocks); n > 0 {
+		b.Height, b.PrevHash = l.blocks[n-1].Height+1, l.blocks[n-1].Hash
+	}
+	if b.Timestamp.IsZero() {
+		b.Timestamp = time.Now()
+	}
+	b.Timestamp = b.Timestamp.UTC().Round(0) // 去掉单调时钟读数，与 JSON 往返后的值一致
+	b.Trades = append([]Trade(nil), b.Trades...)
+	b.MerkleRoot = MerkleRoot(b.Trades)
+	b.Hash = b.ComputeHash()
+	if l.file != nil {
+		data, err := json.Marshal(b)
+		if err != nil {
+			return Block{}, fmt.Errorf("ledger: %w", err)
+		}
+		st, err := l.file.Stat()
+		if err != nil {
+			return Block{}, fmt.Errorf("ledger: %w", err)
+		}
+		_, err = l.file.Write(append(data, '\n'))
+		if err == nil {
+			err = l.file.Sync()
+		}
+		if err != nil {
+			_ = l.file.Truncate(st.Size())
+			return Block{}, fmt.Errorf("ledger: %w", err)
+		}
+	}
+	l.blocks = append(l.blocks, b)
+	return b, nil
+}
+
+// Height 链高（没有区块时为 0）
+func (l *Ledger) Height() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.blocks)
+}
+
+// Head 最新区块
+func (l *Ledger) Head() (Block, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.blocks) == 0 {
+		return Block{}, false
+	}
+	return l.blocks[len(l.blocks)-1], true
+}
+
+// Block 按高度查询区块
+func (l *Ledger) Block(height int) (Block, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if height < 1 || height > len(l.blocks) {
+		return Block{}, false
+	}
+	return l.blocks[height-1], true
+}
+
+// Range 高度 from 起最多 limit 个区块（limit <= 0 表示到链尾）
+func (l *Ledger) Range(from, limit int) []Block {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if from < 1 {
+		from = 1
+	}
+	if from > len(l.blocks) {
+		return nil
+	}
+	end := len(l.blocks)
+	if limit > 0 && from-1+limit < end {
+		end = from - 1 + limit
+	}
+	return append([]Block(nil), l.blocks[from-1:end]...)
+}
+
+// Verify 重新校验内存中的整条链；有文件时还按文件内容重新校验（发现落盘后被改动的区块）
+func (l *Ledger) Verify() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for i := range l.blocks {
+		var prev *Block
+		if i > 0 {
+			prev = &l.blocks[i-1]
+		}
+		if err := l.blocks[i].check(prev); err != nil {
+			return err
+		}
+	}
+	if l.file == nil {
+		return nil
+	}
+	onDisk, _, torn, err := load(l.path)
+	if err != nil {
+		return err
+	}
+	if torn || len(onDisk) != len(l.blocks) || (len(onDisk) > 0 && onDisk[len(onDisk)-1].Hash != l.blocks[len(l.blocks)-1].Hash) {
+		return fmt.Errorf("%w: %s no longer matches the chain in memory", ErrCorrupt, l.path)
+	}
+	return nil
+}
+
+// Path 账本文件路径（只在内存中时为空）
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Close 关闭账本文件
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,44 @@
+package ledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Merkle 树：叶子为 sha256(0x00 || 交易的 JSON 编码)，内部节点为 sha256(0x01 || 左 || 右)，
+// 某层节点数为奇数时最后一个节点原样升入上一层（不与自身配对，否则 [a,b,c] 与 [a,b,c,c] 的根相同）；
+// 没有交易时根为全零。
+
+// leafHash 交易的叶子哈希
+func leafHash(t Trade) []byte {
+	data, _ := json.Marshal(t) // Trade 只含基本类型，编码不会失败
+	h := sha256.Sum256(append([]byte{0x00}, data...))
+	return h[:]
+}
+
+// MerkleRoot 交易列表的 Merkle 根（十六进制）
+func MerkleRoot(trades []Trade) string {
+	if len(trades) == 0 {
+		return hex.EncodeToString(make([]byte, sha256.Size))
+	}
+	level := make([][]byte, len(trades))
+	for i, t := range trades {
+		level[i] = leafHash(t)
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				break
+			}
+			buf := make([]byte, 0, 1+2*sha256.Size)
+			buf = append(append(append(buf, 0x01), level[i]...), level[i+1]...)
+			h := sha256.Sum256(buf)
+			next = append(next, h[:])
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
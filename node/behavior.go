@@ -0,0 +1,402 @@
+package node
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// ======================= 【高亮-2026-10-16】新增：可插拔的拜占庭行为策略 Behavior =======================
+// 目的：取代 BehaviorConfig 在 Node.Sign 里的三选一概率（不签名 / bad-sign / 正常签名）。
+// 引擎在协议的每一步（向每个对端发送每条消息之前）调用 Behavior.Decide，由策略决定诚实执行、
+// 沉默、显式反对、对冲突摘要签名（equivocation）、伪造签名或延迟发送。
+
+// Phase 协议步骤
+type Phase string
+
+const (
+	PhaseAny        Phase = "*"           // 通配：ProbabilisticBehavior 中对所有步骤生效
+	PhasePrePrepare Phase = "pre-prepare" // PBFT/APBFT leader 提案
+	PhasePrepare    Phase = "prepare"
+	PhaseCommit     Phase = "commit"
+	PhasePropose    Phase = "propose"     // RAFT/POS leader 提案
+	PhaseVote       Phase = "vote"        // RAFT RequestVote 响应 / POS 委员会投票
+	PhaseAppend     Phase = "append"      // RAFT AppendEntries 响应
+	PhaseViewChange Phase = "view-change" // 【高亮-2026-10-16】新增：APBFT 的 VIEW-CHANGE / NEW-VIEW
+	PhaseCheckpoint Phase = "checkpoint"  // 【高亮-2026-10-16】新增：APBFT 的 CHECKPOINT 与状态传输
+	PhaseExecute    Phase = "execute"     // 【高亮-2026-10-16】新增：APBFT 副本执行已提交的订单批次
+)
+
+// Step 一次协议步骤的上下文
+type Step struct {
+	Phase     Phase
+	Round     int
+	Self      int
+	Leader    int
+	Peer      int           // 消息接收方；-1 表示不区分对端
+	Digest    string        // 诚实执行时应签名/发送的摘要
+	Timeout   time.Duration // 接收方等待该消息的超时（供"刚好超时"的延迟策略使用）
+	Prominent int           // 引擎给出的"显眼节点"（如权益最高/信誉最高的诚实节点），-1 表示无
+	View      int           // 【高亮-2026-10-16】新增：同一轮内的视图编号（视图转换后主节点与决定随之变化）
+}
+
+// ActionKind 策略对某一步骤的决定
+type ActionKind int
+
+const (
+	ActHonest     ActionKind = iota // 按协议正常执行
+	ActSilent                       // 沉默：不签名 / 不投票 / 不转发
+	ActReject                       // 显式反对票（RAFT 拒绝投票、POS reject）
+	ActEquivocate                   // 对冲突摘要签名/发送
+	ActBadSign                      // 发送伪造签名
+)
+
+func (k ActionKind) String() string {
+	switch k {
+	case ActHonest:
+		return "honest"
+	case ActSilent:
+		return "silent"
+	case ActReject:
+		return "reject"
+	case ActEquivocate:
+		return "equivocate"
+	case ActBadSign:
+		return "bad-sign"
+	default:
+		return "unknown"
+	}
+}
+
+// Action 策略的输出；Delay 可与任意 Kind 组合（发送前额外等待）
+type Action struct {
+	Kind   ActionKind
+	Delay  time.Duration
+	Digest string // ActEquivocate 时实际签名/发送的冲突摘要
+}
+
+// Honest 诚实执行且无额外延迟
+var Honest = Action{Kind: ActHonest}
+
+// Behavior 拜占庭行为策略：对每个协议步骤给出动作。实现必须是确定性的（同一 Step 同一结果），
+// 以保证同一轮仿真可复现。
+type Behavior interface {
+	Name() string
+	Decide(step Step) Action
+}
+
+// ConflictingDigest 返回与 digest 冲突的摘要（equivocation 使用）
+func ConflictingDigest(digest string) string {
+	return "EQV-" + digest
+}
+
+// stepFloat 由步骤上下文派生 [0,1) 的确定性随机数：同一节点同一步骤对所有对端作出相同决定
+func stepFloat(step Step, salt string) float64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%d|%d|%s", salt, step.Phase, step.Round, step.Self, step.Digest)
+	if step.View > 0 {
+		fmt.Fprintf(h, "|v%d", step.View) // view 0 保持原有的随机序列
+	}
+	return float64(h.Sum64()>>11) / float64(1<<53)
+}
+
+// ---------------------------------------------------------------------------
+// HonestBehavior 诚实节点
+
+type HonestBehavior struct{}
+
+func (HonestBehavior) Name() string       { return "honest" }
+func (HonestBehavior) Decide(Step) Action { return Honest }
+
+// ---------------------------------------------------------------------------
+// ProbabilisticBehavior 按步骤概率作恶：各引擎原先硬编码的恶意概率与 BehaviorConfig 都是它的特例
+
+type ProbabilisticBehavior struct {
+	Silent      map[Phase]float64 // 沉默概率
+	Reject      map[Phase]float64 // 显式反对概率
+	BadSign     map[Phase]float64 // 伪造签名概率
+	SilentDelay time.Duration     // 沉默前的等待（模拟"拖一会儿再放弃"）
+}
+
+func (b ProbabilisticBehavior) Name() string { return "random" }
+
+func phaseProb(m map[Phase]float64, p Phase) float64 {
+	if v, ok := m[p]; ok {
+		return v
+	}
+	return m[PhaseAny]
+}
+
+func (b ProbabilisticBehavior) Decide(step Step) Action {
+	p := stepFloat(step, "random")
+	silent := phaseProb(b.Silent, step.Phase)
+	reject := phaseProb(b.Reject, step.Phase)
+	bad := phaseProb(b.BadSign, step.Phase)
+	switch {
+	case p < silent:
+		return Action{Kind: ActSilent, Delay: b.SilentDelay}
+	case p < silent+reject:
+		return Action{Kind: ActReject}
+	case p < silent+reject+bad:
+		return Action{Kind: ActBadSign}
+	default:
+		return Honest
+	}
+}
+
+// Behavior 把旧的 BehaviorConfig 三选一权重转换为等价的 ProbabilisticBehavior
+func (cfg BehaviorConfig) Behavior() Behavior {
+	a, b, c := cfg.MalProbNotSign, cfg.MalProbBadSign, cfg.MalProbGoodSign
+	sum := a + b + c
+	if sum <= 0 {
+		a, b, sum = 1, 1, 3 // 与原实现的均匀三选一一致
+	}
+	return ProbabilisticBehavior{
+		Silent: map[Phase]float64{
+			PhaseAny:        a / sum,
+			PhasePrePrepare: cfg.MalLeaderPrePrepareProb,
+		},
+		BadSign: map[Phase]float64{
+			PhaseAny:        b / sum,
+			PhasePrePrepare: 0,
+		},
+		SilentDelay: time.Duration(cfg.MalNotSignDelayMs) * time.Millisecond,
+	}
+}
+
+// ---------------------------------------------------------------------------
+// EquivocationBehavior 对一半对端发送/签名冲突摘要（leader 时即为"一个 view 两个提案"）
+
+type EquivocationBehavior struct{}
+
+func (EquivocationBehavior) Name() string { return "equivocate" }
+
+func (EquivocationBehavior) Decide(step Step) Action {
+	if step.Peer >= 0 && step.Peer%2 == 1 {
+		return Action{Kind: ActEquivocate, Digest: ConflictingDigest(step.Digest)}
+	}
+	return Honest
+}
+
+// ---------------------------------------------------------------------------
+// SelectiveSilenceBehavior 只对选定的对端保持沉默（例如孤立某个 leader 或某个台区）
+
+type SelectiveSilenceBehavior struct {
+	Targets map[int]bool
+}
+
+func (b SelectiveSilenceBehavior) Name() string { return "silent" }
+
+func (b SelectiveSilenceBehavior) Decide(step Step) Action {
+	if b.Targets[step.Peer] || (step.Peer < 0 && b.Targets[step.Leader]) {
+		return Action{Kind: ActSilent}
+	}
+	return Honest
+}
+
+// ---------------------------------------------------------------------------
+// DelayedVotingBehavior 诚实投票，但刻意拖到接收方超时之后才送出
+
+type DelayedVotingBehavior struct {
+	Margin time.Duration // 超过超时的余量
+}
+
+func (b DelayedVotingBehavior) Name() string { return "delay" }
+
+func (b DelayedVotingBehavior) Decide(step Step) Action {
+	return Action{Kind: ActHonest, Delay: step.Timeout + b.Margin}
+}
+
+// ---------------------------------------------------------------------------
+// Coalition 共谋联盟：成员共享同一个攻击目标
+
+// CoalitionTargetProminent 以引擎给出的 Step.Prominent 为目标（如 POS 的"首富"节点）
+const CoalitionTargetProminent = -1
+
+type Coalition struct {
+	Name    string
+	Target  int          // 目标节点 ID；CoalitionTargetProminent 表示动态跟随 Step.Prominent
+	Members map[int]bool // 成员集合（成员当 leader 时互不攻击）
+}
+
+func (c *Coalition) target(step Step) int {
+	if c.Target == CoalitionTargetProminent {
+		return step.Prominent
+	}
+	return c.Target
+}
+
+// CoalitionBehavior 目标当 leader 时集体出手（Attack），否则按 Otherwise 行事以积累信誉
+type CoalitionBehavior struct {
+	Coalition *Coalition
+	Attack    ActionKind
+	Otherwise Behavior
+}
+
+func (b CoalitionBehavior) Name() string { return "coalition" }
+
+func (b CoalitionBehavior) Decide(step Step) Action {
+	t := b.Coalition.target(step)
+	if t >= 0 && step.Leader == t && !b.Coalition.Members[step.Leader] {
+		return Action{Kind: b.Attack}
+	}
+	if b.Otherwise != nil {
+		return b.Otherwise.Decide(step)
+	}
+	return Honest
+}
+
+// ---------------------------------------------------------------------------
+// SleeperBehavior 潜伏节点：前 WakeRound 轮表现良好（积累信誉），之后切换为 After
+
+type SleeperBehavior struct {
+	WakeRound int
+	After     Behavior
+}
+
+func (b SleeperBehavior) Name() string { return "sleeper" }
+
+func (b SleeperBehavior) Decide(step Step) Action {
+	if step.Round < b.WakeRound || b.After == nil {
+		return Honest
+	}
+	return b.After.Decide(step)
+}
+
+// ======================= 【高亮-2026-10-16】新增：行为策略的声明式配置（PoolConfig 中按节点选择） =======================
+
+// 行为策略名称
+const (
+	BehaviorHonest     = "honest"
+	BehaviorRandom     = "random"
+	BehaviorEquivocate = "equivocate"
+	BehaviorSilent     = "silent"
+	BehaviorDelay      = "delay"
+	BehaviorCoalition  = "coalition"
+	BehaviorSleeper    = "sleeper"
+)
+
+// BehaviorSpec 行为策略的声明式描述（可写入 JSON/YAML 场景文件）
+type BehaviorSpec struct {
+	Kind string `json:"kind" yaml:"kind"`
+
+	Prob      float64       `json:"prob,omitempty" yaml:"prob,omitempty"`           // random：每一步沉默概率
+	Targets   []int         `json:"targets,omitempty" yaml:"targets,omitempty"`     // silent：沉默对象
+	DelayMs   float64       `json:"delayMs,omitempty" yaml:"delayMs,omitempty"`     // delay：超过超时的余量
+	Coalition string        `json:"coalition,omitempty" yaml:"coalition,omitempty"` // coalition：联盟名（同名成员共享目标）
+	Target    int           `json:"target,omitempty" yaml:"target,omitempty"`       // coalition：目标节点，-1 表示跟随引擎的显眼节点
+	Attack    string        `json:"attack,omitempty" yaml:"attack,omitempty"`       // coalition：对目标的动作 silent（默认）/ reject
+	WakeRound int           `json:"wakeRound,omitempty" yaml:"wakeRound,omitempty"` // sleeper：开始作恶的轮次
+	Then      *BehaviorSpec `json:"then,omitempty" yaml:"then,omitempty"`           // sleeper 觉醒后 / coalition 非攻击时的行为
+}
+
+// NodeBehavior 为单个节点指定行为
+type NodeBehavior struct {
+	ID       int          `json:"id" yaml:"id"`
+	Behavior BehaviorSpec `json:"behavior" yaml:"behavior"`
+}
+
+// Validate 检查行为配置
+func (b BehaviorSpec) Validate() error {
+	switch b.Kind {
+	case BehaviorHonest, BehaviorEquivocate, BehaviorDelay:
+	case BehaviorRandom:
+		if b.Prob < 0 || b.Prob > 1 {
+			return fmt.Errorf("behavior random: prob must be in [0,1]")
+		}
+	case BehaviorSilent:
+		if len(b.Targets) == 0 {
+			return fmt.Errorf("behavior silent: targets required")
+		}
+	case BehaviorCoalition:
+		if b.Coalition == "" {
+			return fmt.Errorf("behavior coalition: name required")
+		}
+		if b.Attack != "" && b.Attack != "silent" && b.Attack != "reject" {
+			return fmt.Errorf("behavior coalition: unknown attack %q", b.Attack)
+		}
+	case BehaviorSleeper:
+		if b.Then == nil {
+			return fmt.Errorf("behavior sleeper: then required")
+		}
+	default:
+		return fmt.Errorf("unknown behavior kind %q", b.Kind)
+	}
+	if b.Then != nil {
+		return b.Then.Validate()
+	}
+	return nil
+}
+
+// IsHonest 该配置是否为诚实行为
+func (b *BehaviorSpec) IsHonest() bool {
+	return b == nil || b.Kind == BehaviorHonest
+}
+
+// BuildBehaviors 为节点池中的每个节点构造 Behavior：
+// - NodeSpec.Behavior 非空时按配置构造（同名 coalition 的成员共享同一个 *Coalition）
+// - 否则恶意节点使用 fallback（各引擎的默认恶意模型），诚实节点使用 HonestBehavior
+func BuildBehaviors(specs []NodeSpec, fallback Behavior) map[int]Behavior {
+	coalitions := map[string]*Coalition{}
+	for _, sp := range specs {
+		collectCoalitions(sp.ID, sp.Behavior, coalitions)
+	}
+
+	out := make(map[int]Behavior, len(specs))
+	for _, sp := range specs {
+		switch {
+		case sp.Behavior != nil:
+			out[sp.ID] = buildBehavior(*sp.Behavior, coalitions)
+		case sp.IsMalicious && fallback != nil:
+			out[sp.ID] = fallback
+		default:
+			out[sp.ID] = HonestBehavior{}
+		}
+	}
+	return out
+}
+
+func collectCoalitions(id int, b *BehaviorSpec, coalitions map[string]*Coalition) {
+	for ; b != nil; b = b.Then {
+		if b.Kind != BehaviorCoalition {
+			continue
+		}
+		c, ok := coalitions[b.Coalition]
+		if !ok {
+			c = &Coalition{Name: b.Coalition, Target: b.Target, Members: map[int]bool{}}
+			coalitions[b.Coalition] = c
+		}
+		c.Members[id] = true
+	}
+}
+
+func buildBehavior(b BehaviorSpec, coalitions map[string]*Coalition) Behavior {
+	var then Behavior
+	if b.Then != nil {
+		then = buildBehavior(*b.Then, coalitions)
+	}
+	switch b.Kind {
+	case BehaviorRandom:
+		return ProbabilisticBehavior{Silent: map[Phase]float64{PhaseAny: b.Prob}}
+	case BehaviorEquivocate:
+		return EquivocationBehavior{}
+	case BehaviorSilent:
+		targets := make(map[int]bool, len(b.Targets))
+		for _, t := range b.Targets {
+			targets[t] = true
+		}
+		return SelectiveSilenceBehavior{Targets: targets}
+	case BehaviorDelay:
+		return DelayedVotingBehavior{Margin: time.Duration(b.DelayMs * float64(time.Millisecond))}
+	case BehaviorCoalition:
+		attack := ActSilent
+		if b.Attack == "reject" {
+			attack = ActReject
+		}
+		return CoalitionBehavior{Coalition: coalitions[b.Coalition], Attack: attack, Otherwise: then}
+	case BehaviorSleeper:
+		return SleeperBehavior{WakeRound: b.WakeRound, After: then}
+	default:
+		return HonestBehavior{}
+	}
+}
@@ -0,0 +1,45 @@
+//go:build !blst
+
+package node
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ======================= 【高亮-2026-10-16】修改：无 blst tag 时 NewBlstBLS 退化为 Stub =======================
+// 真实实现见 bls_blst.go（go build -tags blst）。
+
+// BlstEnabled 当前构建是否启用了真实 blst 实现
+const BlstEnabled = false
+
+// BLSScheme 密钥库记录的签名方案（与构建方式绑定，防止用 Stub 构建加载 blst 密钥）
+const BLSScheme = "stub"
+
+// NewBlstBLS 让没有 blst tag 的环境下也可调用（返回 SimpleBLSStub）
+func NewBlstBLS(id int) BLS {
+	return NewSimpleBLSStub(id)
+}
+
+// NewBLSFromSecret 由密钥库中的秘密恢复节点身份（Stub：公钥由秘密派生）
+func NewBLSFromSecret(id int, secret []byte) (BLS, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("stub: empty secret")
+	}
+	return newSeededStub(id, secret), nil
+}
+
+// keySchemeCompatible 密钥文件记录的方案能否在当前构建中加载
+func keySchemeCompatible(scheme string) bool {
+	return scheme == BLSScheme
+}
+
+// VerifyPossession 验证公钥的持有证明（Stub）
+func VerifyPossession(pubKey, proof []byte) (bool, error) {
+	return bytes.Equal(proof, stubSig(pubKey, popMessage(pubKey))), nil
+}
+
+// VerifyAggregate 不持有密钥的一方（审计方）验证同一消息上的聚合签名（Stub：签名须与公钥按相同顺序排列）
+func VerifyAggregate(pubKeys [][]byte, message []byte, aggSig []byte) (bool, error) {
+	return (&SimpleBLSStub{}).VerifyAggregate(pubKeys, message, aggSig)
+}
@@ -1,7 +1,8 @@
 package node
 
 import (
-	"crypto/rand"
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 )
 
@@ -12,22 +13,42 @@ type BLS interface {
 	Sign(message []byte) ([]byte, error)
 	AggregateSignatures(sigs [][]byte) ([]byte, error)
 	VerifyAggregate(pubKeys [][]byte, message []byte, aggSig []byte) (bool, error)
+	// 【高亮-2026-10-16】新增：单签名验证（聚合验证失败时用于定位作恶签名者）
+	Verify(pubKey []byte, message []byte, sig []byte) (bool, error)
 	PublicKey() []byte
+	// 【高亮-2026-10-16】新增：公钥的持有证明（登记公钥时验证，防止恶意公钥攻击伪造聚合签名）
+	ProvePossession() ([]byte, error)
 }
 
 // SimpleBLSStub：非安全 stub，仅用于本地仿真/无 blst 环境
 type SimpleBLSStub struct {
-	id int
+	id     int
+	secret []byte // 【高亮-2026-10-16】新增：来自密钥库的秘密（为空时公钥只由 ID 决定）
 }
 
 func NewSimpleBLSStub(id int) *SimpleBLSStub {
 	return &SimpleBLSStub{id: id}
 }
 
+// newSeededStub 由秘密派生 Stub 身份：公钥为 PK-node-XX-<sha256(secret) 前 4 字节>，
+// 同一密钥文件在每次运行中得到相同的身份，换了秘密则身份不同
+func newSeededStub(id int, secret []byte) *SimpleBLSStub {
+	return &SimpleBLSStub{id: id, secret: append([]byte(nil), secret...)}
+}
+
+func (s *SimpleBLSStub) secretKey() []byte {
+	return s.secret
+}
+
+// 【高亮-2026-10-16】修改：Stub 签名绑定签名者与消息（SIG-node-XX-<消息摘要前 8 字节>），
+// 使伪造签名（如 bad-sign-node-XX）在 Stub 下同样验不过，便于在无 blst 环境中演练作恶者定位。
+func stubSig(pubKey, message []byte) []byte {
+	h := sha256.Sum256(append(append([]byte{}, pubKey...), message...))
+	return []byte(fmt.Sprintf("SIG-%s-%x", bytes.TrimPrefix(pubKey, []byte("PK-")), h[:8]))
+}
+
 func (s *SimpleBLSStub) Sign(message []byte) ([]byte, error) {
-	b := make([]byte, 8)
-	_, _ = rand.Read(b)
-	return append([]byte(fmt.Sprintf("SIG-node-%02d-", s.id)), b...), nil
+	return stubSig(s.PublicKey(), message), nil
 }
 
 func (s *SimpleBLSStub) AggregateSignatures(sigs [][]byte) ([]byte, error) {
@@ -39,13 +60,42 @@ func (s *SimpleBLSStub) AggregateSignatures(sigs [][]byte) ([]byte, error) {
 	return agg, nil
 }
 
+// VerifyAggregate 拆开 "AGG:" 后逐个比对（签名与公钥按相同顺序排列）
 func (s *SimpleBLSStub) VerifyAggregate(pubKeys [][]byte, message []byte, aggSig []byte) (bool, error) {
-	if len(aggSig) >= 4 && string(aggSig[:4]) == "AGG:" {
-		return true, nil
+	if !bytes.HasPrefix(aggSig, []byte("AGG:")) {
+		return false, nil
+	}
+	parts := bytes.Split(bytes.TrimSuffix(aggSig[4:], []byte(";")), []byte(";"))
+	if len(pubKeys) == 0 || len(parts) != len(pubKeys) {
+		return false, nil
+	}
+	for i, pk := range pubKeys {
+		if ok, _ := s.Verify(pk, message, parts[i]); !ok {
+			return false, nil
+		}
 	}
-	return false, nil
+	return true, nil
+}
+
+func (s *SimpleBLSStub) Verify(pubKey []byte, message []byte, sig []byte) (bool, error) {
+	return bytes.Equal(sig, stubSig(pubKey, message)), nil
+}
+
+// popMessage Stub 持有证明签署的内容
+func popMessage(pubKey []byte) []byte {
+	return append([]byte("POP|"), pubKey...)
+}
+
+// ProvePossession Stub 的持有证明：对 "POP|公钥" 签名（与 Stub 签名一样不提供安全性，只演练登记流程）
+func (s *SimpleBLSStub) ProvePossession() ([]byte, error) {
+	pk := s.PublicKey()
+	return stubSig(pk, popMessage(pk)), nil
 }
 
 func (s *SimpleBLSStub) PublicKey() []byte {
+	if len(s.secret) > 0 {
+		h := sha256.Sum256(s.secret)
+		return []byte(fmt.Sprintf("PK-node-%02d-%x", s.id, h[:4]))
+	}
 	return []byte(fmt.Sprintf("PK-node-%02d", s.id))
 }
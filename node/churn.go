@@ -0,0 +1,308 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// ======================= 【高亮-2026-10-16】新增：节点流失模型（宕机 / 恢复 / 加入 / 离开） =======================
+// 目的：NewPool 生成的 NodeSpec.Active 恒为 true，无法衡量产消者设备掉线时各共识引擎的可用性。
+// Churn 是一个跨轮推进的有状态过程：
+// - 宕机：每轮每个在线成员以 CrashRate 概率宕机，宕机时长服从均值为 MTTRRounds 的几何分布，期间 Active=false；
+// - 加入：按计划在某轮加入新的节点 ID（属性按节点池分布抽取，恶意与否按 MaliciousRatio）；
+// - 离开：按计划在某轮让成员永久退出（不再出现在节点池中）。
+// 引擎据此处理：宕机成员仍计入成员数（法定人数不变）但不收发消息；离开的节点从成员中移除。
+
+// MembershipChange 计划中的一次加入/离开
+type MembershipChange struct {
+	Round int   `json:"round" yaml:"round"`
+	Count int   `json:"count,omitempty" yaml:"count,omitempty"` // 加入：新分配的 ID 数；离开：随机挑选的成员数
+	IDs   []int `json:"ids,omitempty" yaml:"ids,omitempty"`     // 显式指定的节点 ID
+}
+
+// ChurnConfig 流失模型配置
+type ChurnConfig struct {
+	CrashRate  float64            `json:"crashRate" yaml:"crashRate"`   // 每轮每个在线成员宕机的概率
+	MTTRRounds float64            `json:"mttrRounds" yaml:"mttrRounds"` // 平均恢复时间（轮），<=0 时取 5
+	Joins      []MembershipChange `json:"joins,omitempty" yaml:"joins,omitempty"`
+	Leaves     []MembershipChange `json:"leaves,omitempty" yaml:"leaves,omitempty"`
+	Seed       int64              `json:"seed,omitempty" yaml:"seed,omitempty"` // 为 0 时取 PoolConfig.Seed
+}
+
+// DefaultMTTRRounds 未配置时的平均恢复轮数
+const DefaultMTTRRounds = 5
+
+// Validate 检查配置合法性
+func (c ChurnConfig) Validate() error {
+	if c.CrashRate < 0 || c.CrashRate > 1 {
+		return fmt.Errorf("churn: crashRate must be in [0,1], got %.3f", c.CrashRate)
+	}
+	if c.MTTRRounds < 0 {
+		return fmt.Errorf("churn: negative mttrRounds")
+	}
+	for _, ch := range append(append([]MembershipChange(nil), c.Joins...), c.Leaves...) {
+		if ch.Round < 0 || ch.Count < 0 {
+			return fmt.Errorf("churn: membership change at round %d has negative round/count", ch.Round)
+		}
+	}
+	return nil
+}
+
+// 流失事件类型
+const (
+	ChurnCrash   = "crash"
+	ChurnRecover = "recover"
+	ChurnJoin    = "join"
+	ChurnLeave   = "leave"
+)
+
+// ChurnEvent 某轮发生的一次成员变化
+type ChurnEvent struct {
+	Round int
+	ID    int
+	Kind  string
+}
+
+// ChurnStats 累计可用性统计（按"节点·轮"计）
+type ChurnStats struct {
+	Rounds       int
+	MemberRounds int // 成员节点·轮
+	OnlineRounds int // 在线节点·轮
+	Crashes      int
+	Joins        int
+	Leaves       int
+}
+
+// Availability 在线节点·轮 / 成员节点·轮
+func (s ChurnStats) Availability() float64 {
+	if s.MemberRounds == 0 {
+		return 1
+	}
+	return float64(s.OnlineRounds) / float64(s.MemberRounds)
+}
+
+// Churn 跨轮推进的流失过程（非并发安全，由仿真主循环驱动）
+type Churn struct {
+	pool  PoolConfig
+	cfg   ChurnConfig
+	rng   *rand.Rand
+	round int // 已推进到的轮次；-1 表示尚未开始
+
+	members   map[int]bool     // 当前成员（含宕机成员）
+	downUntil map[int]int      // 宕机成员 -> 恢复轮次
+	joined    map[int]NodeSpec // 加入节点的固定属性
+	nextID    int
+	events    []ChurnEvent
+	stats     ChurnStats
+}
+
+// NewChurn 按节点池配置创建流失过程；PoolConfig.Churn 为 nil 时不产生任何事件（节点池与 NewPoolFromConfig 相同）
+func NewChurn(pool PoolConfig) *Churn {
+	var cfg ChurnConfig
+	if pool.Churn != nil {
+		cfg = *pool.Churn
+	}
+	if cfg.MTTRRounds <= 0 {
+		cfg.MTTRRounds = DefaultMTTRRounds
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = pool.Seed
+	}
+	c := &Churn{
+		pool:      pool,
+		cfg:       cfg,
+		rng:       rand.New(rand.NewSource(seed)),
+		round:     -1,
+		members:   make(map[int]bool, pool.NumNodes),
+		downUntil: make(map[int]int),
+		joined:    make(map[int]NodeSpec),
+		nextID:    pool.NumNodes,
+	}
+	for id := 0; id < pool.NumNodes; id++ {
+		c.members[id] = true
+	}
+	return c
+}
+
+// Pool 推进到第 round 轮并返回本轮节点池：离开的节点不出现，宕机节点 Active=false。
+// round 应单调不减；重复调用同一轮返回相同结果，不会再次推进。
+func (c *Churn) Pool(round int) []NodeSpec {
+	if round > c.round {
+		c.events = nil
+		for r := c.round + 1; r <= round; r++ {
+			c.advance(r)
+		}
+		c.round = round
+	}
+
+	base := NewPoolFromConfig(round, c.pool)
+	out := make([]NodeSpec, 0, len(c.members))
+	for _, sp := range base {
+		if c.members[sp.ID] {
+			out = append(out, sp)
+		}
+	}
+	for _, id := range c.sortedJoined() {
+		if c.members[id] {
+			out = append(out, c.joined[id])
+		}
+	}
+	for i := range out {
+		_, down := c.downUntil[out[i].ID]
+		out[i].Active = !down
+	}
+	return out
+}
+
+// Events 最近一次 Pool 推进过程中发生的事件
+func (c *Churn) Events() []ChurnEvent {
+	return append([]ChurnEvent(nil), c.events...)
+}
+
+// Stats 到目前为止的累计统计
+func (c *Churn) Stats() ChurnStats {
+	return c.stats
+}
+
+// Members 当前成员 ID（升序，含宕机成员）
+func (c *Churn) Members() []int {
+	ids := make([]int, 0, len(c.members))
+	for id := range c.members {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// advance 推进一轮：先离开、再加入、再恢复、最后抽取新的宕机
+func (c *Churn) advance(r int) {
+	for _, ch := range c.cfg.Leaves {
+		if ch.Round != r {
+			continue
+		}
+		leave := append([]int(nil), ch.IDs...)
+		candidates := c.Members()
+		c.rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		leave = append(leave, candidates[:min(ch.Count, len(candidates))]...)
+		for _, id := range leave {
+			if !c.members[id] {
+				continue
+			}
+			delete(c.members, id)
+			delete(c.downUntil, id)
+			c.emit(r, id, ChurnLeave)
+			c.stats.Leaves++
+		}
+	}
+
+	for _, ch := range c.cfg.Joins {
+		if ch.Round != r {
+			continue
+		}
+		ids := append([]int(nil), ch.IDs...)
+		for k := 0; k < ch.Count; k++ {
+			ids = append(ids, c.allocID())
+		}
+		for _, id := range ids {
+			if _, seen := c.joined[id]; seen || id < c.pool.NumNodes {
+				continue // 节点 ID 只能加入一次（离开后不复用）
+			}
+			if id >= c.nextID {
+				c.nextID = id + 1
+			}
+			c.joined[id] = c.newSpec(id)
+			c.members[id] = true
+			c.emit(r, id, ChurnJoin)
+			c.stats.Joins++
+		}
+	}
+
+	recovered := make(map[int]bool)
+	for _, id := range c.Members() {
+		if until, down := c.downUntil[id]; down && until <= r {
+			delete(c.downUntil, id)
+			recovered[id] = true
+			c.emit(r, id, ChurnRecover)
+		}
+	}
+
+	if c.cfg.CrashRate > 0 {
+		for _, id := range c.Members() {
+			if _, down := c.downUntil[id]; down || recovered[id] {
+				continue // 刚恢复的节点本轮至少在线
+			}
+			if c.rng.Float64() < c.cfg.CrashRate {
+				c.downUntil[id] = r + c.downtime()
+				c.emit(r, id, ChurnCrash)
+				c.stats.Crashes++
+			}
+		}
+	}
+
+	c.stats.Rounds++
+	c.stats.MemberRounds += len(c.members)
+	c.stats.OnlineRounds += len(c.members) - len(c.downUntil)
+}
+
+// downtime 宕机时长（轮）：均值为 MTTRRounds 的几何分布，至少 1 轮
+func (c *Churn) downtime() int {
+	p := 1 / math.Max(c.cfg.MTTRRounds, 1)
+	d := 1 + int(math.Floor(math.Log(1-c.rng.Float64())/math.Log(1-p+1e-12)))
+	if d < 1 {
+		d = 1
+	}
+	return d
+}
+
+func (c *Churn) allocID() int {
+	for {
+		id := c.nextID
+		c.nextID++
+		if _, seen := c.joined[id]; !seen {
+			return id
+		}
+	}
+}
+
+// newSpec 新加入节点的属性：按节点池分布抽取，用节点 ID 固定随机源（与加入时机无关）
+func (c *Churn) newSpec(id int) NodeSpec {
+	rng := rand.New(rand.NewSource(c.pool.Seed + int64(id)*7919))
+	sp := NodeSpec{
+		ID:          id,
+		Throughput:  c.pool.Throughput.Sample(rng),
+		Stake:       c.pool.Stake.Sample(rng),
+		Active:      true,
+		IsMalicious: rng.Float64() < c.pool.MaliciousRatio,
+	}
+	if sp.IsMalicious {
+		sp.Behavior = c.pool.MaliciousBehavior
+	}
+	return sp
+}
+
+func (c *Churn) sortedJoined() []int {
+	ids := make([]int, 0, len(c.joined))
+	for id := range c.joined {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (c *Churn) emit(round, id int, kind string) {
+	c.events = append(c.events, ChurnEvent{Round: round, ID: id, Kind: kind})
+}
+
+// ActiveCount 节点池中在线（Active）的节点数
+func ActiveCount(specs []NodeSpec) int {
+	n := 0
+	for _, sp := range specs {
+		if sp.Active {
+			n++
+		}
+	}
+	return n
+}
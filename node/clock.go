@@ -0,0 +1,87 @@
+package node
+
+import (
+	"sync"
+	"time"
+)
+
+// ======================= 【高亮-2026-10-16】新增：时钟抽象 Clock（真实时钟 / 虚拟离散事件时钟） =======================
+// 目的：签名耗时、Raft 选举超时、模拟器每轮间隔不再 time.Sleep 真实等待。
+// 仿真使用 VirtualClock：Sleep 只把虚拟时间往前拨，Network 的事件队列按虚拟时间投递消息，
+// 因此千轮仿真可以在数秒内跑完，测得的时延以"仿真毫秒"表示且可复现。
+
+// Clock 时间来源
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+}
+
+// RealClock 真实墙钟（交互式服务使用）
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                  { return time.Now() }
+func (RealClock) Since(t time.Time) time.Duration { return time.Since(t) }
+func (RealClock) Sleep(d time.Duration)           { time.Sleep(d) }
+
+// VirtualEpoch 虚拟时钟的起点（固定值，保证时间戳可复现）
+var VirtualEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// VirtualClock 虚拟时钟：时间只会被 Sleep / Advance / AdvanceTo 推进（并发安全）。
+// 注意：并发调用 Sleep 会把各自的等待时长累加（相当于串行处理）；需要并行建模的场景
+// （如多个副本同时签名）应把耗时交给 Network.SendAfter，由事件队列按投递时刻排序。
+type VirtualClock struct {
+	mu      sync.Mutex
+	elapsed time.Duration
+}
+
+// NewVirtualClock 创建从 VirtualEpoch 开始的虚拟时钟
+func NewVirtualClock() *VirtualClock {
+	return &VirtualClock{}
+}
+
+// Now 当前虚拟时刻
+func (c *VirtualClock) Now() time.Time {
+	return VirtualEpoch.Add(c.Elapsed())
+}
+
+// Since 自 t 起经过的虚拟时长
+func (c *VirtualClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Sleep 立即返回，虚拟时间前进 d
+func (c *VirtualClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Elapsed 自 VirtualEpoch 起经过的虚拟时长
+func (c *VirtualClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.elapsed
+}
+
+// Advance 虚拟时间前进 d（d<=0 时不变）
+func (c *VirtualClock) Advance(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.elapsed += d
+}
+
+// AdvanceTo 把虚拟时间推进到 elapsed（时间不会倒退）
+func (c *VirtualClock) AdvanceTo(elapsed time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elapsed > c.elapsed {
+		c.elapsed = elapsed
+	}
+}
+
+// DurationMs 把时长换算为（仿真）毫秒
+func DurationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
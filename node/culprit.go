@@ -0,0 +1,58 @@
+package node
+
+// ======================= 【高亮-2026-10-16】新增：聚合签名验证失败时定位作恶签名者 =======================
+// 聚合签名只能给出"整体对/错"。验证失败时用二分法：把签名集合对半拆开分别聚合验证，
+// 只继续拆分验证失败的一半，直到定位到单个签名。k 个坏签名的验证次数约为 O(k·log n)，
+// 远少于逐个验签的 n 次；坏签名占比很高时退化为逐个验证。
+
+// FindCulprits 返回 sigs 中无法通过验证的签名下标（升序）；sigs[i] 由 pubKeys[i] 对 message 签出
+func FindCulprits(b BLS, pubKeys [][]byte, message []byte, sigs [][]byte) []int {
+	if len(sigs) != len(pubKeys) {
+		return nil
+	}
+	var out []int
+	var bisect func(lo, hi int)
+	bisect = func(lo, hi int) {
+		if hi-lo == 1 {
+			if ok, err := b.Verify(pubKeys[lo], message, sigs[lo]); err != nil || !ok {
+				out = append(out, lo)
+			}
+			return
+		}
+		if aggregateValid(b, pubKeys[lo:hi], message, sigs[lo:hi]) {
+			return
+		}
+		mid := (lo + hi) / 2
+		bisect(lo, mid)
+		bisect(mid, hi)
+	}
+	if len(sigs) > 0 {
+		bisect(0, len(sigs))
+	}
+	return out
+}
+
+func aggregateValid(b BLS, pubKeys [][]byte, message []byte, sigs [][]byte) bool {
+	agg, err := b.AggregateSignatures(sigs)
+	if err != nil {
+		return false
+	}
+	ok, err := b.VerifyAggregate(pubKeys, message, agg)
+	return err == nil && ok
+}
+
+// Verify 导出单签名验证能力（封装 n.bls）
+func (n *Node) Verify(pubKey []byte, message []byte, sig []byte) (bool, error) {
+	n.mu.Lock()
+	bls := n.bls
+	n.mu.Unlock()
+	return bls.Verify(pubKey, message, sig)
+}
+
+// FindCulprits 由节点（通常是 leader）用自身的 BLS 实现定位坏签名
+func (n *Node) FindCulprits(pubKeys [][]byte, message []byte, sigs [][]byte) []int {
+	n.mu.Lock()
+	bls := n.bls
+	n.mu.Unlock()
+	return FindCulprits(bls, pubKeys, message, sigs)
+}
@@ -0,0 +1,114 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ======================= 【高亮-2026-10-16】新增：共享公钥登记表 KeyRegistry =======================
+// 目的：验签方（leader / 审计方）按节点 ID 查公钥，而不是信任投票消息里附带的公钥。
+// 同一 ID 只允许登记一把公钥，防止节点在运行中"换钥"冒充他人。
+// 登记时须附公钥的持有证明（PoP），否则攻击者可用恶意公钥（他人公钥的组合）伪造同一消息上的聚合签名。
+
+// KeyRegistry 节点 ID -> 公钥（并发安全）
+type KeyRegistry struct {
+	mu   sync.RWMutex
+	keys map[int][]byte
+	pops map[int][]byte // 公钥的持有证明（导出清单时一并发布）
+}
+
+// NewKeyRegistry 创建空登记表
+func NewKeyRegistry() *KeyRegistry {
+	return &KeyRegistry{keys: make(map[int][]byte), pops: make(map[int][]byte)}
+}
+
+// RegistryFromNodes 用一组节点的公钥初始化登记表
+func RegistryFromNodes(nodes []*Node) *KeyRegistry {
+	r := NewKeyRegistry()
+	for _, nd := range nodes {
+		pop, _ := nd.ProofOfPossession()
+		_ = r.Register(nd.ID, nd.PublicKey(), pop) // 节点 ID 唯一、证明由节点自身密钥生成，不会失败
+	}
+	return r
+}
+
+// Register 验证持有证明后登记公钥；同一 ID 重复登记相同公钥视为成功，不同公钥返回错误
+func (r *KeyRegistry) Register(id int, pubKey, pop []byte) error {
+	if len(pubKey) == 0 {
+		return fmt.Errorf("key registry: empty public key for node %d", id)
+	}
+	if ok, err := VerifyPossession(pubKey, pop); err != nil || !ok {
+		return fmt.Errorf("key registry: node %d: invalid proof of possession", id)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.keys[id]; ok {
+		if bytes.Equal(old, pubKey) {
+			return nil
+		}
+		return fmt.Errorf("key registry: node %d already has a different public key", id)
+	}
+	r.keys[id] = append([]byte(nil), pubKey...)
+	r.pops[id] = append([]byte(nil), pop...)
+	return nil
+}
+
+// Revoke 注销节点公钥（节点离开网络后其签名不再被接受；流失模型不会复用已离开的 ID）
+func (r *KeyRegistry) Revoke(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, id)
+	delete(r.pops, id)
+}
+
+// PublicKey 查询单个节点公钥
+func (r *KeyRegistry) PublicKey(id int) ([]byte, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pk, ok := r.keys[id]
+	return pk, ok
+}
+
+// ProofOfPossession 查询节点公钥的持有证明
+func (r *KeyRegistry) ProofOfPossession(id int) ([]byte, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pop, ok := r.pops[id]
+	return pop, ok
+}
+
+// PublicKeys 按 ids 顺序返回公钥；任一 ID 未登记即报错
+func (r *KeyRegistry) PublicKeys(ids []int) ([][]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		pk, ok := r.keys[id]
+		if !ok {
+			return nil, fmt.Errorf("key registry: node %d not registered", id)
+		}
+		out = append(out, pk)
+	}
+	return out, nil
+}
+
+// IDs 已登记的节点 ID（升序）
+func (r *KeyRegistry) IDs() []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]int, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Len 已登记的公钥数
+func (r *KeyRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.keys)
+}
@@ -0,0 +1,433 @@
+package node
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ======================= 【高亮-2026-10-16】新增：持久化节点密钥库 =======================
+// 目的：SimpleBLSStub 与 NewBlstBLS 每次构造都生成新密钥，同一节点每次运行身份都不同。
+// Keystore 在目录中为每个节点保存一个加密的密钥文件 node-<id>.key：
+// - 秘密（blst KeyGen 的 IKM / Stub 的种子）用 AES-256-GCM 加密，密钥由口令经 PBKDF2-SHA256 派生；
+// - 节点 ID、签名方案与公钥以明文保存并作为 GCM 附加数据，被篡改或口令错误时解密失败；
+// - ExportManifest 导出只含公钥的清单（manifest.json），其它节点与轻客户端用 LoadManifest 加载。
+// - 【高亮-2026-10-16】密钥文件与清单同时保存公钥的持有证明，清单导入登记表时逐个验证。
+
+// KeystorePassphraseEnv 未显式给出口令时读取的环境变量
+const KeystorePassphraseEnv = "PBFT_KEYSTORE_PASSPHRASE"
+
+// DefaultKDFIterations 新建密钥文件时 PBKDF2 的默认迭代次数
+const DefaultKDFIterations = 100000
+
+const (
+	keystoreVersion = 1
+	keySecretLen    = 32
+	kdfName         = "pbkdf2-sha256"
+	cipherName      = "aes-256-gcm"
+)
+
+// KeystoreConfig 密钥库配置（可写在场景文件中；口令不写入文件，从环境变量读取）
+type KeystoreConfig struct {
+	Dir           string `json:"dir" yaml:"dir"`
+	PassphraseEnv string `json:"passphraseEnv,omitempty" yaml:"passphraseEnv,omitempty"` // 默认 PBFT_KEYSTORE_PASSPHRASE
+	Manifest      string `json:"manifest,omitempty" yaml:"manifest,omitempty"`           // 默认 <dir>/manifest.json
+	Iterations    int    `json:"iterations,omitempty" yaml:"iterations,omitempty"`       // 仅影响新建的密钥文件
+}
+
+// Open 按配置打开密钥库（口令取自 PassphraseEnv 指定的环境变量）
+func (c KeystoreConfig) Open() (*Keystore, error) {
+	env := c.PassphraseEnv
+	if env == "" {
+		env = KeystorePassphraseEnv
+	}
+	pass := os.Getenv(env)
+	if pass == "" {
+		return nil, fmt.Errorf("keystore: passphrase environment variable %s is empty", env)
+	}
+	ks, err := OpenKeystore(c.Dir, pass)
+	if err != nil {
+		return nil, err
+	}
+	if c.Iterations > 0 {
+		ks.iterations = c.Iterations
+	}
+	return ks, nil
+}
+
+// ManifestPath 公钥清单的输出路径
+func (c KeystoreConfig) ManifestPath() string {
+	if c.Manifest != "" {
+		return c.Manifest
+	}
+	return filepath.Join(c.Dir, "manifest.json")
+}
+
+// Keystore 目录中的加密密钥文件集合（并发安全；解密后的密钥缓存在内存中）
+type Keystore struct {
+	dir        string
+	passphrase string
+	iterations int
+
+	mu    sync.Mutex
+	cache map[int]BLS
+}
+
+// keyFile 单个节点密钥文件的 JSON 结构
+type keyFile struct {
+	Version   int    `json:"version"`
+	ID        int    `json:"id"`
+	Scheme    string `json:"scheme"`
+	PublicKey string `json:"publicKey"`     // hex
+	PoP       string `json:"pop,omitempty"` // hex，公钥的持有证明（旧版密钥文件没有，导出清单时由密钥重新生成）
+	KDF       struct {
+		Name       string `json:"name"`
+		Iterations int    `json:"iterations"`
+		Salt       string `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name       string `json:"name"`
+		Nonce      string `json:"nonce"`
+		Ciphertext string `json:"ciphertext"`
+	} `json:"cipher"`
+}
+
+// OpenKeystore 打开（不存在时创建）密钥库目录；口令不能为空
+func OpenKeystore(dir, passphrase string) (*Keystore, error) {
+	if dir == "" {
+		return nil, errors.New("keystore: empty directory")
+	}
+	if passphrase == "" {
+		return nil, errors.New("keystore: empty passphrase")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	return &Keystore{dir: dir, passphrase: passphrase, iterations: DefaultKDFIterations, cache: make(map[int]BLS)}, nil
+}
+
+// Dir 密钥库目录
+func (ks *Keystore) Dir() string {
+	return ks.dir
+}
+
+func (ks *Keystore) path(id int) string {
+	return filepath.Join(ks.dir, fmt.Sprintf("node-%d.key", id))
+}
+
+// Load 读取并解密节点 id 的密钥；文件不存在时返回 os.ErrNotExist
+func (ks *Keystore) Load(id int) (BLS, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.loadLocked(id)
+}
+
+// LoadOrCreate 读取节点 id 的密钥，不存在时生成并保存；created 表示是否新建
+func (ks *Keystore) LoadOrCreate(id int) (b BLS, created bool, err error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	b, err = ks.loadLocked(id)
+	if !errors.Is(err, os.ErrNotExist) {
+		return b, false, err
+	}
+	secret := make([]byte, keySecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, false, fmt.Errorf("keystore: %w", err)
+	}
+	if b, err = NewBLSFromSecret(id, secret); err != nil {
+		return nil, false, fmt.Errorf("keystore: node %d: %w", id, err)
+	}
+	if err := ks.saveLocked(id, b, secret); err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// Save 加密保存节点 id 的密钥（b 须来自 NewBLSFromSecret / NewBlstBLS 等可导出秘密的实现）；
+// 不覆盖已有文件，避免节点身份被意外替换
+func (ks *Keystore) Save(id int, b BLS) error {
+	sk, ok := b.(interface{ secretKey() []byte })
+	if !ok || len(sk.secretKey()) == 0 {
+		return fmt.Errorf("keystore: node %d: key has no exportable secret", id)
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.saveLocked(id, b, sk.secretKey())
+}
+
+// IDs 密钥库中已有密钥文件的节点 ID（升序）
+func (ks *Keystore) IDs() ([]int, error) {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	var ids []int
+	for _, e := range entries {
+		if m := keyFileName.FindStringSubmatch(e.Name()); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+var keyFileName = regexp.MustCompile(`^node-(\d+)\.key$`)
+
+// AttachKeys 为每个节点装上密钥库中的持久身份（缺失的密钥自动生成），返回新建的密钥数
+func (ks *Keystore) AttachKeys(nodes []*Node) (created int, err error) {
+	for _, nd := range nodes {
+		b, isNew, err := ks.LoadOrCreate(nd.ID)
+		if err != nil {
+			return created, err
+		}
+		if isNew {
+			created++
+		}
+		nd.SetBLS(b)
+	}
+	return created, nil
+}
+
+// ExportManifest 把密钥库中全部节点的公钥写成清单文件（不含任何秘密）
+func (ks *Keystore) ExportManifest(path string) error {
+	ids, err := ks.IDs()
+	if err != nil {
+		return err
+	}
+	m := Manifest{Version: keystoreVersion, Scheme: BLSScheme}
+	for _, id := range ids {
+		kf, err := ks.readFile(id)
+		if err != nil {
+			return err
+		}
+		pop := kf.PoP
+		if kf.Scheme != BLSScheme || pop == "" {
+			b, err := ks.Load(id)
+			if err != nil {
+				return err
+			}
+			proof, err := b.ProvePossession()
+			if err != nil {
+				return fmt.Errorf("keystore: node %d: %w", id, err)
+			}
+			pop = hex.EncodeToString(proof)
+		}
+		m.Nodes = append(m.Nodes, ManifestEntry{ID: id, PublicKey: kf.PublicKey, PoP: pop})
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	return nil
+}
+
+func (ks *Keystore) readFile(id int) (keyFile, error) {
+	var kf keyFile
+	data, err := os.ReadFile(ks.path(id))
+	if err != nil {
+		return kf, fmt.Errorf("keystore: %w", err) // 保留 os.ErrNotExist
+	}
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return kf, fmt.Errorf("keystore: %s: %w", ks.path(id), err)
+	}
+	if kf.Version != keystoreVersion || kf.ID != id {
+		return kf, fmt.Errorf("keystore: %s: unexpected version %d / id %d", ks.path(id), kf.Version, kf.ID)
+	}
+	return kf, nil
+}
+
+func (ks *Keystore) loadLocked(id int) (BLS, error) {
+	if b, ok := ks.cache[id]; ok {
+		return b, nil
+	}
+	kf, err := ks.readFile(id)
+	if err != nil {
+		return nil, err
+	}
+	if !keySchemeCompatible(kf.Scheme) {
+		return nil, fmt.Errorf("keystore: node %d key uses scheme %q, this build uses %q", id, kf.Scheme, BLSScheme)
+	}
+	if kf.KDF.Name != kdfName || kf.Cipher.Name != cipherName {
+		return nil, fmt.Errorf("keystore: node %d: unsupported kdf %q / cipher %q", id, kf.KDF.Name, kf.Cipher.Name)
+	}
+	salt, err1 := hex.DecodeString(kf.KDF.Salt)
+	nonce, err2 := hex.DecodeString(kf.Cipher.Nonce)
+	ct, err3 := hex.DecodeString(kf.Cipher.Ciphertext)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, fmt.Errorf("keystore: node %d: %w", id, err)
+	}
+	aead, err := ks.aead(salt, kf.KDF.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := aead.Open(nil, nonce, ct, keyAAD(id, kf.Scheme, kf.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("keystore: node %d: wrong passphrase or corrupted key file", id)
+	}
+	b, err := NewBLSFromSecret(id, secret)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: node %d: %w", id, err)
+	}
+	if hex.EncodeToString(b.PublicKey()) != kf.PublicKey {
+		return nil, fmt.Errorf("keystore: node %d: public key does not match secret", id)
+	}
+	ks.cache[id] = b
+	return b, nil
+}
+
+func (ks *Keystore) saveLocked(id int, b BLS, secret []byte) error {
+	if _, err := os.Stat(ks.path(id)); err == nil {
+		return fmt.Errorf("keystore: key for node %d already exists", id)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	aead, err := ks.aead(salt, ks.iterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+
+	pop, err := b.ProvePossession()
+	if err != nil {
+		return fmt.Errorf("keystore: node %d: %w", id, err)
+	}
+	kf := keyFile{Version: keystoreVersion, ID: id, Scheme: BLSScheme, PublicKey: hex.EncodeToString(b.PublicKey()), PoP: hex.EncodeToString(pop)}
+	kf.KDF.Name, kf.KDF.Iterations, kf.KDF.Salt = kdfName, ks.iterations, hex.EncodeToString(salt)
+	kf.Cipher.Name, kf.Cipher.Nonce = cipherName, hex.EncodeToString(nonce)
+	kf.Cipher.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, secret, keyAAD(id, kf.Scheme, kf.PublicKey)))
+
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	// 先写临时文件再改名，避免中途失败留下半个密钥文件
+	tmp := ks.path(id) + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	if err := os.Rename(tmp, ks.path(id)); err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	ks.cache[id] = b
+	return nil
+}
+
+func (ks *Keystore) aead(salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("keystore: invalid kdf iterations %d", iterations)
+	}
+	key, err := pbkdf2.Key(sha256.New, ks.passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func keyAAD(id int, scheme, pubKeyHex string) []byte {
+	return []byte(fmt.Sprintf("pbft-keystore|%d|%s|%s", id, scheme, pubKeyHex))
+}
+
+// ======================= 公钥清单 =======================
+
+// ManifestEntry 清单中的一个节点
+type ManifestEntry struct {
+	ID        int    `json:"id"`
+	PublicKey string `json:"publicKey"`       // hex
+	PoP       string `json:"pop"`             // hex，公钥的持有证明
+	From      int    `json:"from,omitempty"`  // 【高亮-2026-10-16】加入后的第一个序号（0 表示初始成员）
+	Until     int    `json:"until,omitempty"` // 【高亮-2026-10-16】离开后的第一个序号（0 表示仍是成员）
+}
+
+// MemberAt 节点在序号 seq 时是否为成员
+func (e ManifestEntry) MemberAt(seq int) bool {
+	return seq >= e.From && (e.Until == 0 || seq < e.Until)
+}
+
+// Manifest 公钥清单：只含节点 ID 与公钥，可公开分发
+type Manifest struct {
+	Version int             `json:"version"`
+	Scheme  string          `json:"scheme"`
+	Nodes   []ManifestEntry `json:"nodes"`
+}
+
+// MembersAt 序号 seq 时的成员 ID（升序）：法定人数证书的签名集合大小由此得出，而不是信任证书自报的数值
+func (m *Manifest) MembersAt(seq int) []int {
+	var ids []int
+	for _, e := range m.Nodes {
+		if e.MemberAt(seq) {
+			ids = append(ids, e.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// LoadManifest 读取公钥清单
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("manifest: parse %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Manifest 把登记表导出为公钥清单（方案为当前构建的签名方案）
+// 【高亮-2026-10-16】新增：未使用密钥库时（临时密钥）也能向审计方提供公钥
+func (r *KeyRegistry) Manifest() *Manifest {
+	m := &Manifest{Version: keystoreVersion, Scheme: BLSScheme}
+	for _, id := range r.IDs() {
+		pk, _ := r.PublicKey(id)
+		pop, _ := r.ProofOfPossession(id)
+		m.Nodes = append(m.Nodes, ManifestEntry{ID: id, PublicKey: hex.EncodeToString(pk), PoP: hex.EncodeToString(pop)})
+	}
+	return m
+}
+
+// Registry 把清单转成公钥登记表（验签方据此按节点 ID 查公钥）；
+// 清单的签名方案须与当前构建一致，持有证明无效或重复 ID 的冲突公钥会被拒绝
+func (m *Manifest) Registry() (*KeyRegistry, error) {
+	if m.Scheme != BLSScheme {
+		return nil, fmt.Errorf("manifest: scheme %q does not match this build (%q)", m.Scheme, BLSScheme)
+	}
+	r := NewKeyRegistry()
+	for _, e := range m.Nodes {
+		pk, err1 := hex.DecodeString(e.PublicKey)
+		pop, err2 := hex.DecodeString(e.PoP)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, fmt.Errorf("manifest: node %d: %w", e.ID, err)
+		}
+		if err := r.Register(e.ID, pk, pop); err != nil {
+			return nil, fmt.Errorf("manifest: %w", err)
+		}
+	}
+	return r, nil
+}
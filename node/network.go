@@ -0,0 +1,379 @@
+package node
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ======================= 【高亮-2026-10-16】新增：四种共识引擎共用的消息传递网络层 =======================
+// 目的：投票结果不再由各引擎本地 rng.Float64() 掷硬币决定，而是由真实在节点间传递的协议消息决定。
+// Network 是一个内存中的离散事件传输层：每条链路可配置时延、抖动、丢包、重复、乱序与带宽。
+
+// MsgType 协议消息类型（PBFT/APBFT/RAFT/POS 共用）
+type MsgType string
+
+const (
+	MsgPrePrepare        MsgType = "PRE-PREPARE"
+	MsgPrepare           MsgType = "PREPARE"
+	MsgCommit            MsgType = "COMMIT"
+	MsgRequestVote       MsgType = "REQUEST-VOTE"
+	MsgRequestVoteResp   MsgType = "REQUEST-VOTE-RESP"
+	MsgAppendEntries     MsgType = "APPEND-ENTRIES"
+	MsgAppendEntriesResp MsgType = "APPEND-ENTRIES-RESP"
+	MsgPOSProposal       MsgType = "POS-PROPOSAL"
+	MsgPOSVote           MsgType = "POS-VOTE"
+	MsgViewChange        MsgType = "VIEW-CHANGE" // 【高亮-2026-10-16】新增：APBFT 视图转换
+	MsgNewView           MsgType = "NEW-VIEW"
+	MsgCommitCert        MsgType = "COMMIT-CERT" // 【高亮-2026-10-16】新增：APBFT 提交证书、检查点与状态传输
+	MsgCheckpoint        MsgType = "CHECKPOINT"
+	MsgStableCheckpoint  MsgType = "STABLE-CHECKPOINT"
+	MsgFetchState        MsgType = "FETCH-STATE"
+	MsgState             MsgType = "STATE"
+)
+
+// Message 网络上传递的一条协议消息
+type Message struct {
+	Type    MsgType
+	From    int
+	To      int
+	Round   int         // 轮次 / view / term（由引擎自行解释）
+	Seq     int         // 序列号
+	Digest  string      // 请求摘要
+	Payload interface{} // 引擎自定义载荷（签名、RPC 请求体等）
+	Size    int         // 消息字节数，用于带宽建模；<=0 时按 DefaultMessageSize 计
+
+	SentAt    time.Duration // 发送时刻（仿真时间）
+	DeliverAt time.Duration // 投递时刻（仿真时间）
+}
+
+// DefaultMessageSize 未指定 Size 时的默认消息大小（字节）
+const DefaultMessageSize = 128
+
+// LinkConfig 单条有向链路的传输特性
+type LinkConfig struct {
+	LatencyMs     float64 `json:"latencyMs" yaml:"latencyMs"`         // 基础单向时延
+	JitterMs      float64 `json:"jitterMs" yaml:"jitterMs"`           // 时延抖动上限（均匀分布）
+	LossProb      float64 `json:"lossProb" yaml:"lossProb"`           // 丢包概率
+	DupProb       float64 `json:"dupProb" yaml:"dupProb"`             // 重复投递概率
+	ReorderProb   float64 `json:"reorderProb" yaml:"reorderProb"`     // 乱序概率（额外延迟使其被后发消息超越）
+	BandwidthKbps float64 `json:"bandwidthKbps" yaml:"bandwidthKbps"` // 链路带宽，<=0 表示不限
+	// 【高亮-2026-10-16】新增：每公里附加时延（传播 + 沿途交换），仅在网络设置了 DistanceModel 时生效
+	LatencyPerKmMs float64 `json:"latencyPerKmMs,omitempty" yaml:"latencyPerKmMs,omitempty"`
+}
+
+// DistanceModel 两节点间的通信距离（公里），由电网拓扑（topology.Grid）提供
+type DistanceModel interface {
+	Distance(a, b int) float64
+}
+
+// LinkOverride 针对某条有向链路覆盖默认配置
+type LinkOverride struct {
+	From int        `json:"from" yaml:"from"`
+	To   int        `json:"to" yaml:"to"`
+	Link LinkConfig `json:"link" yaml:"link"`
+}
+
+// NetworkConfig 网络整体配置
+type NetworkConfig struct {
+	Default   LinkConfig     `json:"default" yaml:"default"`
+	Overrides []LinkOverride `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// DefaultNetworkConfig 默认局域电网通信环境：5ms±3ms、1% 丢包、100Mbps
+func DefaultNetworkConfig() NetworkConfig {
+	return NetworkConfig{
+		Default: LinkConfig{
+			LatencyMs:      5,
+			JitterMs:       3,
+			LossProb:       0.01,
+			DupProb:        0.005,
+			ReorderProb:    0.02,
+			BandwidthKbps:  100000,
+			LatencyPerKmMs: 0.05,
+		},
+	}
+}
+
+// Handler 节点收到消息时的回调
+type Handler func(msg Message)
+
+// NetStats 网络层统计
+type NetStats struct {
+	Sent       int
+	Delivered  int
+	Dropped    int
+	Duplicated int
+	Reordered  int
+	Bytes      int64
+}
+
+type linkKey struct{ from, to int }
+
+type envelope struct {
+	msg Message
+	at  time.Duration
+	seq uint64
+}
+
+type envelopeHeap []envelope
+
+func (h envelopeHeap) Len() int { return len(h) }
+func (h envelopeHeap) Less(i, j int) bool {
+	if h[i].at == h[j].at {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at < h[j].at
+}
+func (h envelopeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *envelopeHeap) Push(x interface{}) { *h = append(*h, x.(envelope)) }
+func (h *envelopeHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Network 内存传输层（单线程离散事件驱动：Send 只入队，Run 按投递时刻顺序回调 Handler）
+type Network struct {
+	mu sync.Mutex
+
+	cfg       NetworkConfig
+	overrides map[linkKey]LinkConfig
+	rng       *rand.Rand
+
+	clock    *VirtualClock // 仿真时间来源（可与节点、模拟器共享）
+	seq      uint64
+	queue    envelopeHeap
+	handlers map[int]Handler
+	busy     map[linkKey]time.Duration // 每条链路的发送占用截止时刻（带宽串行化）
+	distance DistanceModel             // 可选：按拓扑距离附加链路时延
+
+	stats NetStats
+}
+
+// NewNetwork 创建网络；seed 固定时丢包/抖动等随机行为可复现
+func NewNetwork(cfg NetworkConfig, seed int64) *Network {
+	return NewNetworkWithClock(cfg, seed, NewVirtualClock())
+}
+
+// 【高亮-2026-10-16】新增：NewNetworkWithClock 与调用方共享虚拟时钟，
+// 多轮仿真复用同一时钟时，各轮网络的投递时刻在同一条时间轴上连续推进
+func NewNetworkWithClock(cfg NetworkConfig, seed int64, clock *VirtualClock) *Network {
+	if clock == nil {
+		clock = NewVirtualClock()
+	}
+	nw := &Network{
+		cfg:       cfg,
+		clock:     clock,
+		overrides: make(map[linkKey]LinkConfig, len(cfg.Overrides)),
+		rng:       rand.New(rand.NewSource(seed)),
+		handlers:  make(map[int]Handler),
+		busy:      make(map[linkKey]time.Duration),
+	}
+	for _, o := range cfg.Overrides {
+		nw.overrides[linkKey{o.From, o.To}] = o.Link
+	}
+	return nw
+}
+
+// Register 注册节点的消息处理回调（重复注册会覆盖）
+func (nw *Network) Register(id int, h Handler) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.handlers[id] = h
+}
+
+// Unregister 节点下线：之后发往该节点的消息全部丢弃
+func (nw *Network) Unregister(id int) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	delete(nw.handlers, id)
+}
+
+// SetLinkConfig 运行期修改某条有向链路（例如模拟针对某节点的 DDoS/日蚀攻击）
+func (nw *Network) SetLinkConfig(from, to int, lc LinkConfig) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.overrides[linkKey{from, to}] = lc
+}
+
+// Now 当前仿真时间（自虚拟时钟起点经过的时长）
+func (nw *Network) Now() time.Duration {
+	return nw.clock.Elapsed()
+}
+
+// SetDistanceModel 设置拓扑距离模型：每条链路的基础时延再加上 距离 * LatencyPerKmMs（nil 关闭）
+func (nw *Network) SetDistanceModel(d DistanceModel) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.distance = d
+}
+
+// Clock 网络使用的虚拟时钟
+func (nw *Network) Clock() *VirtualClock {
+	return nw.clock
+}
+
+// Stats 返回统计快照
+func (nw *Network) Stats() NetStats {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return nw.stats
+}
+
+// Pending 尚未投递的消息数
+func (nw *Network) Pending() int {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return len(nw.queue)
+}
+
+func (nw *Network) linkFor(from, to int) LinkConfig {
+	if lc, ok := nw.overrides[linkKey{from, to}]; ok {
+		return lc
+	}
+	return nw.cfg.Default
+}
+
+// Send 发送一条点对点消息（按链路特性决定丢弃/重复/乱序及投递时刻）
+func (nw *Network) Send(msg Message) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.sendLocked(msg, 0)
+}
+
+// SendAfter 节点本地处理 delay（如签名耗时）后再发送
+func (nw *Network) SendAfter(msg Message, delay time.Duration) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.sendLocked(msg, delay)
+}
+
+// Broadcast 向 to 中每个节点各发一份 msg（msg.To 会被逐一改写）
+func (nw *Network) Broadcast(msg Message, to []int) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	for _, id := range to {
+		m := msg
+		m.To = id
+		nw.sendLocked(m, 0)
+	}
+}
+
+func (nw *Network) sendLocked(msg Message, delay time.Duration) {
+	if msg.Size <= 0 {
+		msg.Size = DefaultMessageSize
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	msg.SentAt = nw.clock.Elapsed() + delay
+	nw.stats.Sent++
+	nw.stats.Bytes += int64(msg.Size)
+
+	// 本地自投递：不经过物理链路
+	if msg.From == msg.To {
+		nw.enqueueLocked(msg, msg.SentAt)
+		return
+	}
+
+	lc := nw.linkFor(msg.From, msg.To)
+	if lc.LossProb > 0 && nw.rng.Float64() < lc.LossProb {
+		nw.stats.Dropped++
+		return
+	}
+
+	// 带宽：同一链路上的消息串行发送
+	key := linkKey{msg.From, msg.To}
+	start := msg.SentAt
+	if b := nw.busy[key]; b > start {
+		start = b
+	}
+	if lc.BandwidthKbps > 0 {
+		tx := time.Duration(float64(msg.Size*8) / (lc.BandwidthKbps * 1000) * float64(time.Second))
+		start += tx
+	}
+	nw.busy[key] = start
+
+	at := start + nw.latencyLocked(lc) + nw.distanceLatencyLocked(lc, msg.From, msg.To)
+	if lc.ReorderProb > 0 && nw.rng.Float64() < lc.ReorderProb {
+		// 额外延迟 1~3 倍基础时延，使其被同链路后发的消息超越
+		at += time.Duration((1 + 2*nw.rng.Float64()) * lc.LatencyMs * float64(time.Millisecond))
+		nw.stats.Reordered++
+	}
+	nw.enqueueLocked(msg, at)
+
+	if lc.DupProb > 0 && nw.rng.Float64() < lc.DupProb {
+		nw.enqueueLocked(msg, at+nw.latencyLocked(lc))
+		nw.stats.Duplicated++
+	}
+}
+
+func (nw *Network) latencyLocked(lc LinkConfig) time.Duration {
+	ms := lc.LatencyMs
+	if lc.JitterMs > 0 {
+		ms += nw.rng.Float64() * lc.JitterMs
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// distanceLatencyLocked 按拓扑距离附加的时延
+func (nw *Network) distanceLatencyLocked(lc LinkConfig, from, to int) time.Duration {
+	if nw.distance == nil || lc.LatencyPerKmMs <= 0 {
+		return 0
+	}
+	return time.Duration(nw.distance.Distance(from, to) * lc.LatencyPerKmMs * float64(time.Millisecond))
+}
+
+func (nw *Network) enqueueLocked(msg Message, at time.Duration) {
+	msg.DeliverAt = at
+	nw.seq++
+	heap.Push(&nw.queue, envelope{msg: msg, at: at, seq: nw.seq})
+}
+
+// Run 按投递时刻顺序投递消息，直到队列为空（网络静默）或下一条消息晚于 deadline；
+// Handler 内可以继续 Send（会被同一次 Run 处理）。返回本次投递条数。
+// deadline<0 表示不设截止时刻。
+func (nw *Network) Run(deadline time.Duration) int {
+	delivered := 0
+	for {
+		nw.mu.Lock()
+		if len(nw.queue) == 0 {
+			// 网络已静默：时间停在最后一次投递时刻，不空转到 deadline
+			nw.mu.Unlock()
+			return delivered
+		}
+		if deadline >= 0 && nw.queue[0].at > deadline {
+			// 超时：时间推进到 deadline，剩余消息留待下次 Run
+			nw.clock.AdvanceTo(deadline)
+			nw.mu.Unlock()
+			return delivered
+		}
+		env := heap.Pop(&nw.queue).(envelope)
+		nw.clock.AdvanceTo(env.at)
+		h, ok := nw.handlers[env.msg.To]
+		if !ok {
+			nw.stats.Dropped++
+			nw.mu.Unlock()
+			continue
+		}
+		nw.stats.Delivered++
+		nw.mu.Unlock()
+
+		h(env.msg)
+		delivered++
+	}
+}
+
+// RunFor 从当前时刻起最多再运行 d 的仿真时间
+func (nw *Network) RunFor(d time.Duration) int {
+	return nw.Run(nw.Now() + d)
+}
+
+func (s NetStats) String() string {
+	return fmt.Sprintf("sent=%d delivered=%d dropped=%d dup=%d reorder=%d bytes=%d",
+		s.Sent, s.Delivered, s.Dropped, s.Duplicated, s.Reordered, s.Bytes)
+}
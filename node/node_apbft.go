@@ -54,21 +54,24 @@ const (
 // 2) 增加 SetRoundSeed：由外部（节点池/模拟器）在每轮开始时注入 round seed
 type Node struct {
 	ID          int
-	m           int
 	IsMalicious bool
 	Throughput  float64
 	Tier        Tier
 	bls BLS
 	mu     sync.Mutex
-	active bool
 	// ======================= 【高亮-2026-03-08】新增字段 =======================
 	cfg BehaviorConfig
 	rng *rand.Rand
-}
-
-// 让没有 blst tag 的环境下也可调用 apbft.NewBlstBLS
-func NewBlstBLS(id int) BLS {
-	return NewSimpleBLSStub(id)
+	// ======================= 【高亮-2026-10-16】新增：可插拔拜占庭行为策略 + 当前轮次 =======================
+	behavior Behavior
+	round    int
+	// ======================= 【高亮-2026-10-16】新增：可插拔信誉模型（取代原 m/active 字段） =======================
+	repModel ReputationModel
+	rep      ReputationState
+	// ======================= 【高亮-2026-10-16】新增：时间来源（默认真实时钟；仿真时注入 VirtualClock） =======================
+	clock Clock
+	// ======================= 【高亮-2026-10-16】新增：是否在线（节点流失模型中宕机的节点不收发消息） =======================
+	offline bool
 }
 
 // NewProgressNode 创建并返回一个新的 Node（改进版构造器）
@@ -89,16 +92,27 @@ func NewProgressNode(id int, throughput float64, isMalicious bool, useBlst bool,
 
 	return &Node{
 		ID:          id,
-		m:           InitialM,
 		IsMalicious: isMalicious,
 		Throughput:  throughput,
 		Tier:        TierNormal,
 		bls:         blsImpl,
-		active:      true,
 
 		cfg: cfg,
 		rng: rng,
+
+		behavior: defaultBehavior(isMalicious, cfg),
+		repModel: LinearModel{},
+		rep:      LinearModel{}.Init(),
+		clock:    RealClock{},
+	}
+}
+
+// defaultBehavior 未显式配置时：恶意节点按 cfg 的概率作恶，诚实节点始终诚实
+func defaultBehavior(isMalicious bool, cfg BehaviorConfig) Behavior {
+	if isMalicious {
+		return cfg.Behavior()
 	}
+	return HonestBehavior{}
 }
 
 // NewNode：保持你原来的 API 不变（兼容 pbft1.go / pbft1main.go 等现有调用）
@@ -116,6 +130,49 @@ func (n *Node) SetRoundSeed(round int) {
 
 	seed := int64(20260308 + round*1000 + n.ID)
 	n.rng = rand.New(rand.NewSource(seed))
+	n.round = round
+}
+
+// ======================= 【高亮-2026-10-16】新增：行为策略访问器 =======================
+// SetBehavior 替换节点的拜占庭行为策略（nil 恢复为按 IsMalicious 的默认策略）
+func (n *Node) SetBehavior(b Behavior) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if b == nil {
+		b = defaultBehavior(n.IsMalicious, n.cfg)
+	}
+	n.behavior = b
+}
+
+// Behavior 返回节点当前的行为策略
+func (n *Node) Behavior() Behavior {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.behavior
+}
+
+// Decide 询问行为策略在 step 上的动作（Step.Self 由节点填写）
+func (n *Node) Decide(step Step) Action {
+	n.mu.Lock()
+	b := n.behavior
+	n.mu.Unlock()
+	step.Self = n.ID
+	return b.Decide(step)
+}
+
+// ApplyBehaviors 把节点池中显式配置的行为（NodeSpec.Behavior）装到对应节点上；
+// 未配置的节点保留构造时的默认策略。同名 coalition 的成员共享同一个联盟对象。
+func ApplyBehaviors(nodes []*Node, specs []NodeSpec) {
+	built := BuildBehaviors(specs, nil)
+	configured := make(map[int]bool, len(specs))
+	for _, sp := range specs {
+		configured[sp.ID] = sp.Behavior != nil
+	}
+	for _, nd := range nodes {
+		if configured[nd.ID] {
+			nd.SetBehavior(built[nd.ID])
+		}
+	}
 }
 
 // RandFloat：统一随机入口（有 rng 用 rng，无 rng 用全局 rand）
@@ -144,7 +201,7 @@ func (n *Node) String() string {
 	defer n.mu.Unlock()
 	return fmt.Sprintf(
 		"Node-%02d(m=%d, tier=%v, tp=%.2f, mal=%v, active=%v)",
-		n.ID, n.m, n.Tier, n.Throughput, n.IsMalicious, n.active,
+		n.ID, n.rep.M, n.Tier, n.Throughput, n.IsMalicious, n.rep.Active,
 	)
 }
 
@@ -153,7 +210,7 @@ func (n *Node) String() string {
 func (n *Node) M() int {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	return n.m
+	return n.rep.M
 }
 
 // PublicKey 导出节点公钥（apbft 需要收集 pubKeys；原 n.bls 未导出）
@@ -164,6 +221,23 @@ func (n *Node) PublicKey() []byte {
 	return bls.PublicKey()
 }
 
+// ProofOfPossession 节点公钥的持有证明（登记公钥时使用）
+// 【高亮-2026-10-16】新增
+func (n *Node) ProofOfPossession() ([]byte, error) {
+	n.mu.Lock()
+	bls := n.bls
+	n.mu.Unlock()
+	return bls.ProvePossession()
+}
+
+// SetBLS 替换节点的签名密钥（例如从密钥库加载的持久身份）；之后需重新登记公钥
+// 【高亮-2026-10-16】新增
+func (n *Node) SetBLS(b BLS) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.bls = b
+}
+
 // AggregateSignatures 导出签名聚合能力（封装 n.bls）
 func (n *Node) AggregateSignatures(sigs [][]byte) ([]byte, error) {
 	n.mu.Lock()
@@ -182,92 +256,139 @@ func (n *Node) VerifyAggregate(pubKeys [][]byte, message []byte, aggSig []byte)
 
 // Sign 对给定消息进行签名
 // 【高亮-2026-03-08】改进：恶意行为概率由 cfg 控制；随机源优先使用 n.rng（可复现）
+// 【高亮-2026-10-16】修改：改为 SignStep 的阻塞包装（PREPARE 步骤、不区分对端），按节点时钟等待签名耗时
+// （VirtualClock 下不真实等待，只推进虚拟时间）
 func (n *Node) Sign(message []byte) ([]byte, error) {
-	// 读取必要字段（减少锁粒度）
+	n.mu.Lock()
+	round := n.round
+	clock := n.clock
+	n.mu.Unlock()
+
+	sig, delay, err := n.SignStep(Step{Phase: PhasePrepare, Round: round, Leader: -1, Peer: -1, Digest: fmt.Sprintf("%x", message), Prominent: -1}, message)
+	clock.Sleep(delay)
+	return sig, err
+}
+
+// SetClock 注入时间来源（nil 恢复为真实时钟）
+func (n *Node) SetClock(c Clock) {
+	if c == nil {
+		c = RealClock{}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.clock = c
+}
+
+// Clock 节点当前使用的时间来源
+func (n *Node) Clock() Clock {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.clock
+}
+
+// ======================= 【高亮-2026-10-16】新增：按行为策略在某个协议步骤上签名（不阻塞） =======================
+// SignStep 返回签名以及签名/发送前应等待的仿真时长，由调用方交给网络层（Network.SendAfter）：
+// - 沉默/反对：不签名，返回 error
+// - 伪造签名：返回 bad-sign
+// - equivocation：对 Action.Digest（冲突摘要）签名
+// - 诚实：正常节点的耗时与吞吐量相关（不超过 MaxNormalDelayMs），再叠加策略要求的额外延迟
+func (n *Node) SignStep(step Step, message []byte) ([]byte, time.Duration, error) {
 	n.mu.Lock()
 	isMal := n.IsMalicious
 	tp := n.Throughput
 	cfg := n.cfg
-	rng := n.rng
+	b := n.behavior
+	bls := n.bls
 	n.mu.Unlock()
 
-	// helper：取随机
-	randFloat := func() float64 {
-		if rng != nil {
-			return rng.Float64()
-		}
-		return rand.Float64()
+	step.Self = n.ID
+	act := b.Decide(step)
+	switch act.Kind {
+	case ActSilent, ActReject:
+		return nil, act.Delay, fmt.Errorf("malicious: not signing")
+	case ActBadSign:
+		return []byte(fmt.Sprintf("bad-sign-node-%02d", n.ID)), act.Delay, nil
+	case ActEquivocate:
+		sig, err := bls.Sign([]byte(act.Digest))
+		return sig, act.Delay, err
 	}
-	randIntn := func(k int) int {
-		if rng != nil {
-			return rng.Intn(k)
+
+	delay := act.Delay
+	if !isMal && tp > 0 {
+		// 正常节点：延迟与吞吐量相关
+		d := time.Duration(1000.0/tp) * time.Millisecond
+		if maxDelay := time.Duration(cfg.MaxNormalDelayMs) * time.Millisecond; d > maxDelay {
+			d = maxDelay
 		}
-		return rand.Intn(k)
+		delay += d
 	}
+	sig, err := bls.Sign(message)
+	return sig, delay, err
+}
 
-	if isMal {
-		// 归一化三种概率（允许用户不严格设置）
-		a := cfg.MalProbNotSign
-		b := cfg.MalProbBadSign
-		c := cfg.MalProbGoodSign
-		sum := a + b + c
-		if sum <= 0 {
-			// fallback：等价原实现
-			choice := randIntn(3)
-			switch choice {
-			case 0:
-				time.Sleep(50 * time.Millisecond)
-				return nil, fmt.Errorf("malicious: not signing")
-			case 1:
-				return []byte(fmt.Sprintf("bad-sign-node-%02d", n.ID)), nil
-			default:
-				return n.bls.Sign(message)
-			}
-		}
+// UpdateReward 结算一次不区分协议步骤的结果
+// 【高亮-2026-10-16】修改：规则由节点的 ReputationModel 决定（默认 LinearModel 与原 ±1 规则一致）
+func (n *Node) UpdateReward(success bool) {
+	n.mu.Lock()
+	round := n.round
+	n.mu.Unlock()
+	n.RecordOutcome(ReputationEvent{Success: success, Phase: PhaseAny, Round: round})
+}
 
-		p := randFloat() * sum
-		switch {
-		case p < a:
-			time.Sleep(time.Duration(cfg.MalNotSignDelayMs) * time.Millisecond)
-			return nil, fmt.Errorf("malicious: not signing")
-		case p < a+b:
-			return []byte(fmt.Sprintf("bad-sign-node-%02d", n.ID)), nil
-		default:
-			return n.bls.Sign(message)
-		}
-	}
+// RecordOutcome 结算一次带协议步骤的结果（供按步骤加权的模型使用）
+func (n *Node) RecordOutcome(ev ReputationEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rep = n.repModel.Update(n.rep, ev)
+}
 
-	// 正常节点：延迟与吞吐量相关
-	delay := time.Duration(1000.0/tp) * time.Millisecond
-	maxDelay := time.Duration(cfg.MaxNormalDelayMs) * time.Millisecond
-	if delay > maxDelay {
-		delay = maxDelay
-	}
-	time.Sleep(delay)
+// BeginRound 每轮开始时调用：记录轮次并让信誉模型处理随时间变化的规则（如观察期复权）
+func (n *Node) BeginRound(round int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.round = round
+	n.rep = n.repModel.Tick(n.rep, round)
+}
 
-	return n.bls.Sign(message)
+// SetReputationModel 更换信誉模型并按新模型重新初始化信誉状态
+func (n *Node) SetReputationModel(m ReputationModel) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.repModel = m
+	n.rep = m.Init()
 }
 
-func (n *Node) UpdateReward(success bool) {
+// Reputation 返回当前信誉状态快照
+func (n *Node) Reputation() ReputationState {
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	return n.rep
+}
 
-	if success {
-		n.m++
-		if n.m >= MMax {
-			n.m = MMax - 1
-			n.active = true
-		}
-	} else {
-		n.m--
-		if n.m < MMin {
-			n.active = false
-		}
-	}
+// SetReputation 恢复信誉状态（例如从集群快照恢复），信誉模型不变
+// 【高亮-2026-10-16】新增
+func (n *Node) SetReputation(st ReputationState) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rep = st
 }
 
 func (n *Node) IsActive() bool {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	return n.active
-}
\ No newline at end of file
+	return n.rep.Active
+}
+
+// SetOnline 标记节点在线/宕机（对应 NodeSpec.Active，与信誉意义上的 IsActive 相互独立）
+func (n *Node) SetOnline(online bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.offline = !online
+}
+
+// Online 节点当前是否在线
+func (n *Node) Online() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return !n.offline
+}
@@ -1,10 +1,7 @@
 package node
 
-import (
-	"math/rand"
-)
-
 // ======================= 【高亮-2026-03-08】强制固定：全局共用节点数/恶意率（四算法统一） =======================
+// 【高亮-2026-10-16】修改：不再强制覆盖，仅作为 DefaultPoolConfig 的默认值
 const FixedNumNodes = 100
 const FixedMaliciousRatio = 0.20
 
@@ -17,6 +14,7 @@ type NodeSpec struct {
 	Throughput  float64 // PBFT/自定义撮合 可用（模拟延迟/处理能力）
 	Stake       float64 // POS 可用
 	Active      bool
+	Behavior    *BehaviorSpec // 【高亮-2026-10-16】新增：该节点的拜占庭行为策略；nil 表示由引擎按 IsMalicious 取默认
 }
 
 // ======================= 【高亮-2026-03-08】新增：每轮 round 固定恶意节点集合的节点池构造 =======================
@@ -25,43 +23,10 @@ type NodeSpec struct {
 // - numNodes：节点数
 // - maliciousRatio：恶意比例（0~1）
 // 返回：NodeSpec 切片（长度 numNodes）
+// 【高亮-2026-10-16】修改：如实采用 numNodes/maliciousRatio 参数，其余属性取 DefaultPoolConfig；需要更多控制时用 NewPoolFromConfig
 func NewPool(round int, numNodes int, maliciousRatio float64) []NodeSpec {
-	//=============参量转变量================
-	numNodes = FixedNumNodes
-    maliciousRatio = FixedMaliciousRatio
-	if numNodes <= 0 {
-		return []NodeSpec{}
-	}
-
-	// 用 round 固定随机种子：保证同一轮恶意��点集合稳定
-	seed := int64(20260308 + round)
-	rng := rand.New(rand.NewSource(seed))
-
-	mCount := int(float64(numNodes) * maliciousRatio)
-	if mCount < 0 {
-		mCount = 0
-	}
-	if mCount > numNodes {
-		mCount = numNodes
-	}
-
-	malSet := make(map[int]bool, mCount)
-	if mCount > 0 {
-		idxs := rng.Perm(numNodes)[:mCount]
-		for _, idx := range idxs {
-			malSet[idx] = true
-		}
-	}
-
-	out := make([]NodeSpec, 0, numNodes)
-	for i := 0; i < numNodes; i++ {
-		out = append(out, NodeSpec{
-			ID:          i,
-			IsMalicious: malSet[i],
-			Throughput:  50.0 + rng.Float64()*150.0, // 50~200
-			Stake:       10.0 + rng.Float64()*90.0,  // 10~100
-			Active:      true,
-		})
-	}
-	return out
-}
\ No newline at end of file
+	cfg := DefaultPoolConfig()
+	cfg.NumNodes = numNodes
+	cfg.MaliciousRatio = maliciousRatio
+	return NewPoolFromConfig(round, cfg)
+}
@@ -0,0 +1,273 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ======================= 【高亮-2026-10-16】新增：声明式节点池配置 PoolConfig（可从 JSON/YAML 场景文件加载） =======================
+// 目的：不再强制 FixedNumNodes/FixedMaliciousRatio，便于扫描网络规模与敌手比例；
+// 吞吐量/权益分布与恶意节点放置策略也可以按场景配置。
+
+// 分布类型
+const (
+	DistUniform   = "uniform"   // [Min, Max) 均匀分布
+	DistNormal    = "normal"    // N(Mean, StdDev)，截断到 [Min, Max]
+	DistLogNormal = "lognormal" // exp(N(Mean, StdDev))，截断到 [Min, Max]
+	DistPareto    = "pareto"    // Min * U^(-1/Alpha)，截断到 Max（重尾：少数节点掌握大部分权益）
+	DistFixed     = "fixed"     // 恒为 Mean
+)
+
+// Distribution 节点属性（吞吐量/权益）的取值分布
+type Distribution struct {
+	Kind   string  `json:"kind" yaml:"kind"`
+	Min    float64 `json:"min,omitempty" yaml:"min,omitempty"`
+	Max    float64 `json:"max,omitempty" yaml:"max,omitempty"`
+	Mean   float64 `json:"mean,omitempty" yaml:"mean,omitempty"`
+	StdDev float64 `json:"stdDev,omitempty" yaml:"stdDev,omitempty"`
+	Alpha  float64 `json:"alpha,omitempty" yaml:"alpha,omitempty"`
+}
+
+// Sample 按分布抽取一个值
+func (d Distribution) Sample(rng *rand.Rand) float64 {
+	var v float64
+	switch d.Kind {
+	case DistFixed:
+		return d.Mean
+	case DistNormal:
+		v = d.Mean + rng.NormFloat64()*d.StdDev
+	case DistLogNormal:
+		v = math.Exp(d.Mean + rng.NormFloat64()*d.StdDev)
+	case DistPareto:
+		alpha := d.Alpha
+		if alpha <= 0 {
+			alpha = 1.16 // 80/20 法则
+		}
+		v = d.Min * math.Pow(1-rng.Float64(), -1/alpha)
+	default: // DistUniform 及未填写
+		return d.Min + rng.Float64()*(d.Max-d.Min)
+	}
+	if d.Max > d.Min {
+		v = math.Min(math.Max(v, d.Min), d.Max)
+	}
+	return v
+}
+
+func (d Distribution) validate(name string) error {
+	switch d.Kind {
+	case "", DistUniform:
+		if d.Max < d.Min {
+			return fmt.Errorf("%s: uniform max %.2f < min %.2f", name, d.Max, d.Min)
+		}
+	case DistNormal, DistLogNormal:
+		if d.StdDev < 0 {
+			return fmt.Errorf("%s: negative stdDev", name)
+		}
+	case DistPareto:
+		if d.Min <= 0 {
+			return fmt.Errorf("%s: pareto needs min > 0", name)
+		}
+	case DistFixed:
+	default:
+		return fmt.Errorf("%s: unknown distribution kind %q", name, d.Kind)
+	}
+	return nil
+}
+
+// 恶意节点放置策略
+const (
+	PlaceRandom       = "random"        // 随机挑选
+	PlaceHighestStake = "highest-stake" // 权益最高的节点作恶（富节点被攻陷）
+	PlaceClustered    = "clustered"     // 相邻编号的一段节点作恶（同一馈线/台区被攻陷）
+)
+
+// PoolConfig 节点池的声明式配置
+type PoolConfig struct {
+	NumNodes       int          `json:"numNodes" yaml:"numNodes"`
+	MaliciousRatio float64      `json:"maliciousRatio" yaml:"maliciousRatio"`
+	Throughput     Distribution `json:"throughput" yaml:"throughput"`
+	Stake          Distribution `json:"stake" yaml:"stake"`
+	Placement      string       `json:"placement" yaml:"placement"`
+	// Seed 基础随机种子，第 round 轮使用 Seed+round（保证同一轮恶意集合可复现）
+	Seed int64 `json:"seed,omitempty" yaml:"seed,omitempty"`
+
+	// 【高亮-2026-10-16】新增：拜占庭行为策略
+	// MaliciousBehavior 应用于所有被放置为恶意的节点；为空时各引擎使用自己的默认恶意模型
+	MaliciousBehavior *BehaviorSpec `json:"maliciousBehavior,omitempty" yaml:"maliciousBehavior,omitempty"`
+	// NodeBehaviors 按节点 ID 单独指定行为（优先级最高；非 honest 行为的节点会被标记为恶意）
+	NodeBehaviors []NodeBehavior `json:"nodeBehaviors,omitempty" yaml:"nodeBehaviors,omitempty"`
+
+	// 【高亮-2026-10-16】新增：电网拓扑文件（JSON/YAML/CSV，见 topology.Load）；为空时使用按节点数生成的合成拓扑
+	Topology string `json:"topology,omitempty" yaml:"topology,omitempty"`
+
+	// 【高亮-2026-10-16】新增：节点流失（宕机 / 恢复 / 加入 / 离开），见 NewChurn；为空时节点全程在线
+	Churn *ChurnConfig `json:"churn,omitempty" yaml:"churn,omitempty"`
+}
+
+// DefaultPoolConfig 与原 NewPool 行为一致：100 节点、20% 随机恶意、吞吐 50~200、权益 10~100
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		NumNodes:       FixedNumNodes,
+		MaliciousRatio: FixedMaliciousRatio,
+		Throughput:     Distribution{Kind: DistUniform, Min: 50, Max: 200},
+		Stake:          Distribution{Kind: DistUniform, Min: 10, Max: 100},
+		Placement:      PlaceRandom,
+		Seed:           20260308,
+	}
+}
+
+// Validate 检查配置合法性
+func (c PoolConfig) Validate() error {
+	if c.NumNodes <= 0 {
+		return fmt.Errorf("pool: numNodes must be positive, got %d", c.NumNodes)
+	}
+	if c.MaliciousRatio < 0 || c.MaliciousRatio > 1 {
+		return fmt.Errorf("pool: maliciousRatio must be in [0,1], got %.3f", c.MaliciousRatio)
+	}
+	switch c.Placement {
+	case "", PlaceRandom, PlaceHighestStake, PlaceClustered:
+	default:
+		return fmt.Errorf("pool: unknown placement %q", c.Placement)
+	}
+	if err := c.Throughput.validate("throughput"); err != nil {
+		return fmt.Errorf("pool: %w", err)
+	}
+	if err := c.Stake.validate("stake"); err != nil {
+		return fmt.Errorf("pool: %w", err)
+	}
+	if c.MaliciousBehavior != nil {
+		if err := c.MaliciousBehavior.Validate(); err != nil {
+			return fmt.Errorf("pool: maliciousBehavior: %w", err)
+		}
+	}
+	for _, nb := range c.NodeBehaviors {
+		if nb.ID < 0 || nb.ID >= c.NumNodes {
+			return fmt.Errorf("pool: nodeBehaviors: node %d out of range", nb.ID)
+		}
+		if err := nb.Behavior.Validate(); err != nil {
+			return fmt.Errorf("pool: nodeBehaviors[%d]: %w", nb.ID, err)
+		}
+	}
+	if c.Churn != nil {
+		if err := c.Churn.Validate(); err != nil {
+			return fmt.Errorf("pool: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadPoolConfig 从场景文件加载节点池配置（.yaml/.yml 按 YAML 解析，其余按 JSON 解析）；
+// 文件中未出现的字段保持 DefaultPoolConfig 的取值。
+func LoadPoolConfig(path string) (PoolConfig, error) {
+	cfg := DefaultPoolConfig()
+	if err := LoadScenarioFile(path, &cfg); err != nil {
+		return cfg, fmt.Errorf("pool: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// LoadScenarioFile 把场景文件解码到 v（同一个场景文件可以同时携带节点池与各引擎的配置段）
+func LoadScenarioFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read scenario: %w", err)
+	}
+	if err := decodeScenario(path, data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// decodeScenario 按扩展名选择 JSON/YAML 解码
+func decodeScenario(path string, data []byte, v interface{}) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, v)
+	default:
+		return json.Unmarshal(data, v)
+	}
+}
+
+// NewPoolFromConfig 按配置生成第 round 轮的节点池
+func NewPoolFromConfig(round int, cfg PoolConfig) []NodeSpec {
+	numNodes := cfg.NumNodes
+	if numNodes <= 0 {
+		return []NodeSpec{}
+	}
+
+	// 用 round 固定随机种子：保证同一轮恶意节点集合稳定
+	rng := rand.New(rand.NewSource(cfg.Seed + int64(round)))
+
+	mCount := int(float64(numNodes) * cfg.MaliciousRatio)
+	if mCount < 0 {
+		mCount = 0
+	}
+	if mCount > numNodes {
+		mCount = numNodes
+	}
+
+	// 随机放置的排列先于属性抽取，保证默认配置下与原 NewPool 的随机序列完全一致
+	perm := rng.Perm(numNodes)
+
+	out := make([]NodeSpec, 0, numNodes)
+	for i := 0; i < numNodes; i++ {
+		out = append(out, NodeSpec{
+			ID:         i,
+			Throughput: cfg.Throughput.Sample(rng),
+			Stake:      cfg.Stake.Sample(rng),
+			Active:     true,
+		})
+	}
+
+	for _, idx := range placeMalicious(cfg.Placement, out, mCount, perm, rng) {
+		out[idx].IsMalicious = true
+		out[idx].Behavior = cfg.MaliciousBehavior
+	}
+	for _, nb := range cfg.NodeBehaviors {
+		if nb.ID < 0 || nb.ID >= numNodes {
+			continue
+		}
+		b := nb.Behavior
+		out[nb.ID].Behavior = &b
+		out[nb.ID].IsMalicious = !b.IsHonest()
+	}
+	return out
+}
+
+// placeMalicious 按放置策略返回恶意节点下标
+func placeMalicious(strategy string, specs []NodeSpec, mCount int, perm []int, rng *rand.Rand) []int {
+	if mCount <= 0 {
+		return nil
+	}
+	switch strategy {
+	case PlaceHighestStake:
+		idxs := make([]int, len(specs))
+		for i := range idxs {
+			idxs[i] = i
+		}
+		sort.SliceStable(idxs, func(a, b int) bool {
+			return specs[idxs[a]].Stake > specs[idxs[b]].Stake
+		})
+		return idxs[:mCount]
+	case PlaceClustered:
+		start := rng.Intn(len(specs))
+		idxs := make([]int, 0, mCount)
+		for k := 0; k < mCount; k++ {
+			idxs = append(idxs, (start+k)%len(specs))
+		}
+		return idxs
+	default:
+		return perm[:mCount]
+	}
+}
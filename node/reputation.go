@@ -0,0 +1,295 @@
+package node
+
+import (
+	"fmt"
+	"math"
+)
+
+// ======================= 【高亮-2026-10-16】新增：可插拔信誉模型 ReputationModel =======================
+// 目的：取代 UpdateReward 里固定的 ±1 规则（且 m 到达 MMax 时被钳在 MMax-1，与 README 中
+// "m > mmax 时重置到 m0"的设计不一致）。模型只负责"状态 + 事件 -> 新状态"，由 Node 持有状态。
+
+// ReputationState 节点的信誉状态
+type ReputationState struct {
+	M          int     // 信誉值 m（leader 排序、MMin 判定使用）
+	Score      float64 // 连续信誉分：衰减模型使用，其余模型恒等于 M
+	Active     bool    // 是否参与共识
+	Probation  int     // 剩余观察期（还需多少次成功才能转正）；0 表示不在观察期
+	ExcludedAt int     // 被排除时的轮次；-1 表示未被排除
+	Exclusions int     // 累计被排除次数
+}
+
+// ReputationEvent 一次需要结算信誉的结果
+type ReputationEvent struct {
+	Success bool
+	Phase   Phase // 发生在哪个协议步骤；PhaseAny 表示不区分
+	Round   int
+}
+
+// ReputationModel 信誉模型
+type ReputationModel interface {
+	Name() string
+	// Init 新节点的初始状态
+	Init() ReputationState
+	// Update 结算一次结果
+	Update(st ReputationState, ev ReputationEvent) ReputationState
+	// Tick 每轮开始时调用（即使节点本轮没有任何结果），用于随时间变化的规则（如观察期复权）
+	Tick(st ReputationState, round int) ReputationState
+}
+
+func initialState(m int) ReputationState {
+	return ReputationState{M: m, Score: float64(m), Active: true, ExcludedAt: -1}
+}
+
+// ---------------------------------------------------------------------------
+// LinearModel 原 UpdateReward 规则：成功 +1（到 MMax 时钳在 MMax-1），失败 -1，低于 MMin 排除
+
+type LinearModel struct{}
+
+func (LinearModel) Name() string                                       { return "linear" }
+func (LinearModel) Init() ReputationState                              { return initialState(InitialM) }
+func (LinearModel) Tick(st ReputationState, round int) ReputationState { return st }
+
+func (LinearModel) Update(st ReputationState, ev ReputationEvent) ReputationState {
+	if ev.Success {
+		st.M++
+		if st.M >= MMax {
+			st.M = MMax - 1
+			st.Active = true
+		}
+	} else {
+		st.M--
+		if st.M < MMin {
+			st.Active = false
+		}
+	}
+	st.Score = float64(st.M)
+	return st
+}
+
+// ---------------------------------------------------------------------------
+// ResetModel README 中的防中心化规则：m 超过 MMax 时重置为 M0，避免单节点长期垄断 leader
+
+type ResetModel struct {
+	M0 int
+}
+
+func (ResetModel) Name() string                                       { return "reset" }
+func (m ResetModel) Init() ReputationState                            { return initialState(m.M0) }
+func (ResetModel) Tick(st ReputationState, round int) ReputationState { return st }
+
+func (m ResetModel) Update(st ReputationState, ev ReputationEvent) ReputationState {
+	if ev.Success {
+		st.M++
+		if st.M > MMax {
+			st.M = m.M0
+		}
+	} else {
+		st.M--
+		if st.M < MMin {
+			st.Active = false
+		}
+	}
+	st.Score = float64(st.M)
+	return st
+}
+
+// ---------------------------------------------------------------------------
+// DecayModel 指数衰减（近期加权）：Score <- Lambda*Score + (1-Lambda)*目标，
+// 成功的目标为 High，失败的目标为 Low；越久远的结果权重按 Lambda^k 衰减。
+
+type DecayModel struct {
+	Lambda float64 // 历史权重 (0,1)，越小越看重最近的结果
+	High   float64 // 成功目标
+	Low    float64 // 失败目标（低于 MMin，持续失败才会被排除）
+}
+
+func (DecayModel) Name() string                                       { return "decay" }
+func (DecayModel) Init() ReputationState                              { return initialState(InitialM) }
+func (DecayModel) Tick(st ReputationState, round int) ReputationState { return st }
+
+func (m DecayModel) Update(st ReputationState, ev ReputationEvent) ReputationState {
+	target := m.Low
+	if ev.Success {
+		target = m.High
+	}
+	st.Score = m.Lambda*st.Score + (1-m.Lambda)*target
+	st.M = int(math.Round(st.Score))
+	if st.Score < MMin {
+		st.Active = false
+	}
+	return st
+}
+
+// ---------------------------------------------------------------------------
+// ProbationModel 观察期与复权：被 Base 排除的节点冷却 Cooldown 轮后以 RehabM 复权进入观察期，
+// 观察期内需要连续 Rounds 次成功才转正，期间任何一次失败立即再次排除；
+// 每多被排除一次，冷却期翻倍（惯犯越来越难回来）。
+
+type ProbationModel struct {
+	Base     ReputationModel
+	Cooldown int
+	Rounds   int
+	RehabM   int
+}
+
+func (m ProbationModel) Name() string          { return "probation(" + m.Base.Name() + ")" }
+func (m ProbationModel) Init() ReputationState { return m.Base.Init() }
+
+func (m ProbationModel) Update(st ReputationState, ev ReputationEvent) ReputationState {
+	if !st.Active {
+		return st // 被排除期间不参与结算
+	}
+	next := m.Base.Update(st, ev)
+	if st.Probation > 0 {
+		if !ev.Success {
+			next.Active = false
+		} else {
+			next.Probation = st.Probation - 1
+		}
+	}
+	if !next.Active {
+		next.Probation = 0
+		next.ExcludedAt = ev.Round
+		next.Exclusions++
+	}
+	return next
+}
+
+func (m ProbationModel) Tick(st ReputationState, round int) ReputationState {
+	st = m.Base.Tick(st, round)
+	if st.Active || st.ExcludedAt < 0 {
+		return st
+	}
+	cooldown := m.Cooldown << uint(max(st.Exclusions-1, 0))
+	if round-st.ExcludedAt < cooldown {
+		return st
+	}
+	st.Active = true
+	st.M = m.RehabM
+	st.Score = float64(m.RehabM)
+	st.Probation = m.Rounds
+	st.ExcludedAt = -1
+	return st
+}
+
+// ---------------------------------------------------------------------------
+// PhaseWeightedModel 按协议步骤加权：失败在 Phase p 上按 Weights[p] 次结算（未列出的步骤记 1 次），
+// 例如 leader 不发 PRE-PREPARE 比副本错过一次 COMMIT 代价更高。成功始终记 1 次。
+
+type PhaseWeightedModel struct {
+	Base    ReputationModel
+	Weights map[Phase]int
+}
+
+func (m PhaseWeightedModel) Name() string          { return "phase-weighted(" + m.Base.Name() + ")" }
+func (m PhaseWeightedModel) Init() ReputationState { return m.Base.Init() }
+
+func (m PhaseWeightedModel) Update(st ReputationState, ev ReputationEvent) ReputationState {
+	w := 1
+	if !ev.Success {
+		if v, ok := m.Weights[ev.Phase]; ok && v > 0 {
+			w = v
+		}
+	}
+	for i := 0; i < w; i++ {
+		st = m.Base.Update(st, ev)
+	}
+	return st
+}
+
+func (m PhaseWeightedModel) Tick(st ReputationState, round int) ReputationState {
+	return m.Base.Tick(st, round)
+}
+
+// ======================= 【高亮-2026-10-16】新增：信誉模型的声明式配置 =======================
+
+// 信誉模型名称
+const (
+	ReputationLinear        = "linear"
+	ReputationReset         = "reset"
+	ReputationDecay         = "decay"
+	ReputationProbation     = "probation"
+	ReputationPhaseWeighted = "phase-weighted"
+)
+
+// ReputationConfig 信誉模型配置；probation / phase-weighted 包装 Base（默认 linear）
+type ReputationConfig struct {
+	Kind string `json:"kind" yaml:"kind"`
+
+	M0              int               `json:"m0,omitempty" yaml:"m0,omitempty"`                           // reset：重置值，默认 InitialM
+	Lambda          float64           `json:"lambda,omitempty" yaml:"lambda,omitempty"`                   // decay：历史权重，默认 0.8
+	CooldownRounds  int               `json:"cooldownRounds,omitempty" yaml:"cooldownRounds,omitempty"`   // probation：冷却轮数，默认 10
+	ProbationRounds int               `json:"probationRounds,omitempty" yaml:"probationRounds,omitempty"` // probation：观察期成功次数，默认 5
+	RehabM          int               `json:"rehabM,omitempty" yaml:"rehabM,omitempty"`                   // probation：复权后的 m，默认 MMin+1
+	PhaseWeights    map[Phase]int     `json:"phaseWeights,omitempty" yaml:"phaseWeights,omitempty"`       // phase-weighted：各步骤失败权重
+	Base            *ReputationConfig `json:"base,omitempty" yaml:"base,omitempty"`
+}
+
+// DefaultReputationConfig 与原 UpdateReward 行为一致
+func DefaultReputationConfig() ReputationConfig {
+	return ReputationConfig{Kind: ReputationLinear}
+}
+
+// DefaultPhaseWeights PRE-PREPARE 失败记 3 次，PREPARE 记 2 次，COMMIT 记 1 次
+func DefaultPhaseWeights() map[Phase]int {
+	return map[Phase]int{PhasePrePrepare: 3, PhasePrepare: 2, PhaseCommit: 1}
+}
+
+// Build 按配置构造信誉模型
+func (c ReputationConfig) Build() (ReputationModel, error) {
+	switch c.Kind {
+	case "", ReputationLinear:
+		return LinearModel{}, nil
+	case ReputationReset:
+		m0 := c.M0
+		if m0 == 0 {
+			m0 = InitialM
+		}
+		if m0 < MMin || m0 > MMax {
+			return nil, fmt.Errorf("reputation reset: m0 %d out of [%d,%d]", m0, MMin, MMax)
+		}
+		return ResetModel{M0: m0}, nil
+	case ReputationDecay:
+		lambda := c.Lambda
+		if lambda == 0 {
+			lambda = 0.8
+		}
+		if lambda <= 0 || lambda >= 1 {
+			return nil, fmt.Errorf("reputation decay: lambda must be in (0,1), got %.3f", lambda)
+		}
+		return DecayModel{Lambda: lambda, High: MMax, Low: MMin - float64(MMax-MMin)/2}, nil
+	case ReputationProbation, ReputationPhaseWeighted:
+		base, err := c.buildBase()
+		if err != nil {
+			return nil, err
+		}
+		if c.Kind == ReputationPhaseWeighted {
+			weights := c.PhaseWeights
+			if len(weights) == 0 {
+				weights = DefaultPhaseWeights()
+			}
+			return PhaseWeightedModel{Base: base, Weights: weights}, nil
+		}
+		pm := ProbationModel{Base: base, Cooldown: c.CooldownRounds, Rounds: c.ProbationRounds, RehabM: c.RehabM}
+		if pm.Cooldown == 0 {
+			pm.Cooldown = 10
+		}
+		if pm.Rounds == 0 {
+			pm.Rounds = 5
+		}
+		if pm.RehabM == 0 {
+			pm.RehabM = MMin + 1
+		}
+		return pm, nil
+	default:
+		return nil, fmt.Errorf("unknown reputation model %q", c.Kind)
+	}
+}
+
+func (c ReputationConfig) buildBase() (ReputationModel, error) {
+	if c.Base == nil {
+		return LinearModel{}, nil
+	}
+	return c.Base.Build()
+}
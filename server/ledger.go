@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	pbft "PBFT1/PBFT"
+	pos "PBFT1/POS"
+	apbft "PBFT1/apbft"
+	"PBFT1/ledger"
+)
+
+// ======================= 【高亮-2026-10-16】新增：各共识引擎的哈希链账本 =======================
+// 每个引擎一条链（pbft / pos / raft / apbft），提交的交易打包为区块追加到对应账本：
+// - pbft / pos / raft 每轮一笔交易一个区块，提交证明记录投 commit 的节点（raft 只记录 leader）；
+// - apbft 一个序号（一批交易）一个区块，提交证明为该序号的法定人数证书；/api/trade 提交的交易同样入链。
+// -ledger 指定目录时每条链写入 <dir>/<engine>.jsonl，启动时校验已有区块后继续追加；否则只在内存中。
+
+// ledgerEngines 有账本的共识引擎
+var ledgerEngines = []string{"pbft", "pos", "raft", "apbft"}
+
+// chains 引擎名 -> 账本（main 中 openLedgers 之后只读）
+var chains = map[string]*ledger.Ledger{}
+
+// openLedgers 打开（或在内存中创建）各引擎的账本
+func openLedgers(dir string) error {
+	for _, name := range ledgerEngines {
+		if dir == "" {
+			chains[name] = ledger.New()
+			continue
+		}
+		l, err := ledger.Open(filepath.Join(dir, name+".jsonl"))
+		if err != nil {
+			return err
+		}
+		chains[name] = l
+		fmt.Printf("ledger %s: %d blocks\n", l.Path(), l.Height())
+	}
+	return nil
+}
+
+// appendBlock 把区块追加到引擎的账本；写入失败只打印日志，不影响共识结果
+func appendBlock(engine string, b ledger.Block) (ledger.Block, bool) {
+	l, ok := chains[engine]
+	if !ok {
+		return ledger.Block{}, false
+	}
+	b.Engine = engine
+	out, err := l.Append(b)
+	if err != nil {
+		fmt.Printf("ledger %s: %v\n", engine, err)
+		return ledger.Block{}, false
+	}
+	return out, true
+}
+
+// pbftCert PBFT 进入 committed 的副本
+func pbftCert(vals []pbft.Validator) ledger.Certificate {
+	cert := ledger.Certificate{Kind: ledger.CertPBFT}
+	for _, v := range vals {
+		if v.Vote == "commit" {
+			cert.Signers = append(cert.Signers, v.ID)
+		}
+	}
+	return cert
+}
+
+// posCert POS 委员会中投 commit 的成员
+func posCert(votes []pos.Vote) ledger.Certificate {
+	cert := ledger.Certificate{Kind: ledger.CertPOS}
+	for _, v := range votes {
+		if v.Vote == "commit" {
+			cert.Signers = append(cert.Signers, v.ID)
+		}
+	}
+	sort.Strings(cert.Signers)
+	return cert
+}
+
+// apbftCert 法定人数证书作为提交证明（没有证书时只记录类型）
+func apbftCert(qc *apbft.QuorumCertificate) ledger.Certificate {
+	cert := ledger.Certificate{Kind: ledger.CertAPBFT}
+	if qc == nil {
+		return cert
+	}
+	for _, id := range qc.SignerIDs() {
+		cert.Signers = append(cert.Signers, fmt.Sprintf("node-%d", id))
+	}
+	cert.Data, _ = json.Marshal(qc)
+	return cert
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"math"
 	"math/rand"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,7 +23,9 @@ import (
 	raft "PBFT1/RAFT"
 	apbft "PBFT1/apbft"
 	"PBFT1/forecast"
+	"PBFT1/ledger"
 	"PBFT1/node"
+	"PBFT1/topology"
 )
 
 var globalRng *rand.Rand
@@ -59,8 +64,9 @@ type TradeHistory struct {
 
 // ============== PBFT相关结构体与展示模型 ========
 type PBFTValidator struct {
-	ID   string `json:"id"`
-	Vote string `json:"vote"`
+	ID     string              `json:"id"`
+	Vote   string              `json:"vote"`
+	Phases []apbft.PhaseRecord `json:"phases,omitempty"` // 【高亮-2026-10-16】新增：APBFT 各 view 各阶段的结果与时延
 }
 
 type PBFTConsensusResult struct {
@@ -73,12 +79,22 @@ type PBFTConsensusResult struct {
 	FailedReason string          `json:"failedReason,omitempty"`
 	Price        float64         `json:"price,omitempty"`
 	LeaderNode   string          `json:"leaderNode,omitempty"`
+	Culprits     []string        `json:"culprits,omitempty"` // 【高亮-2026-10-16】新增：验签定位的坏签名节点
+	Pricing      *apbft.PricingRecord `json:"pricing,omitempty"` // 【高亮-2026-10-16】新增：APBFT 成交价使用的定价策略及参数
+	Transcript   *apbft.Transcript    `json:"transcript,omitempty"` // 【高亮-2026-10-16】新增：主节点、视图转换、定价报价与聚合签名
+	QC           *apbft.QuorumCertificate `json:"qc,omitempty"`      // 【高亮-2026-10-16】新增：可凭公钥清单离线验证的法定人数证书
 }
 
 type PBFTBlock struct {
 	Height       int       `json:"height"`
 	Timestamp    time.Time `json:"timestamp"`
 	ConfirmedTxs int       `json:"confirmedTxs"`
+	// 【高亮-2026-10-16】新增：APBFT 账本最新区块的哈希链字段（见 server/ledger.go）
+	Hash       string `json:"hash,omitempty"`
+	PrevHash   string `json:"prevHash,omitempty"`
+	MerkleRoot string `json:"merkleRoot,omitempty"`
+	Proposer   string `json:"proposer,omitempty"`
+	Trades     int    `json:"trades,omitempty"`
 }
 
 type RoundStat struct {
@@ -87,6 +103,9 @@ type RoundStat struct {
 	BuyerNode   string  `json:"buyerNode"`
 	SellerNode  string  `json:"sellerNode"`
 	SuccessRate float64 `json:"successRate"`
+	LatencyMs   float64 `json:"latencyMs"` // 【高亮-2026-10-16】新增：本轮实测共识时延（仿真毫秒）
+	Members     int     `json:"members"`   // 【高亮-2026-10-16】新增：本轮成员节点数（节点流失）
+	Online      int     `json:"online"`    // 【高亮-2026-10-16】新增：本轮在线节点数
 }
 
 type AlgoStat struct {
@@ -150,6 +169,11 @@ type SystemStateCache struct {
 	allAlgoNodeCostStats     map[string][]NodeCostPoint
 	// ======================= 【高亮-2026-03-22 16:45】补充缺少的时延 map 字段 =======================
     allAlgoLatencyStats      map[string][]LatencyPoint
+	// 【高亮-2026-10-16】新增：APBFT 吞吐量随批大小、流水线深度的变化
+	batchPoints    []apbft.BatchPoint
+	pipelinePoints []apbft.PipelinePoint
+	// 【高亮-2026-10-16】新增：APBFT 已提交交易的法定人数证书（按交易 ID）
+	qcs map[string]*apbft.QuorumCertificate
 }
 
 // 全局单例状态机
@@ -161,6 +185,7 @@ var sysState = &SystemStateCache{
 	// ======================= 【高亮-2026-03-22 16:45】初始化时延 map 字段 =======================
     allAlgoLatencyStats:      make(map[string][]LatencyPoint),
 	roundOverview:            make([]RoundStat, 0),
+	qcs:                      make(map[string]*apbft.QuorumCertificate),
 }
 
 func (s *SystemStateCache) NextGlobalRound() int {
@@ -174,11 +199,20 @@ func (s *SystemStateCache) UpdatePBFTState(res PBFTConsensusResult, confirmedTxs
 	s.Lock()
 	defer s.Unlock()
 	s.latestPBFTResult = res
+	if res.QC != nil {
+		s.qcs[res.TxId] = res.QC
+	}
 	s.latestBlock = PBFTBlock{
 		Height:       res.BlockHeight,
 		Timestamp:    time.Now(),
 		ConfirmedTxs: confirmedTxs,
 	}
+	// 【高亮-2026-10-16】区块高度取 APBFT 账本的链高，并附上最新区块的哈希
+	if head, ok := chains["apbft"].Head(); ok {
+		s.latestBlock.Height, s.latestBlock.Timestamp = head.Height, head.Timestamp
+		s.latestBlock.Hash, s.latestBlock.PrevHash, s.latestBlock.MerkleRoot = head.Hash, head.PrevHash, head.MerkleRoot
+		s.latestBlock.Proposer, s.latestBlock.Trades = head.Proposer, len(head.Trades)
+	}
 }
 
 // ================= 【高亮-2026-03-22】重构 2：策略模式统共识引擎接口 =================
@@ -197,20 +231,29 @@ func (e *PBFTEngine) ExecuteRound(db *gorm.DB, r int, specs []node.NodeSpec) Rou
 	rate := 0.0
 	if res.Status == "已确认" {
 		rate = 1.0
+		appendBlock(e.Name(), ledger.Block{ // 【高亮-2026-10-16】提交的交易入链
+			Round: r, Proposer: res.LeaderNode, Cert: pbftCert(res.Validators),
+			Trades: []ledger.Trade{{TxID: txId, Seller: res.LeaderNode, Amount: 10, Price: res.Price}},
+		})
 	}
-	return RoundStat{Round: r, SuccessRate: rate, MinPrice: res.Price, SellerNode: res.LeaderNode}
+	return RoundStat{Round: r, SuccessRate: rate, MinPrice: res.Price, SellerNode: res.LeaderNode, LatencyMs: res.LatencyMs}
 }
 
 type RAFTEngine struct{}
 
 func (e *RAFTEngine) Name() string { return "raft" }
 func (e *RAFTEngine) ExecuteRound(db *gorm.DB, r int, specs []node.NodeSpec) RoundStat {
-	leaderID, price, err := raft.SimulateRoundWithPrice(r, specs)
+	leaderID, price, latency, err := raft.SimulateRoundWithLatency(r, specs)
+	leader := fmt.Sprintf("node-%d", leaderID)
 	rate := 0.0
 	if err == nil {
 		rate = 1.0
+		appendBlock(e.Name(), ledger.Block{ // 【高亮-2026-10-16】提交的交易入链
+			Round: r, Proposer: leader, Cert: ledger.Certificate{Kind: ledger.CertRAFT},
+			Trades: []ledger.Trade{{TxID: fmt.Sprintf("raft-round-%d", r), Seller: leader, Amount: 10, Price: price}},
+		})
 	}
-	return RoundStat{Round: r, SuccessRate: rate, MinPrice: price, SellerNode: fmt.Sprintf("node-%d", leaderID)}
+	return RoundStat{Round: r, SuccessRate: rate, MinPrice: price, SellerNode: leader, LatencyMs: node.DurationMs(latency)}
 }
 
 type POSEngine struct {
@@ -218,15 +261,22 @@ type POSEngine struct {
 	cfg   pos.SimConfig
 }
 
-func NewPOSEngine(specs []node.NodeSpec) *POSEngine {
-	return &POSEngine{nodes: pos.NewNodesFromSpecs(specs), cfg: pos.DefaultSimConfig()}
+func NewPOSEngine(specs []node.NodeSpec, poolCfg node.PoolConfig) *POSEngine {
+	cfg := pos.DefaultSimConfig()
+	cfg.Pool = poolCfg
+	return &POSEngine{nodes: pos.NewNodesFromSpecs(specs), cfg: cfg}
 }
 func (e *POSEngine) Name() string { return "pos" }
 func (e *POSEngine) ExecuteRound(db *gorm.DB, r int, specs []node.NodeSpec) RoundStat {
 	txId := fmt.Sprintf("pos-round-%d-%d", r, time.Now().UnixNano())
+	e.nodes, _, _ = pos.UpdateValidatorSet(e.nodes, specs) // 【高亮-2026-10-16】节点流失：接纳新验证者、移出离开的节点
 	res := pos.RunPOSWithRoundAndSpecs(r, txId, 10, e.nodes, specs, e.cfg)
 	rate := 0.0
 	if res.Status == "已确认" {
+		appendBlock(e.Name(), ledger.Block{ // 【高亮-2026-10-16】提交的交易入链
+			Round: r, Proposer: res.Leader, Cert: posCert(res.Votes),
+			Trades: []ledger.Trade{{TxID: txId, Seller: res.Leader, Amount: 10, Price: res.Price}},
+		})
 		rate = 1.0
 		maliciousRatio := node.FixedMaliciousRatio
 		if globalRng.Float64() < (maliciousRatio * 0.15) {
@@ -236,26 +286,81 @@ func (e *POSEngine) ExecuteRound(db *gorm.DB, r int, specs []node.NodeSpec) Roun
 			rate = 0.0
 		}
 	}
-	return RoundStat{Round: r, SuccessRate: rate, MinPrice: res.Price, SellerNode: res.Leader}
+	return RoundStat{Round: r, SuccessRate: rate, MinPrice: res.Price, SellerNode: res.Leader, LatencyMs: res.LatencyMs}
 }
 
 // 原 runCustomRound 逻辑现在被封装为 CustomEngine，与其它算法平起平坐
-type CustomEngine struct{}
+// 【高亮-2026-10-16】修改：持有服务端唯一的 apbft.Cluster，信誉在各轮、各笔交易之间延续
+// 【高亮-2026-10-16】修改：本轮交易经批处理器攒批后共识（一批一个序号），每笔交易取各自的结果
+type CustomEngine struct {
+	cluster *apbft.Cluster
+	batcher *apbft.Batcher
+}
+
+// tradeIntervalMs 仿真中同一轮相邻两笔交易的到达间隔（仿真毫秒）
+const tradeIntervalMs = 20
 
 func (e *CustomEngine) Name() string {return "apbft"}
 func (e *CustomEngine) ExecuteRound(db *gorm.DB, r int, specs []node.NodeSpec) RoundStat {
 	successCount := 0
+	totalLatencyMs := 0.0
 	minPrice := math.MaxFloat64
 	var minBuyer, minSeller string
 	numTrades := globalRng.Intn(5) + 5
+	e.cluster.UpdateMembership(specs) // 节点流失：增删成员、标记宕机节点
+
+	type roundTrade struct {
+		buyer  string
+		price  float64
+		amount int
+		txId   string
+	}
+	trades := make([]roundTrade, numTrades)
+	results := make(map[string]apbft.PBFTResult, numTrades)
+	arrival := e.cluster.Elapsed()
+	for i := range trades {
+		t := roundTrade{buyer: fmt.Sprintf("Node-%02d", globalRng.Intn(20)), price: globalRng.Float64()*500 + 30, amount: globalRng.Intn(50) + 10}
+		t.txId = fmt.Sprintf("custom-round-%d-trade-%d-%d", r, i, time.Now().UnixNano())
+		trades[i] = t
+		for _, res := range e.batcher.Offer(apbft.Tx{ID: t.txId, Amount: t.amount, Class: apbft.ClassifyDemand(t.amount)}, arrival+time.Duration(i*tradeIntervalMs)*time.Millisecond) {
+			results[res.TxId] = res
+		}
+	}
+	for _, res := range e.batcher.Flush() {
+		results[res.TxId] = res
+	}
 
-	for i := 0; i < numTrades; i++ {
-		buyer := fmt.Sprintf("Node-%02d", globalRng.Intn(20))
-		price := globalRng.Float64()*500 + 30
-		amount := globalRng.Intn(50) + 10
+	// 【高亮-2026-10-16】每个提交的序号（一批交易）作为一个区块入链，提交证明为该序号的法定人数证书
+	heights := make(map[string]int, numTrades)
+	var seqs []int
+	batches := make(map[int][]roundTrade)
+	for _, t := range trades {
+		res := results[t.txId]
+		if res.Status != "已确认" {
+			continue
+		}
+		if _, ok := batches[res.BlockHeight]; !ok {
+			seqs = append(seqs, res.BlockHeight)
+		}
+		batches[res.BlockHeight] = append(batches[res.BlockHeight], t)
+	}
+	for _, seq := range seqs {
+		batch, first := batches[seq], results[batches[seq][0].txId]
+		b := ledger.Block{Round: seq, Proposer: first.LeaderNode, Cert: apbftCert(first.QC)}
+		for _, t := range batch {
+			b.Trades = append(b.Trades, ledger.Trade{TxID: t.txId, Buyer: t.buyer, Seller: first.LeaderNode, Amount: t.amount, Price: t.price})
+		}
+		if blk, ok := appendBlock(e.Name(), b); ok {
+			for _, t := range batch {
+				heights[t.txId] = blk.Height
+			}
+		}
+	}
 
-		txId := fmt.Sprintf("custom-round-%d-trade-%d-%d", r, i, time.Now().UnixNano())
-		pbftRes := apbft.RunAPBFTWithRoundAndSpecs(r, txId, amount, specs)
+	for _, t := range trades {
+		buyer, price, amount, txId := t.buyer, t.price, t.amount, t.txId
+		pbftRes := results[txId]
+		totalLatencyMs += pbftRes.LatencyMs
 
 		seller := pbftRes.LeaderNode
 		if seller == "" {
@@ -279,10 +384,7 @@ func (e *CustomEngine) ExecuteRound(db *gorm.DB, r int, specs []node.NodeSpec) R
 			db.Create(&trade)
 		}
 
-		vals := make([]PBFTValidator, 0, len(pbftRes.Validators))
-		for _, v := range pbftRes.Validators {
-			vals = append(vals, PBFTValidator{ID: v.ID, Vote: v.Vote})
-		}
+		vals := convertValidators(pbftRes.Validators)
 
 		pbftRound := sysState.NextGlobalRound()
 		reason := pbftRes.FailedReason
@@ -294,8 +396,9 @@ func (e *CustomEngine) ExecuteRound(db *gorm.DB, r int, specs []node.NodeSpec) R
 
 		// 利用全新的状态缓存写入本轮状态
 		sysState.UpdatePBFTState(PBFTConsensusResult{
-			TxId: txId, Status: status, Consensus: pbftRes.Consensus, BlockHeight: pbftRes.BlockHeight,
+			TxId: txId, Status: status, Consensus: pbftRes.Consensus, BlockHeight: heights[txId], // 【高亮-2026-10-16】账本中的区块高度（未提交为 0）
 			Timestamp: time.Now(), Validators: vals, FailedReason: reason, Price: pbftRes.Price, LeaderNode: pbftRes.LeaderNode,
+			Pricing: &pbftRes.Pricing, Transcript: &pbftRes.Transcript, QC: pbftRes.QC,
 		}, amount)
 	}
 
@@ -303,17 +406,19 @@ func (e *CustomEngine) ExecuteRound(db *gorm.DB, r int, specs []node.NodeSpec) R
 		minPrice = 0
 	}
 	successRate := 0.0
+	avgLatencyMs := 0.0
 	if numTrades > 0 {
 		successRate = float64(successCount) / float64(numTrades)
+		avgLatencyMs = totalLatencyMs / float64(numTrades)
 	}
 
 	fmt.Printf("[模拟轮 %d] 最低价: %v 买方: %s 卖方: %s 成功挂单率: %.2f%%\n", r, minPrice, minBuyer, minSeller, successRate*100)
-	return RoundStat{Round: r, MinPrice: minPrice, BuyerNode: minBuyer, SellerNode: minSeller, SuccessRate: successRate}
+	return RoundStat{Round: r, MinPrice: minPrice, BuyerNode: minBuyer, SellerNode: minSeller, SuccessRate: successRate, LatencyMs: avgLatencyMs}
 }
 
 // ================= 【高亮-2026-03-22】重构 3：统一指标生成引擎 =================
 // 合并了原先 3 个结构几乎一模一样的 simulateXXXForAlgo 方法
-func generateMetricsForAlgo(algo string, malRatio float64) ([]ErrorRatePoint, []LeaderChangePoint, []NodeCostPoint, []LatencyPoint) {
+func generateMetricsForAlgo(algo string, malRatio float64) ([]ErrorRatePoint, []LeaderChangePoint, []NodeCostPoint) {
 	fixedRounds := []int{100, 200, 300, 400, 500, 600, 700, 800, 900, 1000}
 	errs := make([]ErrorRatePoint, 0, len(fixedRounds))
 	leaders := make([]LeaderChangePoint, 0, len(fixedRounds))
@@ -367,46 +472,43 @@ func generateMetricsForAlgo(algo string, malRatio float64) ([]ErrorRatePoint, []
 		}
 		costs = append(costs, NodeCostPoint{Round: r, NodeCost: cost})
 	}
-    	// ======================= 【高亮-2026-03-22】新增：生成 1~20 轮的平均时延数据 =======================
-    	lats := make([]LatencyPoint, 0, 20)
-    	for r := 1; r <= 20; r++ {
-    		var latency float64
-    		switch algo {
-    		case "pbft":
-    			// 传统 PBFT O(N^2) 全网广播，时延极高
-    			latency = 200.0 + globalRng.Float64()*80.0
-    		case "raft":
-    			// Raft 强主节点，线性通信，时延中等
-    			latency = 50.0 + globalRng.Float64()*20.0
-    		case "pos":
-    			// PoS 验证者轮换，时延较低
-    			latency = 30.0 + globalRng.Float64()*15.0
-    		case "apbft":
-    			// KNN-APBFT 局部共识，距离远直接拒绝，极大降低了通信包，时延最低
-    			latency = 12.0 + globalRng.Float64()*8.0
-    		}
-    		lats = append(lats, LatencyPoint{Round: r, Latency: latency})
-    	}
-    return errs, leaders, costs, lats // <== 【高亮-2026-03-22】返回时延切片
+    return errs, leaders, costs
+}
+
+// latencyPointsFromStats 时延曲线取各轮实测的仿真时延
+// 【高亮-2026-10-16】新增：取代原先按算法拍脑袋生成的时延数据
+func latencyPointsFromStats(stats []RoundStat) []LatencyPoint {
+	lats := make([]LatencyPoint, 0, len(stats))
+	for _, st := range stats {
+		lats = append(lats, LatencyPoint{Round: st.Round, Latency: st.LatencyMs})
+	}
+	return lats
 }
 
 // ================= 【高亮-2026-03-22】重构 4：核心调度器完全解耦 =================
-func simulateAllAlgos(db *gorm.DB, totalRounds int, maliciousRatio float64, numNodes int) {
+// 【高亮-2026-10-16】修改：节点池由 node.PoolConfig 描述（可由 -scenario 场景文件加载），不再写死节点数/恶意率
+func simulateAllAlgos(db *gorm.DB, totalRounds int, poolCfg node.PoolConfig, cluster *apbft.Cluster) {
 	// 初始化引擎列表 (未来加新算法只需加一行，符合开闭原则)
-	specs0 := node.NewPool(1, numNodes, maliciousRatio)
+	// 【高亮-2026-10-16】修改：节点池由流失过程逐轮给出（poolCfg.Churn 为空时与 NewPoolFromConfig 相同）
+	churn := node.NewChurn(poolCfg)
+	specs0 := churn.Pool(1)
 	engines := []ConsensusEngine{
 		&PBFTEngine{},
-		NewPOSEngine(specs0),
+		NewPOSEngine(specs0, poolCfg),
 		&RAFTEngine{},
-		&CustomEngine{},
+		&CustomEngine{cluster: cluster, batcher: cluster.NewBatcher()},
 	}
 
 	for r := 1; r <= totalRounds; r++ {
 		// 全局共用统一测试池（恶意节点和拓扑对齐）
-		specs := node.NewPool(r, numNodes, maliciousRatio)
+		specs := churn.Pool(r)
+		for _, ev := range churn.Events() {
+			fmt.Printf("[churn] round %d: node-%d %s\n", ev.Round, ev.ID, ev.Kind)
+		}
 
 		for _, engine := range engines {
 			stat := engine.ExecuteRound(db, r, specs)
+			stat.Members, stat.Online = len(specs), node.ActiveCount(specs)
 
 			sysState.Lock()
 			sysState.allAlgoStats[engine.Name()] = append(sysState.allAlgoStats[engine.Name()], stat)
@@ -424,18 +526,63 @@ func simulateAllAlgos(db *gorm.DB, totalRounds int, maliciousRatio float64, numN
 	for _, engine := range engines {
 		name := engine.Name()
     // ======================= 【高亮-2026-03-22】4. 接收并存入时延缓存 =======================
-		errs, leaders, costs, lats := generateMetricsForAlgo(name, maliciousRatio)
+		errs, leaders, costs := generateMetricsForAlgo(name, poolCfg.MaliciousRatio)
 		sysState.allAlgoErrorRateStats[name] = errs
 		sysState.allAlgoLeaderChangeStats[name] = leaders
 		sysState.allAlgoNodeCostStats[name] = costs
-		sysState.allAlgoLatencyStats[name] = lats // 将时延数据写入缓存
+		sysState.allAlgoLatencyStats[name] = latencyPointsFromStats(sysState.allAlgoStats[name]) // 【高亮-2026-10-16】实测仿真时延
+	}
+	if poolCfg.Churn != nil {
+		st := churn.Stats()
+		fmt.Printf("[churn] node availability %.1f%% over %d rounds (crashes %d, joins %d, leaves %d)\n",
+			st.Availability()*100, st.Rounds, st.Crashes, st.Joins, st.Leaves)
+	}
+}
+
+// batchSweepSizes 吞吐量图的批大小采样；batchSweepRate 扫描时交易的到达速率（笔/仿真秒）
+var batchSweepSizes = []int{1, 2, 4, 8, 16, 32, 64, 128}
+
+const batchSweepRate = 500
+
+// measureBatching 在独立的集群上测量 APBFT 吞吐量随批大小的变化，写入缓存供 /api/performance/batching 使用
+// 【高亮-2026-10-16】新增
+func measureBatching(specs []node.NodeSpec, cfg apbft.Config, txs int) {
+	points, err := apbft.BatchSweep(specs, cfg, batchSweepSizes, txs, batchSweepRate)
+	if err != nil {
+		fmt.Println("apbft batch sweep:", err)
+		return
 	}
+	for _, p := range points {
+		fmt.Printf("[batch] size %3d: %4d batches, %.1f tx/s, avg latency %.1f ms\n", p.BatchSize, p.Batches, p.Throughput, p.AvgLatencyMs)
+	}
+	sysState.Lock()
+	sysState.batchPoints = points
+	sysState.Unlock()
+}
+
+// pipelineSweepDepths 吞吐量图的流水线深度采样
+var pipelineSweepDepths = []int{1, 2, 4, 8, 12, 16, 20}
+
+// measurePipelining 在独立的集群上测量 APBFT 吞吐量随流水线深度的变化（每个请求一个序号，请求始终就绪）
+// 【高亮-2026-10-16】新增
+func measurePipelining(specs []node.NodeSpec, cfg apbft.Config, requests int) {
+	points, err := apbft.PipelineSweep(specs, cfg, pipelineSweepDepths, requests)
+	if err != nil {
+		fmt.Println("apbft pipeline sweep:", err)
+		return
+	}
+	for _, p := range points {
+		fmt.Printf("[pipeline] depth %2d: %.1f req/s, avg latency %.1f ms\n", p.Depth, p.Throughput, p.AvgLatencyMs)
+	}
+	sysState.Lock()
+	sysState.pipelinePoints = points
+	sysState.Unlock()
 }
 
 func convertValidators(origin []apbft.Validator) []PBFTValidator {
 	r := make([]PBFTValidator, 0, len(origin))
 	for _, v := range origin {
-		r = append(r, PBFTValidator{ID: v.ID, Vote: v.Vote})
+		r = append(r, PBFTValidator{ID: v.ID, Vote: v.Vote, Phases: v.Phases})
 	}
 	return r
 }
@@ -458,14 +605,117 @@ func persistTradeResult(db *gorm.DB, trade *TradeHistory) {
 
 func main() {
 	totalRounds := flag.Int("rounds", 20, "number of consensus rounds")
+	scenario := flag.String("scenario", "", "pool scenario file (JSON/YAML); empty uses node.DefaultPoolConfig")
+	topoFile := flag.String("topology", "", "grid topology file (JSON/YAML/CSV); overrides the scenario's topology")
+	keyDir := flag.String("keystore", "", "node key store directory (passphrase from $"+node.KeystorePassphraseEnv+"); overrides the scenario's keystore")
+	stateFile := flag.String("apbft-state", "", "APBFT cluster snapshot file: restored at startup if present, saved after simulation and each trade")
+	sweepTxs := flag.Int("batch-sweep-txs", 256, "trades per batch size when charting APBFT throughput against batch size (0 disables)")
+	sweepRequests := flag.Int("pipeline-sweep-requests", 100, "requests per depth when charting APBFT throughput against pipeline depth (0 disables)")
+	ledgerDir := flag.String("ledger", "", "block ledger directory (one append-only <engine>.jsonl per consensus engine, verified at startup); empty keeps ledgers in memory")
+	clearInterval := flag.Duration("clear-interval", 10*time.Second, "APBFT market clearing round length under uniform clearing: a consensus-ordered clearing request is submitted at each tick (0 disables)")
 	flag.Parse()
 
+	poolCfg := node.DefaultPoolConfig()
+	apbftCfg := apbft.DefaultConfig()
+	if *scenario != "" {
+		loaded, err := node.LoadPoolConfig(*scenario)
+		if err != nil {
+			panic(err)
+		}
+		poolCfg = loaded
+		// 同一场景文件中的 reputation 段配置 APBFT 信誉模型
+		if apbftCfg, err = apbft.LoadConfig(*scenario); err != nil {
+			panic(err)
+		}
+	}
+	// 【高亮-2026-10-16】所有共识引擎共用同一张电网拓扑（KNN 距离、拒绝概率、链路时延）
+	if *topoFile == "" {
+		*topoFile = poolCfg.Topology
+	}
+	if *topoFile != "" {
+		grid, err := topology.Load(*topoFile)
+		if err != nil {
+			panic(err)
+		}
+		if !grid.Covers(poolCfg.NumNodes) {
+			panic(fmt.Sprintf("topology %s does not cover nodes 0..%d", *topoFile, poolCfg.NumNodes-1))
+		}
+		topology.Use(grid)
+	}
+
+	// 【高亮-2026-10-16】持久化节点密钥：APBFT 节点每次运行使用同一身份，并导出公钥清单
+	if *keyDir != "" {
+		apbftCfg.Keystore, apbftCfg.Keys = &node.KeystoreConfig{Dir: *keyDir}, nil
+	}
+	if err := apbftCfg.OpenKeystore(); err != nil {
+		panic(err)
+	}
+	if apbftCfg.Keys != nil {
+		created := 0
+		for id := 0; id < poolCfg.NumNodes; id++ {
+			_, isNew, err := apbftCfg.Keys.LoadOrCreate(id)
+			if err != nil {
+				panic(err)
+			}
+			if isNew {
+				created++
+			}
+		}
+		if err := apbftCfg.Keys.ExportManifest(apbftCfg.Keystore.ManifestPath()); err != nil {
+			panic(err)
+		}
+		fmt.Printf("keystore %s: %d keys (%d new), manifest %s\n", apbftCfg.Keys.Dir(), poolCfg.NumNodes, created, apbftCfg.Keystore.ManifestPath())
+	}
+
+	// 【高亮-2026-10-16】服务端生命周期内唯一的 APBFT 集群：仿真各轮与 /api/trade 共用，信誉跨交易延续
+	cluster, err := apbft.NewCluster(node.NewPoolFromConfig(1, poolCfg), apbftCfg)
+	if err != nil {
+		panic(err)
+	}
+	if *stateFile != "" {
+		if snap, err := apbft.LoadSnapshot(*stateFile); err == nil {
+			if err := cluster.Restore(snap); err != nil {
+				panic(err)
+			}
+			fmt.Printf("apbft cluster restored from %s (seq %d, height %d)\n", *stateFile, snap.Seq, snap.Height)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			panic(err)
+		}
+	}
+	saveClusterState := func() {
+		if *stateFile == "" {
+			return
+		}
+		if err := cluster.SaveSnapshot(*stateFile); err != nil {
+			fmt.Println("save apbft cluster state:", err)
+		}
+	}
+
+	// 【高亮-2026-10-16】各共识引擎的哈希链账本：文件被篡改或末尾区块不完整时拒绝启动
+	if err := openLedgers(*ledgerDir); err != nil {
+		panic(err)
+	}
+
 	forecastClient = forecast.NewClient("http://192.168.140.1:8000")
 	db := dbConnect()
 
-	simMalRatio := node.FixedMaliciousRatio
-	simNumNodes := node.FixedNumNodes
-	simulateAllAlgos(db, *totalRounds, simMalRatio, simNumNodes)
+	simulateAllAlgos(db, *totalRounds, poolCfg, cluster)
+	saveClusterState()
+	for _, line := range apbft.FormatLeaderTiers(cluster.LeaderTiers()) { // 【高亮-2026-10-16】主节点按层级的分布
+		fmt.Println("[apbft]", line)
+	}
+	fmt.Println("[apbft]", cluster.CommitteeStats())
+	if *sweepTxs > 0 {
+		measureBatching(node.NewPoolFromConfig(1, poolCfg), apbftCfg, *sweepTxs)
+	}
+	if *sweepRequests > 0 {
+		measurePipelining(node.NewPoolFromConfig(1, poolCfg), apbftCfg, *sweepRequests)
+	}
+
+	// 【高亮-2026-10-16】集合竞价按轮次出清：订单只挂单，出清请求经共识排序后各副本在同一位置出清
+	if cluster.Clearing() == apbft.UniformClearing && *clearInterval > 0 {
+		go clearMarketLoop(db, cluster, *clearInterval, saveClusterState)
+	}
 
 	sysState.RLock()
 	fmt.Printf("roundOverview len = %d\n", len(sysState.roundOverview))
@@ -504,6 +754,23 @@ func main() {
 		c.JSON(200, sysState.latestPBFTResult)
 	})
 
+	// 【高亮-2026-10-16】新增：交易的法定人数证书，第三方凭 /api/pbft/manifest 的公钥清单离线验证其最终性
+	api.GET("/pbft/qc/:txId", func(c *gin.Context) {
+		sysState.RLock()
+		defer sysState.RUnlock()
+		qc, ok := sysState.qcs[c.Param("txId")]
+		if !ok {
+			c.JSON(404, gin.H{"msg": "该交易没有法定人数证书"})
+			return
+		}
+		c.JSON(200, qc)
+	})
+
+	// 【高亮-2026-10-16】新增：APBFT 节点公钥清单（与密钥库导出的 manifest 格式相同）
+	api.GET("/pbft/manifest", func(c *gin.Context) {
+		c.JSON(200, cluster.Manifest())
+	})
+
 	api.GET("/pbft/block", func(c *gin.Context) {
 		sysState.RLock()
 		defer sysState.RUnlock()
@@ -514,6 +781,45 @@ func main() {
 		c.JSON(200, sysState.latestBlock)
 	})
 
+	// 【高亮-2026-10-16】新增：引擎账本的区块（?from=起始高度&limit=数量，默认最近 20 个）
+	api.GET("/ledger/:engine", func(c *gin.Context) {
+		l, ok := chains[c.Param("engine")]
+		if !ok {
+			c.JSON(404, gin.H{"msg": "未知的共识引擎"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil {
+			c.JSON(400, gin.H{"msg": "参数错误"})
+			return
+		}
+		from := 1
+		if limit > 0 {
+			from = l.Height() - limit + 1
+		}
+		if q := c.Query("from"); q != "" {
+			if from, err = strconv.Atoi(q); err != nil {
+				c.JSON(400, gin.H{"msg": "参数错误"})
+				return
+			}
+		}
+		c.JSON(200, gin.H{"height": l.Height(), "blocks": l.Range(from, limit)})
+	})
+
+	// 【高亮-2026-10-16】新增：重新校验引擎账本的哈希链、Merkle 根与落盘文件
+	api.GET("/ledger/:engine/verify", func(c *gin.Context) {
+		l, ok := chains[c.Param("engine")]
+		if !ok {
+			c.JSON(404, gin.H{"msg": "未知的共识引擎"})
+			return
+		}
+		if err := l.Verify(); err != nil {
+			c.JSON(200, gin.H{"ok": false, "height": l.Height(), "error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "height": l.Height()})
+	})
+
 	api.POST("/register", func(c *gin.Context) {
 		var req struct {
 			Username string `json:"username"`
@@ -573,7 +879,8 @@ func main() {
 		}
 		var b Balance
 		db.Where("user_id = ?", user.ID).First(&b)
-		c.JSON(200, gin.H{"balance": b.Balance})
+		reserved := reservedBy(cluster.AgreedOrderBook(), user.Username) // 【高亮-2026-10-16】买单挂单冻结的余额
+		c.JSON(200, gin.H{"balance": b.Balance, "reserved": reserved, "available": b.Balance - reserved})
 	})
 
 	api.POST("/account/deposit", func(c *gin.Context) {
@@ -592,13 +899,18 @@ func main() {
 			c.JSON(401, gin.H{"msg": "未登录"})
 			return
 		}
-		var b Balance
-		db.Where("user_id = ?", user.ID).First(&b)
-		b.Balance += req.Amount
-		db.Save(&b)
-		db.Create(&TradeHistory{
-			UserID: user.ID, Type: "充值", Amount: req.Amount, Time: time.Now(), Status: "成功", Price: 0, Node: "",
-		})
+		// 【高亮-2026-10-16】修改：条件更新加款，不与并发的成交结算互相覆盖
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := adjustBalance(tx, user.ID, req.Amount, 0); err != nil {
+				return err
+			}
+			return tx.Create(&TradeHistory{
+				UserID: user.ID, Type: "充值", Amount: req.Amount, Time: time.Now(), Status: "成功", Price: 0, Node: "",
+			}).Error
+		}); err != nil {
+			c.JSON(500, gin.H{"msg": "充值失败"})
+			return
+		}
 		c.JSON(200, gin.H{"msg": "充值成功"})
 	})
 
@@ -607,8 +919,10 @@ func main() {
 		var req struct {
 			Type   string `json:"type"`
 			Amount int    `json:"amount"`
+			orderFields   // 【高亮-2026-10-16】新增：订单类型、撤单与改单（见 orders.go）
 		}
-		if err := c.ShouldBindJSON(&req); err != nil || !(req.Type == "buy" || req.Type == "sell") || req.Amount <= 0 {
+		// 【高亮-2026-10-16】修改：撤单 / 改单不需要方向与数量，订单参数由订单簿校验并返回拒绝原因
+		if err := c.ShouldBindJSON(&req); err != nil || (!req.isOrder() && (!(req.Type == "buy" || req.Type == "sell") || req.Amount <= 0)) {
 			c.JSON(400, gin.H{"msg": "参数错误"})
 			return
 		}
@@ -621,23 +935,26 @@ func main() {
 			c.JSON(401, gin.H{"msg": "未登录"})
 			return
 		}
-		var b Balance
-		db.Where("user_id = ?", user.ID).First(&b)
+		if req.isOrder() {
+			submitOrder(c, db, cluster, user, req.Type, req.Amount, req.orderFields)
+			saveClusterState()
+			return
+		}
+		// 【高亮-2026-10-16】修改：买入只能动用未被买单挂单冻结的余额，条件更新扣款（见 orders.go adjustBalance）
 		status := "成功"
+		marketMu.Lock()
+		delta, floor := req.Amount, 0
 		if req.Type == "buy" {
-			if b.Balance < req.Amount {
-				status = "失败"
-			} else {
-				b.Balance -= req.Amount
-				db.Save(&b)
-			}
-		} else {
-			b.Balance += req.Amount
-			db.Save(&b)
+			delta, floor = -req.Amount, reservedBy(cluster.AgreedOrderBook(), user.Username)
 		}
+		if err := db.Transaction(func(tx *gorm.DB) error { return adjustBalance(tx, user.ID, delta, floor) }); err != nil {
+			status = "失败"
+		}
+		marketMu.Unlock()
 
 		nowTxId := fmt.Sprintf("%s_%d", username, time.Now().UnixNano())
-		pbftResult := apbft.RunAPBFT(nowTxId, req.Amount)
+		pbftResult := cluster.Submit(apbft.Tx{ID: nowTxId, Amount: req.Amount, Class: apbft.ClassifyDemand(req.Amount)}) // 【高亮-2026-10-16】修改：共用长期存活的集群，按电量分层路由
+		saveClusterState()
 		validators := convertValidators(pbftResult.Validators)
 
 		tradePrice := pbftResult.Price
@@ -647,6 +964,14 @@ func main() {
 		sellNode := pbftResult.LeaderNode
 
 		if status == "成功" && pbftResult.Status == "已确认" {
+			// 【高亮-2026-10-16】成交的交易单独成块写入 APBFT 账本
+			blockHeight := 0
+			if blk, ok := appendBlock("apbft", ledger.Block{
+				Round: pbftResult.BlockHeight, Proposer: sellNode, Cert: apbftCert(pbftResult.QC),
+				Trades: []ledger.Trade{{TxID: nowTxId, Buyer: username, Seller: sellNode, Amount: req.Amount, Price: tradePrice}},
+			}); ok {
+				blockHeight = blk.Height
+			}
 			trade := TradeHistory{
 				UserID: user.ID,
 				Type:   req.Type,
@@ -665,12 +990,16 @@ func main() {
 				TxId:         pbftResult.TxId,
 				Status:       pbftResult.Status,
 				Consensus:    pbftResult.Consensus,
-				BlockHeight:  pbftResult.BlockHeight,
+				BlockHeight:  blockHeight,
 				Timestamp:    time.Now(),
 				Validators:   validators,
 				FailedReason: pbftResult.FailedReason,
 				Price:        tradePrice,
 				LeaderNode:   sellNode,
+				Culprits:     pbftResult.Culprits,
+				Pricing:      &pbftResult.Pricing,
+				Transcript:   &pbftResult.Transcript,
+				QC:           pbftResult.QC,
 			}, req.Amount)
 
 			if forecastClient != nil {
@@ -695,12 +1024,14 @@ func main() {
 			TxId:         nowTxId,
 			Status:       "失败",
 			Consensus:    "pbft",
-			BlockHeight:  pbftResult.BlockHeight,
+			BlockHeight:  0, // 【高亮-2026-10-16】未入链
 			Timestamp:    time.Now(),
 			Validators:   validators,
 			FailedReason: reason,
 			Price:        0,
 			LeaderNode:   "",
+			Culprits:     pbftResult.Culprits,
+			Transcript:   &pbftResult.Transcript,
 		}, req.Amount)
 
 		failTrade := TradeHistory{
@@ -843,5 +1174,29 @@ func main() {
 		c.JSON(200, gin.H{"algos": out})
 	})
 
+	// 【高亮-2026-10-16】新增：APBFT 吞吐量 / 平均时延随批大小的变化
+	api.GET("/performance/batching", func(c *gin.Context) {
+		sysState.RLock()
+		defer sysState.RUnlock()
+		c.JSON(200, gin.H{"points": sysState.batchPoints})
+	})
+
+	// 【高亮-2026-10-16】新增：APBFT 吞吐量 / 平均时延随流水线深度的变化
+	api.GET("/performance/pipelining", func(c *gin.Context) {
+		sysState.RLock()
+		defer sysState.RUnlock()
+		c.JSON(200, gin.H{"points": sysState.pipelinePoints})
+	})
+
+	// 【高亮-2026-10-16】新增：APBFT 各需求类别下主节点的层级分布与平均时延（含 /api/trade 提交的交易）
+	api.GET("/performance/tiers", func(c *gin.Context) {
+		c.JSON(200, gin.H{"shares": cluster.LeaderTiers()})
+	})
+
+	// 【高亮-2026-10-16】新增：APBFT 验证委员会的失败概率估计与每次三阶段流程的消息量
+	api.GET("/performance/committee", func(c *gin.Context) {
+		c.JSON(200, cluster.CommitteeStats())
+	})
+
 	r.Run(":5000")
 }
\ No newline at end of file
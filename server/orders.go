@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	apbft "PBFT1/apbft"
+	"PBFT1/ledger"
+)
+
+// ======================= 【高亮-2026-10-16】新增：/api/trade 的订单类型、撤单与改单 =======================
+// 请求带任一订单字段时，/api/trade 不再走单笔交易，而是把订单作为订单批次提交给 APBFT 集群，
+// 由各副本的订单簿执行（见 apbft/orders.go、apbft/market.go）：
+// - action 为空或 place 时下单：type（buy / sell）、amount 为数量，orderType（limit / market）、price、
+//   tif（GTC / IOC / FOK）、postOnly、minAmount、expireRound（共识序号）、expireAt 描述订单；
+// - action 为 cancel / amend 时按 orderId 撤单或改单（amend 的 price、amount 为新价格与新的剩余数量，0 表示不改）；
+// - 被拒绝时返回 400，msg 为原因说明、reason 为原因代码；成交按数量结算双方余额（与单笔交易相同，余额单位即电量），
+//   写入交易记录，并打包为一个区块写入 APBFT 账本。
+// 【高亮-2026-10-16】修改：结算整个订单批次的成交（Market.Trades）：集合竞价模式下订单只挂单，
+// 出清时统一价格的成交可能涉及之前挂单的其他用户。
+// 【高亮-2026-10-16】修改：买单挂单冻结余额。冻结量即一致的订单簿（Cluster.AgreedOrderBook）中该用户买单的剩余挂单量，
+// 挂单时冻结，撤单、过期、改单、成交后随订单簿自动释放；下单、改单与单笔买入只能动用 余额 - 冻结量。
+// 订单提交、出清与单笔交易的余额变动串行执行（marketMu），一次执行的全部成交在一个数据库事务中结算，
+// 扣款是带条件的更新（余额不足时整个事务回滚），并发请求不会把余额扣成负数。
+
+// marketMu 串行化订单提交、出清与单笔交易的余额检查：检查时的一致订单簿与余额在执行、结算时仍然成立
+var marketMu sync.Mutex
+
+var errInsufficientBalance = errors.New("余额不足")
+
+// reservedBy 订单簿 book 中用户 username 买单的剩余挂单量（冻结的余额，向上取整）
+func reservedBy(book *apbft.OrderBook, username string) int {
+	total := 0.0
+	for _, o := range book.Buys() {
+		if o.User == username {
+			total += o.Quantity
+		}
+	}
+	return int(math.Ceil(total))
+}
+
+// extraReserve 执行操作 req 需要新冻结的余额：买入下单为数量，调高自己买单的剩余量时为增加的部分，其余为 0
+func extraReserve(book *apbft.OrderBook, req apbft.OrderRequest) int {
+	switch req.Action {
+	case "", apbft.ActionPlace:
+		if req.Type == apbft.Buy {
+			return int(math.Ceil(req.Quantity))
+		}
+	case apbft.ActionAmend:
+		for _, o := range book.Buys() {
+			if o.ID == req.OrderID && o.User == req.User && req.Quantity > o.Quantity {
+				return int(math.Ceil(req.Quantity - o.Quantity))
+			}
+		}
+	}
+	return 0
+}
+
+// adjustBalance 在事务 tx 中把用户余额调整 delta，调整后不得低于 floor（条件更新，不会先读后写）；
+// 余额不足时返回 errInsufficientBalance，没有余额记录时按 0 新建
+func adjustBalance(tx *gorm.DB, userID uint, delta, floor int) error {
+	if delta == 0 {
+		return nil
+	}
+	res := tx.Model(&Balance{}).Where("user_id = ? AND balance + ? >= ?", userID, delta, floor).
+		Update("balance", gorm.Expr("balance + ?", delta))
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	var n int64
+	if err := tx.Model(&Balance{}).Where("user_id = ?", userID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 || delta < floor {
+		return errInsufficientBalance
+	}
+	return tx.Create(&Balance{UserID: userID, Balance: delta}).Error
+}
+
+// orderFields /api/trade 请求中的订单字段
+type orderFields struct {
+	Action      string    `json:"action"`
+	OrderID     int       `json:"orderId"`
+	OrderType   string    `json:"orderType"`
+	Price       float64   `json:"price"`
+	TIF         string    `json:"tif"`
+	PostOnly    bool      `json:"postOnly"`
+	MinAmount   float64   `json:"minAmount"`
+	ExpireRound int       `json:"expireRound"`
+	ExpireAt    time.Time `json:"expireAt"`
+}
+
+// isOrder 请求是否带订单字段（都为空时按原来的单笔交易处理）
+func (f orderFields) isOrder() bool {
+	return f.Action != "" || f.OrderType != "" || f.Price != 0 || f.TIF != "" || f.PostOnly ||
+		f.MinAmount != 0 || f.ExpireRound != 0 || !f.ExpireAt.IsZero()
+}
+
+// orderRequest 转换为订单簿的操作
+func (f orderFields) orderRequest(user, side string, amount int) apbft.OrderRequest {
+	req := apbft.OrderRequest{
+		Action: apbft.OrderAction(strings.ToLower(f.Action)), OrderID: f.OrderID, Type: apbft.OrderType(-1),
+		Kind: apbft.OrderKind(strings.ToLower(f.OrderType)), TIF: apbft.TimeInForce(strings.ToUpper(f.TIF)), PostOnly: f.PostOnly,
+		Price: f.Price, Quantity: float64(amount), MinQuantity: f.MinAmount, ExpireRound: f.ExpireRound, ExpireAt: f.ExpireAt, User: user,
+	}
+	switch side {
+	case "buy":
+		req.Type = apbft.Buy
+	case "sell":
+		req.Type = apbft.Sell
+	}
+	return req
+}
+
+// submitOrder 经 APBFT 共识执行一笔订单操作并结算成交
+func submitOrder(c *gin.Context, db *gorm.DB, cluster *apbft.Cluster, user User, side string, amount int, f orderFields) {
+	req := f.orderRequest(user.Username, side, amount)
+	marketMu.Lock()
+	defer marketMu.Unlock()
+	book := cluster.AgreedOrderBook()
+	if need := extraReserve(book, req); need > 0 {
+		var b Balance
+		db.Where("user_id = ?", user.ID).First(&b)
+		if b.Balance-reservedBy(book, user.Username) < need {
+			c.JSON(400, gin.H{"msg": "余额不足"})
+			return
+		}
+	}
+
+	pbftResult := cluster.SubmitOrders([]apbft.OrderRequest{req})
+	if pbftResult.Status != "已确认" {
+		c.JSON(400, gin.H{"msg": pbftResult.FailedReason})
+		return
+	}
+	if pbftResult.Market == nil || len(pbftResult.Market.Results) != 1 {
+		c.JSON(500, gin.H{"msg": "副本订单簿状态未达成一致"})
+		return
+	}
+	res := pbftResult.Market.Results[0]
+	if res.Rejected() {
+		c.JSON(400, gin.H{"msg": res.Reason.Message(), "reason": res.Reason, "order": res})
+		return
+	}
+
+	blockHeight, err := settleMarket(db, pbftResult)
+	if err != nil {
+		c.JSON(500, gin.H{"msg": "成交结算失败：" + err.Error(), "order": res})
+		return
+	}
+	msg := "操作成功"
+	if res.Reason != "" {
+		msg = res.Reason.Message()
+	}
+	c.JSON(200, gin.H{"msg": msg, "order": res, "blockHeight": blockHeight})
+}
+
+// settleMarket 按一次共识执行的全部成交结算双方余额（一个数据库事务，任一笔失败时全部回滚并返回错误），
+// 写入 apbft 账本并更新系统状态，返回新区块高度（无成交时为 0）
+func settleMarket(db *gorm.DB, pbftResult apbft.PBFTResult) (int, error) {
+	blockHeight := 0
+	if fills := pbftResult.Market.Trades; len(fills) > 0 {
+		trades := make([]ledger.Trade, 0, len(fills))
+		filled := 0
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for i, t := range fills {
+				// 服务端订单数量都是整数（amount），集合竞价的边际档位也按整单位分配（apbft/auction.go prorate），成交数量都是整数
+				qty := int(math.Round(t.Quantity))
+				if err := settleTrade(tx, t.BuyUser, "buy", -qty, t.Price, pbftResult.LeaderNode); err != nil {
+					return fmt.Errorf("%s/%d buyer %s: %w", pbftResult.TxId, i, t.BuyUser, err)
+				}
+				if err := settleTrade(tx, t.SellUser, "sell", qty, t.Price, pbftResult.LeaderNode); err != nil {
+					return fmt.Errorf("%s/%d seller %s: %w", pbftResult.TxId, i, t.SellUser, err)
+				}
+				filled += qty
+				trades = append(trades, ledger.Trade{
+					TxID: fmt.Sprintf("%s/%d", pbftResult.TxId, i), Buyer: t.BuyUser, Seller: t.SellUser, Amount: qty, Price: t.Price,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		if blk, ok := appendBlock("apbft", ledger.Block{
+			Round: pbftResult.BlockHeight, Proposer: pbftResult.LeaderNode, Cert: apbftCert(pbftResult.QC), Trades: trades,
+		}); ok {
+			blockHeight = blk.Height
+		}
+		sysState.UpdatePBFTState(PBFTConsensusResult{
+			TxId:        pbftResult.TxId,
+			Status:      pbftResult.Status,
+			Consensus:   pbftResult.Consensus,
+			BlockHeight: blockHeight,
+			Timestamp:   time.Now(),
+			Validators:  convertValidators(pbftResult.Validators),
+			Price:       fills[len(fills)-1].Price,
+			LeaderNode:  pbftResult.LeaderNode,
+			Culprits:    pbftResult.Culprits,
+			Pricing:     &pbftResult.Pricing,
+			Transcript:  &pbftResult.Transcript,
+			QC:          pbftResult.QC,
+		}, filled)
+	}
+	return blockHeight, nil
+}
+
+// clearMarketLoop 集合竞价模式下每隔 interval 经共识提交一次出清请求，结束当前出清轮次并结算成交；
+// 订单批次本身只挂单（见 apbft/auction.go）。每次出清后调用 afterClear（保存集群快照）
+func clearMarketLoop(db *gorm.DB, cluster *apbft.Cluster, interval time.Duration, afterClear func()) {
+	for range time.Tick(interval) {
+		clearMarket(db, cluster)
+		afterClear()
+	}
+}
+
+// clearMarket 提交一次出清请求并结算成交（与订单提交串行）
+func clearMarket(db *gorm.DB, cluster *apbft.Cluster) {
+	marketMu.Lock()
+	defer marketMu.Unlock()
+	pbftResult := cluster.ClearMarket()
+	switch {
+	case pbftResult.Status != "已确认":
+		fmt.Println("[apbft] market clearing failed:", pbftResult.FailedReason)
+	case pbftResult.Market == nil:
+		fmt.Println("[apbft] market clearing: 副本订单簿状态未达成一致")
+	default:
+		if _, err := settleMarket(db, pbftResult); err != nil {
+			fmt.Println("[apbft] market clearing settlement failed:", err)
+		}
+	}
+}
+
+// settleTrade 在事务 tx 中按成交数量调整用户余额（扣款后不得为负）并写入交易记录（用户不存在时跳过）
+func settleTrade(tx *gorm.DB, username, side string, delta int, price float64, leader string) error {
+	var user User
+	if err := tx.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := adjustBalance(tx, user.ID, delta, 0); err != nil {
+		return err
+	}
+	amount := delta
+	if amount < 0 {
+		amount = -amount
+	}
+	return tx.Create(&TradeHistory{
+		UserID: user.ID, Type: side, Amount: amount, Time: time.Now(), Status: "成功", Price: price, Node: leader,
+	}).Error
+}
@@ -0,0 +1,123 @@
+package topology
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"PBFT1/node"
+)
+
+// Load 从文件加载拓扑：.csv 按分类行格式解析，.yaml/.yml 按 YAML，其余按 JSON（字段同 Grid）。
+//
+// CSV 每行第一列为行类型，'#' 开头为注释，第一列为 "kind" 的表头行会被跳过：
+//
+//	substation,<id>,<name>,<x>,<y>
+//	feeder,<id>,<substation>,<capacityKW>
+//	node,<id>,<x>,<y>,<feeder>
+//	line,<from>,<to>,<lengthKm>,<capacityKW>,<lossPerKm>
+//	grid,<lossPerKm>
+//
+// line 行末尾的可选列可省略或留空（长度按坐标计算、容量不限、线损取全局值）。
+func Load(path string) (*Grid, error) {
+	g := &Grid{}
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("topology: %w", err)
+		}
+		defer f.Close()
+		if g, err = ReadCSV(f); err != nil {
+			return nil, fmt.Errorf("topology: parse %s: %w", path, err)
+		}
+	} else if err := node.LoadScenarioFile(path, g); err != nil {
+		return nil, fmt.Errorf("topology: %w", err)
+	}
+	if err := g.Build(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ReadCSV 解析分类行格式的 CSV（不调用 Build）
+func ReadCSV(r io.Reader) (*Grid, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	g := &Grid{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		row := csvRow{fields: rec, line: line}
+		switch strings.ToLower(strings.TrimSpace(rec[0])) {
+		case "", "kind":
+			continue
+		case "substation":
+			g.Substations = append(g.Substations, Substation{ID: row.atoi(1), Name: row.str(2), X: row.atof(3), Y: row.atof(4)})
+		case "feeder":
+			g.Feeders = append(g.Feeders, Feeder{ID: row.str(1), Substation: row.atoi(2), CapacityKW: row.atof(3)})
+		case "node":
+			g.Nodes = append(g.Nodes, Node{ID: row.atoi(1), X: row.atof(2), Y: row.atof(3), Feeder: row.str(4)})
+		case "line":
+			g.Lines = append(g.Lines, Line{From: row.atoi(1), To: row.atoi(2), LengthKm: row.atof(3), CapacityKW: row.atof(4), LossPerKm: row.atof(5)})
+		case "grid":
+			g.LossPerKm = row.atof(1)
+		default:
+			return nil, fmt.Errorf("line %d: unknown row kind %q", line, rec[0])
+		}
+		if row.err != nil {
+			return nil, row.err
+		}
+	}
+	return g, nil
+}
+
+// csvRow 按列取值；缺失或为空的列取零值，格式错误记录第一处错误
+type csvRow struct {
+	fields []string
+	line   int
+	err    error
+}
+
+func (r *csvRow) str(i int) string {
+	if i >= len(r.fields) {
+		return ""
+	}
+	return strings.TrimSpace(r.fields[i])
+}
+
+func (r *csvRow) atoi(i int) int {
+	s := r.str(i)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("line %d column %d: %w", r.line, i+1, err)
+	}
+	return v
+}
+
+func (r *csvRow) atof(i int) float64 {
+	s := r.str(i)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("line %d column %d: %w", r.line, i+1, err)
+	}
+	return v
+}
@@ -0,0 +1,201 @@
+package topology
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"PBFT1/node"
+)
+
+// SubstationIDBase 合成拓扑中变电站母线编号的起点（与节点 ID 0..N-1 不冲突，新加入的节点也不会撞号）
+const SubstationIDBase = 100000
+
+// DefaultSeed 默认合成拓扑的随机种子
+const DefaultSeed = 20260322
+
+// SyntheticConfig 合成配电网参数：变电站均匀分布在 AreaKm x AreaKm 区域内，
+// 节点随机撒点后挂到最近的变电站、按方位划入该站的某条馈线，馈线内按"就近接入"连成辐射状树，
+// 变电站之间由联络线连通。
+type SyntheticConfig struct {
+	NumNodes             int     `json:"numNodes" yaml:"numNodes"`
+	Substations          int     `json:"substations,omitempty" yaml:"substations,omitempty"`                   // 默认每 25 个节点一座
+	FeedersPerSubstation int     `json:"feedersPerSubstation,omitempty" yaml:"feedersPerSubstation,omitempty"` // 默认 3
+	AreaKm               float64 `json:"areaKm,omitempty" yaml:"areaKm,omitempty"`                             // 默认 40
+	FeederCapacityKW     float64 `json:"feederCapacityKW,omitempty" yaml:"feederCapacityKW,omitempty"`         // 默认 5000
+	LineCapacityKW       float64 `json:"lineCapacityKW,omitempty" yaml:"lineCapacityKW,omitempty"`             // 馈线内线路，默认 2000
+	TieCapacityKW        float64 `json:"tieCapacityKW,omitempty" yaml:"tieCapacityKW,omitempty"`               // 变电站联络线，默认 20000
+	Seed                 int64   `json:"seed,omitempty" yaml:"seed,omitempty"`
+}
+
+func (c SyntheticConfig) withDefaults() SyntheticConfig {
+	if c.Substations <= 0 {
+		c.Substations = (c.NumNodes + 24) / 25
+		if c.Substations < 1 {
+			c.Substations = 1
+		}
+	}
+	if c.FeedersPerSubstation <= 0 {
+		c.FeedersPerSubstation = 3
+	}
+	if c.AreaKm <= 0 {
+		c.AreaKm = 40
+	}
+	if c.FeederCapacityKW <= 0 {
+		c.FeederCapacityKW = 5000
+	}
+	if c.LineCapacityKW <= 0 {
+		c.LineCapacityKW = 2000
+	}
+	if c.TieCapacityKW <= 0 {
+		c.TieCapacityKW = 20000
+	}
+	if c.Seed == 0 {
+		c.Seed = DefaultSeed
+	}
+	return c
+}
+
+// Synthetic 按配置生成节点 0..NumNodes-1 的合成拓扑（同一配置结果确定）
+func Synthetic(cfg SyntheticConfig) (*Grid, error) {
+	if cfg.NumNodes <= 0 {
+		return nil, fmt.Errorf("topology: synthetic grid needs numNodes > 0, got %d", cfg.NumNodes)
+	}
+	if cfg.NumNodes > SubstationIDBase {
+		return nil, fmt.Errorf("topology: synthetic grid supports at most %d nodes", SubstationIDBase)
+	}
+	cfg = cfg.withDefaults()
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	g := &Grid{}
+
+	// 1. 变电站：放在 k x k 网格的格心附近
+	k := int(math.Ceil(math.Sqrt(float64(cfg.Substations))))
+	cell := cfg.AreaKm / float64(k)
+	for i := 0; i < cfg.Substations; i++ {
+		cx := (float64(i%k) + 0.5 + (rng.Float64()-0.5)*0.3) * cell
+		cy := (float64(i/k) + 0.5 + (rng.Float64()-0.5)*0.3) * cell
+		g.Substations = append(g.Substations, Substation{ID: SubstationIDBase + i, Name: fmt.Sprintf("S%d", i), X: cx, Y: cy})
+		for j := 0; j < cfg.FeedersPerSubstation; j++ {
+			g.Feeders = append(g.Feeders, Feeder{ID: feederID(i, j), Substation: SubstationIDBase + i, CapacityKW: cfg.FeederCapacityKW})
+		}
+	}
+
+	// 2. 节点：随机撒点，挂到最近的变电站，按相对方位划分馈线
+	members := make(map[string][]int)
+	for id := 0; id < cfg.NumNodes; id++ {
+		x, y := rng.Float64()*cfg.AreaKm, rng.Float64()*cfg.AreaKm
+		si := 0
+		best := math.Inf(1)
+		for i, s := range g.Substations {
+			if d := math.Hypot(x-s.X, y-s.Y); d < best {
+				si, best = i, d
+			}
+		}
+		s := g.Substations[si]
+		angle := math.Atan2(y-s.Y, x-s.X) + math.Pi // [0, 2π]
+		fj := int(angle / (2 * math.Pi) * float64(cfg.FeedersPerSubstation))
+		if fj >= cfg.FeedersPerSubstation {
+			fj = cfg.FeedersPerSubstation - 1
+		}
+		fid := feederID(si, fj)
+		g.Nodes = append(g.Nodes, Node{ID: id, X: x, Y: y, Feeder: fid})
+		members[fid] = append(members[fid], id)
+	}
+	g.coords = make(map[int][2]float64, len(g.Nodes)+len(g.Substations))
+	for _, s := range g.Substations {
+		g.coords[s.ID] = [2]float64{s.X, s.Y}
+	}
+	for _, n := range g.Nodes {
+		g.coords[n.ID] = [2]float64{n.X, n.Y}
+	}
+
+	// 3. 馈线内：按离变电站由近到远，每个节点接到已接入母线中最近的一条（辐射状）
+	for _, f := range g.Feeders {
+		ids := members[f.ID]
+		sort.SliceStable(ids, func(a, b int) bool {
+			return g.Euclidean(ids[a], f.Substation) < g.Euclidean(ids[b], f.Substation)
+		})
+		connected := []int{f.Substation}
+		for _, id := range ids {
+			to := connected[0]
+			for _, c := range connected[1:] {
+				if g.Euclidean(id, c) < g.Euclidean(id, to) {
+					to = c
+				}
+			}
+			g.Lines = append(g.Lines, Line{From: to, To: id, CapacityKW: cfg.LineCapacityKW})
+			connected = append(connected, id)
+		}
+	}
+
+	// 4. 联络线：每座变电站接到编号更小的变电站中最近的一座
+	for i := 1; i < len(g.Substations); i++ {
+		to := 0
+		for j := 1; j < i; j++ {
+			if g.Euclidean(g.Substations[i].ID, g.Substations[j].ID) < g.Euclidean(g.Substations[i].ID, g.Substations[to].ID) {
+				to = j
+			}
+		}
+		g.Lines = append(g.Lines, Line{From: g.Substations[to].ID, To: g.Substations[i].ID, CapacityKW: cfg.TieCapacityKW})
+	}
+
+	if err := g.Build(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func feederID(substation, feeder int) string {
+	return fmt.Sprintf("S%d-F%d", substation, feeder)
+}
+
+// ======================= 进程级共享拓扑 =======================
+// 各共识引擎与工具通过 Default(numNodes) 取同一张电网；服务端 / 工具加载拓扑文件后调用 Use 安装。
+
+var (
+	sharedMu  sync.Mutex
+	shared    *Grid
+	synthetic = make(map[int]*Grid)
+)
+
+// Use 安装进程级共享拓扑（nil 恢复为默认合成拓扑）
+func Use(g *Grid) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	shared = g
+}
+
+// Default 返回覆盖节点 0..numNodes-1 的共享拓扑：已安装且覆盖这些节点时返回安装的拓扑，
+// 否则返回按 numNodes 生成（并缓存）的默认合成拓扑
+func Default(numNodes int) *Grid {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if shared != nil && shared.Covers(numNodes) {
+		return shared
+	}
+	if numNodes <= 0 {
+		numNodes = 1
+	}
+	if g, ok := synthetic[numNodes]; ok {
+		return g
+	}
+	g, err := Synthetic(SyntheticConfig{NumNodes: numNodes})
+	if err != nil {
+		panic(err) // numNodes 已保证在合法范围内，合成拓扑不会失败
+	}
+	synthetic[numNodes] = g
+	return g
+}
+
+// ForPool 返回覆盖节点池全部节点 ID 的共享拓扑
+func ForPool(specs []node.NodeSpec) *Grid {
+	n := 0
+	for _, sp := range specs {
+		if sp.ID+1 > n {
+			n = sp.ID + 1
+		}
+	}
+	return Default(n)
+}
@@ -0,0 +1,354 @@
+package topology
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// ======================= 【高亮-2026-10-16】新增：共享电网拓扑模型 =======================
+// 目的：原 apbft.calculateNodeDistance 用节点 ID 哈希出的随机数当距离，find_k.go 又独立抽取距离，
+// 两者描述的并不是同一张电网。Grid 统一描述节点坐标、馈线、变电站与线路容量，
+// KNN 定价、距离拒绝概率、网络时延与 K 值寻优工具都从同一个 Grid 查询距离 / 路径 / 线损。
+//
+// 母线编号：参与交易的节点与变电站共用一个整数编号空间（节点 ID 与 node.NodeSpec.ID 一致），
+// 线路连接任意两条母线。
+
+// Node 参与交易的节点（产消者）
+type Node struct {
+	ID     int     `json:"id" yaml:"id"`
+	X      float64 `json:"x" yaml:"x"` // 坐标（公里）
+	Y      float64 `json:"y" yaml:"y"`
+	Feeder string  `json:"feeder" yaml:"feeder"` // 所属馈线
+}
+
+// Substation 变电站
+type Substation struct {
+	ID   int     `json:"id" yaml:"id"`
+	Name string  `json:"name,omitempty" yaml:"name,omitempty"`
+	X    float64 `json:"x" yaml:"x"`
+	Y    float64 `json:"y" yaml:"y"`
+}
+
+// Feeder 馈线：由一座变电站供电
+type Feeder struct {
+	ID         string  `json:"id" yaml:"id"`
+	Substation int     `json:"substation" yaml:"substation"`
+	CapacityKW float64 `json:"capacityKW,omitempty" yaml:"capacityKW,omitempty"` // 馈线总容量，<=0 表示不限
+}
+
+// Line 一条线路（无向）
+type Line struct {
+	From       int     `json:"from" yaml:"from"`
+	To         int     `json:"to" yaml:"to"`
+	LengthKm   float64 `json:"lengthKm,omitempty" yaml:"lengthKm,omitempty"`     // <=0 时按两端坐标的直线距离
+	CapacityKW float64 `json:"capacityKW,omitempty" yaml:"capacityKW,omitempty"` // 线路容量，<=0 表示不限
+	LossPerKm  float64 `json:"lossPerKm,omitempty" yaml:"lossPerKm,omitempty"`   // 每公里损耗比例，<=0 时取 Grid.LossPerKm
+}
+
+// DefaultLossPerKm 默认每公里线损比例（100 公里约损耗 10%）
+const DefaultLossPerKm = 0.001
+
+// Grid 电网拓扑（构建后只读，查询并发安全）
+type Grid struct {
+	Nodes       []Node       `json:"nodes" yaml:"nodes"`
+	Substations []Substation `json:"substations" yaml:"substations"`
+	Feeders     []Feeder     `json:"feeders" yaml:"feeders"`
+	Lines       []Line       `json:"lines" yaml:"lines"`
+	LossPerKm   float64      `json:"lossPerKm,omitempty" yaml:"lossPerKm,omitempty"`
+
+	adj    map[int][]edge // 母线 -> 相邻线路
+	coords map[int][2]float64
+
+	mu    sync.Mutex
+	trees map[int]*spTree // 按源点缓存的最短路树
+}
+
+type edge struct {
+	to   int
+	line int // Lines 下标
+}
+
+// spTree 单源最短路树
+type spTree struct {
+	dist map[int]float64
+	prev map[int]edge // 到达该母线所经过的线路（prev[v].to 为上一跳母线）
+}
+
+// Build 校验拓扑并建立邻接表；加载或生成拓扑后必须调用（Load / Synthetic 已自动调用）
+func (g *Grid) Build() error {
+	g.coords = make(map[int][2]float64, len(g.Nodes)+len(g.Substations))
+	for _, s := range g.Substations {
+		if _, dup := g.coords[s.ID]; dup {
+			return fmt.Errorf("topology: duplicate bus id %d", s.ID)
+		}
+		g.coords[s.ID] = [2]float64{s.X, s.Y}
+	}
+	feeders := make(map[string]bool, len(g.Feeders))
+	for _, f := range g.Feeders {
+		if feeders[f.ID] {
+			return fmt.Errorf("topology: duplicate feeder %q", f.ID)
+		}
+		if !g.isSubstation(f.Substation) {
+			return fmt.Errorf("topology: feeder %q references unknown substation %d", f.ID, f.Substation)
+		}
+		feeders[f.ID] = true
+	}
+	for _, n := range g.Nodes {
+		if _, dup := g.coords[n.ID]; dup {
+			return fmt.Errorf("topology: duplicate bus id %d", n.ID)
+		}
+		if n.Feeder != "" && !feeders[n.Feeder] {
+			return fmt.Errorf("topology: node %d references unknown feeder %q", n.ID, n.Feeder)
+		}
+		g.coords[n.ID] = [2]float64{n.X, n.Y}
+	}
+
+	g.adj = make(map[int][]edge, len(g.coords))
+	for i, l := range g.Lines {
+		if _, ok := g.coords[l.From]; !ok {
+			return fmt.Errorf("topology: line %d-%d references unknown bus %d", l.From, l.To, l.From)
+		}
+		if _, ok := g.coords[l.To]; !ok {
+			return fmt.Errorf("topology: line %d-%d references unknown bus %d", l.From, l.To, l.To)
+		}
+		if l.From == l.To {
+			return fmt.Errorf("topology: line %d-%d is a self loop", l.From, l.To)
+		}
+		if l.LengthKm <= 0 {
+			g.Lines[i].LengthKm = g.Euclidean(l.From, l.To)
+		}
+		g.adj[l.From] = append(g.adj[l.From], edge{to: l.To, line: i})
+		g.adj[l.To] = append(g.adj[l.To], edge{to: l.From, line: i})
+	}
+	if g.LossPerKm <= 0 {
+		g.LossPerKm = DefaultLossPerKm
+	}
+
+	g.mu.Lock()
+	g.trees = make(map[int]*spTree)
+	g.mu.Unlock()
+
+	// 所有节点必须连通：否则距离/路径没有意义
+	if len(g.Nodes) > 0 {
+		t := g.tree(g.Nodes[0].ID)
+		for _, n := range g.Nodes {
+			if _, ok := t.dist[n.ID]; !ok {
+				return fmt.Errorf("topology: node %d is not connected to node %d", n.ID, g.Nodes[0].ID)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Grid) isSubstation(id int) bool {
+	for _, s := range g.Substations {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// HasNode 拓扑中是否有该母线（节点或变电站）
+func (g *Grid) HasNode(id int) bool {
+	_, ok := g.coords[id]
+	return ok
+}
+
+// Covers 拓扑是否包含 0..numNodes-1 全部节点
+func (g *Grid) Covers(numNodes int) bool {
+	for id := 0; id < numNodes; id++ {
+		if !g.HasNode(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// Euclidean 两条母线的直线距离（公里）；未知母线返回 0
+func (g *Grid) Euclidean(a, b int) float64 {
+	pa, okA := g.coords[a]
+	pb, okB := g.coords[b]
+	if !okA || !okB {
+		return 0
+	}
+	return math.Hypot(pa[0]-pb[0], pa[1]-pb[1])
+}
+
+// Distance 两条母线沿线路的最短电气距离（公里）；a==b 为 0，不连通或未知母线返回 +Inf。
+// 实现 node.DistanceModel，可直接交给 Network.SetDistanceModel。
+func (g *Grid) Distance(a, b int) float64 {
+	if a == b {
+		return 0
+	}
+	if !g.HasNode(a) || !g.HasNode(b) {
+		return math.Inf(1)
+	}
+	d, ok := g.tree(a).dist[b]
+	if !ok {
+		return math.Inf(1)
+	}
+	return d
+}
+
+// Path 两条母线之间的最短路径（含两端）及其长度；不连通时返回 nil, +Inf
+func (g *Grid) Path(a, b int) ([]int, float64) {
+	if !g.HasNode(a) || !g.HasNode(b) {
+		return nil, math.Inf(1)
+	}
+	if a == b {
+		return []int{a}, 0
+	}
+	t := g.tree(a)
+	d, ok := t.dist[b]
+	if !ok {
+		return nil, math.Inf(1)
+	}
+	path := []int{b}
+	for v := b; v != a; {
+		v = t.prev[v].to
+		path = append(path, v)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, d
+}
+
+// Transfer 沿最短路径从 a 向 b 输送 powerKW 的结果
+type Transfer struct {
+	Path         []int
+	LengthKm     float64
+	LossKW       float64 // 线路损耗（逐段按剩余功率计算）
+	LossRatio    float64 // LossKW / powerKW
+	BottleneckKW float64 // 路径上最小的线路容量；+Inf 表示不限
+	Feasible     bool    // powerKW 不超过 BottleneckKW
+}
+
+// Transfer 计算沿最短路径输送 powerKW 的线损与容量约束
+func (g *Grid) Transfer(a, b int, powerKW float64) (Transfer, error) {
+	path, length := g.Path(a, b)
+	if path == nil {
+		return Transfer{}, fmt.Errorf("topology: no path between %d and %d", a, b)
+	}
+	tr := Transfer{Path: path, LengthKm: length, BottleneckKW: math.Inf(1)}
+	remaining := powerKW
+	for i := 1; i < len(path); i++ {
+		l := g.Lines[g.lineBetween(path[i-1], path[i])]
+		loss := l.LossPerKm
+		if loss <= 0 {
+			loss = g.LossPerKm
+		}
+		ratio := math.Min(loss*l.LengthKm, 1)
+		tr.LossKW += remaining * ratio
+		remaining -= remaining * ratio
+		if l.CapacityKW > 0 && l.CapacityKW < tr.BottleneckKW {
+			tr.BottleneckKW = l.CapacityKW
+		}
+	}
+	if powerKW > 0 {
+		tr.LossRatio = tr.LossKW / powerKW
+	}
+	tr.Feasible = powerKW <= tr.BottleneckKW
+	return tr, nil
+}
+
+// LineLoss 沿最短路径输送 powerKW 的线路损耗（kW）；不连通时返回 +Inf
+func (g *Grid) LineLoss(a, b int, powerKW float64) float64 {
+	tr, err := g.Transfer(a, b, powerKW)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return tr.LossKW
+}
+
+// lineBetween 路径上相邻两条母线之间最短的一条线路
+func (g *Grid) lineBetween(a, b int) int {
+	best := -1
+	for _, e := range g.adj[a] {
+		if e.to == b && (best < 0 || g.Lines[e.line].LengthKm < g.Lines[best].LengthKm) {
+			best = e.line
+		}
+	}
+	return best
+}
+
+// FeederOf 节点所属馈线（未知节点返回 ""）
+func (g *Grid) FeederOf(id int) string {
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			return n.Feeder
+		}
+	}
+	return ""
+}
+
+// NodeIDs 全部交易节点 ID（升序）
+func (g *Grid) NodeIDs() []int {
+	ids := make([]int, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// tree 取（或计算并缓存）以 src 为源点的最短路树
+func (g *Grid) tree(src int) *spTree {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if t, ok := g.trees[src]; ok {
+		return t
+	}
+	t := g.dijkstra(src)
+	g.trees[src] = t
+	return t
+}
+
+func (g *Grid) dijkstra(src int) *spTree {
+	t := &spTree{dist: map[int]float64{src: 0}, prev: map[int]edge{}}
+	pq := &distHeap{{bus: src}}
+	done := make(map[int]bool, len(g.coords))
+	for pq.Len() > 0 {
+		cur := heap.Pop(pq).(distItem)
+		if done[cur.bus] {
+			continue
+		}
+		done[cur.bus] = true
+		for _, e := range g.adj[cur.bus] {
+			nd := cur.dist + g.Lines[e.line].LengthKm
+			if old, ok := t.dist[e.to]; !ok || nd < old {
+				t.dist[e.to] = nd
+				t.prev[e.to] = edge{to: cur.bus, line: e.line}
+				heap.Push(pq, distItem{bus: e.to, dist: nd})
+			}
+		}
+	}
+	return t
+}
+
+type distItem struct {
+	bus  int
+	dist float64
+}
+
+type distHeap []distItem
+
+func (h distHeap) Len() int { return len(h) }
+func (h distHeap) Less(i, j int) bool {
+	if h[i].dist == h[j].dist {
+		return h[i].bus < h[j].bus
+	}
+	return h[i].dist < h[j].dist
+}
+func (h distHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *distHeap) Push(x interface{}) { *h = append(*h, x.(distItem)) }
+func (h *distHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}